@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"unaware/pkg"
+)
+
+// subcommands are the commands completed as the first argument.
+var subcommands = []string{"mask", "detokenize", "verify", "init", "scan", "diff", "detectors", "bench", "db", "pipe", "daemon", "completion", "help"}
+
+// flagValues returns the values completed for flags that take one of a fixed
+// set, by flag name. Other flags that take a value complete file names.
+func flagValues() map[string][]string {
+	valueTypes := []string{"string", "number", "bool", "null"}
+	return map[string][]string{
+		"format":       {"json", "ndjson", "xml", "csv", "text", "mysqldump"},
+		"output-style": {pkg.StylePretty, pkg.StyleCompact, pkg.StylePreserve},
+		"method":       {"random", "deterministic", "fpe", "null", "partial:", "dictionary:", "hash:", "wasm:"},
+		"preset":       pkg.Presets(),
+		"locale":       append([]string{"en"}, pkg.Locales()...),
+		"only-type":    valueTypes,
+		"skip-type":    valueTypes,
+	}
+}
+
+// runCompletion writes a completion script for shell, covering the flags of
+// flags, the values of flagValues and the subcommands.
+func runCompletion(w io.Writer, shell string, flags *flag.FlagSet) error {
+	var all []*flag.Flag
+	flags.VisitAll(func(f *flag.Flag) { all = append(all, f) })
+	values := flagValues()
+
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, all, values)
+	case "zsh":
+		writeZshCompletion(w, all, values)
+	case "fish":
+		writeFishCompletion(w, all, values)
+	default:
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", shell)
+	}
+	return nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func isRepeatableFlag(f *flag.Flag) bool {
+	_, ok := f.Value.(*stringSlice)
+	return ok
+}
+
+func writeBashCompletion(w io.Writer, flags []*flag.Flag, values map[string][]string) {
+	var names []string
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+	}
+	fmt.Fprintln(w, "# bash completion for unaware, load with: source <(unaware completion bash)")
+	fmt.Fprintln(w, "_unaware() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `	case "$prev" in`)
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(w, "	-%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", name, strings.Join(values[name], " "))
+	}
+	fmt.Fprintln(w, "	esac")
+	fmt.Fprintf(w, "	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then COMPREPLY=($(compgen -W %q -- \"$cur\")); return; fi\n", strings.Join(subcommands, " "))
+	fmt.Fprintf(w, "	if [[ $cur == -* ]]; then COMPREPLY=($(compgen -W %q -- \"$cur\")); fi\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _unaware unaware")
+}
+
+func writeZshCompletion(w io.Writer, flags []*flag.Flag, values map[string][]string) {
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	fmt.Fprintln(w, "#compdef unaware")
+	fmt.Fprintln(w, "# zsh completion for unaware, load with: source <(unaware completion zsh)")
+	fmt.Fprintln(w, "_unaware() {")
+	fmt.Fprintln(w, "	_arguments \\")
+	fmt.Fprintf(w, "		'1::command:(%s)' \\\n", strings.Join(subcommands, " "))
+	for _, f := range flags {
+		spec := "-" + f.Name + "[" + escape.Replace(f.Usage) + "]"
+		if isRepeatableFlag(f) {
+			spec = "*" + spec
+		}
+		switch {
+		case isBoolFlag(f):
+		case values[f.Name] != nil:
+			spec += ":" + f.Name + ":(" + strings.Join(values[f.Name], " ") + ")"
+		default:
+			spec += ":" + f.Name + ":_files"
+		}
+		fmt.Fprintf(w, "		'%s' \\\n", spec)
+	}
+	fmt.Fprintln(w, "		'*:file:_files'")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "compdef _unaware unaware")
+}
+
+func writeFishCompletion(w io.Writer, flags []*flag.Flag, values map[string][]string) {
+	escape := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	fmt.Fprintln(w, "# fish completion for unaware, load with: unaware completion fish | source")
+	fmt.Fprintf(w, "complete -c unaware -n __fish_use_subcommand -xa '%s'\n", strings.Join(subcommands, " "))
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c unaware -o %s -d '%s'", f.Name, escape.Replace(f.Usage))
+		switch {
+		case isBoolFlag(f):
+		case values[f.Name] != nil:
+			line += fmt.Sprintf(" -xa '%s'", strings.Join(values[f.Name], " "))
+		default:
+			line += " -rF"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
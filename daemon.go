@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+
+	"unaware/pkg"
+)
+
+// runDaemon masks the framed requests of clients of a Unix socket until it is
+// interrupted, keeping the engine and its secrets loaded between requests.
+func runDaemon(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	p := addPolicyFlags(flags)
+	socket := flags.String("socket", "", "Path of the Unix socket to listen on, created readable and writable by the owner only")
+	maxFrame := flags.Int("max-frame", pkg.DefaultMaxFrame, "Largest input of a request, in bytes")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintln(out, "Usage: unaware daemon -socket <path> [flags]")
+		fmt.Fprintln(out, "\nEvery request is a header line of the format of the input and its length in")
+		fmt.Fprintln(out, "bytes, followed by the input; \"-\" masks as -format. It is answered with a")
+		fmt.Fprintln(out, "header line of ok or error and the length of what follows, then the masked")
+		fmt.Fprintln(out, "output or the error. A connection can send any number of requests.")
+		fmt.Fprintln(out, "\nEXAMPLES:")
+		fmt.Fprintln(out, "  # Serve masking to the web app of the same host")
+		fmt.Fprintln(out, "  unaware daemon -socket /run/unaware.sock -config policy.yaml")
+		fmt.Fprintln(out, "\n  # Mask a record through it")
+		fmt.Fprintln(out, "  printf 'json 28\\n{\"email\":\"jane@example.com\"}' | nc -U /run/unaware.sock")
+		fmt.Fprintln(out, "\nFLAGS:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	switch {
+	case *socket == "":
+		fmt.Fprintln(os.Stderr, "Error: daemon requires -socket.")
+		os.Exit(exitConfig)
+	case *maxFrame < 1:
+		fmt.Fprintln(os.Stderr, "Error: -max-frame must be at least 1.")
+		os.Exit(exitConfig)
+	}
+	engine, err := pkg.New(pkg.WithConfig(p.appConfig(flags, false)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitConfig)
+	}
+	server, err := pkg.NewServer(engine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitConfig)
+	}
+	server.MaxFrame = *maxFrame
+
+	// A socket left by a daemon that was killed is replaced, but not one of
+	// a daemon still listening, nor another kind of file.
+	if info, err := os.Lstat(*socket); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			fmt.Fprintf(os.Stderr, "Error: %s exists and is not a socket.\n", *socket)
+			os.Exit(exitConfig)
+		}
+		if conn, err := net.Dial("unix", *socket); err == nil {
+			conn.Close()
+			fmt.Fprintf(os.Stderr, "Error: another daemon is listening on %s.\n", *socket)
+			os.Exit(exitConfig)
+		}
+		os.Remove(*socket)
+	}
+	listener, err := listenPrivate(*socket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailure)
+	}
+	// Closing the listener removes the socket.
+	defer listener.Close()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", *socket)
+	if err := server.Serve(interruptible(), listener); err != nil && !errors.Is(err, net.ErrClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
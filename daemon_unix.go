@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenPrivate listens on a Unix socket at path that only the owner can
+// connect to. It is created so, under a umask leaving out the group and
+// others, rather than narrowed once others could have connected.
+func listenPrivate(path string) (net.Listener, error) {
+	umask := syscall.Umask(0o077)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenPrivate(t *testing.T) {
+	umask := syscall.Umask(0o022)
+	t.Cleanup(func() { syscall.Umask(umask) })
+	socket := filepath.Join(t.TempDir(), "unaware.sock")
+	listener, err := listenPrivate(socket)
+	require.NoError(t, err)
+	defer listener.Close()
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0o077, "Only the owner can connect")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "after"))
+	require.NoError(t, err)
+	f.Close()
+	info, err = os.Stat(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm(), "The umask is restored")
+}
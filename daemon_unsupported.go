@@ -0,0 +1,22 @@
+//go:build !unix
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// listenPrivate listens on a Unix socket at path, narrowed to the owner once
+// created, as there is no umask to create it so.
+func listenPrivate(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the pgx driver
+	"unaware/pkg"
+)
+
+// runDB masks the rows of a Postgres table into another table, or into a
+// script of COPY statements, without a CSV export in between.
+func runDB(args []string) {
+	flags := flag.NewFlagSet("db", flag.ExitOnError)
+	p := addPolicyFlags(flags)
+	dsn := flags.String("dsn", "", "Postgres connection URL such as postgres://user@host/db (default: from PGHOST, PGUSER and the other libpq variables)")
+	table := flags.String("table", "", "Table to mask, optionally with its schema, e.g. public.customers")
+	target := flags.String("target", "", "Table the masked rows are written to, created like -table if missing")
+	targetSchema := flags.String("target-schema", "", "Schema the masked rows are written to, in a table named like -table")
+	emitCopy := flags.Bool("copy", false, "Write a script creating the target table and COPYing the masked rows into it, instead of writing them")
+	outputFile := flags.String("out", "", "File the -copy script is written to (default: stdout)")
+	truncate := flags.Bool("truncate", false, "Empty an existing target table before writing to it")
+	batch := flags.Int("batch", 1000, "Rows fetched from the cursor, and inserted, at a time")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintln(out, "Usage: unaware db -table <table> (-target <table> | -target-schema <schema> | -copy) [flags]")
+		fmt.Fprintln(out, "\nColumns are keyed by name, as the columns of CSV are.")
+		fmt.Fprintln(out, "\nEXAMPLES:")
+		fmt.Fprintln(out, "  # Mask customers into the anonymized schema of the same database")
+		fmt.Fprintln(out, "  unaware db -dsn postgres://localhost/shop -table customers -target-schema anonymized -include email -include name")
+		fmt.Fprintln(out, "\n  # Load masked customers into another database")
+		fmt.Fprintln(out, "  unaware db -dsn postgres://replica/shop -table customers -copy -include email | psql postgres://staging/shop")
+		fmt.Fprintln(out, "\nFLAGS:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	switch {
+	case *table == "":
+		fmt.Fprintln(os.Stderr, "Error: db requires -table.")
+		os.Exit(exitConfig)
+	case *target != "" && *targetSchema != "" && strings.Contains(*target, "."):
+		fmt.Fprintln(os.Stderr, "Error: -target cannot name a schema when -target-schema is set.")
+		os.Exit(exitConfig)
+	case *target == "" && *targetSchema == "" && !*emitCopy:
+		fmt.Fprintln(os.Stderr, "Error: db requires -target, -target-schema or -copy to know where the masked rows go.")
+		os.Exit(exitConfig)
+	case *outputFile != "" && !*emitCopy:
+		fmt.Fprintln(os.Stderr, "Error: -out requires -copy.")
+		os.Exit(exitConfig)
+	case *truncate && *emitCopy:
+		fmt.Fprintln(os.Stderr, "Error: -truncate cannot be used with -copy.")
+		os.Exit(exitConfig)
+	case *batch < 1:
+		fmt.Fprintln(os.Stderr, "Error: -batch must be at least 1.")
+		os.Exit(exitConfig)
+	}
+	appConfig := p.appConfig(flags, false)
+
+	source := strings.Split(*table, ".")
+	dest := source
+	if *target != "" {
+		dest = strings.Split(*target, ".")
+	}
+	if *targetSchema != "" {
+		dest = []string{*targetSchema, dest[len(dest)-1]}
+	}
+	db, err := sql.Open("pgx", *dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitConfig)
+	}
+	defer db.Close()
+	job := tableJob{db: db, source: pgx.Identifier(source), target: pgx.Identifier(dest), batch: *batch, truncate: *truncate}
+	ctx := interruptible()
+	if *emitCopy {
+		var w io.Writer = os.Stdout
+		if *outputFile != "" {
+			f, err := os.Create(*outputFile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: cannot create output file:", err)
+				os.Exit(exitFailure)
+			}
+			defer f.Close()
+			w = f
+		}
+		err = job.copyTo(ctx, appConfig, w)
+	} else {
+		err = job.insert(ctx, appConfig)
+	}
+	if errors.Is(err, context.Canceled) && !*emitCopy {
+		err = errors.New("interrupted, the target table was left as it was")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+	if *emitCopy {
+		fmt.Fprintf(os.Stderr, "Masked %d rows of %s\n", job.rows, *table)
+	} else {
+		fmt.Printf("Successfully masked %d rows of %s into %s\n", job.rows, *table, strings.Join(dest, "."))
+	}
+}
+
+// tableJob masks the rows of a source table into a target table.
+type tableJob struct {
+	db             *sql.DB
+	source, target pgx.Identifier
+	batch          int
+	truncate       bool
+	rows           int // Rows masked so far
+}
+
+// column is a column of the source table, with its type as Postgres names
+// it, so the target gets the same.
+type column struct {
+	name, dataType string
+	notNull        bool
+}
+
+// columns returns the columns of the source table in their order.
+func (j *tableJob) columns(ctx context.Context, tx *sql.Tx) ([]column, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT attname, format_type(atttypid, atttypmod), attnotnull
+		FROM pg_attribute WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped ORDER BY attnum`, j.source.Sanitize())
+	if err != nil {
+		return nil, &pkg.InputError{Err: fmt.Errorf("cannot read the columns of %s: %w", j.source.Sanitize(), err)}
+	}
+	defer rows.Close()
+	var columns []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.name, &c.dataType, &c.notNull); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// createTable returns the statement creating the target table, with the
+// columns of the source, unless it exists.
+func (j *tableJob) createTable(columns []column) string {
+	var definitions []string
+	for _, c := range columns {
+		definition := pgx.Identifier{c.name}.Sanitize() + " " + c.dataType
+		if c.notNull {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", j.target.Sanitize(), strings.Join(definitions, ", "))
+}
+
+// read calls fn with the masked rows of the source table, read through a
+// cursor in a read-only transaction, so tables of any size are masked in
+// batches and see a single snapshot.
+func (j *tableJob) read(ctx context.Context, appConfig pkg.AppConfig, fn func(columns []column, rows *pkg.MaskedRows) error) error {
+	tx, err := j.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fmt.Errorf("cannot connect: %w", err)
+	}
+	defer tx.Rollback()
+	columns, err := j.columns(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DECLARE unaware_rows NO SCROLL CURSOR FOR SELECT * FROM "+j.source.Sanitize()); err != nil {
+		return &pkg.InputError{Err: fmt.Errorf("cannot read %s: %w", j.source.Sanitize(), err)}
+	}
+	cursor := &cursorRows{ctx: ctx, tx: tx, fetch: fmt.Sprintf("FETCH %d FROM unaware_rows", j.batch), batch: j.batch}
+	if err := cursor.next(); err != nil {
+		return &pkg.InputError{Err: fmt.Errorf("cannot read %s: %w", j.source.Sanitize(), err)}
+	}
+	defer cursor.Close()
+	rows, err := pkg.NewMaskedRows(cursor, appConfig)
+	if err != nil {
+		return err
+	}
+	if err := fn(columns, rows); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return &pkg.InputError{Err: fmt.Errorf("cannot read %s: %w", j.source.Sanitize(), err)}
+	}
+	return nil
+}
+
+// insert writes the masked rows into the target table in one transaction,
+// so a failed run leaves the target as it was.
+func (j *tableJob) insert(ctx context.Context, appConfig pkg.AppConfig) error {
+	tx, err := j.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot connect: %w", err)
+	}
+	defer tx.Rollback()
+	err = j.read(ctx, appConfig, func(columns []column, rows *pkg.MaskedRows) error {
+		// Names are compared as Postgres resolves them, so public.customers
+		// or a search path leading to the source is caught too.
+		var inPlace sql.NullBool
+		if err := tx.QueryRowContext(ctx, "SELECT $1::regclass = to_regclass($2)", j.source.Sanitize(), j.target.Sanitize()).Scan(&inPlace); err != nil {
+			return &pkg.InputError{Err: fmt.Errorf("cannot read %s: %w", j.source.Sanitize(), err)}
+		}
+		if inPlace.Bool {
+			return &pkg.ConfigError{Err: errors.New("the target table is -table itself; masking a table in place is not supported")}
+		}
+		if len(j.target) == 2 {
+			if _, err := tx.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{j.target[0]}.Sanitize()); err != nil {
+				return fmt.Errorf("cannot create schema %s: %w", j.target[0], err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, j.createTable(columns)); err != nil {
+			return fmt.Errorf("cannot create %s: %w", j.target.Sanitize(), err)
+		}
+		if j.truncate {
+			if _, err := tx.ExecContext(ctx, "TRUNCATE "+j.target.Sanitize()); err != nil {
+				return fmt.Errorf("cannot truncate %s: %w", j.target.Sanitize(), err)
+			}
+		}
+		// Postgres takes at most 65535 parameters a statement.
+		batch := max(1, min(j.batch, 65535/max(1, len(columns))))
+		var args []any
+		flush := func() error {
+			if len(args) == 0 {
+				return nil
+			}
+			if _, err := tx.ExecContext(ctx, j.insertStatement(columns, len(args)/len(columns)), args...); err != nil {
+				return fmt.Errorf("cannot write %s: %w", j.target.Sanitize(), err)
+			}
+			args = args[:0]
+			return nil
+		}
+		for rows.Next() {
+			values, err := scanRow(rows, len(columns))
+			if err != nil {
+				return err
+			}
+			args = append(args, values...)
+			j.rows++
+			if len(args) == batch*len(columns) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot write %s: %w", j.target.Sanitize(), err)
+	}
+	return nil
+}
+
+// insertStatement returns the statement inserting n rows into the target.
+func (j *tableJob) insertStatement(columns []column, n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", j.target.Sanitize(), columnList(columns))
+	for row := range n {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for i := range columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", row*len(columns)+i+1)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// copyTo writes a script creating the target table and COPYing the masked
+// rows into it, in the text format of COPY, to w.
+func (j *tableJob) copyTo(ctx context.Context, appConfig pkg.AppConfig, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	err := j.read(ctx, appConfig, func(columns []column, rows *pkg.MaskedRows) error {
+		if len(j.target) == 2 {
+			fmt.Fprintf(out, "CREATE SCHEMA IF NOT EXISTS %s;\n", pgx.Identifier{j.target[0]}.Sanitize())
+		}
+		fmt.Fprintf(out, "%s;\n", j.createTable(columns))
+		fmt.Fprintf(out, "COPY %s (%s) FROM stdin;\n", j.target.Sanitize(), columnList(columns))
+		for rows.Next() {
+			values, err := scanRow(rows, len(columns))
+			if err != nil {
+				return err
+			}
+			for i, value := range values {
+				if i > 0 {
+					out.WriteByte('\t')
+				}
+				out.WriteString(copyValue(value))
+			}
+			out.WriteByte('\n')
+			j.rows++
+		}
+		_, err := out.WriteString("\\.\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("cannot write output: %w", err)
+	}
+	return nil
+}
+
+// columnList returns the quoted names of columns, separated by commas.
+func columnList(columns []column) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = pgx.Identifier{c.name}.Sanitize()
+	}
+	return strings.Join(names, ", ")
+}
+
+// scanRow returns the masked values of the current row as driver values.
+func scanRow(rows *pkg.MaskedRows, n int) ([]any, error) {
+	values := make([]any, n)
+	pointers := make([]any, n)
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, &pkg.InputError{Err: err}
+	}
+	return values, nil
+}
+
+// copyValue returns a driver value as a field of the text format of COPY.
+func copyValue(value driver.Value) string {
+	switch v := value.(type) {
+	case nil:
+		return `\N`
+	case []byte:
+		return `\\x` + hex.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// cursorRows are the rows of a cursor, fetched a batch at a time as they
+// are read.
+type cursorRows struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	fetch   string // Statement fetching the next batch
+	batch   int
+	rows    *sql.Rows
+	fetched int // Rows of the current batch read
+	err     error
+}
+
+// next fetches the next batch.
+func (r *cursorRows) next() error {
+	if r.rows != nil {
+		r.rows.Close()
+	}
+	r.rows, r.err = r.tx.QueryContext(r.ctx, r.fetch)
+	r.fetched = 0
+	return r.err
+}
+
+func (r *cursorRows) Columns() ([]string, error) {
+	return r.rows.Columns()
+}
+
+func (r *cursorRows) Next() bool {
+	for r.err == nil {
+		if r.rows.Next() {
+			r.fetched++
+			return true
+		}
+		// A batch shorter than asked for is the last one.
+		if r.rows.Err() != nil || r.fetched < r.batch {
+			return false
+		}
+		r.next()
+	}
+	return false
+}
+
+func (r *cursorRows) Scan(dest ...any) error {
+	return r.rows.Scan(dest...)
+}
+
+func (r *cursorRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+func (r *cursorRows) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	return r.rows.Close()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableJob_Statements(t *testing.T) {
+	job := tableJob{target: pgx.Identifier{"anonymized", "customers"}}
+	columns := []column{
+		{name: "id", dataType: "integer", notNull: true},
+		{name: "email", dataType: "character varying(255)"},
+		{name: `say "hi"`, dataType: "text"},
+	}
+
+	assert.Equal(t, `"id", "email", "say ""hi"""`, columnList(columns), "Names are quoted, with their quotes doubled")
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "anonymized"."customers" ("id" integer NOT NULL, "email" character varying(255), "say ""hi""" text)`,
+		job.createTable(columns))
+	assert.Equal(t, `INSERT INTO "anonymized"."customers" ("id", "email", "say ""hi""") VALUES ($1, $2, $3)`,
+		job.insertStatement(columns, 1))
+	assert.Equal(t, `INSERT INTO "anonymized"."customers" ("id", "email", "say ""hi""") VALUES ($1, $2, $3), ($4, $5, $6)`,
+		job.insertStatement(columns, 2), "Parameters are numbered on across rows")
+}
+
+func TestCopyValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"null", nil, `\N`},
+		{"bytes", []byte{0xde, 0xad}, `\\xdead`},
+		{"time", time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC), "2024-03-01T12:30:00.0000005Z"},
+		{"float", 0.1, "0.1"},
+		{"large float", 1e21, "1e+21"},
+		{"integer", int64(42), "42"},
+		{"bool", true, "true"},
+		{"string", "jane@example.com", "jane@example.com"},
+		{"escaped string", "back\\slash\ttab\nline\rreturn", `back\\slash\ttab\nline\rreturn`},
+		{"string of null", `\N`, `\\N`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, copyValue(tt.value))
+		})
+	}
+}
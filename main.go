@@ -1,16 +1,76 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
 	"unaware/pkg"
 )
 
+// Exit codes, so scripts and CI jobs can branch on the outcome of a run.
+const (
+	exitFailure  = 1 // Any other failure, such as output that cannot be written
+	exitConfig   = 2 // Invalid flags or config, as for flags the flag package rejects
+	exitInput    = 3 // Input that cannot be read or processed
+	exitPartial  = 4 // Some, but not all, of several input files failed
+	exitFindings = 5 // scan found more personal data than its threshold allows, or -verify masked values in the output
+)
+
+// exitCode returns the exit code for an error of a run.
+func exitCode(err error) int {
+	var configErr *pkg.ConfigError
+	var inputErr *pkg.InputError
+	var leakErr *leakError
+	switch {
+	case errors.As(err, &configErr):
+		return exitConfig
+	case errors.As(err, &inputErr):
+		return exitInput
+	case errors.As(err, &leakErr):
+		return exitFindings
+	}
+	return exitFailure
+}
+
+// leakError reports masked values that -verify found in the output.
+type leakError struct {
+	leaks []pkg.Leak
+}
+
+func (e *leakError) Error() string {
+	var b strings.Builder
+	b.WriteString("masked values survived in the output, which was not written:")
+	for _, leak := range e.leaks {
+		fmt.Fprintf(&b, "\n  %q on line %d", leak.Example, leak.Line)
+		if leak.Count > 1 {
+			fmt.Fprintf(&b, " and %d more times", leak.Count-1)
+		}
+	}
+	return b.String()
+}
+
 type stringSlice []string
 
 func (s *stringSlice) String() string {
@@ -23,89 +83,914 @@ func (s *stringSlice) Set(value string) error {
 }
 
 func main() {
-	flag.Usage = func() {
-		out := flag.CommandLine.Output()
+	if len(os.Args) > 1 {
+		switch command := os.Args[1]; command {
+		case "mask", "detokenize":
+			runMask(command, os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "scan":
+			runScan(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "detectors":
+			runDetectors(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "db":
+			runDB(os.Args[2:])
+			return
+		case "pipe":
+			runPipe(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "completion":
+			if len(os.Args) != 3 {
+				fmt.Fprintln(os.Stderr, "Error: completion takes the shell to complete for: bash, zsh or fish.")
+				os.Exit(exitConfig)
+			}
+			flags, _ := newMaskFlags("mask")
+			if err := runCompletion(os.Stdout, os.Args[2], flags); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(exitConfig)
+			}
+			return
+		case "help":
+			flags, _ := newMaskFlags("mask")
+			flags.SetOutput(os.Stdout)
+			flags.Usage()
+			return
+		default:
+			if !strings.HasPrefix(command, "-") {
+				fmt.Fprintf(os.Stderr, "Error: unknown command %q, see unaware help.\n", command)
+				os.Exit(exitConfig)
+			}
+		}
+	}
+
+	// Flags without a command mask, as before unaware had commands.
+	if len(os.Args) < 2 || !slices.Contains([]string{"-h", "-help", "--help"}, os.Args[1]) {
+		fmt.Fprintln(os.Stderr, "Warning: masking without a command is deprecated and will be removed; use unaware mask with the same flags.")
+	}
+	runMask("mask", os.Args[1:])
+}
+
+// policyFlags are the flags describing how to mask, shared by the commands
+// that mask: mask, detokenize and verify.
+type policyFlags struct {
+	configFile, profile, format, method, outputStyle, recordRange  *string
+	locale, mappingFile, saltFile, fpeKeyFile, mappingKeyFile      *string
+	maxMemory, maxTextLine, jsonBackend                            *string
+	delimiter, quote, comment, columns                             *string
+	cpuCount, batchSize, firstN, lastN, kAnonymity                 *int
+	decrypt, saltStdin, fieldScoped, unique, preserveSign          *bool
+	inferRanges, preserveLength, noHeader, lazyQuotes, cdataMarkup *bool
+
+	include, exclude, onlyTypes, skipTypes, safeValues, presets     stringSlice
+	rules, templates, types, fieldMethods, values, detected, ranges stringSlice
+	shuffle, quasiIdentifiers, plugins                              stringSlice
+
+	randomSalt []byte // Salt drawn when none is given
+}
+
+func addPolicyFlags(flags *flag.FlagSet) *policyFlags {
+	p := &policyFlags{}
+	p.configFile = flags.String("config", "", "YAML file describing the masking policy; other flags override or extend it")
+	p.profile = flags.String("profile", "", "Named profile of the -config file to mask with")
+	p.format = flags.String("format", "json", "Format of the input data (json, ndjson, xml, csv, text, mysqldump)")
+	p.method = flags.String("method", "random", "Masking method (random, deterministic, fpe, null, partial:firstN,lastN, dictionary:file, hash:hex|base64,length, wasm:file or one registered by a -plugin)")
+	p.outputStyle = flags.String("output-style", "", "Layout of json, ndjson and xml output: pretty, compact or preserve, which keeps that of the input (default pretty, compact for ndjson)")
+	p.cpuCount = flags.Int("cpu", 0, "Most CPU cores to use; workers are added while masking keeps them all busy (0 means GOMAXPROCS, every core by default)")
+	p.batchSize = flags.Int("batch-size", pkg.DefaultBatchSize, "Number of records a worker masks at a time; 1 masks every record as soon as it is read")
+	p.jsonBackend = flags.String("json-backend", "std", "Decoder and encoder of json and ndjson records: std (encoding/json), jsoniter, which is faster on wide records, or one registered by a -plugin")
+	p.maxMemory = flags.String("max-memory", "", "Bound of the records held in memory, read but not yet written, e.g. 512MB; reading waits while it is reached")
+	p.maxTextLine = flags.String("max-text-line", "1MiB", "Longest line of text input masked as a whole, e.g. 16MB; longer lines, such as minified JSON, are masked in parts of this size")
+	p.firstN = flags.Int("first", 0, "Process only the first n records/lines (0 means all)")
+	p.lastN = flags.Int("last", 0, "Process only the last n records/lines (0 means all)")
+	p.recordRange = flags.String("range", "", "Process only records/lines start through end, counting from 1, e.g. 100:200, 100: or :50")
+	p.decrypt = flags.Bool("decrypt", false, "Decrypt values previously masked with -method fpe")
+	p.mappingFile = flags.String("mapping-file", "", "Encrypted file recording original to masked values, reused on later runs (key in MAPPING_KEY)")
+	p.saltFile = flags.String("salt-file", "", "File holding the salt, such as a secret mount or /dev/fd/3, or secret URI such as vault://secret/data/unaware#salt, instead of STATIC_SALT")
+	p.fpeKeyFile = flags.String("fpe-key-file", "", "File or secret URI holding the hex-encoded key of -method fpe, instead of FPE_KEY")
+	p.mappingKeyFile = flags.String("mapping-key-file", "", "File or secret URI holding the hex-encoded key of -mapping-file, instead of MAPPING_KEY")
+	p.saltStdin = flags.Bool("salt-stdin", false, "Read the salt from stdin, instead of STATIC_SALT; the input must come from -in")
+	p.fieldScoped = flags.Bool("field-scoped", false, "Seed deterministic values on the field path too, so equal values under different keys get different fakes")
+	p.unique = flags.Bool("unique", false, "Guarantee that different values of a field never mask to the same deterministic output")
+	p.locale = flags.String("locale", "en", "Locale of generated names, addresses, phone numbers, IBANs and text (en, "+strings.Join(pkg.Locales(), ", ")+")")
+	p.preserveSign = flags.Bool("preserve-sign", false, "Keep negative numbers negative and positive numbers positive")
+	p.inferRanges = flags.Bool("infer-ranges", false, "Keep masked percentages, recognized by their key, within 0-100")
+	p.preserveLength = flags.Bool("preserve-length", false, "Keep the length of every word in masked free text")
+	p.noHeader = flags.Bool("no-header", false, "Read CSV without a header row, addressing columns as col:1, col:2, ... in patterns")
+	p.columns = flags.String("columns", "", "Names of the columns of CSV read with -no-header, comma-separated, e.g. id,name,email, to use in patterns instead of col:1, col:2, ...")
+	p.delimiter = flags.String("delimiter", ",", "Separator of CSV fields, such as ; or | (\\t or tab for TSV); the output is separated the same way")
+	p.quote = flags.String("quote", "\"", "Character quoting CSV fields, in the input and the output")
+	p.comment = flags.String("comment", "", "Character starting CSV lines that are skipped, such as #")
+	p.lazyQuotes = flags.Bool("lazy-quotes", false, "Read CSV quotes in unquoted fields, and undoubled ones in quoted fields, as part of the field")
+	p.cdataMarkup = flags.Bool("cdata-markup", false, "Mask XML CDATA sections holding markup, such as embedded XHTML, as the elements they hold")
+	p.kAnonymity = flags.Int("k-anonymity", 0, "Generalize CSV quasi-identifier columns until every combination occurs at least k times (0 disables)")
+
+	flags.Var(&p.include, "include", "Glob pattern to include keys for masking (can be specified multiple times)")
+	flags.Var(&p.exclude, "exclude", "Glob pattern to exclude keys from masking (can be specified multiple times)")
+	flags.Var(&p.onlyTypes, "only-type", "JSON value type masked by default (string, number, bool or null), others are kept (can be specified multiple times)")
+	flags.Var(&p.skipTypes, "skip-type", "JSON value type never masked by default (string, number, bool or null) (can be specified multiple times)")
+	flags.Var(&p.safeValues, "safe-value", "Literal value never masked, such as N/A or an enum constant, whatever selects it (can be specified multiple times)")
+	flags.Var(&p.rules, "rule", "Regex rule PATTERN=REGEX masking only what REGEX captures, or PATTERN=REGEX=>REPLACEMENT (can be specified multiple times)")
+	flags.Var(&p.templates, "template", "Fake template PATTERN=TEMPLATE generating values like \"{firstname} {lastname}\" (can be specified multiple times)")
+	flags.Var(&p.types, "type", "Type PATTERN=TYPE masking matching keys as e.g. phone, email, name or iban whatever they look like (can be specified multiple times)")
+	flags.Var(&p.fieldMethods, "field-method", "Masking method for matching keys PATTERN=METHOD, e.g. ssn=null (can be specified multiple times)")
+	flags.Var(&p.values, "match-value", "Regex selecting values to mask under any key, even when no -include pattern selects it (can be specified multiple times)")
+	flags.Var(&p.detected, "match-type", "Detected type, e.g. email, of values to mask under any key, even when no -include pattern selects it (can be specified multiple times)")
+	flags.Var(&p.presets, "preset", "Built-in rules for the fields a regulation protects ("+strings.Join(pkg.Presets(), ", ")+") (can be specified multiple times)")
+	flags.Var(&p.ranges, "clamp", "Range PATTERN=MIN:MAX keeping masked numbers of matching keys within bounds (can be specified multiple times)")
+	flags.Var(&p.shuffle, "shuffle", "CSV column whose real values are shuffled across rows instead of masked (can be specified multiple times)")
+	flags.Var(&p.plugins, "plugin", "Go plugin (.so) registering custom masking methods (can be specified multiple times)")
+	flags.Var(&p.quasiIdentifiers, "quasi-identifier", "CSV column generalized by -k-anonymity (can be specified multiple times)")
+	return p
+}
+
+// appConfig returns the config of a run as loadConfig does, exiting if it is
+// invalid.
+func (p *policyFlags) appConfig(flags *flag.FlagSet, stdinIsInput bool) pkg.AppConfig {
+	appConfig, err := p.loadConfig(flags, stdinIsInput)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitConfig)
+	}
+	return appConfig
+}
+
+// loadConfig returns the config of a run described by the -config file and
+// the flags that flags, holding those of p, were parsed with, including the
+// secrets its methods need. stdinIsInput tells whether the input is read
+// from stdin, which then cannot hold the salt. Files and secrets are read
+// again by every call, so a long-running command can reload them.
+func (p *policyFlags) loadConfig(flags *flag.FlagSet, stdinIsInput bool) (pkg.AppConfig, error) {
+	// Flags are a thin layer over the config model: scalar flags that are set
+	// override the file, and repeatable flags extend its lists. Rules from
+	// flags come first, so they take precedence over those in the file.
+	var config pkg.Config
+	if *p.configFile != "" {
+		var err error
+		if config, err = pkg.LoadConfig(*p.configFile); err != nil {
+			return pkg.AppConfig{}, err
+		}
+	}
+	if *p.profile != "" {
+		if *p.configFile == "" {
+			return pkg.AppConfig{}, errors.New("-profile requires -config")
+		}
+		var err error
+		if config, err = config.Profile(*p.profile); err != nil {
+			return pkg.AppConfig{}, err
+		}
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["format"] || config.Format == "" {
+		config.Format = *p.format
+	}
+	if set["method"] || config.Method == "" {
+		config.Method = *p.method
+	}
+	if set["cpu"] || config.CPUCount == 0 {
+		config.CPUCount = *p.cpuCount
+	}
+	if set["batch-size"] {
+		config.BatchSize = *p.batchSize
+	}
+	if set["max-memory"] {
+		config.MaxMemory = *p.maxMemory
+	}
+	if set["max-text-line"] {
+		config.MaxTextLine = *p.maxTextLine
+	}
+	if set["json-backend"] {
+		config.JSONBackend = *p.jsonBackend
+	}
+	// Subsets selected by flags replace the one of the file.
+	if set["first"] || set["last"] || set["range"] {
+		config.FirstN, config.LastN, config.Range = *p.firstN, *p.lastN, *p.recordRange
+	}
+	if set["output-style"] {
+		config.OutputStyle = *p.outputStyle
+	}
+	if set["locale"] || config.Locale == "" {
+		config.Locale = *p.locale
+	}
+	if set["mapping-file"] {
+		config.MappingFile = *p.mappingFile
+	}
+	if set["salt-file"] {
+		config.SaltFile = *p.saltFile
+	}
+	if set["fpe-key-file"] {
+		config.FPEKeyFile = *p.fpeKeyFile
+	}
+	if set["mapping-key-file"] {
+		config.MappingKeyFile = *p.mappingKeyFile
+	}
+	for name, value := range map[string]struct{ dst, src *string }{
+		"delimiter": {&config.Delimiter, p.delimiter},
+		"quote":     {&config.Quote, p.quote},
+		"comment":   {&config.Comment, p.comment},
+	} {
+		if set[name] {
+			*value.dst = *value.src
+		}
+	}
+	if set["columns"] {
+		config.Columns = strings.Split(*p.columns, ",")
+	}
+	if set["k-anonymity"] {
+		config.KAnonymity = *p.kAnonymity
+	}
+	for name, value := range map[string]struct{ dst, src *bool }{
+		"decrypt":         {&config.Decrypt, p.decrypt},
+		"unique":          {&config.Unique, p.unique},
+		"field-scoped":    {&config.FieldScoped, p.fieldScoped},
+		"preserve-length": {&config.PreserveLength, p.preserveLength},
+		"preserve-sign":   {&config.PreserveSign, p.preserveSign},
+		"infer-ranges":    {&config.InferRanges, p.inferRanges},
+		"no-header":       {&config.NoHeader, p.noHeader},
+		"lazy-quotes":     {&config.LazyQuotes, p.lazyQuotes},
+		"cdata-markup":    {&config.CDATAMarkup, p.cdataMarkup},
+	} {
+		if set[name] {
+			*value.dst = *value.src
+		}
+	}
+	config.Include = append(config.Include, p.include...)
+	config.Exclude = append(config.Exclude, p.exclude...)
+	config.Shuffle = append(config.Shuffle, p.shuffle...)
+	config.QuasiIdentifiers = append(config.QuasiIdentifiers, p.quasiIdentifiers...)
+	config.OnlyTypes = append(config.OnlyTypes, p.onlyTypes...)
+	config.SkipTypes = append(config.SkipTypes, p.skipTypes...)
+	config.SafeValues = append(config.SafeValues, p.safeValues...)
+	config.Plugins = append(config.Plugins, p.plugins...)
+	config.Presets = append(config.Presets, p.presets...)
+
+	var rules []pkg.Rule
+	for _, spec := range p.rules {
+		rule, err := pkg.ParseRule(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range p.templates {
+		rule, err := pkg.ParseTemplateRule(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range p.types {
+		rule, err := pkg.ParseTypeRule(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range p.fieldMethods {
+		rule, err := pkg.ParseMethodRule(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range p.values {
+		rule, err := pkg.ParseValueRule(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range p.detected {
+		rule, err := pkg.ParseDetectedRule(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		rules = append(rules, rule)
+	}
+	config.Rules = append(rules, config.Rules...)
+	for _, spec := range p.ranges {
+		r, err := pkg.ParseRange(spec)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		config.Ranges = append([]pkg.NumericRange{r}, config.Ranges...)
+	}
+
+	// Plugins register their maskers, so they are loaded before methods are
+	// parsed.
+	for _, path := range config.Plugins {
+		if err := pkg.LoadPlugin(path); err != nil {
+			return pkg.AppConfig{}, err
+		}
+	}
+
+	appConfig, err := config.AppConfig()
+	if err != nil {
+		return pkg.AppConfig{}, err
+	}
+	appConfig.Report = os.Stderr
+
+	// Secrets are needed for every method in use, including per-field ones.
+	methods := make(map[pkg.MaskingMethod]bool)
+	for _, method := range appConfig.Methods() {
+		methods[method] = true
+	}
+	// Deterministic, dictionary, hash and registered methods are seeded.
+	needsSalt := false
+	for method := range methods {
+		switch method {
+		case pkg.MethodRandom, pkg.MethodFPE, pkg.MethodNull, pkg.MethodPartial, pkg.MethodWasm:
+		default:
+			needsSalt = true
+		}
+	}
+	if needsSalt {
+		salt, err := readSalt(*p.saltStdin, config.SaltFile, config.SaltEnv, stdinIsInput)
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		// A random salt is drawn once, so reloads mask as before.
+		if salt == nil && p.randomSalt == nil {
+			p.randomSalt = make([]byte, 32)
+			if _, err := rand.Read(p.randomSalt); err != nil {
+				return pkg.AppConfig{}, fmt.Errorf("failed to generate random salt: %w", err)
+			}
+		}
+		if salt == nil {
+			salt = p.randomSalt
+		}
+		appConfig.Masker.Salt = salt
+	}
+	if methods[pkg.MethodFPE] {
+		key, err := readKey(config.FPEKeyFile, "FPE_KEY")
+		if err != nil {
+			return pkg.AppConfig{}, err
+		}
+		if len(key) == 0 {
+			return pkg.AppConfig{}, errors.New("-method fpe requires -fpe-key-file or FPE_KEY to hold a hex-encoded 16, 24 or 32 byte AES key")
+		}
+		appConfig.Masker.Key = key
+		appConfig.Masker.Tweak = []byte(os.Getenv("FPE_TWEAK"))
+	} else if config.Decrypt {
+		return pkg.AppConfig{}, errors.New("-decrypt and detokenize can only be used with -method fpe")
+	}
+
+	if appConfig.MappingFile != "" {
+		if appConfig.MappingKey, err = readKey(config.MappingKeyFile, "MAPPING_KEY"); err != nil {
+			return pkg.AppConfig{}, err
+		}
+		if len(appConfig.MappingKey) == 0 {
+			return pkg.AppConfig{}, errors.New("-mapping-file requires -mapping-key-file or MAPPING_KEY to hold a hex-encoded 16, 24 or 32 byte AES key")
+		}
+	}
+	return appConfig, nil
+}
+
+// maskFlags are the flags of mask and detokenize: a policy, and what to mask
+// and where to write it.
+type maskFlags struct {
+	*policyFlags
+	inputFiles                                 stringSlice
+	outputFile, outputTemplate, checkpointFile *string
+	jobs                                       *int
+	inPlace, backup, verify, dumpMappings      *bool
+	mmap                                       *bool
+	stats                                      *bool
+	notifyURL                                  *string
+	profile                                    *profileFlags
+}
+
+// newMaskFlags returns the flags of command, mask or detokenize, and where
+// they are parsed into.
+func newMaskFlags(command string) (*flag.FlagSet, *maskFlags) {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		out := flags.Output()
 		fmt.Fprintf(out, "Anonymize data in JSON, XML, CSV, and text files.\n\n")
 		fmt.Fprintf(out, "USAGE:\n")
-		fmt.Fprintf(out, "  unaware -format <type> [flags]\n\n")
+		fmt.Fprintf(out, "  unaware mask -format <type> [flags]\n")
+		fmt.Fprintf(out, "  unaware detokenize -method fpe [flags]\n")
+		fmt.Fprintf(out, "  unaware verify -in <original> [flags] <masked>\n")
+		fmt.Fprintf(out, "  unaware init -in <sample> [-out <config>]\n")
+		fmt.Fprintf(out, "  unaware scan (-in <file> | -dir <tree>) [-report table|json|sarif] [-threshold <n>]\n")
+		fmt.Fprintf(out, "  unaware diff [-hash] [-side-by-side] <original> <masked>\n")
+		fmt.Fprintf(out, "  unaware detectors [-locale <locale>] [-method <method>]\n")
+		fmt.Fprintf(out, "  unaware bench [-format <type>] [-method <method>] [-cpu <n>] [-records <n>]\n")
+		fmt.Fprintf(out, "  unaware db -table <table> (-target <table> | -target-schema <schema> | -copy) [flags]\n")
+		fmt.Fprintf(out, "  unaware pipe [-max-line <bytes>] [flags]\n")
+		fmt.Fprintf(out, "  unaware daemon -socket <path> [flags]\n")
+		fmt.Fprintf(out, "  unaware completion bash|zsh|fish\n\n")
+		fmt.Fprintf(out, "Run a command with -h for its flags. mask, detokenize and verify share the\n")
+		fmt.Fprintf(out, "flags describing how to mask.\n\n")
 		fmt.Fprintf(out, "EXAMPLES:\n")
 		fmt.Fprintf(out, "  # Mask a JSON file using random values\n")
-		fmt.Fprintf(out, "  unaware -format json -in input.json -out masked.json\n\n")
+		fmt.Fprintf(out, "  unaware mask -format json -in input.json -out masked.json\n\n")
 		fmt.Fprintf(out, "  # Mask a CSV file, keeping the output consistent between runs\n")
-		fmt.Fprintf(out, "  STATIC_SALT=secret-key unaware -format csv -method deterministic -in data.csv > data_masked.csv\n\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -method deterministic -salt-file salt.txt -in data.csv > data_masked.csv\n\n")
+		fmt.Fprintf(out, "  # Show only the last four digits of card numbers\n")
+		fmt.Fprintf(out, "  unaware mask -format json -method partial:last4 -include \"**.card_number\" -in orders.json\n\n")
+		fmt.Fprintf(out, "  # Generate realistic names and cities for specific columns\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -template 'name={firstname} {lastname}' -template 'location={city}, {stateabr}' -in people.csv\n\n")
+		fmt.Fprintf(out, "  # Generate Dutch names, phone numbers and IBANs\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -locale nl -template 'name={name}' -in klanten.csv\n\n")
+		fmt.Fprintf(out, "  # Mask only the digits after the dash in order ids, e.g. ORD-20240101\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -rule 'order_id=-(\\d+)$' -in orders.csv\n\n")
+		fmt.Fprintf(out, "  # Keep masked balances negative where they were, and discounts between 0 and 50\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -preserve-sign -clamp discount=0:50 -in accounts.csv\n\n")
+		fmt.Fprintf(out, "  # Mix methods: consistent customer ids, removed SSNs and random values elsewhere\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -field-method customer_id=deterministic -field-method ssn=null -in customers.csv\n\n")
+		fmt.Fprintf(out, "  # Replace user ids by stable 16 character pseudonyms\n")
+		fmt.Fprintf(out, "  STATIC_SALT=secret-key unaware mask -format json -method hash:16 -include \"**.user_id\" -in events.json\n\n")
+		fmt.Fprintf(out, "  # Replace company names with names from an approved list\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -method dictionary:companies.txt -include company -in customers.csv\n\n")
+		fmt.Fprintf(out, "  # Mask employee ids with a masker from an organization-specific plugin\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -plugin ./acme.so -field-method employee_id=acme-employee-id -in staff.csv\n\n")
+		fmt.Fprintf(out, "  # Mask ticket numbers with a WebAssembly module written in any language\n")
+		fmt.Fprintf(out, "  unaware mask -format json -field-method \"**.ticket=wasm:tickets.wasm\" -in incidents.json\n\n")
+		fmt.Fprintf(out, "  # Mask only the second and fourth column of a CSV file without a header\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -no-header -include col:2 -type col:4=phone -in export.csv\n\n")
+		fmt.Fprintf(out, "  # The same, naming the columns\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -no-header -columns id,name,notes,mobile -include name -type mobile=phone -in export.csv\n\n")
+		fmt.Fprintf(out, "  # Shuffle real salaries across rows, masking everything else\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -shuffle salary -in employees.csv\n\n")
+		fmt.Fprintf(out, "  # Keep masked values stable across runs in an encrypted mapping file, and audit it\n")
+		fmt.Fprintf(out, "  export MAPPING_KEY=$(openssl rand -hex 32)\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -method deterministic -mapping-file customers.map -in customers.csv\n")
+		fmt.Fprintf(out, "  unaware mask -mapping-file customers.map -dump-mappings > customers_map.csv\n\n")
+		fmt.Fprintf(out, "  # Generalize zip code and age so every combination occurs at least 5 times\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -k-anonymity 5 -quasi-identifier zip -quasi-identifier age -exclude zip -exclude age -in patients.csv\n\n")
+		fmt.Fprintf(out, "  # Encrypt identifiers in place with format-preserving encryption, then decrypt them again\n")
+		fmt.Fprintf(out, "  export FPE_KEY=$(openssl rand -hex 32)\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -method fpe -include customer_id -in data.csv > data_enc.csv\n")
+		fmt.Fprintf(out, "  unaware detokenize -format csv -method fpe -include customer_id -in data_enc.csv > data.csv\n\n")
+		fmt.Fprintf(out, "  # Mask phone numbers stored without separators as phone numbers, not integers\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -type mobile=phone -type contact=name -in contacts.csv\n\n")
+		fmt.Fprintf(out, "  # Mask ids, and emails and order numbers wherever they occur in a document\n")
+		fmt.Fprintf(out, "  unaware mask -format json -include \"**.id\" -match-type email -match-value '^ORD-\\d+$' -in tickets.json\n\n")
+		fmt.Fprintf(out, "  # Mask cardholder data the way PCI DSS expects, without writing any rules\n")
+		fmt.Fprintf(out, "  STATIC_SALT=secret-key unaware mask -format json -preset pci -in payments.json\n\n")
+		fmt.Fprintf(out, "  # Inspect a sample and write a starter config to review\n")
+		fmt.Fprintf(out, "  unaware init -in sample.json -out policy.yaml\n\n")
+		fmt.Fprintf(out, "  # Fail a CI job when an export holds personal data\n")
+		fmt.Fprintf(out, "  unaware scan -in export.json -exclude \"**.support_email\"\n\n")
+		fmt.Fprintf(out, "  # Report personal data in the fixtures of a repository to code scanning\n")
+		fmt.Fprintf(out, "  unaware scan -dir . -report sarif > unaware.sarif\n\n")
+		fmt.Fprintf(out, "  # Mask with a policy kept in a config file, overriding its format for one run\n")
+		fmt.Fprintf(out, "  unaware mask -config policy.yaml -format json -in export.json\n")
+		fmt.Fprintf(out, "  unaware mask -config policy.yaml -profile vendor-export -in export.csv\n\n")
+		fmt.Fprintf(out, "  # Mask free text everywhere, leaving numeric metrics and flags alone\n")
+		fmt.Fprintf(out, "  unaware mask -format json -only-type string -in events.json\n\n")
+		fmt.Fprintf(out, "  # Mask every export, writing masked/orders.csv for exports/orders.csv and so on\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -in 'exports/*.csv' -out-template 'masked/{name}{ext}'\n\n")
+		fmt.Fprintf(out, "  # Mask every export in a bucket into another bucket, without touching local disk\n")
+		fmt.Fprintf(out, "  unaware mask -format ndjson -in s3://exports/2024/ -out-template 's3://masked-exports/2024/{name}{ext}'\n\n")
+		fmt.Fprintf(out, "  # Mask uploads where they are, keeping the originals as .bak files\n")
+		fmt.Fprintf(out, "  unaware mask -format csv -inplace -backup -in 'uploads/*.csv'\n\n")
 		fmt.Fprintf(out, "  # Mask only email fields (using a glob pattern) in a large JSON file\n")
 		fmt.Fprintf(out, "  # Use \"**\" to match across multiple nested levels (e.g., \"**.email\")\n")
-		fmt.Fprintf(out, "  cat users.json | unaware -format json -include \"**.email\" > masked.json\n\n")
-		fmt.Fprintf(out, "FLAGS:\n")
-		flag.PrintDefaults()
-	}
-
-	format := flag.String("format", "json", "Format of the input data (json, xml, csv, text)")
-	methodFlag := flag.String("method", "random", "Masking method (random or deterministic)")
-	inputFile := flag.String("in", "", "Input file path (default: stdin)")
-	outputFile := flag.String("out", "", "Output file path (default: stdout)")
-	cpuCount := flag.Int("cpu", 4, "Number of CPU cores to use")
-	firstN := flag.Int("first", 0, "Process only the first n records/lines (0 means all)")
-
-	var includePatterns, excludePatterns stringSlice
-	flag.Var(&includePatterns, "include", "Glob pattern to include keys for masking (can be specified multiple times)")
-	flag.Var(&excludePatterns, "exclude", "Glob pattern to exclude keys from masking (can be specified multiple times)")
-
-	flag.Parse()
-
-	var maskerConfig pkg.MaskerConfig
-	switch *methodFlag {
-	case string(pkg.MethodDeterministic):
-		maskerConfig.Method = pkg.MethodDeterministic
-		var salt []byte
-		if staticSalt := os.Getenv("STATIC_SALT"); staticSalt != "" {
-			salt = []byte(staticSalt)
-		} else {
-			salt = make([]byte, 32)
-			if _, err := rand.Read(salt); err != nil {
-				fmt.Fprintln(os.Stderr, "failed to generate random salt:", err)
-				os.Exit(1)
+		fmt.Fprintf(out, "  cat users.json | unaware mask -format json -include \"**.email\" > masked.json\n\n")
+		fmt.Fprintf(out, "FLAGS of mask and detokenize:\n")
+		flags.PrintDefaults()
+	}
+
+	m := &maskFlags{policyFlags: addPolicyFlags(flags)}
+	flags.Var(&m.inputFiles, "in", "Input file path, glob pattern such as 'data/*.csv', S3 object or prefix such as s3://bucket/exports/, or SFTP file such as sftp://user@host/outbox/*.csv (default: stdin) (can be specified multiple times)")
+	m.outputFile = flags.String("out", "", "Output file path, S3 object such as s3://bucket/masked.json, or SFTP file such as sftp://user@host/inbox/masked.csv (default: stdout)")
+	m.outputTemplate = flags.String("out-template", "", "Output path of every -in file, with {dir}, {name} and {ext} of the input, e.g. \"masked/{name}{ext}\"")
+	m.jobs = flags.Int("jobs", 2, "Number of -in files masked at the same time")
+	m.checkpointFile = flags.String("checkpoint", "", "File recording the progress of an ndjson run, so an interrupted run resumes where it stopped")
+	m.inPlace = flags.Bool("inplace", false, "Replace every -in file by its masked version")
+	m.backup = flags.Bool("backup", false, "Keep a file replaced by -inplace or -out as FILE.bak")
+	m.verify = flags.Bool("verify", false, "Check the output for every masked value of 5 or more bytes, also within longer values, and fail without writing it if any survived")
+	m.mmap = flags.Bool("mmap", false, "Map regular -in files into memory, so csv and ndjson records are sliced out of the mapping instead of read through buffers")
+	m.dumpMappings = flags.Bool("dump-mappings", false, "Write the mappings of -mapping-file as CSV for auditing instead of masking")
+	m.stats = flags.Bool("stats", false, "Report the records, masked values by type, bytes and time of every run on stderr")
+	m.notifyURL = flags.String("notify-url", "", "Webhook the summary of the run, its files, counts, duration and status, is POSTed to as JSON when it finishes")
+	m.profile = addProfileFlags(flags)
+	return flags, m
+}
+
+// runMask masks the input as command describes: mask masks it, and
+// detokenize decrypts values masked with -method fpe.
+func runMask(command string, args []string) {
+	flags, m := newMaskFlags(command)
+	flags.Parse(args)
+	if command == "detokenize" {
+		flags.Set("decrypt", "true")
+	}
+	appConfig := m.appConfig(flags, len(m.inputFiles) == 0)
+	ctx := interruptible()
+
+	if *m.dumpMappings && appConfig.MappingFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: -dump-mappings requires -mapping-file.")
+		os.Exit(exitConfig)
+	}
+	if *m.dumpMappings {
+		mappings, err := pkg.ReadMappings(appConfig.MappingFile, appConfig.MappingKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitConfig)
+		}
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"field", "original", "masked"})
+		for _, mapping := range mappings {
+			w.Write([]string{mapping.Field, fmt.Sprint(mapping.Original), fmt.Sprint(mapping.Masked)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	inputs, err := expandInputs(ctx, m.inputFiles)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitInput)
+	}
+	remoteOutput := isRemote(*m.outputFile)
+	for _, input := range inputs {
+		if *m.inPlace && isRemote(input) || *m.outputTemplate != "" && isRemote(outputPath(*m.outputTemplate, input)) {
+			remoteOutput = true
+		}
+	}
+	switch {
+	case *m.inPlace && (*m.outputFile != "" || *m.outputTemplate != ""):
+		fmt.Fprintln(os.Stderr, "Error: -inplace cannot be used with -out or -out-template.")
+		os.Exit(exitConfig)
+	case *m.inPlace && len(inputs) == 0:
+		fmt.Fprintln(os.Stderr, "Error: -inplace requires -in.")
+		os.Exit(exitConfig)
+	case len(inputs) > 1 && *m.outputTemplate == "" && !*m.inPlace:
+		fmt.Fprintln(os.Stderr, "Error: multiple input files need -out-template to name their outputs.")
+		os.Exit(exitConfig)
+	case *m.outputTemplate != "" && *m.outputFile != "":
+		fmt.Fprintln(os.Stderr, "Error: -out and -out-template cannot be used together.")
+		os.Exit(exitConfig)
+	case *m.outputTemplate != "" && len(inputs) == 0:
+		fmt.Fprintln(os.Stderr, "Error: -out-template requires -in.")
+		os.Exit(exitConfig)
+	case *m.backup && !*m.inPlace && *m.outputFile == "" && *m.outputTemplate == "":
+		fmt.Fprintln(os.Stderr, "Error: -backup requires an output file.")
+		os.Exit(exitConfig)
+	case *m.checkpointFile != "" && (len(inputs) != 1 || *m.outputFile == "" || *m.backup):
+		fmt.Fprintln(os.Stderr, "Error: -checkpoint requires a single -in file and an -out file, without -backup.")
+		os.Exit(exitConfig)
+	case *m.checkpointFile != "" && (remoteOutput || slices.ContainsFunc(inputs, isRemote)):
+		fmt.Fprintln(os.Stderr, "Error: -checkpoint cannot be used with S3 objects or SFTP files.")
+		os.Exit(exitConfig)
+	case remoteOutput && *m.backup:
+		fmt.Fprintln(os.Stderr, "Error: -backup cannot be used with S3 or SFTP outputs, enable bucket versioning to keep replaced objects.")
+		os.Exit(exitConfig)
+	case remoteOutput && *m.verify:
+		fmt.Fprintln(os.Stderr, "Error: -verify cannot be used with S3 or SFTP outputs, since they are never written to local disk.")
+		os.Exit(exitConfig)
+	case *m.verify && *m.outputFile == "" && *m.outputTemplate == "" && !*m.inPlace:
+		fmt.Fprintln(os.Stderr, "Error: -verify requires an output file, from -out, -out-template or -inplace.")
+		os.Exit(exitConfig)
+	case *m.verify && *m.checkpointFile != "":
+		fmt.Fprintln(os.Stderr, "Error: -verify cannot be used with -checkpoint, since a resumed run does not know what was masked before.")
+		os.Exit(exitConfig)
+	case *m.checkpointFile != "" && (appConfig.FirstN > 0 || appConfig.LastN > 0 || appConfig.Range != pkg.RecordRange{}):
+		fmt.Fprintln(os.Stderr, "Error: -checkpoint cannot be used with -first, -last or -range.")
+		os.Exit(exitConfig)
+	}
+
+	if *m.outputTemplate != "" {
+		if err := checkOutputs(*m.outputTemplate, inputs); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitConfig)
+		}
+	}
+
+	stopProfiles, err := m.profile.start()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitConfig)
+	}
+
+	// The webhook hears of every batch that started masking, however it
+	// ends. Failing to reach it does not change the outcome of the run.
+	summary := newRunSummary(command)
+	exit := func(code int) {
+		stopProfiles()
+		if *m.notifyURL != "" {
+			summary.finish()
+			if err := notify(*m.notifyURL, summary); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning:", err)
 			}
 		}
-		maskerConfig.Salt = salt
-	case string(pkg.MethodRandom):
-		maskerConfig.Method = pkg.MethodRandom
-	default:
-		fmt.Fprintf(os.Stderr, "Error: Invalid method '%s'. Please use 'random' or 'deterministic'.\n", *methodFlag)
-		os.Exit(1)
+		if code != 0 {
+			os.Exit(code)
+		}
+	}
+
+	if *m.checkpointFile != "" {
+		stats, err := maskResumable(ctx, appConfig, inputs[0], *m.outputFile, *m.checkpointFile, *m.mmap)
+		summary.add(inputs[0], *m.outputFile, stats, err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			exit(exitCode(err))
+		}
+		if *m.stats {
+			printStats("", stats)
+		}
+		fmt.Printf("Successfully masked input and saved to %s\n", *m.outputFile)
+		exit(0)
+		return
 	}
 
-	appConfig := pkg.AppConfig{
-		Format:   *format,
-		CPUCount: *cpuCount,
-		Include:  includePatterns,
-		Exclude:  excludePatterns,
-		FirstN:   *firstN,
-		Masker:   maskerConfig,
+	if *m.outputTemplate == "" && !*m.inPlace {
+		input := ""
+		if len(inputs) == 1 {
+			input = inputs[0]
+		}
+		stats, err := maskFile(ctx, appConfig, input, *m.outputFile, true, *m.backup, *m.verify, *m.mmap)
+		summary.add(input, *m.outputFile, stats, err)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			exit(exitCode(err))
+		}
+		if *m.stats {
+			printStats("", stats)
+		}
+		if *m.outputFile != "" {
+			fmt.Printf("Successfully masked input and saved to %s\n", *m.outputFile)
+		}
+		exit(0)
+		return
 	}
 
+	// Every file is masked by its own run of the engine. Runs sharing a
+	// mapping file must see each other's mappings, so they take turns.
+	poolSize := *m.jobs
+	if poolSize < 1 || appConfig.MappingFile != "" {
+		poolSize = 1
+	}
+	paths := make(chan string)
+	errs := make(chan error)
+	var wg sync.WaitGroup
+	for range min(poolSize, len(inputs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range paths {
+				output := input
+				if !*m.inPlace {
+					output = outputPath(*m.outputTemplate, input)
+				}
+				stats, err := maskFile(ctx, appConfig, input, output, false, *m.backup, *m.verify, *m.mmap)
+				summary.add(input, output, stats, err)
+				if err == nil && *m.stats {
+					printStats(input, stats)
+				}
+				if err == nil && *m.inPlace {
+					fmt.Printf("Successfully masked %s in place\n", input)
+				} else if err == nil {
+					fmt.Printf("Successfully masked %s and saved to %s\n", input, output)
+				}
+				errs <- err
+			}
+		}()
+	}
+	go func() {
+		for _, input := range inputs {
+			paths <- input
+		}
+		close(paths)
+		wg.Wait()
+		close(errs)
+	}()
+	failed := 0
+	var lastErr error
+	for err := range errs {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			failed++
+			lastErr = err
+		}
+	}
+	if failed == len(inputs) {
+		exit(exitCode(lastErr))
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d of %d files could not be masked.\n", failed, len(inputs))
+		exit(exitPartial)
+	}
+	exit(0)
+}
+
+// interruptible returns a context that is canceled on an interrupt or
+// termination signal, so a run stops between records and cleans up. A second
+// signal stops the process at once.
+func interruptible() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+// runVerify masks the -in file as the policy flags describe, discarding the
+// output, and checks the masked file for the values that were masked.
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	p := addPolicyFlags(flags)
+	inputFile := flags.String("in", "", "Original the masked file was masked from")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: unaware verify -in <original> [flags] <masked>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *inputFile == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitConfig)
+	}
+	appConfig := p.appConfig(flags, false)
+	appConfig.Verify = pkg.NewMaskedValues()
+
+	input, err := os.Open(*inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening input file: %v\n", err)
+		os.Exit(exitInput)
+	}
+	defer input.Close()
+	if _, err := pkg.StartContext(interruptible(), input, io.Discard, appConfig); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+	if err := verifyOutput(appConfig.Verify, flags.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+	fmt.Printf("No masked values found in %s\n", flags.Arg(0))
+}
+
+// expandInputs expands the shell-style glob patterns among the -in paths, for
+// shells that do not or when quoted, also those of sftp:// URLs, and the
+// s3:// prefixes among them into the objects below them, and drops
+// duplicates. Patterns and prefixes must
+// match at least one file or object.
+func expandInputs(ctx context.Context, patterns []string) ([]string, error) {
+	var inputs []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		var err error
+		switch {
+		case isS3Prefix(pattern):
+			if matches, err = listS3(ctx, pattern); err != nil {
+				return nil, err
+			}
+		case isSFTP(pattern) && strings.ContainsAny(pattern, "*?["):
+			if matches, err = globSFTP(ctx, pattern); err != nil {
+				return nil, err
+			}
+		case !isS3(pattern) && strings.ContainsAny(pattern, "*?["):
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no input files match %q", pattern)
+			}
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				inputs = append(inputs, match)
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// outputPath names the output of input after template, in which {dir} is the
+// directory of input, {name} its file name without extension and {ext} the
+// extension including the dot.
+func outputPath(template, input string) string {
+	ext := filepath.Ext(input)
+	dir := filepath.Dir(input)
+	if isRemote(input) {
+		dir = urlDir(input)
+	}
+	return strings.NewReplacer(
+		"{dir}", dir,
+		"{name}", strings.TrimSuffix(filepath.Base(input), ext),
+		"{ext}", ext,
+	).Replace(template)
+}
+
+// placeholderRegex matches the placeholders of an -out-template.
+var placeholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// checkOutputs checks that template only holds known placeholders and names
+// a different output for every input, none of which is an input itself, so
+// no run overwrites the input or output of another.
+func checkOutputs(template string, inputs []string) error {
+	for _, placeholder := range placeholderRegex.FindAllString(template, -1) {
+		if !slices.Contains([]string{"{dir}", "{name}", "{ext}"}, placeholder) {
+			return fmt.Errorf("unknown placeholder %s in -out-template, expected {dir}, {name} or {ext}", placeholder)
+		}
+	}
+	outputs := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		outputs[cleanPath(input)] = ""
+	}
+	for _, input := range inputs {
+		output := cleanPath(outputPath(template, input))
+		switch other, ok := outputs[output]; {
+		case ok && other == "":
+			return fmt.Errorf("-out-template names input %s as the output of %s, use -inplace to replace inputs", output, input)
+		case ok:
+			return fmt.Errorf("-out-template names %s as the output of both %s and %s", output, other, input)
+		}
+		outputs[output] = input
+	}
+	return nil
+}
+
+// cleanPath cleans a file path as filepath.Clean does, leaving s3:// and
+// sftp:// URLs as they are.
+func cleanPath(path string) string {
+	if isRemote(path) {
+		return path
+	}
+	return filepath.Clean(path)
+}
+
+// maskFile masks input to output, where empty names mean stdin and stdout.
+// Progress is shown when asked for and both are files. Output files are
+// written to a temporary file next to them and renamed over them once
+// complete, so a failed run leaves any existing file untouched, and the
+// output may be the input itself. With backup, a replaced file is kept with
+// a .bak extension. With verify, output holding any of the masked values is
+// not written. s3://bucket/key names stream from and to S3 objects instead,
+// and sftp:// URLs from and to files on SFTP servers.
+// The metrics of the run are returned with it.
+func maskFile(ctx context.Context, appConfig pkg.AppConfig, input, output string, progress, backup, verify, mmap bool) (*pkg.Stats, error) {
 	var reader io.Reader = os.Stdin
-	var inputCloser io.Closer
-	var fileInfo os.FileInfo
+	size := int64(-1) // Unknown for stdin
 
-	if *inputFile != "" {
-		f, err := os.Open(*inputFile)
+	switch {
+	case isS3(input):
+		object, objectSize, err := openS3(ctx, input)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error opening input file: %v\n", err)
-			os.Exit(1)
+			return nil, &pkg.InputError{Err: fmt.Errorf("cannot open input object: %w", err)}
 		}
-		fileInfo, err = f.Stat()
+		defer object.Close()
+		reader, size = object, objectSize
+	case isSFTP(input):
+		file, fileSize, err := openSFTP(ctx, input)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error getting file info: %v\n", err)
-			os.Exit(1)
+			return nil, &pkg.InputError{Err: fmt.Errorf("cannot open input file: %w", err)}
+		}
+		defer file.Close()
+		reader, size = file, fileSize
+	case input != "":
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, &pkg.InputError{Err: fmt.Errorf("cannot open input file: %w", err)}
+		}
+		defer f.Close()
+		fileInfo, err := f.Stat()
+		if err != nil {
+			return nil, &pkg.InputError{Err: fmt.Errorf("cannot read input file: %w", err)}
+		}
+		if !fileInfo.IsDir() {
+			size = fileInfo.Size()
 		}
-		inputCloser = f
 		reader = f
+		if mmap && fileInfo.Mode().IsRegular() {
+			mapped, err := pkg.MapInput(f)
+			if err != nil {
+				return nil, &pkg.InputError{Err: fmt.Errorf("cannot map input file: %w", err)}
+			}
+			defer mapped.Close()
+			reader = mapped
+		}
 	}
 
-	if *outputFile != "" && fileInfo != nil && !fileInfo.IsDir() {
+	if progress && output != "" && size >= 0 {
 		bar := progressbar.NewOptions64(
-			fileInfo.Size(),
+			size,
 			progressbar.OptionSetDescription("Masking..."),
 			progressbar.OptionSetWriter(os.Stderr),
 			progressbar.OptionShowBytes(true),
@@ -118,43 +1003,731 @@ func main() {
 			progressbar.OptionSpinnerType(14),
 			progressbar.OptionFullWidth(),
 		)
-		progressBarReader := progressbar.NewReader(reader, bar)
-		reader = &progressBarReader
+		if mapped, ok := reader.(*pkg.MappedInput); ok {
+			defer followMapped(bar, mapped)()
+		} else {
+			progressBarReader := progressbar.NewReader(reader, bar)
+			reader = &progressBarReader
+		}
+	}
+
+	if output == "" {
+		return pkg.StartContext(ctx, reader, os.Stdout, appConfig)
+	}
+	if isRemote(output) {
+		return maskToRemote(ctx, appConfig, reader, input, output)
+	}
+	dir := filepath.Dir(output)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create output directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create output file: %w", err)
+	}
+	defer os.Remove(f.Name()) // No-op once renamed
+	if verify {
+		appConfig.Verify = pkg.NewMaskedValues()
+	}
+	stats, err := pkg.StartContext(ctx, reader, f, appConfig)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, context.Canceled) {
+			err = fmt.Errorf("interrupted before the output was written: %w", err)
+		}
+		if input != "" {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot write output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("cannot close output file: %w", err)
+	}
+	if verify {
+		if err := verifyOutput(appConfig.Verify, f.Name()); err != nil {
+			if input != "" {
+				return nil, fmt.Errorf("%s: %w", input, err)
+			}
+			return nil, err
+		}
+	}
+
+	// A replaced file keeps its permissions, new files get the usual ones
+	// rather than the owner-only ones of temporary files.
+	mode := os.FileMode(0o644)
+	if existing, err := os.Stat(output); err == nil {
+		mode = existing.Mode().Perm()
+		if backup {
+			if err := copyFile(output, output+".bak", mode); err != nil {
+				return nil, fmt.Errorf("cannot back up %s: %w", output, err)
+			}
+		}
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return nil, fmt.Errorf("cannot write output file: %w", err)
+	}
+	if err := os.Rename(f.Name(), output); err != nil {
+		return nil, fmt.Errorf("cannot replace output file: %w", err)
+	}
+	return stats, nil
+}
+
+// remoteWriter writes a remote output, which only replaces the output once
+// closed.
+type remoteWriter interface {
+	io.WriteCloser
+	Abort(err error)
+}
+
+// maskToRemote masks reader to the S3 object or SFTP file at output as
+// maskFile does, writing it while it is masked. A failed run aborts the
+// write, leaving any existing object or file untouched.
+func maskToRemote(ctx context.Context, appConfig pkg.AppConfig, reader io.Reader, input, output string) (*pkg.Stats, error) {
+	var w remoteWriter
+	var err error
+	if isSFTP(output) {
+		w, err = createSFTP(ctx, output)
+	} else {
+		w, err = createS3(ctx, output)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %s: %w", output, err)
+	}
+	stats, err := pkg.StartContext(ctx, reader, w, appConfig)
+	if err != nil {
+		w.Abort(err)
+		if errors.Is(err, context.Canceled) {
+			err = fmt.Errorf("interrupted before the output was written: %w", err)
+		}
+		if input != "" {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("cannot write %s: %w", output, err)
+	}
+	return stats, nil
+}
+
+// verifyOutput fails with a leakError when the output file holds any of the
+// masked values.
+func verifyOutput(masked *pkg.MaskedValues, output string) error {
+	f, err := os.Open(output)
+	if err != nil {
+		return fmt.Errorf("cannot verify output file: %w", err)
+	}
+	defer f.Close()
+	leaks, err := masked.Verify(f)
+	if err != nil {
+		return fmt.Errorf("cannot verify output file: %w", err)
+	}
+	if len(leaks) > 0 {
+		return &leakError{leaks: leaks}
+	}
+	return nil
+}
+
+// printStats writes the -stats report of a run, of the file name if not
+// empty, to stderr at once, so the reports of concurrent runs do not mix.
+func printStats(name string, stats *pkg.Stats) {
+	var report strings.Builder
+	if name != "" {
+		fmt.Fprintf(&report, "%s: ", name)
+	}
+	fmt.Fprintf(&report, "masked %d values in %d records (%.1f MB in, %.1f MB out) in %s, %d workers %.0f%% busy\n",
+		stats.MaskedValues(), stats.Records, float64(stats.BytesIn)/1e6, float64(stats.BytesOut)/1e6,
+		stats.Duration.Round(time.Millisecond), stats.Workers, stats.Utilization*100)
+	for _, kind := range slices.Sorted(maps.Keys(stats.Masked)) {
+		fmt.Fprintf(&report, "  %s: %d\n", kind, stats.Masked[kind])
+	}
+	os.Stderr.WriteString(report.String())
+}
+
+// checkpoint is the content of a -checkpoint file. The file names make sure
+// a run only resumes the run that wrote it.
+type checkpoint struct {
+	InputFile  string `json:"input_file"`
+	OutputFile string `json:"output_file"`
+	pkg.Checkpoint
+}
+
+// followMapped moves bar on with what a run took of mapped input, which is
+// not read through a reader the bar could count. The returned function stops
+// it, once the bar is up to date.
+func followMapped(bar *progressbar.ProgressBar, mapped *pkg.MappedInput) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(65 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bar.Set64(mapped.Offset())
+			case <-done:
+				bar.Set64(mapped.Offset())
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// maskResumable masks input to output like maskFile, but records its
+// progress in checkpointPath. When that file exists, the run resumes: the
+// output is cut back to the records the checkpoint covers and masking
+// continues with the input after them, so no record is lost or written
+// twice. The checkpoint is removed once the run completes.
+func maskResumable(ctx context.Context, appConfig pkg.AppConfig, input, output, checkpointPath string, mmap bool) (*pkg.Stats, error) {
+	var start checkpoint
+	data, err := os.ReadFile(checkpointPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &start); err != nil {
+			return nil, &pkg.ConfigError{Err: fmt.Errorf("invalid checkpoint file: %w", err)}
+		}
+		if start.InputFile != input || start.OutputFile != output {
+			return nil, &pkg.ConfigError{Err: fmt.Errorf("checkpoint %s records a run from %s to %s", checkpointPath, start.InputFile, start.OutputFile)}
+		}
+	case errors.Is(err, os.ErrNotExist):
+		start = checkpoint{InputFile: input, OutputFile: output}
+	default:
+		return nil, &pkg.ConfigError{Err: fmt.Errorf("cannot read checkpoint file: %w", err)}
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return nil, &pkg.InputError{Err: fmt.Errorf("cannot open input file: %w", err)}
+	}
+	defer in.Close()
+	if _, err := in.Seek(start.Input, io.SeekStart); err != nil {
+		return nil, &pkg.InputError{Err: fmt.Errorf("cannot resume input file: %w", err)}
+	}
+	var reader io.Reader = in
+	if mmap {
+		mapped, err := pkg.MapInput(in)
+		if err != nil {
+			return nil, &pkg.InputError{Err: fmt.Errorf("cannot map input file: %w", err)}
+		}
+		defer mapped.Close()
+		reader = mapped
+	}
+	out, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open output file: %w", err)
+	}
+	defer out.Close()
+	if info, err := out.Stat(); err != nil || info.Size() < start.Output {
+		return nil, fmt.Errorf("output file %s is shorter than checkpoint %s records, remove the checkpoint to start over", output, checkpointPath)
+	}
+	if err := out.Truncate(start.Output); err != nil {
+		return nil, fmt.Errorf("cannot resume output file: %w", err)
+	}
+	if _, err := out.Seek(start.Output, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("cannot resume output file: %w", err)
+	}
+	if start.Records > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming after record %d\n", start.Records)
+	}
+
+	appConfig.Checkpoint = func(progress pkg.Checkpoint) error {
+		// The checkpoint must not get ahead of what is on disk.
+		if err := out.Sync(); err != nil {
+			return err
+		}
+		next := start
+		next.Input += progress.Input
+		next.Output += progress.Output
+		next.Records += progress.Records
+		return writeCheckpoint(checkpointPath, next)
+	}
+	stats, err := pkg.StartContext(ctx, reader, out, appConfig)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("interrupted, run the same command to resume: %w", err)
+		}
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("cannot close output file: %w", err)
+	}
+	if err := os.Remove(checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// writeCheckpoint replaces the checkpoint file atomically, so an interrupted
+// write leaves the previous checkpoint.
+func writeCheckpoint(path string, c checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // No-op once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// copyFile copies src to dst, syncing it to disk.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// runInit inspects a sample, lists its key paths on stderr and writes a
+// starter config for them.
+func runInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	inputFile := flags.String("in", "", "Sample file to inspect (default: stdin)")
+	outputFile := flags.String("out", "", "Config file to write (default: stdout)")
+	format := flags.String("format", "", "Format of the sample (json or csv, default: from the -in extension, or json)")
+	interactive := flags.Bool("interactive", false, "Ask for every field whether to mask or keep it, and with which method; requires -in")
+	flags.Parse(args)
+
+	if *interactive && *inputFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: -interactive reads answers from stdin, so the sample must come from -in.")
+		os.Exit(exitConfig)
+	}
+
+	if *format == "" {
+		*format = "json"
+		if ext := strings.TrimPrefix(filepath.Ext(*inputFile), "."); ext == "csv" {
+			*format = ext
+		}
 	}
 
-	if inputCloser != nil {
-		defer inputCloser.Close()
+	var reader io.Reader = os.Stdin
+	if *inputFile != "" {
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error opening input file: %v\n", err)
+			os.Exit(exitInput)
+		}
+		defer f.Close()
+		reader = f
+	}
+	fields, err := pkg.InspectSample(reader, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+
+	if *interactive {
+		if err := reviewFields(os.Stdin, os.Stderr, fields); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitFailure)
+		}
+	} else {
+		table := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "PATH\tTYPE\tDISTINCT\tEXAMPLE\tSUGGESTION")
+		for _, field := range fields {
+			suggestion := "keep"
+			if field.Mask {
+				suggestion = "mask"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%d/%d\t%q\t%s\n", field.Path, field.Type, field.Distinct, field.Count, field.Example, suggestion)
+		}
+		table.Flush()
 	}
 
 	var writer io.Writer = os.Stdout
-	var outputCloser io.Closer
 	if *outputFile != "" {
 		f, err := os.Create(*outputFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error creating output file: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitFailure)
 		}
-		outputCloser = f
+		defer f.Close()
 		writer = f
 	}
+	if err := pkg.ScaffoldConfig(writer, *format, fields); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitFailure)
+	}
+}
 
-	if err := pkg.Start(reader, writer, appConfig); err != nil {
+// runScan reports the personal data found in the input on stdout, without
+// masking it, and fails when it holds more values than the threshold.
+func runScan(args []string) {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	inputFile := flags.String("in", "", "File to scan (default: stdin)")
+	dir := flags.String("dir", "", "Source tree whose data files (.json, .ndjson, .jsonl, .csv, .xml and .sql) are scanned, such as . in a pre-merge check")
+	format := flags.String("format", "", "Format of the input (json, ndjson, csv, xml or mysqldump, default: from the -in extension, or json)")
+	report := flags.String("report", "table", "Report written to stdout: table, json or sarif")
+	threshold := flags.Int("threshold", 0, "Number of values with personal data tolerated before failing")
+	var excludePatterns, skipPatterns stringSlice
+	flags.Var(&excludePatterns, "exclude", "Glob pattern of keys not to report (can be specified multiple times)")
+	flags.Var(&skipPatterns, "skip", "Glob pattern of files and directories of -dir not to scan, e.g. 'testdata/large/**' (can be specified multiple times)")
+	flags.Parse(args)
+
+	var results []fileFindings
+	switch {
+	case *report != "table" && *report != "json" && *report != "sarif":
+		fmt.Fprintf(os.Stderr, "Error: unknown report %q, want table, json or sarif.\n", *report)
+		os.Exit(exitConfig)
+	case *dir != "" && (*inputFile != "" || *format != ""):
+		fmt.Fprintln(os.Stderr, "Error: -dir cannot be used with -in or -format, the format of every file is told by its extension.")
+		os.Exit(exitConfig)
+	case *dir != "":
+		var err error
+		if results, err = scanTree(*dir, skipPatterns, excludePatterns); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitCode(err))
+		}
+	default:
+		if *format == "" {
+			*format = "json"
+			if ext, ok := scanFormats[strings.ToLower(filepath.Ext(*inputFile))]; ok {
+				*format = ext
+			}
+		}
+		var reader io.Reader = os.Stdin
+		if *inputFile != "" {
+			f, err := os.Open(*inputFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error opening input file: %v\n", err)
+				os.Exit(exitInput)
+			}
+			defer f.Close()
+			reader = f
+		}
+		findings, err := pkg.Scan(reader, *format, excludePatterns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitCode(err))
+		}
+		results = []fileFindings{{File: *inputFile, Findings: findings}}
+	}
+
+	if err := writeScanReport(os.Stdout, *report, results, *dir != ""); err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
-		if outputCloser != nil {
-			outputCloser.Close()
-			os.Remove(*outputFile)
+		os.Exit(exitCode(err))
+	}
+	total, fields := 0, 0
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			total += finding.Count
 		}
-		os.Exit(1)
+		fields += len(result.Findings)
+	}
+	if *dir != "" {
+		fmt.Fprintf(os.Stderr, "%d values with personal data in %d fields of %d files\n", total, fields, len(results))
+	} else {
+		fmt.Fprintf(os.Stderr, "%d values with personal data in %d fields\n", total, fields)
+	}
+	if total > *threshold {
+		fmt.Fprintf(os.Stderr, "Error: %d values exceed the threshold of %d.\n", total, *threshold)
+		os.Exit(exitFindings)
+	}
+}
+
+// runDiff shows on stdout which values of an input its masked output
+// changed, followed by the number of values changed per field.
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flags.String("format", "", "Format of the files (json, ndjson or csv, default: from the extension of the original, or json)")
+	hash := flags.Bool("hash", false, "Show values as the start of their SHA-256 digest instead of truncated")
+	sideBySide := flags.Bool("side-by-side", false, "Show the original and masked value of every change on one line")
+	summary := flags.Bool("summary", false, "Show only the number of values changed per field")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: unaware diff [flags] <original> <masked>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(exitConfig)
 	}
+	originalFile, maskedFile := flags.Arg(0), flags.Arg(1)
 
-	if outputCloser != nil {
-		if err := outputCloser.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "error closing output file: %v\n", err)
-			os.Exit(1)
+	if *format == "" {
+		*format = "json"
+		if ext := strings.TrimPrefix(filepath.Ext(originalFile), "."); ext == "csv" || ext == "ndjson" {
+			*format = ext
 		}
 	}
 
-	if *outputFile != "" {
-		fmt.Printf("Successfully masked input and saved to %s\n", *outputFile)
+	original, err := os.Open(originalFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening input file: %v\n", err)
+		os.Exit(exitInput)
+	}
+	defer original.Close()
+	masked, err := os.Open(maskedFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening input file: %v\n", err)
+		os.Exit(exitInput)
+	}
+	defer masked.Close()
+	report, err := pkg.Diff(original, masked, *format, *hash)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+
+	switch {
+	case *summary:
+	case *sideBySide:
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "RECORD\tPATH\tORIGINAL\tMASKED")
+		for _, change := range report.Changes {
+			output := change.Masked
+			if output == "" {
+				output = "(removed)"
+			}
+			fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", change.Record, change.Path, change.Original, output)
+		}
+		table.Flush()
+		fmt.Println()
+	default:
+		fmt.Printf("--- %s\n+++ %s\n", originalFile, maskedFile)
+		record := 0
+		for _, change := range report.Changes {
+			if change.Record != record {
+				record = change.Record
+				fmt.Printf("@@ record %d @@\n", record)
+			}
+			fmt.Printf("-%s: %s\n", change.Path, change.Original)
+			if change.Masked != "" {
+				fmt.Printf("+%s: %s\n", change.Path, change.Masked)
+			}
+		}
+		fmt.Println()
+	}
+
+	changed := 0
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FIELD\tCHANGED\tKEPT")
+	for _, field := range report.Fields {
+		fmt.Fprintf(table, "%s\t%d\t%d\n", field.Path, field.Changed, field.Values-field.Changed)
+		changed += field.Changed
+	}
+	table.Flush()
+	fmt.Fprintf(os.Stderr, "%d values changed in %d records\n", changed, report.Records)
+}
+
+// exampleMethods are the methods detectors shows examples for by default.
+var exampleMethods = []string{"random", "deterministic", "fpe", "null", "partial:last4", "hash:hex,12"}
+
+// runDetectors lists the types of value masking recognizes, in the order they
+// are tried, with an example masked by every method.
+func runDetectors(args []string) {
+	flags := flag.NewFlagSet("detectors", flag.ExitOnError)
+	locale := flags.String("locale", "en", "Locale of the examples ("+strings.Join(append([]string{"en"}, pkg.Locales()...), ", ")+")")
+	var methods stringSlice
+	flags.Var(&methods, "method", "Method to show examples for, instead of "+strings.Join(exampleMethods, ", ")+" (can be specified multiple times)")
+	flags.Parse(args)
+	if len(methods) == 0 {
+		methods = exampleMethods
+	}
+
+	// Examples use fixed secrets, so those of a real run are never shown.
+	configs := make([]pkg.MaskerConfig, len(methods))
+	for i, method := range methods {
+		config, err := pkg.ParseMethod(method)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitConfig)
+		}
+		config.Salt, config.Key, config.Locale = []byte("unaware-example"), []byte("unaware-examples"), *locale
+		configs[i] = config
+	}
+
+	fmt.Println("Values are faked as the first of these types that recognizes them. Names are")
+	fmt.Println("recognized by their key. Examples use example secrets, and random output differs")
+	fmt.Println("from run to run.")
+	for i, detector := range pkg.Detectors() {
+		example, _ := json.Marshal(detector.Example)
+		fmt.Printf("\n%d. %s: %s\n   fake: %s\n   %s\n", i+1, detector.Type, detector.Recognizes, detector.Generator, example)
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for j, config := range configs {
+			masked, err := pkg.MaskExample(config, detector.Type, detector.Example)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(exitConfig)
+			}
+			output, _ := json.Marshal(masked)
+			fmt.Fprintf(table, "     %s\t-> %s\n", methods[j], output)
+		}
+		table.Flush()
+	}
+}
+
+// runBench masks synthetic input of every format with every method and CPU
+// count, reporting the throughput of each run on stdout.
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	records := flags.Int("records", 10000, "Records, rows or lines of the generated input")
+	fields := flags.Int("fields", 10, "Fields of every record")
+	depth := flags.Int("depth", 0, "Objects or elements the fields of json, ndjson and xml records are nested in")
+	seed := flags.Int64("seed", 1, "Seed of the generated input, which is the same for the same seed")
+	var formats, methods, cpuCounts stringSlice
+	flags.Var(&formats, "format", "Format to measure, instead of json, ndjson, csv, xml and text (can be specified multiple times)")
+	flags.Var(&methods, "method", "Method to measure, instead of random and deterministic (can be specified multiple times)")
+	flags.Var(&cpuCounts, "cpu", "Number of CPU cores to measure with, instead of 1 and all of them (can be specified multiple times)")
+	flags.Parse(args)
+	if len(formats) == 0 {
+		formats = stringSlice{"json", "ndjson", "csv", "xml", "text"}
+	}
+	if len(methods) == 0 {
+		methods = stringSlice{"random", "deterministic"}
+	}
+	if len(cpuCounts) == 0 {
+		cpuCounts = stringSlice{"1"}
+		if runtime.NumCPU() > 1 {
+			cpuCounts = append(cpuCounts, strconv.Itoa(runtime.NumCPU()))
+		}
+	}
+
+	// The output is discarded, so fixed secrets will do.
+	configs := make([]pkg.MaskerConfig, len(methods))
+	for i, method := range methods {
+		config, err := pkg.ParseMethod(method)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitConfig)
+		}
+		config.Salt, config.Key = []byte("unaware-example"), []byte("unaware-examples")
+		configs[i] = config
+	}
+	cpus := make([]int, len(cpuCounts))
+	for i, count := range cpuCounts {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "Error: invalid -cpu %q, expected a positive number.\n", count)
+			os.Exit(exitConfig)
+		}
+		cpus[i] = n
+	}
+
+	shape := pkg.SampleShape{Records: *records, Fields: *fields, Depth: *depth}
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FORMAT\tMETHOD\tCPU\tINPUT\tTIME\tMB/S\tRECORDS/S")
+	for _, format := range formats {
+		var input bytes.Buffer
+		if err := pkg.GenerateSample(&input, format, shape, *seed); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitCode(err))
+		}
+		for i, config := range configs {
+			for _, cpu := range cpus {
+				appConfig := pkg.AppConfig{Format: format, CPUCount: cpu, Masker: config}
+				start := time.Now()
+				if _, err := pkg.Start(bytes.NewReader(input.Bytes()), io.Discard, appConfig); err != nil {
+					fmt.Fprintln(os.Stderr, "Error:", err)
+					os.Exit(exitCode(err))
+				}
+				elapsed := time.Since(start)
+				fmt.Fprintf(table, "%s\t%s\t%d\t%.1f MB\t%s\t%.1f\t%.0f\n", format, methods[i], cpu,
+					float64(input.Len())/1e6, elapsed.Round(time.Millisecond),
+					float64(input.Len())/1e6/elapsed.Seconds(), float64(*records)/elapsed.Seconds())
+			}
+		}
+	}
+	table.Flush()
+}
+
+// readSalt reads the salt from stdin, a file or the environment, in that
+// order of preference. Files and stdin keep the salt out of the process
+// environment, which other users of a host may be able to list; a trailing
+// line break is not part of it. A source named by the policy or flags must
+// provide a salt, since a random salt would silently break consistency with
+// earlier runs. Without any, nil is returned.
+func readSalt(fromStdin bool, file, env string, stdinIsInput bool) ([]byte, error) {
+	var data []byte
+	switch {
+	case fromStdin && file != "":
+		return nil, errors.New("-salt-stdin and -salt-file cannot be used together")
+	case fromStdin && stdinIsInput:
+		return nil, errors.New("-salt-stdin requires -in, since stdin holds the salt")
+	case fromStdin:
+		salt, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read salt from stdin: %w", err)
+		}
+		data = salt
+	case file != "":
+		salt, err := readSecret(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read salt file: %w", err)
+		}
+		data = salt
+	default:
+		name := env
+		if name == "" {
+			name = "STATIC_SALT"
+		}
+		salt := os.Getenv(name)
+		if salt == "" && env != "" {
+			return nil, fmt.Errorf("the config reads its salt from %s, which is not set", env)
+		}
+		if salt == "" {
+			return nil, nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: reading the salt from %s is deprecated, since the environment of a process can be listed; use -salt-file or -salt-stdin.\n", name)
+		return []byte(salt), nil
+	}
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil, errors.New("the salt is empty")
+	}
+	return data, nil
+}
+
+// readKey reads a hex-encoded key from file, a file or secret URI, or else
+// from the environment variable env. It returns nil if neither holds one.
+func readKey(file, env string) ([]byte, error) {
+	data := []byte(os.Getenv(env))
+	name := env
+	if file != "" {
+		var err error
+		if data, err = readSecret(file); err != nil {
+			return nil, fmt.Errorf("cannot read key file: %w", err)
+		}
+		name = file
+	}
+	key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s does not hold a hex-encoded key", name)
 	}
+	return key, nil
 }
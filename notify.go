@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"unaware/pkg"
+)
+
+// Statuses of a run in its summary.
+const (
+	statusSucceeded   = "succeeded"
+	statusPartial     = "partial"
+	statusFailed      = "failed"
+	statusInterrupted = "interrupted"
+)
+
+// runSummary is the report of a batch POSTed to -notify-url when it
+// finishes. Text describes it in one line, so chat webhooks such as those of
+// Slack show it as the message.
+type runSummary struct {
+	Text     string        `json:"text"`
+	Command  string        `json:"command"`
+	Status   string        `json:"status"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Records  int           `json:"records"`
+	Masked   int           `json:"masked"` // Values masking changed, in all files
+	Files    []fileSummary `json:"files"`
+
+	mu sync.Mutex
+}
+
+// fileSummary is the outcome of masking one input of a batch.
+type fileSummary struct {
+	Input  string     `json:"input"`           // Empty for stdin
+	Output string     `json:"output"`          // Empty for stdout
+	Status string     `json:"status"`          // succeeded, failed or interrupted
+	Error  string     `json:"error,omitempty"` // Why masking failed
+	Stats  *pkg.Stats `json:"stats,omitempty"` // Metrics of the run, if it completed
+}
+
+// newRunSummary starts the summary of a batch of command.
+func newRunSummary(command string) *runSummary {
+	return &runSummary{Command: command, Started: time.Now(), Files: []fileSummary{}}
+}
+
+// add records the outcome of masking input to output. It is safe to call from
+// the workers of a batch.
+func (s *runSummary) add(input, output string, stats *pkg.Stats, err error) {
+	file := fileSummary{Input: input, Output: output, Status: statusSucceeded}
+	switch {
+	case errors.Is(err, context.Canceled):
+		file.Status, file.Error = statusInterrupted, err.Error()
+	case err != nil:
+		file.Status, file.Error = statusFailed, err.Error()
+	default:
+		file.Stats = stats
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files = append(s.Files, file)
+	if stats != nil {
+		s.Records += stats.Records
+		s.Masked += stats.MaskedValues()
+	}
+}
+
+// finish completes the summary once every input is masked or failed.
+func (s *runSummary) finish() {
+	s.Duration = time.Since(s.Started)
+	failed, interrupted := 0, false
+	for _, file := range s.Files {
+		if file.Status != statusSucceeded {
+			failed++
+		}
+		interrupted = interrupted || file.Status == statusInterrupted
+	}
+	switch {
+	case interrupted:
+		s.Status = statusInterrupted
+	case failed == 0:
+		s.Status = statusSucceeded
+	case failed < len(s.Files):
+		s.Status = statusPartial
+	default:
+		s.Status = statusFailed
+	}
+	s.Text = fmt.Sprintf("unaware %s %s: %d of %d files masked, %d values in %d records, in %s",
+		s.Command, s.Status, len(s.Files)-failed, len(s.Files), s.Masked, s.Records, s.Duration.Round(time.Millisecond))
+}
+
+// notify POSTs the finished summary to url as JSON. A webhook that does not
+// answer within 10 seconds, or answers with anything but a 2xx status, is an
+// error.
+func notify(url string, summary *runSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot notify %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot notify %s: %w", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("cannot notify %s: %s", url, resp.Status)
+	}
+	return nil
+}
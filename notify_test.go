@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestNotify_Interrupted(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "users.json"), filepath.Join(dir, "masked.json")
+	require.NoError(t, os.WriteFile(input, []byte(`[{"email": "jane@example.com"}]`), 0o644))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, Masker: pkg.MaskerConfig{Method: pkg.MethodNull}}
+
+	summary := newRunSummary("mask")
+	stats, err := maskFile(ctx, appConfig, input, output, false, false, false, false)
+	require.ErrorIs(t, err, context.Canceled)
+	summary.add(input, output, stats, err)
+	summary.add(input+".2", output+".2", &pkg.Stats{Records: 1}, nil)
+	summary.finish()
+	assert.Equal(t, statusInterrupted, summary.Files[0].Status)
+	assert.Contains(t, summary.Files[0].Error, "interrupted before the output was written")
+	assert.Equal(t, statusInterrupted, summary.Status, "An interrupted file interrupts the run")
+	assert.True(t, strings.HasPrefix(summary.Text, "unaware mask interrupted: 1 of 2 files masked"), summary.Text)
+	assert.NoFileExists(t, output)
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	require.NoError(t, notify(server.URL, summary))
+	assert.Equal(t, statusInterrupted, received["status"])
+	assert.Equal(t, summary.Text, received["text"])
+	files := received["files"].([]any)
+	require.Len(t, files, 2)
+	assert.Equal(t, statusInterrupted, files[0].(map[string]any)["status"])
+
+	t.Run("Rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+		assert.ErrorContains(t, notify(server.URL, summary), "500")
+	})
+}
+
+func TestMaskResumable_Interrupted(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "users.ndjson"), filepath.Join(dir, "masked.ndjson")
+	require.NoError(t, os.WriteFile(input, []byte(`{"email": "jane@example.com"}`+"\n"), 0o644))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	appConfig := pkg.AppConfig{Format: "ndjson", CPUCount: 1, Masker: pkg.MaskerConfig{Method: pkg.MethodNull}}
+
+	_, err := maskResumable(ctx, appConfig, input, output, output+".checkpoint", false)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "run the same command to resume")
+}
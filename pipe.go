@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"unaware/pkg"
+)
+
+// runPipe masks line-delimited JSON from stdin to stdout until stdin ends, as
+// the exec filter of a log forwarder, reloading the rules on SIGHUP.
+func runPipe(args []string) {
+	flags := flag.NewFlagSet("pipe", flag.ExitOnError)
+	p := addPolicyFlags(flags)
+	maxLine := flags.Int("max-line", pkg.DefaultMaxLine, "Longest line masked, in bytes; longer lines are dropped and reported on stderr")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintln(out, "Usage: unaware pipe [flags]")
+		fmt.Fprintln(out, "\nEvery line of stdin is masked to stdout as soon as it is read: JSON as a")
+		fmt.Fprintln(out, "record of ndjson is, other lines as text. Send SIGHUP to reload -config and")
+		fmt.Fprintln(out, "the files the flags name; lines keep being masked with the old rules if the")
+		fmt.Fprintln(out, "new ones are invalid.")
+		fmt.Fprintln(out, "\nEXAMPLES:")
+		fmt.Fprintln(out, "  # Mask application logs before Fluent Bit reads them")
+		fmt.Fprintln(out, "  ./app | unaware pipe -config policy.yaml | fluent-bit -i stdin -o forward")
+		fmt.Fprintln(out, "\nFLAGS:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *maxLine < 1 {
+		fmt.Fprintln(os.Stderr, "Error: -max-line must be at least 1.")
+		os.Exit(exitConfig)
+	}
+	engine, err := newPipeEngine(p, flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitConfig)
+	}
+	pipe := pkg.NewPipe(engine)
+	pipe.MaxLine = *maxLine
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			engine, err := newPipeEngine(p, flags)
+			if err == nil {
+				err = pipe.Reload(engine)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error: cannot reload rules, keeping the old ones:", err)
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "Reloaded rules")
+		}
+	}()
+
+	if err := pipe.Run(interruptible(), os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// newPipeEngine returns an engine masking with the rules of the -config
+// file and flags, read from disk again.
+func newPipeEngine(p *policyFlags, flags *flag.FlagSet) (*pkg.Engine, error) {
+	appConfig, err := p.loadConfig(flags, true)
+	if err != nil {
+		return nil, err
+	}
+	appConfig.Format = "ndjson"
+	return pkg.New(pkg.WithConfig(appConfig))
+}
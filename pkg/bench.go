@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// SampleShape describes the synthetic input GenerateSample writes.
+type SampleShape struct {
+	Records int // Records, rows or lines
+	Fields  int // Fields of every record, of the types of sampleFields in turn
+	Depth   int // Objects or elements the fields of JSON and XML records are nested in
+}
+
+// sampleFields are the fields of generated records, covering the types
+// masking recognizes most often in exports.
+var sampleFields = []struct {
+	key   string
+	value func(f *gofakeit.Faker) any
+}{
+	{"name", func(f *gofakeit.Faker) any { return f.Name() }},
+	{"email", func(f *gofakeit.Faker) any { return f.Email() }},
+	{"phone", func(f *gofakeit.Faker) any { return "+1 " + f.PhoneFormatted() }},
+	{"city", func(f *gofakeit.Faker) any { return f.City() }},
+	{"id", func(f *gofakeit.Faker) any { return f.UUID() }},
+	{"amount", func(f *gofakeit.Faker) any { return json.Number(strconv.FormatFloat(f.Price(1, 1000), 'f', 2, 64)) }},
+	{"created_at", func(f *gofakeit.Faker) any { return f.Date().Format("2006-01-02") }},
+	{"ip", func(f *gofakeit.Faker) any { return f.IPv4Address() }},
+	{"note", func(f *gofakeit.Faker) any { return f.Sentence(8) }},
+	{"active", func(f *gofakeit.Faker) any { return f.Bool() }},
+}
+
+// sampleField is a field of a generated record.
+type sampleField struct {
+	key   string
+	value any
+}
+
+// GenerateSample writes synthetic input of format and shape to w, the same
+// for the same seed, for measuring how fast it is masked. Fields after the
+// first ten repeat their types under numbered keys, such as email_2. CSV and
+// text cannot nest, so they ignore the depth of shape.
+func GenerateSample(w io.Writer, format string, shape SampleShape, seed int64) error {
+	if shape.Records < 0 || shape.Fields < 1 || shape.Depth < 0 {
+		return &ConfigError{Err: fmt.Errorf("invalid sample shape of %d records of %d fields at depth %d", shape.Records, shape.Fields, shape.Depth)}
+	}
+	faker := gofakeit.NewUnlocked(seed)
+	keys := make([]string, shape.Fields)
+	for i := range keys {
+		keys[i] = sampleFields[i%len(sampleFields)].key
+		if round := i / len(sampleFields); round > 0 {
+			keys[i] += "_" + strconv.Itoa(round+1)
+		}
+	}
+	record := func() []sampleField {
+		fields := make([]sampleField, shape.Fields)
+		for i := range fields {
+			fields[i] = sampleField{keys[i], sampleFields[i%len(sampleFields)].value(faker)}
+		}
+		return fields
+	}
+
+	buf := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case "json", "ndjson":
+		err = generateJSON(buf, format == "ndjson", shape, record)
+	case "csv":
+		writer := csv.NewWriter(buf)
+		writer.Write(keys)
+		for range shape.Records {
+			fields := record()
+			row := make([]string, len(fields))
+			for i, field := range fields {
+				row[i] = formatValue(field.value)
+			}
+			writer.Write(row)
+		}
+		writer.Flush()
+		err = writer.Error()
+	case "xml":
+		err = generateXML(buf, shape, record)
+	case "text":
+		for range shape.Records {
+			var words []string
+			for _, field := range record() {
+				words = append(words, formatValue(field.value))
+			}
+			fmt.Fprintln(buf, strings.Join(words, " "))
+		}
+	default:
+		return &ConfigError{Err: fmt.Errorf("unsupported format %q", format)}
+	}
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// generateJSON writes the records of a sample as a JSON array, or as NDJSON,
+// nesting their fields in objects named level_1, level_2 and so on.
+func generateJSON(w io.Writer, ndjson bool, shape SampleShape, record func() []sampleField) error {
+	if !ndjson {
+		io.WriteString(w, "[\n")
+	}
+	for i := range shape.Records {
+		var b strings.Builder
+		for depth := range shape.Depth {
+			fmt.Fprintf(&b, `{"level_%d":`, depth+1)
+		}
+		b.WriteByte('{')
+		for j, field := range record() {
+			data, err := json.Marshal(field.value)
+			if err != nil {
+				return err
+			}
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%q:%s", field.key, data)
+		}
+		b.WriteString(strings.Repeat("}", shape.Depth+1))
+		if !ndjson && i < shape.Records-1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+		io.WriteString(w, b.String())
+	}
+	if !ndjson {
+		io.WriteString(w, "]\n")
+	}
+	return nil
+}
+
+// generateXML writes the records of a sample as record elements of a records
+// root, nesting their fields in elements named level_1, level_2 and so on.
+func generateXML(w io.Writer, shape SampleShape, record func() []sampleField) error {
+	encoder := xml.NewEncoder(w)
+	root := xml.StartElement{Name: xml.Name{Local: "records"}}
+	encoder.EncodeToken(root)
+	for range shape.Records {
+		elements := []xml.StartElement{{Name: xml.Name{Local: "record"}}}
+		for depth := range shape.Depth {
+			elements = append(elements, xml.StartElement{Name: xml.Name{Local: "level_" + strconv.Itoa(depth+1)}})
+		}
+		for _, element := range elements {
+			encoder.EncodeToken(element)
+		}
+		for _, field := range record() {
+			if err := encoder.EncodeElement(formatValue(field.value), xml.StartElement{Name: xml.Name{Local: field.key}}); err != nil {
+				return err
+			}
+		}
+		for i := len(elements) - 1; i >= 0; i-- {
+			encoder.EncodeToken(elements[i].End())
+		}
+	}
+	encoder.EncodeToken(root.End())
+	return encoder.Flush()
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// maskCacheSize is the number of deterministically masked values a run
+// keeps, the least recently used of which make room for new ones.
+const maskCacheSize = 1 << 20
+
+// maskCacheShards is the number of parts of a maskCache locked separately, so
+// workers looking up values rarely wait for one another.
+const maskCacheShards = 16
+
+// maskCache is an LRU cache of deterministically masked values, by the cache
+// key of their input, shared by the maskers of a run. A value seen before
+// skips deriving its seed and generating its fake.
+//
+// Keys are kept as two hashes of 64 bits rather than as strings, and entries
+// are linked by their index, so the garbage collector has only the values to
+// scan however many there are.
+type maskCache struct {
+	seed, check maphash.Seed
+	shards      [maskCacheShards]cacheShard
+}
+
+type cacheShard struct {
+	mu         sync.Mutex
+	index      map[uint64]int32 // Entries by the hash of their key
+	entries    []cacheEntry
+	head, tail int32 // The most and least recently used entry
+}
+
+type cacheEntry struct {
+	hash, check uint64
+	value       any
+	prev, next  int32 // Entries used more and less recently, or -1
+}
+
+func newMaskCache() *maskCache {
+	return &maskCache{seed: maphash.MakeSeed(), check: maphash.MakeSeed()}
+}
+
+func (c *maskCache) lookup(key string) (*cacheShard, uint64, uint64) {
+	hash := maphash.String(c.seed, key)
+	return &c.shards[hash%maskCacheShards], hash, maphash.String(c.check, key)
+}
+
+// Get returns the masked value cached for key.
+func (c *maskCache) Get(key string) (any, bool) {
+	s, hash, check := c.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[hash]
+	if !ok || s.entries[i].check != check {
+		return nil, false
+	}
+	s.moveToFront(i)
+	return s.entries[i].value, true
+}
+
+// Set caches the masked value of key, evicting the least recently used value
+// of its shard when it is full.
+func (c *maskCache) Set(key string, value any) {
+	s, hash, check := c.lookup(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.index[hash]; ok {
+		s.entries[i].check, s.entries[i].value = check, value
+		s.moveToFront(i)
+		return
+	}
+	if s.index == nil {
+		s.index = make(map[uint64]int32)
+		s.head, s.tail = -1, -1
+	}
+	var i int32
+	if len(s.entries) < maskCacheSize/maskCacheShards {
+		i = int32(len(s.entries))
+		s.entries = append(s.entries, cacheEntry{prev: -1, next: -1})
+	} else {
+		i = s.tail
+		s.unlink(i)
+		delete(s.index, s.entries[i].hash)
+	}
+	s.entries[i] = cacheEntry{hash: hash, check: check, value: value, prev: -1, next: -1}
+	s.index[hash] = i
+	s.pushFront(i)
+}
+
+func (s *cacheShard) moveToFront(i int32) {
+	if s.head != i {
+		s.unlink(i)
+		s.pushFront(i)
+	}
+}
+
+func (s *cacheShard) unlink(i int32) {
+	e := &s.entries[i]
+	if e.prev >= 0 {
+		s.entries[e.prev].next = e.next
+	} else {
+		s.head = e.next
+	}
+	if e.next >= 0 {
+		s.entries[e.next].prev = e.prev
+	} else {
+		s.tail = e.prev
+	}
+	e.prev, e.next = -1, -1
+}
+
+func (s *cacheShard) pushFront(i int32) {
+	s.entries[i].next = s.head
+	if s.head >= 0 {
+		s.entries[s.head].prev = i
+	}
+	s.head = i
+	if s.tail < 0 {
+		s.tail = i
+	}
+}
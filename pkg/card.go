@@ -0,0 +1,165 @@
+package pkg
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theplant/luhn"
+)
+
+// expiryLayouts are the card expiry formats recognised when masking a card
+// object. Masked expiries are written back in the layout they were read in.
+var expiryLayouts = []string{"2006-01", "2006/01", "01/06", "01/2006", "01-06", "01-2006"}
+
+var (
+	cvvKeyRegex    = regexp.MustCompile(`(?i)^(cvv2?|cvc2?|csc|cid|security_?code|card_?security_?code|card_?code)$`)
+	expiryKeyRegex = regexp.MustCompile(`(?i)exp(iry|iration|ires)?([_-]?date)?$`)
+)
+
+// cardFields holds the map keys of the fields that make up a card object.
+type cardFields struct {
+	number, expiry, cvv string
+}
+
+// findCardFields looks for a Luhn-valid card number next to an expiry and/or
+// CVV field among the direct children of an object.
+func (m *masker) findCardFields(fields map[string]any) (cardFields, bool) {
+	var card cardFields
+	for k, v := range fields {
+		s, ok := leafString(v)
+		if !ok {
+			continue
+		}
+		roles := m.keyRoles(strings.TrimPrefix(k, "-"))
+		switch {
+		case roles&cvvKey != 0:
+			card.cvv = k
+		case roles&expiryKey != 0:
+			card.expiry = k
+		case isCardNumber(s):
+			card.number = k
+		}
+	}
+	return card, card.number != "" && (card.expiry != "" || card.cvv != "")
+}
+
+// isCardNumber reports whether s is a Luhn-valid number of 13 to 19 digits,
+// with or without spaces and dashes. It is asked of every string of every
+// object, so others are turned down at the first character that cannot be
+// part of one.
+func isCardNumber(s string) bool {
+	if len(s) < 13 {
+		return false
+	}
+	digits := make([]byte, 0, 19)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			if len(digits) == 19 {
+				return false
+			}
+			digits = append(digits, c)
+		case c != ' ' && c != '-':
+			return false
+		}
+	}
+	if len(digits) < 13 {
+		return false
+	}
+	num, err := strconv.Atoi(string(digits))
+	return err == nil && luhn.Valid(num)
+}
+
+// maskCardFields generates a coherent replacement for a card object: the card
+// number is masked as usual, the expiry becomes a future date in the original
+// layout and the CVV gets the length required by the masked card's brand. The
+// expiry and CVV are seeded on the original number so they stay stable in
+// deterministic mode. Only fields for which shouldMaskField returns true are
+// replaced; the returned map holds the masked values by field key.
+func (m *masker) maskCardFields(fields map[string]any, card cardFields, shouldMaskField func(k string) bool) map[string]any {
+	masked := make(map[string]any, 3)
+	if m.nullify || m.partial != nil || m.dictionary != nil || m.hash != nil || m.custom != nil || m.wasm != nil {
+		return masked
+	}
+	number, _ := leafString(fields[card.number])
+	maskedNumber := number
+	if shouldMaskField(card.number) {
+		maskedNumber, _ = m.mask(number).(string)
+		masked[card.number] = withLeafString(fields[card.number], maskedNumber)
+	}
+
+	m.seeder.SeedFakerForWord(m.faker, number)
+	if card.expiry != "" && shouldMaskField(card.expiry) {
+		expiry, _ := leafString(fields[card.expiry])
+		for _, layout := range expiryLayouts {
+			if len(layout) != len(expiry) {
+				continue
+			}
+			if _, err := time.Parse(layout, expiry); err == nil {
+				future := Now().AddDate(0, 1+m.faker.Rand.Intn(60), 0)
+				masked[card.expiry] = withLeafString(fields[card.expiry], future.Format(layout))
+				break
+			}
+		}
+	}
+	if card.cvv != "" && shouldMaskField(card.cvv) {
+		length := 3
+		if strings.HasPrefix(maskedNumber, "34") || strings.HasPrefix(maskedNumber, "37") {
+			length = 4 // American Express
+		}
+		masked[card.cvv] = withLeafString(fields[card.cvv], m.faker.Numerify(strings.Repeat("#", length)))
+	}
+	return masked
+}
+
+// leafString returns the string form of a scalar value, unwrapping XML
+// elements that only hold text or a CDATA section.
+func leafString(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case json.Number:
+		return val.String(), true
+	case map[string]any:
+		if len(val) == 1 {
+			if text, ok := val["#text"].(string); ok {
+				return text, true
+			}
+			if text, ok := val["#cdata"].(string); ok {
+				return text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// leafValue returns the scalar of an XML element that only holds text or a
+// CDATA section, and other values as they are.
+func leafValue(v any) any {
+	if _, ok := v.(map[string]any); ok {
+		if s, ok := leafString(v); ok {
+			return s
+		}
+	}
+	return v
+}
+
+// withLeafString replaces the value of a scalar leaf with s, keeping the type
+// and XML text wrapping of the original.
+func withLeafString(v any, s string) any {
+	switch val := v.(type) {
+	case json.Number:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	case map[string]any:
+		if _, ok := val["#cdata"]; ok {
+			return map[string]any{"#cdata": s}
+		}
+		return map[string]any{"#text": s}
+	}
+	return s
+}
@@ -0,0 +1,274 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a masking policy as written in a -config file. The CLI
+// flags set the same fields, so everything a run can do can be kept in a
+// file, with flags overriding or extending it for a single run. Secrets are
+// never part of it: salts and keys come from the environment.
+//
+// A minimal file looks like:
+//
+//	format: csv
+//	method: deterministic
+//	exclude: [country]
+//	rules:
+//	  - pattern: ssn
+//	    method: "null"
+//	  - pattern: phone
+//	    type: phone
+//
+// Named profiles hold variations of the policy for different audiences. A
+// profile is written like the file itself and overrides the keys it sets;
+// lists it sets replace those of the file:
+//
+//	profiles:
+//	  vendor-export:
+//	    method: "null"
+//	    salt_env: VENDOR_SALT
+type Config struct {
+	Format           string         `yaml:"format"`
+	Method           string         `yaml:"method"` // As accepted by the -method flag, e.g. "partial:last4"
+	CPUCount         int            `yaml:"cpu"`
+	MaxMemory        string         `yaml:"max_memory"`    // Bound of the records held, e.g. "512MB"
+	JSONBackend      string         `yaml:"json_backend"`  // Decoder of json and ndjson records, e.g. "jsoniter"
+	BatchSize        int            `yaml:"batch_size"`    // Records masked by a worker at a time
+	MaxTextLine      string         `yaml:"max_text_line"` // Longest line of text masked as a whole, e.g. "16MB"
+	FirstN           int            `yaml:"first"`
+	LastN            int            `yaml:"last"`
+	Range            string         `yaml:"range"` // Records to process, e.g. "100:200"
+	OutputStyle      string         `yaml:"output_style"`
+	Include          []string       `yaml:"include"`
+	Exclude          []string       `yaml:"exclude"`
+	Rules            []Rule         `yaml:"rules"`
+	Presets          []string       `yaml:"presets"` // Built-in rules applied after Rules, such as "pci"
+	Unique           bool           `yaml:"unique"`
+	FieldScoped      bool           `yaml:"field_scoped"`
+	PreserveLength   bool           `yaml:"preserve_length"`
+	PreserveSign     bool           `yaml:"preserve_sign"`
+	Locale           string         `yaml:"locale"`
+	Ranges           []NumericRange `yaml:"ranges"`
+	InferRanges      bool           `yaml:"infer_ranges"`
+	Shuffle          []string       `yaml:"shuffle"`
+	NoHeader         bool           `yaml:"no_header"`
+	Columns          []string       `yaml:"columns"`   // Names of the columns of CSV without a header, in order
+	Delimiter        string         `yaml:"delimiter"` // Of CSV fields, e.g. ";", or "\t" for TSV
+	Quote            string         `yaml:"quote"`     // Of quoted CSV fields, e.g. "'"
+	Comment          string         `yaml:"comment"`   // Starts CSV lines that are skipped, e.g. "#"
+	LazyQuotes       bool           `yaml:"lazy_quotes"`
+	CDATAMarkup      bool           `yaml:"cdata_markup"`
+	OnlyTypes        []string       `yaml:"only_types"`
+	SkipTypes        []string       `yaml:"skip_types"`
+	SafeValues       []string       `yaml:"safe_values"` // Literal values never masked, such as "N/A"
+	KAnonymity       int            `yaml:"k_anonymity"`
+	QuasiIdentifiers []string       `yaml:"quasi_identifiers"`
+	MappingFile      string         `yaml:"mapping_file"`
+	Plugins          []string       `yaml:"plugins"`
+	Decrypt          bool           `yaml:"decrypt"`
+	SaltEnv          string         `yaml:"salt_env"`         // Environment variable holding the salt, STATIC_SALT by default
+	SaltFile         string         `yaml:"salt_file"`        // File or secret URI holding the salt, preferred over SaltEnv
+	FPEKeyFile       string         `yaml:"fpe_key_file"`     // File or secret URI holding the FPE key, preferred over FPE_KEY
+	MappingKeyFile   string         `yaml:"mapping_key_file"` // File or secret URI holding the mapping file key, preferred over MAPPING_KEY
+
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// LoadConfig reads a YAML config file. Unknown keys are reported, so a typo
+// cannot silently leave a field unmasked.
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("error opening config: %w", err)
+	}
+	defer f.Close()
+
+	var config Config
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	for _, name := range config.ProfileNames() {
+		if _, err := config.Profile(name); err != nil {
+			return Config{}, fmt.Errorf("error reading config %s: %w", path, err)
+		}
+	}
+	return config, nil
+}
+
+// ProfileNames returns the names of the profiles in the config, sorted.
+func (c Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Profile returns the policy of the named profile: the config with the keys
+// the profile sets replaced.
+func (c Config) Profile(name string) (Config, error) {
+	node, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return Config{}, fmt.Errorf("unknown profile %q, the config has no profiles", name)
+		}
+		return Config{}, fmt.Errorf("unknown profile %q, expected one of %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading profile %s: %w", name, err)
+	}
+
+	profile := c
+	profile.Profiles = nil
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&profile); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("error reading profile %s: %w", name, err)
+	}
+	if profile.Profiles != nil {
+		return Config{}, fmt.Errorf("profile %s cannot hold profiles itself", name)
+	}
+	return profile, nil
+}
+
+// AppConfig converts the policy into the configuration of a masking run. The
+// format defaults to json and the method to random. Secrets for the methods in
+// use must be set on the result separately.
+func (c Config) AppConfig() (AppConfig, error) {
+	format := c.Format
+	if format == "" {
+		format = "json"
+	}
+	method := c.Method
+	if method == "" {
+		method = string(MethodRandom)
+	}
+	masker, err := ParseMethod(method)
+	if err != nil {
+		return AppConfig{}, err
+	}
+	masker.PreserveLength = c.PreserveLength
+	masker.PreserveSign = c.PreserveSign
+	masker.FieldScoped = c.FieldScoped
+	masker.Locale = c.Locale
+	masker.Decrypt = c.Decrypt
+
+	rules := c.Rules
+	for _, name := range c.Presets {
+		preset, err := PresetRules(name)
+		if err != nil {
+			return AppConfig{}, err
+		}
+		rules = append(slices.Clone(rules), preset...)
+	}
+
+	if len(c.Shuffle) > 0 && format != "csv" {
+		return AppConfig{}, errors.New("shuffle requires the csv format")
+	}
+	if c.NoHeader && format != "csv" {
+		return AppConfig{}, errors.New("no_header requires the csv format")
+	}
+	if len(c.Columns) > 0 && !c.NoHeader {
+		return AppConfig{}, errors.New("columns requires no_header")
+	}
+	if (c.Delimiter != "" || c.Quote != "" || c.Comment != "" || c.LazyQuotes) && format != "csv" {
+		return AppConfig{}, errors.New("delimiter, quote, comment and lazy_quotes require the csv format")
+	}
+	dialect := CSVDialect{LazyQuotes: c.LazyQuotes}
+	for _, char := range []struct {
+		name, text string
+		value      *rune
+	}{{"delimiter", c.Delimiter, &dialect.Delimiter}, {"quote", c.Quote, &dialect.Quote}, {"comment", c.Comment, &dialect.Comment}} {
+		var err error
+		if *char.value, err = parseCSVChar(char.text, char.name); err != nil {
+			return AppConfig{}, err
+		}
+	}
+	if c.CDATAMarkup && format != "xml" {
+		return AppConfig{}, errors.New("cdata_markup requires the xml format")
+	}
+	if c.KAnonymity > 0 && (format != "csv" || len(c.QuasiIdentifiers) == 0) {
+		return AppConfig{}, errors.New("k-anonymity requires the csv format and at least one quasi-identifier")
+	}
+	var records RecordRange
+	if c.Range != "" {
+		var err error
+		if records, err = ParseRecordRange(c.Range); err != nil {
+			return AppConfig{}, err
+		}
+	}
+	var maxMemory int64
+	if c.MaxMemory != "" {
+		var err error
+		if maxMemory, err = ParseByteSize(c.MaxMemory); err != nil {
+			return AppConfig{}, err
+		}
+	}
+
+	var maxTextLine int64
+	if c.MaxTextLine != "" {
+		var err error
+		if maxTextLine, err = ParseByteSize(c.MaxTextLine); err != nil {
+			return AppConfig{}, err
+		}
+	}
+
+	return AppConfig{
+		Format:      format,
+		CPUCount:    c.CPUCount,
+		MaxMemory:   maxMemory,
+		JSONBackend: c.JSONBackend,
+		BatchSize:   c.BatchSize,
+		MaxTextLine: int(maxTextLine),
+		Include:     c.Include,
+		Exclude:     c.Exclude,
+		FirstN:      c.FirstN,
+		LastN:       c.LastN,
+		Range:       records,
+		OutputStyle: c.OutputStyle,
+		Rules:       rules,
+		Unique:      c.Unique,
+		MappingFile: c.MappingFile,
+		Masker:      masker,
+		KAnonymity: KAnonymityConfig{
+			K:                c.KAnonymity,
+			QuasiIdentifiers: c.QuasiIdentifiers,
+		},
+		Shuffle:     c.Shuffle,
+		NoHeader:    c.NoHeader,
+		Columns:     c.Columns,
+		CSV:         dialect,
+		CDATAMarkup: c.CDATAMarkup,
+		OnlyTypes:   c.OnlyTypes,
+		SkipTypes:   c.SkipTypes,
+		SafeValues:  c.SafeValues,
+		Ranges:      c.Ranges,
+		InferRanges: c.InferRanges,
+	}, nil
+}
+
+// Methods returns the masking methods the policy uses, globally and for
+// rules, so the secrets they need can be provided. Invalid methods are left
+// out; they are reported by AppConfig and Start.
+func (c *AppConfig) Methods() []MaskingMethod {
+	methods := []MaskingMethod{c.Masker.Method}
+	for _, rule := range c.Rules {
+		if config, err := ParseMethod(rule.Method); err == nil && rule.Method != "" {
+			methods = append(methods, config.Method)
+		}
+	}
+	return methods
+}
@@ -1,10 +1,17 @@
 package pkg
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
 	"sync"
+	"unicode/utf8"
 )
 
 type csvProcessor struct {
@@ -14,88 +21,519 @@ type csvProcessor struct {
 
 func newCSVProcessor(config AppConfig) *csvProcessor {
 	return &csvProcessor{
-		config: config,
-		methodFactory: func() *masker {
-			return newMasker(config.Masker)
-		},
+		config:        config,
+		methodFactory: maskerFactory(config.Masker),
 	}
 }
 
-func (p *csvProcessor) Process(r io.Reader, w io.Writer) error {
-	csvReader := csv.NewReader(r)
-
-	header, err := csvReader.Read()
+func (p *csvProcessor) Process(ctx context.Context, r io.Reader, w io.Writer) error {
+	rows := newCSVRows(r, p.config.CSV)
+	headerRow, err := rows.read()
 	if err == io.EOF {
 		return nil // Handle empty file
 	}
 	if err != nil {
-		return fmt.Errorf("error reading CSV header: %w", err)
+		located := csvError(err, 0)
+		located.Err = fmt.Errorf("error reading CSV header: %w", located.Err)
+		return located
+	}
+	header := headerRow.fields
+	// Without a header the first row is data, and columns are addressed by
+	// the names given for them, or by their position.
+	var first *csvRow
+	if p.config.NoHeader {
+		if len(p.config.Columns) > len(header) {
+			return fmt.Errorf("%d columns are named, but the CSV rows have %d", len(p.config.Columns), len(header))
+		}
+		first, header = &headerRow, columnKeys(len(header))
+		copy(header, p.config.Columns)
+		named := make(map[string]bool, len(header))
+		for _, column := range header {
+			if named[column] {
+				return fmt.Errorf("column %q is named twice", column)
+			}
+			named[column] = true
+		}
+	}
+	read := 0 // Rows read, after the header
+
+	for _, qi := range p.config.KAnonymity.QuasiIdentifiers {
+		if indexOf(header, qi) < 0 {
+			return fmt.Errorf("quasi-identifier %q is not a column of the CSV header", qi)
+		}
+	}
+	shuffle := &columnShuffle{}
+	if faker := p.config.Masker.faker; faker != nil {
+		shuffle.perm = faker.Rand.Perm
+	}
+	for _, column := range p.config.Shuffle {
+		index := indexOf(header, column)
+		if index < 0 {
+			return fmt.Errorf("shuffled column %q is not a column of the CSV header", column)
+		}
+		shuffle.columns = append(shuffle.columns, index)
 	}
 
 	// chunkReader reads one CSV row at a time and converts it into a map.
 	// This map is the "chunk" our concurrent runner will process, providing the
-	// necessary key (column name) for filtering and masking.
-	rowCount := 0
-	chunkReader := func() (any, error) {
-		if p.config.FirstN > 0 && rowCount >= p.config.FirstN {
-			return nil, io.EOF
+	// necessary key (column name) for filtering and masking. The layout of
+	// the row is kept until it is written, unless records are streamed.
+	var layouts *csvLayouts
+	if p.config.emit == nil {
+		layouts = &csvLayouts{}
+	}
+	readRow := selectRecords(&p.config, func() (csvRow, error) {
+		if row := first; row != nil {
+			first = nil
+			read++
+			return *row, nil
+		}
+		row, err := rows.read()
+		if err != nil && err != io.EOF { // Let the runner handle io.EOF
+			return csvRow{}, csvError(err, read+1)
 		}
-		record, err := csvReader.Read()
+		read++
+		return row, err
+	})
+	chunkReader := func() (any, error) {
+		row, err := readRow()
 		if err != nil {
-			return nil, err // Let the runner handle io.EOF
+			return nil, err
+		}
+		if layouts != nil {
+			layouts.add(row.layout)
 		}
-		rowCount++
+		record := row.fields
+		// Shuffled columns keep their real values, so they bypass masking.
+		shuffle.collect(record)
 		rowMap := make(map[string]any, len(header))
 		for i, value := range record {
-			if i < len(header) {
+			if i < len(header) && !slices.Contains(shuffle.columns, i) {
 				rowMap[header[i]] = value
 			}
 		}
 		return rowMap, nil
 	}
 
-	assembler := &csvAssembler{
-		header: header,
-		writer: csv.NewWriter(w),
+	csvAssembler := &csvAssembler{
+		header:       header,
+		headerLayout: headerRow.layout,
+		noHeader:     p.config.NoHeader,
+		layouts:      layouts,
+		writer:       p.config.CSV.newWriter(w),
+	}
+	var postProcessors []csvPostProcessor
+	if len(shuffle.columns) > 0 {
+		postProcessors = append(postProcessors, shuffle.apply)
+	}
+	if p.config.KAnonymity.K > 0 {
+		postProcessors = append(postProcessors, kAnonymize(p.config.KAnonymity, p.config.Report))
+	}
+	var a Assembler = csvAssembler
+	if len(postProcessors) > 0 {
+		a = &bufferedCSVAssembler{csvAssembler: csvAssembler, postProcessors: postProcessors}
+	}
+	runner := newRunner(p.methodFactory, p.config)
+
+	return runner.Run(ctx, w, chunkReader, a)
+}
+
+// csvRow is a row of CSV input, along with its layout.
+type csvRow struct {
+	fields []string
+	layout csvLayout
+}
+
+// csvLayout is how a row was written in the input, so its masked fields are
+// written the same way.
+type csvLayout struct {
+	quoted []bool // By field, whether it was quoted; nil if none were
+	crlf   bool   // Whether it ended in \r\n rather than \n
+	open   bool   // Whether it ended the input without a line ending
+}
+
+// csvLayouts holds the layouts of the rows read, in order, until they are
+// written.
+type csvLayouts struct {
+	mu      sync.Mutex
+	layouts []csvLayout
+}
+
+func (l *csvLayouts) add(layout csvLayout) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.layouts = append(l.layouts, layout)
+}
+
+// take returns the layout of the next row written.
+func (l *csvLayouts) take() csvLayout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	layout := l.layouts[0]
+	l.layouts = l.layouts[1:]
+	return layout
+}
+
+// csvBufferSize is the size of the buffer input that is not mapped is read
+// into, which grows to hold longer rows.
+const csvBufferSize = 64 << 10
+
+// Results of parsing the row the input starts with.
+const (
+	rowParsed     = iota
+	rowIncomplete // The row may go on past the input read so far
+	rowRejected   // A csv.Reader rejects the row
+)
+
+// csvRows reads the rows of CSV input as a csv.Reader does, but along with
+// their layout, and with the line endings in quoted fields as they were.
+// Mapped input is parsed out of the mapping without copying it first, and
+// other input out of a buffer that is filled as rows need. A row that a
+// csv.Reader rejects is read by one from where it starts, so the error is
+// located as it would be.
+type csvRows struct {
+	r         io.Reader
+	input     *MappedInput // Of mapped input, whose data is the mapping
+	data      []byte       // The input read and not dropped yet
+	eof       bool         // Whether data holds the end of the input
+	dialect   CSVDialect
+	delimiter []byte
+	comment   []byte
+	offset    int // In data of the next row
+	lines     int // Before offset
+	fields    int // Of every row, as the first one has
+	buf       []byte
+	ends      []int  // In buf of the fields of the row
+	quoted    []bool // By field of the row
+	crlf      bool
+	open      bool
+	reader    *bufio.Reader
+	rest      bytes.Reader
+}
+
+func newCSVRows(r io.Reader, dialect CSVDialect) *csvRows {
+	cr := &csvRows{r: r, dialect: dialect, delimiter: utf8.AppendRune(nil, dialect.delimiter())}
+	if dialect.Comment != 0 {
+		cr.comment = utf8.AppendRune(nil, dialect.Comment)
+	}
+	if mapped, ok := r.(*MappedInput); ok {
+		cr.input, cr.data, cr.eof = mapped, mapped.rest(), true
+	}
+	return cr
+}
+
+func (cr *csvRows) read() (csvRow, error) {
+	for {
+		data := cr.data[cr.offset:]
+		if len(data) == 0 && cr.eof {
+			return csvRow{}, io.EOF
+		}
+		n, result := 0, rowIncomplete
+		switch {
+		case len(data) < len(cr.comment) && !cr.eof:
+			// Whether the line is a comment is not told yet.
+		case cr.comment != nil && bytes.HasPrefix(data, cr.comment):
+			// A comment line is skipped as an empty one.
+			cr.ends = cr.ends[:0]
+			if j := bytes.IndexByte(data, '\n'); j >= 0 {
+				n, result = j+1, rowParsed
+			} else if cr.eof {
+				n, result = len(data), rowParsed
+			}
+		default:
+			n, result = cr.parse(data)
+		}
+
+		switch result {
+		case rowIncomplete:
+			if err := cr.fill(); err != nil {
+				return csvRow{}, err
+			}
+			continue
+		case rowRejected:
+			return cr.readRejected()
+		}
+		line := cr.lines + 1
+		cr.advance(n)
+		if len(cr.ends) == 0 {
+			continue // Empty lines are skipped
+		}
+		row := csvRow{fields: cr.record(), layout: csvLayout{crlf: cr.crlf, open: cr.open}}
+		if slices.Contains(cr.quoted, true) {
+			row.layout.quoted = slices.Clone(cr.quoted)
+		}
+		if cr.fields == 0 {
+			cr.fields = len(row.fields)
+		} else if len(row.fields) != cr.fields {
+			return row, &csv.ParseError{StartLine: line, Line: line, Column: 1, Err: csv.ErrFieldCount}
+		}
+		return row, nil
+	}
+}
+
+// fill reads more of the input, dropping that before the offset.
+func (cr *csvRows) fill() error {
+	n := copy(cr.data, cr.data[cr.offset:])
+	cr.data, cr.offset = cr.data[:n], 0
+	if n == cap(cr.data) {
+		cr.data = slices.Grow(cr.data, max(n, csvBufferSize))
+	}
+	m, err := cr.r.Read(cr.data[n:cap(cr.data)])
+	cr.data = cr.data[:n+m]
+	if err == io.EOF {
+		cr.eof = true
+		return nil
 	}
-	runner := newConcurrentRunner(p.methodFactory, p.config)
+	return err
+}
+
+// parse splits the row data starts with into its fields, and returns the
+// length of the row and its line ending. An empty line has no fields.
+func (cr *csvRows) parse(data []byte) (n int, result int) {
+	cr.buf, cr.ends, cr.quoted = cr.buf[:0], cr.ends[:0], cr.quoted[:0]
+	cr.crlf, cr.open = false, false
+	quote, lazy := byte(cr.dialect.quote()), cr.dialect.LazyQuotes
+	// What follows a closing quote is only told with enough input.
+	lookahead := max(2, len(cr.delimiter))
+	i, eol := 0, -1 // eol is the index of the end of the line at i, once found
+fields:
+	for {
+		if i < len(data) && data[i] == quote {
+			for i++; ; {
+				j := bytes.IndexByte(data[i:], quote)
+				if j < 0 {
+					switch {
+					case !cr.eof:
+						return 0, rowIncomplete
+					case !lazy:
+						return 0, rowRejected
+					}
+					// A lazily quoted field can run to the end of the input.
+					cr.buf = append(cr.buf, data[i:]...)
+					cr.endField(true)
+					cr.open = true
+					return len(data), rowParsed
+				}
+				cr.buf = append(cr.buf, data[i:i+j]...)
+				i += j + 1
+				rest := data[i:]
+				if len(rest) < lookahead && !cr.eof {
+					return 0, rowIncomplete
+				}
+				switch {
+				case len(rest) > 0 && rest[0] == quote:
+					cr.buf = append(cr.buf, quote) // An escaped quote
+					i++
+					continue
+				case bytes.HasPrefix(rest, cr.delimiter):
+					cr.endField(true)
+					i += len(cr.delimiter)
+					continue fields
+				case len(rest) == 0:
+					cr.endField(true)
+					cr.open = true
+					return i, rowParsed
+				case rest[0] == '\n':
+					cr.endField(true)
+					return i + 1, rowParsed
+				case rest[0] == '\r' && len(rest) == 1:
+					// A csv.Reader drops \r at the end of the input.
+					cr.endField(true)
+					cr.open = true
+					return i + 1, rowParsed
+				case rest[0] == '\r' && rest[1] == '\n':
+					cr.endField(true)
+					cr.crlf = true
+					return i + 2, rowParsed
+				case lazy:
+					cr.buf = append(cr.buf, quote)
+					continue
+				}
+				return 0, rowRejected
+			}
+		}
 
-	return runner.Run(w, chunkReader, assembler)
+		if eol < i {
+			eol = len(data)
+			if j := bytes.IndexByte(data[i:], '\n'); j >= 0 {
+				eol = i + j
+			} else if !cr.eof {
+				return 0, rowIncomplete
+			}
+		}
+		line := data[i:eol]
+		field := line
+		j := bytes.Index(line, cr.delimiter)
+		if j >= 0 {
+			field = line[:j]
+		} else if field, cr.crlf = bytes.CutSuffix(line, []byte{'\r'}); eol == len(data) {
+			cr.crlf, cr.open = false, true
+		}
+		if !lazy && bytes.IndexByte(field, quote) >= 0 {
+			return 0, rowRejected
+		}
+		if j >= 0 {
+			cr.buf = append(cr.buf, field...)
+			cr.endField(false)
+			i += j + len(cr.delimiter)
+			continue
+		}
+		n = min(eol+1, len(data))
+		if len(field) == 0 && len(cr.ends) == 0 {
+			return n, rowParsed
+		}
+		cr.buf = append(cr.buf, field...)
+		cr.endField(false)
+		return n, rowParsed
+	}
+}
+
+func (cr *csvRows) endField(quoted bool) {
+	cr.ends = append(cr.ends, len(cr.buf))
+	cr.quoted = append(cr.quoted, quoted)
+}
+
+// record returns the fields parsed, cut out of a single string as those of
+// a csv.Reader are.
+func (cr *csvRows) record() []string {
+	s := string(cr.buf)
+	record := make([]string, len(cr.ends))
+	start := 0
+	for i, end := range cr.ends {
+		record[i], start = s[start:end], end
+	}
+	return record
+}
+
+// readRejected reads the row at the offset with a csv.Reader, for its error.
+// It is found in the input read, as the input up to it was parsed.
+func (cr *csvRows) readRejected() (csvRow, error) {
+	cr.rest.Reset(cr.data[cr.offset:])
+	if cr.reader == nil {
+		cr.reader = bufio.NewReader(&cr.rest)
+	}
+	cr.reader.Reset(&cr.rest)
+	reader := cr.dialect.newReader(cr.reader)
+	reader.FieldsPerRecord = cr.fields
+	record, err := reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		parseErr.StartLine += cr.lines
+		parseErr.Line += cr.lines
+	}
+	if err == nil && cr.fields == 0 {
+		cr.fields = len(record)
+	}
+	cr.advance(int(reader.InputOffset()))
+	return csvRow{fields: record}, err
+}
+
+// advance moves the offset n bytes on.
+func (cr *csvRows) advance(n int) {
+	cr.lines += bytes.Count(cr.data[cr.offset:cr.offset+n], []byte{'\n'})
+	cr.offset += n
+	if cr.input != nil {
+		cr.input.advance(n)
+	}
+}
+
+// columnKeys returns the keys of the columns of a CSV file without a header:
+// col:1, col:2 and so on.
+func columnKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "col:" + strconv.Itoa(i+1)
+	}
+	return keys
 }
 
 type csvAssembler struct {
-	header []string
-	writer *csv.Writer
+	header       []string
+	headerLayout csvLayout
+	noHeader     bool        // The header is not part of the input, so it is not written
+	layouts      *csvLayouts // Of the rows, in the order they are written
+	writer       *csvWriter
 	// A mutex is needed because multiple workers will call WriteItem concurrently.
 	mu sync.Mutex
 }
 
 func (a *csvAssembler) WriteStart(w io.Writer) error {
-	return a.writer.Write(a.header)
+	if a.noHeader {
+		return nil
+	}
+	return a.writer.Write(a.header, a.headerLayout)
 }
 
 func (a *csvAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	record, err := a.toRecord(item)
+	if err != nil {
+		return err
+	}
+	return a.writer.Write(record, a.layouts.take())
+}
+
+// toRecord converts a row map back into a slice of strings in header order.
+func (a *csvAssembler) toRecord(item any) ([]string, error) {
 	rowMap, ok := item.(map[string]any)
 	if !ok {
-		return fmt.Errorf("csv assembler expected map[string]any, but got %T", item)
+		return nil, fmt.Errorf("csv assembler expected map[string]any, but got %T", item)
 	}
-
-	// Convert the map back into a slice of strings in the correct order.
 	record := make([]string, len(a.header))
 	for i, key := range a.header {
 		if val, ok := rowMap[key]; ok {
-			record[i] = fmt.Sprintf("%v", val)
+			record[i] = formatValue(val)
 		}
 	}
-
-	return a.writer.Write(record)
+	return record, nil
 }
 
 func (a *csvAssembler) WriteEnd(w io.Writer) error {
-	// The csv.Writer must be flushed to ensure all buffered data is written.
+	// The writer must be flushed to ensure all buffered data is written.
 	a.writer.Flush()
 	return a.writer.Error()
 }
+
+// csvPostProcessor modifies the masked records of a whole CSV file in place.
+type csvPostProcessor func(header []string, records [][]string) error
+
+// bufferedCSVAssembler collects all masked rows, for post-processing that
+// needs to see the whole data set, and writes them once the input is
+// exhausted.
+type bufferedCSVAssembler struct {
+	*csvAssembler
+	postProcessors []csvPostProcessor
+	records        [][]string
+	layouts        []csvLayout
+}
+
+func (a *bufferedCSVAssembler) WriteStart(w io.Writer) error {
+	return nil
+}
+
+func (a *bufferedCSVAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
+	record, err := a.toRecord(item)
+	if err != nil {
+		return err
+	}
+	a.records = append(a.records, record)
+	a.layouts = append(a.layouts, a.csvAssembler.layouts.take())
+	return nil
+}
+
+func (a *bufferedCSVAssembler) WriteEnd(w io.Writer) error {
+	for _, process := range a.postProcessors {
+		if err := process(a.header, a.records); err != nil {
+			return err
+		}
+	}
+	if err := a.csvAssembler.WriteStart(w); err != nil {
+		return err
+	}
+	if err := a.writer.WriteAll(a.records, a.layouts); err != nil {
+		return err
+	}
+	return a.writer.Error()
+}
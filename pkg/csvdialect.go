@@ -0,0 +1,237 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVDialect describes how the fields of CSV input are separated and quoted.
+// The output is written in the same dialect. The zero value is that of RFC
+// 4180: fields separated by commas and quoted with double quotes, without
+// comments.
+type CSVDialect struct {
+	Delimiter  rune `json:"delimiter"`   // Separates the fields of a row; ',' if 0
+	Quote      rune `json:"quote"`       // Quotes fields, an ASCII character; '"' if 0
+	Comment    rune `json:"comment"`     // Starts lines that are skipped, none if 0
+	LazyQuotes bool `json:"lazy_quotes"` // Quotes may appear in unquoted fields, and undoubled in quoted ones
+}
+
+func (d CSVDialect) delimiter() rune {
+	if d.Delimiter == 0 {
+		return ','
+	}
+	return d.Delimiter
+}
+
+func (d CSVDialect) quote() rune {
+	if d.Quote == 0 {
+		return '"'
+	}
+	return d.Quote
+}
+
+func (d CSVDialect) validate() error {
+	delimiter, quote := d.delimiter(), d.quote()
+	if !validCSVChar(delimiter) {
+		return fmt.Errorf("invalid CSV delimiter %q", delimiter)
+	}
+	if !validCSVChar(quote) || quote >= utf8.RuneSelf {
+		return fmt.Errorf("invalid CSV quote %q, expected an ASCII character", quote)
+	}
+	if quote == delimiter {
+		return fmt.Errorf("the CSV quote %q cannot be the delimiter", quote)
+	}
+	if d.Comment != 0 && (!validCSVChar(d.Comment) || d.Comment == delimiter || d.Comment == quote) {
+		return fmt.Errorf("invalid CSV comment %q, expected a character other than the delimiter and quote", d.Comment)
+	}
+	return nil
+}
+
+func validCSVChar(r rune) bool {
+	return r != 0 && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// parseCSVChar parses a delimiter, quote or comment as written in a config
+// file or flag: the character itself, or \t or tab for a tab.
+func parseCSVChar(s, name string) (rune, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) {
+		return 0, fmt.Errorf("invalid %s %q, expected a single character", name, s)
+	}
+	return r, nil
+}
+
+// csvReader reads CSV of a dialect with a csv.Reader, which only quotes with
+// double quotes: the quote of the dialect and double quotes are swapped in
+// the input, and back in the fields and errors read.
+type csvReader struct {
+	*csv.Reader
+	swap quoteSwap
+}
+
+func (d CSVDialect) newReader(r io.Reader) *csvReader {
+	swap := quoteSwap(0)
+	if quote := d.quote(); quote != '"' {
+		swap = quoteSwap(quote)
+		r = &swapReader{r: r, swap: swap}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma, reader.Comment, reader.LazyQuotes = swap.rune(d.delimiter()), swap.rune(d.Comment), d.LazyQuotes
+	return &csvReader{Reader: reader, swap: swap}
+}
+
+func (r *csvReader) Read() ([]string, error) {
+	record, err := r.Reader.Read()
+	if r.swap == 0 {
+		return record, err
+	}
+	for i, field := range record {
+		record[i] = r.swap.string(field)
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) && (errors.Is(parseErr.Err, csv.ErrQuote) || errors.Is(parseErr.Err, csv.ErrBareQuote)) {
+		parseErr.Err = &quoteError{err: parseErr.Err, quote: rune(r.swap)}
+	}
+	return record, err
+}
+
+// quoteSwap is the quote swapped with double quotes, or 0 for none.
+type quoteSwap byte
+
+func (s quoteSwap) rune(r rune) rune {
+	switch {
+	case s == 0:
+		return r
+	case r == rune(s):
+		return '"'
+	case r == '"':
+		return rune(s)
+	}
+	return r
+}
+
+func (s quoteSwap) string(field string) string {
+	if !strings.ContainsAny(field, string([]byte{byte(s), '"'})) {
+		return field
+	}
+	return strings.Map(s.rune, field)
+}
+
+// swapReader swaps the quotes of what is read from r.
+type swapReader struct {
+	r    io.Reader
+	swap quoteSwap
+}
+
+func (sr *swapReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	for i, c := range p[:n] {
+		if c == byte(sr.swap) || c == '"' {
+			p[i] = byte(sr.swap.rune(rune(c)))
+		}
+	}
+	return n, err
+}
+
+// quoteError is an error of a csv.Reader about quotes, told with the quote
+// of the dialect it read.
+type quoteError struct {
+	err   error
+	quote rune
+}
+
+func (e *quoteError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), `"`, string(e.quote))
+}
+
+func (e *quoteError) Unwrap() error { return e.err }
+
+// csvWriter writes rows in a dialect and the layout they were read in. Fields
+// the input quoted are quoted, and others only when they have to be: when they
+// hold the delimiter, a quote or a line ending, or when the row would be read
+// as another, such as a comment or an empty line.
+type csvWriter struct {
+	w                         *bufio.Writer
+	delimiter, quote, comment rune
+}
+
+func (d CSVDialect) newWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: bufio.NewWriter(w), delimiter: d.delimiter(), quote: d.quote(), comment: d.Comment}
+}
+
+func (w *csvWriter) Write(record []string, layout csvLayout) error {
+	for i, field := range record {
+		if i > 0 {
+			w.w.WriteRune(w.delimiter)
+		}
+		if !(i < len(layout.quoted) && layout.quoted[i]) && !w.needsQuotes(record, i) {
+			w.w.WriteString(field)
+			continue
+		}
+		w.w.WriteByte(byte(w.quote))
+		for {
+			j := strings.IndexByte(field, byte(w.quote))
+			if j < 0 {
+				break
+			}
+			// A quote in a quoted field is doubled.
+			w.w.WriteString(field[:j+1])
+			w.w.WriteByte(byte(w.quote))
+			field = field[j+1:]
+		}
+		w.w.WriteString(field)
+		w.w.WriteByte(byte(w.quote))
+	}
+	switch {
+	case layout.open:
+	case layout.crlf:
+		w.w.WriteString("\r\n")
+	default:
+		w.w.WriteByte('\n')
+	}
+	return w.Error()
+}
+
+// needsQuotes reports whether the field at index i of record has to be quoted.
+func (w *csvWriter) needsQuotes(record []string, i int) bool {
+	field := record[i]
+	switch {
+	case strings.ContainsRune(field, w.delimiter) || strings.ContainsAny(field, string([]rune{w.quote, '\r', '\n'})):
+		return true
+	case i == 0 && w.comment != 0:
+		if r, _ := utf8.DecodeRuneInString(field); r == w.comment {
+			return true
+		}
+	}
+	// A row of one empty field would be read as an empty line, and skipped.
+	return len(record) == 1 && field == ""
+}
+
+// WriteAll writes the records in their layouts and flushes them.
+func (w *csvWriter) WriteAll(records [][]string, layouts []csvLayout) error {
+	for i, record := range records {
+		if err := w.Write(record, layouts[i]); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+func (w *csvWriter) Flush() { w.w.Flush() }
+
+// Error returns the error of a Write or Flush before.
+func (w *csvWriter) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// MaskFunc masks a single value for a custom masking method. Values are
+// strings, json.Numbers or booleans; the result replaces the value as is. The
+// faker is seeded on the value whenever a salt is set, so fakes drawn from it
+// are consistent across records, as with the deterministic method.
+type MaskFunc func(value any, faker *gofakeit.Faker) any
+
+var (
+	customMaskersMu sync.RWMutex
+	customMaskers   = make(map[string]MaskFunc)
+)
+
+// RegisterMasker adds a masking method that can be selected by name with
+// -method and -field-method, e.g. for organization-specific employee ids or
+// ticket numbers. Plugins loaded with LoadPlugin call it from their init
+// functions. Names of built-in methods cannot be registered, and a name can
+// only be registered once.
+func RegisterMasker(name string, fn MaskFunc) error {
+	if name == "" || fn == nil {
+		return errors.New("masker needs a name and a function")
+	}
+	switch MaskingMethod(name) {
+	case MethodRandom, MethodDeterministic, MethodFPE, MethodNull, MethodPartial, MethodDictionary, MethodHash, MethodWasm:
+		return fmt.Errorf("cannot register masker %q: it is a built-in method", name)
+	}
+	customMaskersMu.Lock()
+	defer customMaskersMu.Unlock()
+	if _, ok := customMaskers[name]; ok {
+		return fmt.Errorf("masker %q is already registered", name)
+	}
+	customMaskers[name] = fn
+	return nil
+}
+
+func lookupMasker(name string) (MaskFunc, bool) {
+	customMaskersMu.RLock()
+	defer customMaskersMu.RUnlock()
+	fn, ok := customMaskers[name]
+	return fn, ok
+}
+
+// maskCustom masks a value with a registered masker.
+func (m *masker) maskCustom(value any) any {
+	m.seeder.SeedFaker(m.faker, value)
+	return m.custom(value, m.faker)
+}
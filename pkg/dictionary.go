@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dictionary holds user-approved replacement values for the dictionary
+// method. Values found in Mappings are replaced by their mapped fake; all
+// other values are replaced by one of Values.
+type Dictionary struct {
+	Mappings map[string]string
+	Values   []string
+}
+
+// LoadDictionary reads a dictionary file. Files with a .csv extension hold
+// original,fake pairs without a header row; the fakes also serve as the
+// replacements for values that are not mapped. Any other file holds one
+// replacement value per line.
+func LoadDictionary(path string) (*Dictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dictionary: %w", err)
+	}
+	defer f.Close()
+
+	var d *Dictionary
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		d, err = readDictionaryMappings(f)
+	} else {
+		d, err = readDictionaryValues(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading dictionary %s: %w", path, err)
+	}
+	if len(d.Values) == 0 {
+		return nil, fmt.Errorf("dictionary %s holds no values", path)
+	}
+	return d, nil
+}
+
+func readDictionaryMappings(r io.Reader) (*Dictionary, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	d := &Dictionary{Mappings: make(map[string]string)}
+	seen := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return d, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.Mappings[record[0]] = record[1]
+		if !seen[record[1]] {
+			seen[record[1]] = true
+			d.Values = append(d.Values, record[1])
+		}
+	}
+}
+
+func readDictionaryValues(r io.Reader) (*Dictionary, error) {
+	d := &Dictionary{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if value := strings.TrimSpace(scanner.Text()); value != "" {
+			d.Values = append(d.Values, value)
+		}
+	}
+	return d, scanner.Err()
+}
+
+// replaceFromDictionary returns the replacement for a string or number.
+// Unmapped values pick a replacement seeded on the original value, so with a
+// salt identical values get identical replacements. Booleans cannot be
+// substituted and are returned unchanged.
+func (m *masker) replaceFromDictionary(value any) any {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return value
+	}
+	if fake, ok := m.dictionary.Mappings[s]; ok {
+		return fake
+	}
+	m.seeder.SeedFaker(m.faker, s)
+	return m.dictionary.Values[m.faker.Rand.Intn(len(m.dictionary.Values))]
+}
@@ -0,0 +1,217 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// Change is a value that differs between an input and its masked output, as
+// reported by diff. Values are shown truncated, or hashed, rather than whole.
+type Change struct {
+	Record   int    // Record or CSV row, counting from 1
+	Path     string // Key path, e.g. "items[2].email"
+	Original string // Quoted if a string, e.g. "\"jane@e…\"", null or {…}
+	Masked   string // Shown the same, or empty if the output does not hold the path
+}
+
+// FieldDiff counts the values of a field that masking changed.
+type FieldDiff struct {
+	Path    string // Key path without array indexes
+	Values  int    // Values of the input
+	Changed int    // Values that differ in the output
+}
+
+// DiffReport is what changed between an input and its masked output.
+type DiffReport struct {
+	Records int
+	Changes []Change    // In order of the input
+	Fields  []FieldDiff // In order of appearance in the input
+}
+
+// Diff reads json, ndjson or csv input and its masked output, record by
+// record, and reports every value that masking changed. Values are shown
+// truncated, or with hash set as the start of their SHA-256 digest, so that a
+// reviewer can tell equal values apart without seeing them. The input and
+// output must hold the same records; errors are reported as by Start.
+func Diff(original, masked io.Reader, format string, hash bool) (*DiffReport, error) {
+	d := &differ{hash: hash, report: &DiffReport{}, fields: make(map[string]*FieldDiff)}
+	switch format {
+	case "json", "ndjson":
+		originals, outputs := jsonRecords(original), jsonRecords(masked)
+		for {
+			a, errA := originals()
+			b, errB := outputs()
+			if err := d.nextRecord(errA, errB); err != nil {
+				return nil, err
+			}
+			if errors.Is(errA, io.EOF) {
+				break
+			}
+			d.compare("", a, b, true)
+		}
+	case "csv":
+		originals, outputs := csv.NewReader(original), csv.NewReader(masked)
+		header, err := originals.Read()
+		if err != nil {
+			return nil, &InputError{Err: fmt.Errorf("error reading header of the input: %w", err)}
+		}
+		outputHeader, err := outputs.Read()
+		if err != nil {
+			return nil, &InputError{Err: fmt.Errorf("error reading header of the output: %w", err)}
+		}
+		for {
+			a, errA := originals.Read()
+			b, errB := outputs.Read()
+			if err := d.nextRecord(errA, errB); err != nil {
+				return nil, err
+			}
+			if errors.Is(errA, io.EOF) {
+				break
+			}
+			for i, column := range header {
+				if i >= len(a) {
+					continue
+				}
+				j := slices.Index(outputHeader, column)
+				if j < 0 || j >= len(b) {
+					d.compare(column, a[i], nil, false)
+					continue
+				}
+				d.compare(column, a[i], b[j], true)
+			}
+		}
+	default:
+		return nil, &ConfigError{Err: fmt.Errorf("diff supports json, ndjson and csv input, not %s", format)}
+	}
+	for _, path := range d.order {
+		d.report.Fields = append(d.report.Fields, *d.fields[path])
+	}
+	return d.report, nil
+}
+
+// jsonRecords returns a function reading the elements of a root array, or a
+// stream of root values such as ndjson, one at a time, until io.EOF.
+func jsonRecords(r io.Reader) func() (any, error) {
+	br := newPeekingReader(r)
+	var decoder *json.Decoder
+	return func() (any, error) {
+		if decoder == nil {
+			firstChar, err := br.PeekFirstChar()
+			if err != nil {
+				return nil, err
+			}
+			decoder = json.NewDecoder(br)
+			decoder.UseNumber()
+			if firstChar == '[' {
+				_, _ = decoder.Token() // consume '['
+			}
+		}
+		if !decoder.More() {
+			return nil, io.EOF
+		}
+		var data any
+		err := decoder.Decode(&data)
+		return data, err
+	}
+}
+
+type differ struct {
+	hash   bool
+	report *DiffReport
+	fields map[string]*FieldDiff
+	order  []string
+}
+
+// nextRecord checks the errors of reading the next record of the input and
+// the output, which must both hold one or both have ended.
+func (d *differ) nextRecord(errA, errB error) error {
+	record := d.report.Records + 1
+	switch {
+	case errA != nil && !errors.Is(errA, io.EOF):
+		return &InputError{Err: fmt.Errorf("error reading record %d of the input: %w", record, errA)}
+	case errB != nil && !errors.Is(errB, io.EOF):
+		return &InputError{Err: fmt.Errorf("error reading record %d of the output: %w", record, errB)}
+	case errors.Is(errA, io.EOF) != errors.Is(errB, io.EOF):
+		return &InputError{Err: fmt.Errorf("the input and output hold a different number of records, from record %d on", record)}
+	}
+	if errA == nil {
+		d.report.Records++
+	}
+	return nil
+}
+
+// compare adds the changes between value a of the input and b of the output,
+// where found tells whether the output holds the path at all.
+func (d *differ) compare(key string, a, b any, found bool) {
+	switch v := a.(type) {
+	case map[string]any:
+		object, ok := b.(map[string]any)
+		if found && ok {
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				value, ok := object[k]
+				d.compare(joinKey(key, k), v[k], value, ok)
+			}
+			return
+		}
+	case []any:
+		array, ok := b.([]any)
+		if found && ok {
+			for i, item := range v {
+				if i < len(array) {
+					d.compare(indexKey(key, i), item, array[i], true)
+				} else {
+					d.compare(indexKey(key, i), item, nil, false)
+				}
+			}
+			return
+		}
+	}
+
+	path := fieldPath(key)
+	field, ok := d.fields[path]
+	if !ok {
+		field = &FieldDiff{Path: path}
+		d.fields[path] = field
+		d.order = append(d.order, path)
+	}
+	field.Values++
+	if found && reflect.DeepEqual(a, b) {
+		return
+	}
+	field.Changed++
+	change := Change{Record: d.report.Records, Path: key, Original: d.show(a)}
+	if found {
+		change.Masked = d.show(b)
+	}
+	d.report.Changes = append(d.report.Changes, change)
+}
+
+// show returns value as it is reported: truncated or hashed.
+func (d *differ) show(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "{…}"
+	case []any:
+		return "[…]"
+	}
+	text := formatValue(value)
+	if d.hash {
+		sum := sha256.Sum256([]byte(text))
+		return "sha256:" + hex.EncodeToString(sum[:4])
+	}
+	if _, ok := value.(string); ok {
+		return strconv.Quote(truncateExample(text))
+	}
+	return truncateExample(text)
+}
@@ -0,0 +1,46 @@
+// Package pkg masks sensitive values in JSON, NDJSON, XML, CSV and text, as
+// the unaware command does.
+//
+// A run is described by an AppConfig, whose Masker field chooses the method,
+// and performed by Start, which streams the input to the output:
+//
+//	config := pkg.AppConfig{
+//		Format:   "json",
+//		CPUCount: 4,
+//		Include:  []string{"**.email"},
+//		Masker:   pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: salt},
+//	}
+//	stats, err := pkg.Start(os.Stdin, os.Stdout, config)
+//
+// It returns the metrics of the run as Stats: the records masked, the values
+// masked by detected type, the bytes read and written, and how long it took.
+// StartContext stops a run when its context is done, and NewRecordStream
+// yields the masked records one at a time instead of writing them.
+//
+// New creates the same runs from options, as an Engine that validated its
+// configuration once and masks any number of inputs:
+//
+//	engine, err := pkg.New(pkg.WithFormat("ndjson"), pkg.WithDeterministic(salt), pkg.WithInclude("**.email"))
+//	...
+//	stats, err := engine.Mask(ctx, r, w)
+//
+// Start and NewRecordStream are the shorthand of an Engine for a single run.
+// Everything else that masks is built on an Engine: its Masker masks single
+// values from any number of goroutines, Writer and Handler mask logs, and
+// Rows masks the rows of a query. It masks HTTP bodies with MaskRequests,
+// MaskResponses and MaskingTransport, proto messages with MaskProto and the
+// gRPC interceptors of MaskingInterceptors, and the messages of a schema
+// registry, such as Kafka records, with MaskMessage. NewPipe and NewServer
+// serve it to other processes. NewMasker creates a Masker from a
+// MaskerConfig alone. The constructors taking an AppConfig that were there
+// before Engine, such as NewMaskingWriter, are deprecated.
+//
+// A Config is the same policy as written in a config file: LoadConfig reads
+// one, and its AppConfig method turns it into the config of a run. Methods
+// and rules written as flags, such as "partial:last4" or "ssn=null", are
+// parsed with ParseMethod and the Parse*Rule functions.
+//
+// Start reports an invalid configuration as a *ConfigError and input that
+// cannot be processed as an *InputError. The other entry points, Scan,
+// InspectSample, Diff and GenerateSample, report their errors the same way.
+package pkg
@@ -1,21 +1,32 @@
 package pkg
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"maps"
+	"math/rand"
+	randv2 "math/rand/v2"
 	"net"
 	"net/url"
 	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/brianvoe/gofakeit/v6"
-	"github.com/dgraph-io/ristretto"
 	"github.com/gobwas/glob"
 	"github.com/google/uuid"
 	"github.com/jacoelho/banking/iban"
@@ -31,18 +42,58 @@ var Now = time.Now
 
 // AppConfig holds the complete configuration for a masking operation.
 type AppConfig struct {
-	Format       string   `json:"format"`
-	CPUCount     int      `json:"cpu_count"`
-	Include      []string `json:"include"`
-	Exclude      []string `json:"exclude"`
-	FirstN       int      `json:"first_n"`
+	Format       string              `json:"format"`
+	CPUCount     int                 `json:"cpu_count"` // Most records masked concurrently; runtime.GOMAXPROCS if 0
+	Include      []string            `json:"include"`
+	Exclude      []string            `json:"exclude"`
+	FirstN       int                 `json:"first_n"`
+	LastN        int                 `json:"last_n"` // Keeps the last n records in memory until the input ends
+	Range        RecordRange         `json:"range"`
+	OutputStyle  string              `json:"output_style"` // Layout of JSON and XML output: pretty, compact or preserve
+	Rules        []Rule              `json:"rules"`
+	FieldMaskers map[string]MaskFunc `json:"-"`             // Masks the values of keys matching a pattern, before the rules
+	Unique       bool                `json:"unique"`        // Re-derive deterministic values that collide within a field
+	MappingFile  string              `json:"mapping_file"`  // Encrypted original to masked mappings, reused across runs
+	MappingKey   []byte              `json:"-"`             // AES key of the mapping file
+	MappingSet   *MappingSet         `json:"-"`             // Mappings in memory, reused across runs, instead of a mapping file
+	MaxMemory    int64               `json:"max_memory"`    // Bytes of records read but not yet written, estimated; 0 is unbounded
+	JSONBackend  string              `json:"json_backend"`  // Decodes and encodes json and ndjson records: std, jsoniter or a registered one
+	BatchSize    int                 `json:"batch_size"`    // Records masked by a worker at a time; DefaultBatchSize if 0
+	MaxTextLine  int                 `json:"max_text_line"` // Longest line of text masked as a whole, in bytes; DefaultMaxLine if 0
 	Masker       MaskerConfig
-	IncludeGlobs []glob.Glob `json:"-"`
-	ExcludeGlobs []glob.Glob `json:"-"`
+	KAnonymity   KAnonymityConfig       // Only used for csv format
+	Shuffle      []string               `json:"shuffle"`      // Only used for csv format
+	NoHeader     bool                   `json:"no_header"`    // CSV without a header row, columns are keyed col:1, col:2, ...
+	Columns      []string               `json:"columns"`      // Keys of the first columns of CSV without a header row, instead of col:1, col:2, ...
+	CSV          CSVDialect             `json:"csv"`          // Delimiter, quote and comment of csv input and output
+	CDATAMarkup  bool                   `json:"cdata_markup"` // XML CDATA sections holding markup are masked as the elements they hold
+	OnlyTypes    []string               `json:"only_types"`   // Value types masked by default: string, number, bool or null
+	SkipTypes    []string               `json:"skip_types"`   // Value types never masked by default
+	SafeValues   []string               `json:"safe_values"`  // Literal values never masked, such as "N/A" or enum constants
+	Ranges       []NumericRange         `json:"ranges"`       // Clamp masked numbers of matching keys
+	InferRanges  bool                   `json:"infer_ranges"` // Clamp percentages to 0-100
+	Report       io.Writer              `json:"-"`            // Receives human-readable summaries, e.g. of k-anonymity
+	Checkpoint   func(Checkpoint) error `json:"-"`            // Receives the progress of ndjson runs, so they can be resumed
+	Verify       *MaskedValues          `json:"-"`            // Collects the masked values, to check the output for leaks
+	OnMask       func(MaskEvent) bool   `json:"-"`            // Called for every masked value, and keeps the original when it returns false
+	RedactEvents bool                   `json:"-"`            // Truncates the original values passed to OnMask
+	IncludeGlobs []glob.Glob            `json:"-"`
+	ExcludeGlobs []glob.Glob            `json:"-"`
+
+	emit            func(record any) error // Receives the masked records instead of the output, for record streams
+	stats           *runStats              // Collects the metrics of a run
+	safeValues      map[string]bool
+	unique          *uniqueOutputs
+	mappings        *mappingStore
+	subtreeExcludes []*pathGlob // Exclude patterns ending in **, which can prune subtrees
+	selectors       []*pathGlob // Include and rule patterns, which prune the subtrees none of them reaches
+	jsonBackend     JSONBackend // Of JSONBackend, nil for encoding/json
 }
 
-type processor interface {
-	Process(r io.Reader, w io.Writer) error
+// Processor masks an input of a format into its output. Formats registered
+// with RegisterFormat provide one for every run.
+type Processor interface {
+	Process(ctx context.Context, r io.Reader, w io.Writer) error
 }
 
 // MaskingMethod is an enum for the available masking methods.
@@ -51,48 +102,566 @@ type MaskingMethod string
 const (
 	MethodRandom        MaskingMethod = "random"
 	MethodDeterministic MaskingMethod = "deterministic"
+	MethodFPE           MaskingMethod = "fpe"
+	MethodNull          MaskingMethod = "null"
+	MethodPartial       MaskingMethod = "partial"
+	MethodDictionary    MaskingMethod = "dictionary"
+	MethodHash          MaskingMethod = "hash"
+	MethodWasm          MaskingMethod = "wasm"
 )
 
 // MaskerConfig holds all the configuration for a masker.
 type MaskerConfig struct {
-	Method MaskingMethod
-	Salt   []byte // Only used for deterministic method
+	Method  MaskingMethod // Random if empty
+	Salt    []byte        // Only used for deterministic, dictionary, hash and registered methods
+	Key     []byte        // AES key, only used for fpe method
+	Tweak   []byte        // Optional tweak, only used for fpe method
+	Decrypt bool          // Reverses a previous fpe run, only used for fpe method
+	Partial PartialConfig // Only used for partial method
+	Hash    HashConfig    // Only used for hash method
+
+	// PreserveLength makes free text masked word by word keep the length of
+	// every word, for fixed-width schemas and layouts.
+	PreserveLength bool
+
+	// PreserveSign keeps negative numbers negative and positive numbers
+	// positive.
+	PreserveSign bool
+
+	// FieldScoped mixes the field path into seeds and hashes, so the same
+	// value under different keys, such as phone and fax, gets different fakes
+	// that are still stable per field.
+	FieldScoped bool
+
+	// Locale, such as "nl" or "de", makes generated names, addresses, phone
+	// numbers, IBANs and free text match a country. Empty means US English.
+	Locale string
+
+	// Faker generates the fakes of methods that do not seed them, instead of
+	// a faker of every worker seeded from crypto/rand: random, fpe, null,
+	// partial, hash and wasm, and dictionary and registered methods without a
+	// salt. It also shuffles CSV columns. Workers share it, so it must be
+	// safe for concurrent use, as the fakers of gofakeit.New are.
+	Faker *gofakeit.Faker
+
+	// Source is what a Faker draws from when none is set. Workers take turns
+	// drawing from it, so runs with a CPUCount of 1 and a source seeded the
+	// same way mask the same way every time, such as in tests.
+	Source rand.Source
+
+	// Only used for dictionary method. Dictionary is loaded from
+	// DictionaryFile by Start when not set.
+	DictionaryFile string
+	Dictionary     *Dictionary
+
+	// Only used for wasm method. Wasm is loaded from WasmFile by Start when
+	// not set.
+	WasmFile string
+	Wasm     *WasmModule
+
+	custom MaskFunc        // Masks every value, for the masker of a field masker
+	faker  *gofakeit.Faker // Faker, or one drawing from Source
+}
+
+// PartialConfig controls how many characters the partial method leaves
+// readable. Only letters and digits are counted and replaced; separators keep
+// their position, so "4111-1111-1111-1234" with KeepLast 4 becomes
+// "****-****-****-1234".
+type PartialConfig struct {
+	KeepFirst int
+	KeepLast  int
+	MaskChar  rune // Defaults to '*'
+}
+
+// HashConfig controls the output of the hash method, which replaces values by
+// their HMAC-SHA256 keyed with the salt.
+type HashConfig struct {
+	Encoding string // "hex" (default) or "base64", the unpadded URL-safe alphabet
+	Length   int    // Truncates the encoded HMAC to this many characters when set
+}
+
+// ParseMethod parses a masking method specification as accepted by the
+// -method flag, such as "random", "deterministic", "partial:last4",
+// "dictionary:names.txt", "hash:base64,16", "wasm:mask.wasm" or the name of a masker added with
+// RegisterMasker. Secrets for the deterministic, fpe, dictionary, hash and
+// registered methods must be set on the result separately.
+func ParseMethod(spec string) (MaskerConfig, error) {
+	name, options, _ := strings.Cut(spec, ":")
+	config := MaskerConfig{Method: MaskingMethod(name)}
+	switch config.Method {
+	case MethodRandom, MethodDeterministic, MethodFPE, MethodNull:
+		if options != "" {
+			return config, fmt.Errorf("method %q does not take options", name)
+		}
+	case MethodPartial:
+		if options == "" {
+			return config, fmt.Errorf("method %q requires options, e.g. partial:last4", name)
+		}
+		for option := range strings.SplitSeq(options, ",") {
+			var err error
+			switch {
+			case strings.HasPrefix(option, "first"):
+				config.Partial.KeepFirst, err = strconv.Atoi(strings.TrimPrefix(option, "first"))
+			case strings.HasPrefix(option, "last"):
+				config.Partial.KeepLast, err = strconv.Atoi(strings.TrimPrefix(option, "last"))
+			default:
+				err = errors.New("expected firstN or lastN")
+			}
+			if err != nil {
+				return config, fmt.Errorf("invalid partial option %q: %w", option, err)
+			}
+		}
+	case MethodHash:
+		if options == "" {
+			break
+		}
+		for option := range strings.SplitSeq(options, ",") {
+			switch option {
+			case "hex", "base64":
+				config.Hash.Encoding = option
+			default:
+				length, err := strconv.Atoi(option)
+				if err != nil || length <= 0 {
+					return config, fmt.Errorf("invalid hash option %q: expected hex, base64 or a length", option)
+				}
+				config.Hash.Length = length
+			}
+		}
+	case MethodDictionary:
+		if options == "" {
+			return config, fmt.Errorf("method %q requires a dictionary file, e.g. dictionary:names.txt", name)
+		}
+		config.DictionaryFile = options
+	case MethodWasm:
+		if options == "" {
+			return config, fmt.Errorf("method %q requires a module file, e.g. wasm:mask.wasm", name)
+		}
+		config.WasmFile = options
+	default:
+		if _, ok := lookupMasker(name); !ok {
+			return config, fmt.Errorf("unknown masking method %q", name)
+		}
+		if options != "" {
+			return config, fmt.Errorf("method %q does not take options", name)
+		}
+	}
+	return config, nil
+}
+
+// prepare validates the configuration of a masker and loads the files it
+// refers to.
+func (c *MaskerConfig) prepare() error {
+	if _, err := lookupLocale(c.Locale); err != nil {
+		return err
+	}
+	switch c.Method {
+	case "", MethodRandom, MethodDeterministic, MethodFPE, MethodNull, MethodPartial, MethodHash, MethodDictionary, MethodWasm:
+	default:
+		if _, ok := lookupMasker(string(c.Method)); !ok && c.custom == nil {
+			return fmt.Errorf("unknown masking method %q", c.Method)
+		}
+	}
+	if c.Method == MethodFPE {
+		if _, err := NewFF1(c.Key, c.Tweak); err != nil {
+			return err
+		}
+	}
+	if c.Method == MethodDictionary && c.Dictionary == nil {
+		if c.DictionaryFile == "" {
+			return errors.New("method dictionary requires a dictionary file")
+		}
+		d, err := LoadDictionary(c.DictionaryFile)
+		if err != nil {
+			return err
+		}
+		c.Dictionary = d
+	}
+	if c.Method == MethodWasm && c.Wasm == nil {
+		if c.WasmFile == "" {
+			return errors.New("method wasm requires a module file")
+		}
+		w, err := LoadWasmModule(c.WasmFile)
+		if err != nil {
+			return err
+		}
+		c.Wasm = w
+	}
+	switch {
+	case c.Faker != nil:
+		c.faker = c.Faker
+	case c.Source != nil && c.faker == nil:
+		c.faker = &gofakeit.Faker{Rand: rand.New(&lockedSource{src: c.Source})}
+	}
+	return nil
+}
+
+// lockedSource is a rand.Source that workers can share.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// ConfigError reports an invalid configuration, found before any input is
+// read.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// InputError reports input that could not be read or processed, and where
+// in the input, when known.
+type InputError struct {
+	Err    error
+	Record int    // Record, CSV row or element of an XML list, counting from 1
+	Line   int    // Line of the input, counting from 1
+	Column int    // Byte of the line, counting from 1
+	Path   string // Key path of the value, e.g. "items[2].email"
+}
+
+func (e *InputError) Error() string {
+	var location []string
+	if e.Record > 0 {
+		location = append(location, fmt.Sprintf("record %d", e.Record))
+	}
+	if e.Line > 0 {
+		location = append(location, fmt.Sprintf("line %d", e.Line))
+	}
+	if e.Column > 0 {
+		location = append(location, fmt.Sprintf("column %d", e.Column))
+	}
+	if e.Path != "" {
+		location = append(location, "key "+e.Path)
+	}
+	if len(location) == 0 {
+		return e.Err.Error()
+	}
+	return strings.Join(location, ", ") + ": " + e.Err.Error()
+}
+func (e *InputError) Unwrap() error { return e.Err }
+
+// Start initiates the masking process based on the provided configuration,
+// and returns the metrics of the run. An invalid configuration is reported as
+// a *ConfigError and input that cannot be processed as an *InputError; the
+// metrics then cover the part of the input masked before it, if any.
+func Start(r io.Reader, w io.Writer, config AppConfig) (*Stats, error) {
+	return StartContext(context.Background(), r, w, config)
+}
+
+// StartContext is Start, stopping when ctx is done. The error of ctx is then
+// returned as is, and w may hold part of the output. Reading stops between
+// records, so a Read of r that blocks is waited for.
+func StartContext(ctx context.Context, r io.Reader, w io.Writer, config AppConfig) (*Stats, error) {
+	start := time.Now()
+	config.stats = newRunStats()
+	p, err := config.prepare()
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	stats := func() *Stats { return config.stats.snapshot(start, config.CPUCount) }
+	if err := ctx.Err(); err != nil {
+		return stats(), err
+	}
+	// Records sliced out of mapped input are never read, so what the run
+	// took of it is counted once it ends.
+	mapped, _ := r.(*MappedInput)
+	var mappedStart int64
+	if mapped != nil {
+		mappedStart = mapped.Offset()
+	} else {
+		r = countingReader{r: r, n: &config.stats.in}
+	}
+	out := newOutputWriter(countingWriter{w: w, n: &config.stats.out})
+	err = p.Process(ctx, r, out)
+	if mapped != nil {
+		config.stats.in.Add(mapped.Offset() - mappedStart)
+	}
+	// The output written before an error is kept, as it would be unbuffered.
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var inputErr *InputError
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) || errors.As(err, &inputErr) {
+			return stats(), err
+		}
+		return stats(), &InputError{Err: err}
+	}
+	if config.MappingFile != "" {
+		return stats(), config.mappings.save(config.MappingFile, config.MappingKey)
+	}
+	return stats(), nil
+}
+
+// preparedRun is a config prepared once for masking many small inputs, such
+// as the bodies of requests, each without the preparing and output writer of
+// a run of StartContext.
+type preparedRun struct {
+	config    AppConfig
+	processor Processor
+	err       error // Why the config cannot mask, returned by every run
+}
+
+// prepareRun prepares config for runs masking with it. A config that cannot
+// be prepared is kept, as runs report why.
+func prepareRun(config AppConfig) *preparedRun {
+	p, err := config.prepare()
+	if err != nil {
+		return &preparedRun{err: &ConfigError{Err: err}}
+	}
+	return &preparedRun{config: config, processor: p}
 }
 
-// Start initiates the masking process based on the provided configuration.
-func Start(r io.Reader, w io.Writer, config AppConfig) error {
+// mask returns input masked, reporting errors as StartContext does. Mappings
+// of a mapping file are not saved.
+func (p *preparedRun) mask(ctx context.Context, input []byte) ([]byte, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var out memoryOutput
+	if err := p.processor.Process(ctx, bytes.NewReader(input), &out); err != nil {
+		var inputErr *InputError
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) || errors.As(err, &inputErr) {
+			return nil, err
+		}
+		return nil, &InputError{Err: err}
+	}
+	return out.Bytes(), nil
+}
+
+// memoryOutput is output held in memory, which processors write to as it is
+// rather than buffering it.
+type memoryOutput struct {
+	bytes.Buffer
+}
+
+func (*memoryOutput) Flush() error { return nil }
+
+// prepare validates and compiles the configuration, and returns the
+// processor of its format.
+func (c *AppConfig) prepare() (Processor, error) {
+	if c.CPUCount <= 0 {
+		c.CPUCount = runtime.GOMAXPROCS(0)
+	}
+	if err := c.Masker.prepare(); err != nil {
+		return nil, err
+	}
+
 	// Pre-compile glob patterns once at startup for performance during masking.
 	// This avoids re-parsing the patterns for every key in the input data.
-	for _, pattern := range config.Include {
-		g, err := glob.Compile(pattern, '.')
+	for _, pattern := range c.Include {
+		g, err := compileGlob(pattern)
 		if err != nil {
-			return fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		c.IncludeGlobs = append(c.IncludeGlobs, g)
+	}
+	for _, pattern := range c.Exclude {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+		c.ExcludeGlobs = append(c.ExcludeGlobs, g)
+		if pg := g.(*pathGlob); pg.coversSubtrees() {
+			c.subtreeExcludes = append(c.subtreeExcludes, pg)
+		}
+	}
+	backend, err := lookupJSONBackend(c.JSONBackend)
+	if err != nil {
+		return nil, err
+	}
+	c.jsonBackend = backend
+	if err := c.CSV.validate(); err != nil {
+		return nil, err
+	}
+	if c.MaxTextLine < 0 {
+		return nil, fmt.Errorf("invalid longest text line %d, expected at least 1 byte, or 0 for %d", c.MaxTextLine, DefaultMaxLine)
+	}
+	if c.BatchSize < 0 {
+		return nil, fmt.Errorf("invalid batch size %d, expected at least 1, or 0 for %d", c.BatchSize, DefaultBatchSize)
+	}
+	if len(c.SafeValues) > 0 {
+		c.safeValues = make(map[string]bool, len(c.SafeValues))
+		for _, value := range c.SafeValues {
+			c.safeValues[value] = true
+		}
+	}
+	if c.Unique {
+		c.unique = newUniqueOutputs()
+	}
+	if c.MappingFile != "" && c.MappingSet != nil {
+		return nil, errors.New("a mapping file and a mapping set cannot be used together")
+	}
+	if c.MappingSet != nil {
+		c.mappings = c.MappingSet.store
+		if c.unique != nil {
+			c.mappings.claimAll(c.unique)
 		}
-		config.IncludeGlobs = append(config.IncludeGlobs, g)
 	}
-	for _, pattern := range config.Exclude {
-		g, err := glob.Compile(pattern, '.')
+	if c.MappingFile != "" {
+		mappings, err := ReadMappings(c.MappingFile, c.MappingKey)
 		if err != nil {
-			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			return nil, err
+		}
+		c.mappings = newMappingStore(mappings)
+		if c.unique != nil {
+			c.mappings.claimAll(c.unique)
 		}
-		config.ExcludeGlobs = append(config.ExcludeGlobs, g)
 	}
+	for _, kind := range slices.Concat(c.OnlyTypes, c.SkipTypes) {
+		if !slices.Contains(valueTypes, kind) {
+			return nil, fmt.Errorf("unknown value type %q, expected one of %s", kind, strings.Join(valueTypes, ", "))
+		}
+	}
+	c.Ranges = append([]NumericRange(nil), c.Ranges...)
+	for i := range c.Ranges {
+		if err := c.Ranges[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	// Rules are copied so compiling and ordering them does not modify the
+	// caller's slice. Field maskers come first, as rules of their own.
+	var fieldRules []Rule
+	for _, pattern := range slices.Sorted(maps.Keys(c.FieldMaskers)) {
+		if c.FieldMaskers[pattern] == nil {
+			return nil, fmt.Errorf("field masker for %q has no function", pattern)
+		}
+		fieldRules = append(fieldRules, Rule{Pattern: pattern, fn: c.FieldMaskers[pattern]})
+	}
+	c.Rules = slices.Concat(fieldRules, c.Rules)
+	slices.SortStableFunc(c.Rules, func(a, b Rule) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+	for i := range c.Rules {
+		if err := c.Rules[i].compile(c.Masker); err != nil {
+			return nil, err
+		}
+	}
+	c.selectors = c.selectingPatterns()
 
-	var p processor
-	switch config.Format {
+	if err := c.validateSubset(); err != nil {
+		return nil, err
+	}
+	if c.Format == "mysqldump" && c.selectsSubset() {
+		return nil, errors.New("rows of a mysqldump cannot be left out, as the dump would not restore")
+	}
+	if c.emit != nil {
+		// Streamed records are not written, so they have no layout, and
+		// those of CSV are yielded before shuffling or generalizing could
+		// see all rows.
+		c.OutputStyle = ""
+		switch {
+		case c.Format == "csv" && (len(c.Shuffle) > 0 || c.KAnonymity.K > 0):
+			return nil, errors.New("record streams cannot shuffle columns or generalize quasi-identifiers")
+		case c.Checkpoint != nil:
+			return nil, errors.New("record streams cannot be checkpointed")
+		}
+	}
+	if c.OutputStyle != "" {
+		switch {
+		case !slices.Contains(outputStyles, c.OutputStyle):
+			return nil, fmt.Errorf("unknown output style %q, expected one of %s", c.OutputStyle, strings.Join(outputStyles, ", "))
+		case c.Format != "json" && c.Format != "ndjson" && c.Format != "xml":
+			return nil, fmt.Errorf("output styles are only supported for json, ndjson and xml, not %s", c.Format)
+		case c.Format == "ndjson" && c.OutputStyle == StylePretty:
+			return nil, errors.New("ndjson records are written a line each, so they cannot be pretty")
+		}
+	}
+	if c.Checkpoint != nil {
+		// Resumed runs cannot restore the state of mappings and unique
+		// values, so they would mask differently.
+		switch {
+		case c.Format != "ndjson":
+			return nil, fmt.Errorf("checkpoints are only supported for ndjson, not %s", c.Format)
+		case c.MappingFile != "" || c.MappingSet != nil || c.Unique:
+			return nil, errors.New("checkpoints cannot be used with mappings or unique values")
+		case c.selectsSubset():
+			return nil, errors.New("checkpoints cannot be used when selecting a subset of the records")
+		}
+	}
+
+	var p Processor
+	switch c.Format {
 	case "json":
-		p = newJSONProcessor(config)
+		p = newJSONProcessor(*c)
 	case "xml":
-		p = newXMLProcessor(config)
+		p = newXMLProcessor(*c)
 	case "csv":
-		p = newCSVProcessor(config)
+		p = newCSVProcessor(*c)
+	case "ndjson":
+		p = newNDJSONProcessor(*c)
 	case "text":
-		p = newTextProcessor(config)
+		p = newTextProcessor(*c)
+	case "mysqldump":
+		p = newMySQLDumpProcessor(*c)
 	default:
-		return fmt.Errorf("unsupported format: %s", config.Format)
+		newProcessor, ok := lookupFormat(c.Format)
+		if !ok {
+			return nil, fmt.Errorf("unsupported format: %s", c.Format)
+		}
+		config := *c
+		runner := newRunner(maskerFactory(config.Masker), config)
+		runner.subset = true
+		p = newProcessor(runner)
 	}
 
-	return p.Process(r, w)
+	return p, nil
+}
+
+// valueTypes are the types of JSON values. Values of CSV, XML and text input
+// are all strings.
+var valueTypes = []string{"string", "number", "bool", "null"}
+
+func valueType(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	}
+	return ""
+}
+
+// selectsType reports whether values of the type of value are masked when
+// no rule says otherwise.
+func (c *AppConfig) selectsType(value any) bool {
+	kind := valueType(value)
+	if slices.Contains(c.SkipTypes, kind) {
+		return false
+	}
+	return len(c.OnlyTypes) == 0 || slices.Contains(c.OnlyTypes, kind)
+}
+
+// isSafe reports whether value is one of the safe values, which are kept
+// whatever rules and patterns select them. Numbers compare in their notation.
+func (c *AppConfig) isSafe(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return c.safeValues[v]
+	case json.Number:
+		return c.safeValues[v.String()]
+	}
+	return false
 }
 
 func shouldMask(key string, include, exclude []glob.Glob) bool {
@@ -114,12 +683,77 @@ func shouldMask(key string, include, exclude []glob.Glob) bool {
 	return true
 }
 
+// selectingPatterns returns the patterns that select every key masked, when
+// there are include patterns and all rules have patterns of their own, and
+// none of them reaches every key. Records streamed, and those of a JSON
+// backend, are decoded as a whole.
+func (c *AppConfig) selectingPatterns() []*pathGlob {
+	if len(c.IncludeGlobs) == 0 || c.emit != nil || c.jsonBackend != nil {
+		return nil
+	}
+	var patterns []*pathGlob
+	for _, g := range c.IncludeGlobs {
+		pg, ok := g.(*pathGlob)
+		if !ok {
+			return nil // Set by the caller, who knows what they match
+		}
+		patterns = append(patterns, pg)
+	}
+	for _, r := range c.Rules {
+		if r.glob == nil {
+			return nil
+		}
+		patterns = append(patterns, r.glob.(*pathGlob))
+	}
+	if slices.ContainsFunc(patterns, (*pathGlob).reachesEverything) {
+		return nil
+	}
+	return patterns
+}
+
+// canPrune reports whether any exclude pattern can cover a whole subtree, or
+// include and rule patterns can leave one out.
+func (c *AppConfig) canPrune() bool {
+	return len(c.subtreeExcludes) > 0 || len(c.selectors) > 0
+}
+
+// prunes reports whether the subtree at key is excluded as a whole, or no
+// include or rule pattern reaches into it. Nothing in it is masked, so
+// processors copy it through instead of walking it.
+func (c *AppConfig) prunes(key string) bool {
+	if !c.canPrune() {
+		return false
+	}
+	var segments []string
+	if key != "" {
+		segments = strings.Split(key, ".")
+	}
+	for _, g := range c.subtreeExcludes {
+		if g.coversSubtree(segments) {
+			return true
+		}
+	}
+	if len(c.selectors) == 0 {
+		return false
+	}
+	for _, g := range c.selectors {
+		if g.reaches(segments) {
+			return false
+		}
+	}
+	return true
+}
+
 type seeder interface {
 	SeedFaker(f *gofakeit.Faker, input any)
 	SeedFakerForWord(f *gofakeit.Faker, word string)
 }
 
-type deterministicSeeder struct{ salt []byte }
+type deterministicSeeder struct {
+	salt []byte
+	mac  hash.Hash // HMAC keyed with salt, reset for every seed
+	sum  [sha256.Size]byte
+}
 
 func (ds *deterministicSeeder) SeedFaker(f *gofakeit.Faker, input any) {
 	var seedInput string
@@ -149,46 +783,126 @@ func (ds *deterministicSeeder) createSeed(s string) int64 {
 		s = s[:64]
 	}
 
-	mac := hmac.New(sha256.New, ds.salt)
-	mac.Write([]byte(s))
-	seedBytes := mac.Sum(nil)
+	// The keyed state of the HMAC is derived once, rather than for every
+	// seed.
+	if ds.mac == nil {
+		ds.mac = hmac.New(sha256.New, ds.salt)
+	}
+	ds.mac.Reset()
+	io.WriteString(ds.mac, s)
+	seedBytes := ds.mac.Sum(ds.sum[:0])
 	return int64(binary.BigEndian.Uint64(seedBytes))
 }
 
+// newSeededFaker creates the faker of a masker seeded for every value. Its
+// source is a PCG, which takes a seed as its state: the source of
+// NewUnlocked fills a table of 607 numbers for every seed, which took most
+// of the time of deterministic masking.
+func newSeededFaker() *gofakeit.Faker {
+	return gofakeit.NewCustom(&pcgSource{})
+}
+
+// pcgSource is a rand.Source64 drawing from a PCG.
+type pcgSource struct{ pcg randv2.PCG }
+
+func (s *pcgSource) Seed(seed int64) {
+	// The second half of the state spreads seeds that differ in a few bits.
+	s.pcg.Seed(uint64(seed), uint64(seed)*0x9e3779b97f4a7c15)
+}
+
+func (s *pcgSource) Uint64() uint64 { return s.pcg.Uint64() }
+func (s *pcgSource) Int63() int64   { return int64(s.pcg.Uint64() >> 1) }
+
 type randomSeeder struct{}
 
 func (rs *randomSeeder) SeedFaker(f *gofakeit.Faker, input any)          { /* No-op */ }
 func (rs *randomSeeder) SeedFakerForWord(f *gofakeit.Faker, word string) { /* No-op */ }
 
-// concurrentRunner orchestrates concurrent processing of data chunks.
-type concurrentRunner struct {
-	methodFactory func() *masker
-	config        AppConfig // The entire AppConfig is now passed
-	Root          string    // Used for XML to define the root element name for chunking
+// forField returns the masker for the values of key. With FieldScoped, that
+// is a copy of m whose seeds and hashes are keyed on both the salt and the
+// field path, sharing the cache of m under a prefix. Copies are created on
+// first use.
+func (m *masker) forField(key string) *masker {
+	if !m.fieldScoped {
+		return m
+	}
+	if scoped, ok := m.fields[key]; ok {
+		return scoped
+	}
+	scoped := *m
+	scoped.fieldScoped = false
+	scoped.cachePrefix = key + "\x00"
+	if ds, ok := m.seeder.(*deterministicSeeder); ok {
+		scoped.seeder = &deterministicSeeder{salt: fieldSalt(ds.salt, key)}
+	}
+	if m.hash != nil {
+		scoped.hash = &hasher{salt: fieldSalt(m.hash.salt, key), config: m.hash.config}
+	}
+	if m.fields == nil {
+		m.fields = make(map[string]*masker)
+	}
+	m.fields[key] = &scoped
+	return &scoped
 }
 
-// newConcurrentRunner creates a new concurrentRunner.
-func newConcurrentRunner(methodFactory func() *masker, config AppConfig) *concurrentRunner {
-	return &concurrentRunner{
-		methodFactory: methodFactory,
-		config:        config,
-	}
+func fieldSalt(salt []byte, key string) []byte {
+	return fmt.Appendf(append([]byte(nil), salt...), "\x00field\x00%s", key)
 }
 
 type masker struct {
 	faker           *gofakeit.Faker
 	seeder          seeder
-	cache           *ristretto.Cache
+	cache           *maskCache
 	dateLayouts     []string
 	emailRegex      *regexp.Regexp
 	numLikeRegex    *regexp.Regexp
 	ulidRegex       *regexp.Regexp
 	ksuidRegex      *regexp.Regexp
+	fpe             *fpeCipher
+	nullify         bool
+	dictionary      *Dictionary
+	hash            *hasher
+	custom          MaskFunc
+	wasm            *wasmHook
+	preserveLength  bool
+	preserveSign    bool
+	locale          *locale
+	overrides       map[*MaskerConfig]*masker // Maskers for rules overriding the method
+	fieldScoped     bool
+	fields          map[string]*masker // Field-scoped copies, see forField
+	cachePrefix     string
+	partial         *PartialConfig
 	creditCardRegex *regexp.Regexp
 	currencyRegex   *regexp.Regexp
+	unixPathRegex   *regexp.Regexp
+	winPathRegex    *regexp.Regexp
+	hexDigestRegex  *regexp.Regexp
+	tokenRegex      *regexp.Regexp
+	keys            memo[*keyMatch] // What the patterns of keysFor select of key paths
+	keysFor         *AppConfig
+	roles           memo[keyRoles] // Of key names
+	types           memo[string]   // detectStringType of values
 }
 
 func newMasker(config MaskerConfig) *masker {
+	return newSharedMasker(config, nil)
+}
+
+// maskerFactory returns a function creating the maskers of the workers of a
+// run of config, which share the cache of the values masked
+// deterministically.
+func maskerFactory(config MaskerConfig) func() *masker {
+	var cache *maskCache
+	if config.Method == MethodDeterministic {
+		cache = newMaskCache()
+	}
+	return func() *masker { return newSharedMasker(config, cache) }
+}
+
+// newSharedMasker creates a masker using cache, if not nil, for the values
+// it masks deterministically. The cache is safe to share between maskers of
+// the same config, which mask the same values the same way.
+func newSharedMasker(config MaskerConfig, cache *maskCache) *masker {
 	m := &masker{
 		dateLayouts: []string{
 			time.RFC3339,
@@ -206,35 +920,138 @@ func newMasker(config MaskerConfig) *masker {
 		ksuidRegex:      regexp.MustCompile(`^[a-zA-Z0-9]{27}$`),
 		creditCardRegex: regexp.MustCompile(`^(?:\d[ -]*?){13,16}$`),
 		currencyRegex:   regexp.MustCompile(`^(\$|€|£|USD|EUR|GBP)\s*(\d{1,3}(?:[.,]\d{3})*(?:[.,]\d{2})?)$`),
+		unixPathRegex:   regexp.MustCompile(`^(?:~|\.{1,2})?(?:/[^/\s]+)+/?$`),
+		winPathRegex:    regexp.MustCompile(`^(?:[A-Za-z]:|\\\\[^\\/\s]+)(?:\\[^\\/:*?"<>|\r\n]+)+\\?$`),
+		// Lengths of md5, sha1, sha224, sha256, sha384 and sha512 hex digests.
+		hexDigestRegex: regexp.MustCompile(`^(?:[0-9a-f]{32}|[0-9a-f]{40}|[0-9a-f]{56}|[0-9a-f]{64}|[0-9a-f]{96}|[0-9a-f]{128}|[0-9A-F]{32}|[0-9A-F]{40}|[0-9A-F]{56}|[0-9A-F]{64}|[0-9A-F]{96}|[0-9A-F]{128})$`),
+		tokenRegex:     regexp.MustCompile(`^[A-Za-z0-9_\-+/]{20,}={0,2}$`),
+		preserveLength: config.PreserveLength,
+		fieldScoped:    config.FieldScoped,
+		preserveSign:   config.PreserveSign,
 	}
+	m.locale, _ = lookupLocale(config.Locale) // Validated in Start
 
-	switch config.Method {
+	method := config.Method
+	if method == "" && config.custom == nil {
+		method = MethodRandom
+	}
+	switch method {
 	case MethodDeterministic:
 		m.seeder = &deterministicSeeder{salt: config.Salt}
-		cache, err := ristretto.NewCache(&ristretto.Config{
-			NumCounters: 1e7,     // number of keys to track frequency of (10M).
-			MaxCost:     1 << 30, // maximum cost of cache (1GB).
-			BufferItems: 64,      // number of keys per Get buffer.
-		})
-		if err != nil {
-			panic(err)
+		if cache == nil {
+			cache = newMaskCache()
 		}
 		m.cache = cache
-		m.faker = gofakeit.NewUnlocked(1)
+		m.faker = newSeededFaker()
 	case MethodRandom:
 		m.seeder = &randomSeeder{}
 		m.faker = gofakeit.New(0)
+	case MethodFPE:
+		ff1, err := NewFF1(config.Key, config.Tweak)
+		if err != nil {
+			panic(err) // Validated in Start
+		}
+		m.fpe = &fpeCipher{ff1: ff1, decrypt: config.Decrypt}
+		m.seeder = &randomSeeder{}
+		m.faker = gofakeit.New(0)
+	case MethodNull:
+		m.nullify = true
+		m.seeder = &randomSeeder{}
+		m.faker = gofakeit.New(0)
+	case MethodPartial:
+		m.partial = &config.Partial
+		m.seeder = &randomSeeder{}
+		m.faker = gofakeit.New(0)
+	case MethodHash:
+		m.hash = &hasher{salt: config.Salt, config: config.Hash}
+		m.seeder = &randomSeeder{}
+		m.faker = gofakeit.New(0)
+	case MethodWasm:
+		hook, err := config.Wasm.instantiate()
+		if err != nil {
+			panic(err) // Validated in Start
+		}
+		m.wasm = hook
+		m.seeder = &randomSeeder{}
+		m.faker = gofakeit.New(0)
+	case MethodDictionary:
+		// Picks are seeded when a salt is given, so identical values get
+		// identical replacements.
+		m.dictionary = config.Dictionary
+		if len(config.Salt) > 0 {
+			m.seeder = &deterministicSeeder{salt: config.Salt}
+			m.faker = newSeededFaker()
+		} else {
+			m.seeder = &randomSeeder{}
+			m.faker = gofakeit.New(0)
+		}
 	default:
-		panic("unknown masking method") // Should not happen with validation
+		custom, ok := config.custom, config.custom != nil
+		if !ok {
+			custom, ok = lookupMasker(string(config.Method))
+		}
+		if !ok {
+			panic("unknown masking method") // Should not happen with validation
+		}
+		// Like dictionary picks, custom fakes are seeded when a salt is given.
+		m.custom = custom
+		if len(config.Salt) > 0 {
+			m.seeder = &deterministicSeeder{salt: config.Salt}
+			m.faker = newSeededFaker()
+		} else {
+			m.seeder = &randomSeeder{}
+			m.faker = gofakeit.New(0)
+		}
+	}
+	if _, random := m.seeder.(*randomSeeder); random && config.faker != nil {
+		m.faker = config.faker
 	}
 
 	return m
 }
 
+// maskKey masks the value of key. The wasm method passes the key to the
+// module, and field-scoped maskers seed on it.
+func (m *masker) maskKey(key string, value any) any {
+	m = m.forField(key)
+	if m.wasm != nil && value != nil {
+		return m.maskWasm(key, value)
+	}
+	return m.mask(value)
+}
+
 func (m *masker) mask(value any) any {
-	if value == nil {
+	if value == nil || m.nullify {
 		return nil
 	}
+	if m.partial != nil {
+		return m.partial.mask(value)
+	}
+	if m.dictionary != nil {
+		return m.replaceFromDictionary(value)
+	}
+	if m.hash != nil {
+		return m.hash.sum(value)
+	}
+	if m.custom != nil {
+		return m.maskCustom(value)
+	}
+	if m.wasm != nil {
+		return m.maskWasm("", value)
+	}
+
+	// Values that cannot be encrypted (booleans, values too short for a secure
+	// domain) fall back to regular random masking and are not reversible.
+	// When decrypting they are left as they are.
+	if m.fpe != nil {
+		if encrypted, err := m.fpe.mask(value); err == nil {
+			return encrypted
+		}
+		if m.fpe.decrypt {
+			return value
+		}
+		return m.maskUncached(value)
+	}
 
 	// Use cache for deterministic masking to avoid re-computing for the same input.
 	if m.cache != nil {
@@ -248,20 +1065,71 @@ func (m *masker) mask(value any) any {
 
 	if m.cache != nil {
 		cacheKey := m.getCacheKey(value)
-		m.cache.Set(cacheKey, maskedValue, 1)
+		m.cache.Set(cacheKey, maskedValue)
 	}
 
 	return maskedValue
 }
 
+// mask hides all but the configured leading and trailing letters and digits
+// of strings and numbers. Numbers are returned as strings since the masked
+// form is no longer numeric. Other values are returned unchanged.
+func (p *PartialConfig) mask(value any) any {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return value
+	}
+
+	maskChar := p.MaskChar
+	if maskChar == 0 {
+		maskChar = '*'
+	}
+	total := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			total++
+		}
+	}
+	var b strings.Builder
+	seen := 0
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteRune(r)
+			continue
+		}
+		if seen < p.KeepFirst || seen >= total-p.KeepLast {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(maskChar)
+		}
+		seen++
+	}
+	return b.String()
+}
+
+// formatValue converts a masked value to its textual form for formats without
+// a null type. Values removed by the null method become empty strings.
+func formatValue(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
 func (m *masker) getCacheKey(value any) string {
 	switch v := value.(type) {
 	case string:
-		return v
+		return m.cachePrefix + v
 	case json.Number:
-		return v.String()
+		// Numbers and booleans are told from strings that read the same.
+		return m.cachePrefix + "\x00n" + v.String()
 	case bool:
-		return strconv.FormatBool(v)
+		return m.cachePrefix + "\x00b" + strconv.FormatBool(v)
 	default:
 		return "" // Should not happen for supported types
 	}
@@ -276,118 +1144,326 @@ func (m *masker) generateAlphanumericN(n int) string {
 	return generated
 }
 
-func (m *masker) maskUncached(value any) any {
-	m.seeder.SeedFaker(m.faker, value)
-	switch v := value.(type) {
-	case string:
-		s := v
-		if strings.TrimSpace(s) == "" {
-			return s
-		}
-		if _, err := uuid.Parse(s); err == nil {
-			return m.faker.UUID()
+// isOpaqueToken reports whether s looks like a generated token (API keys,
+// base64 blobs, session ids) rather than natural text.
+func (m *masker) isOpaqueToken(s string) bool {
+	if !m.tokenRegex.MatchString(s) {
+		return false
+	}
+	hasDigit, hasLetter := false, false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			hasLetter = true
 		}
-		if err := iban.Validate(strings.ReplaceAll(s, " ", "")); err == nil {
-			// Generate a fake IBAN that looks plausible
-			return m.faker.Regex(`[A-Z]{2}\d{2}[A-Z\d]{4}\d{7,12}`)
+	}
+	return hasDigit && hasLetter
+}
+
+// maskCharset regenerates s character by character so the length and charset
+// are preserved. Hex digests are regenerated from the hex alphabet in their
+// original case; other tokens keep the class (lower, upper, digit) of every
+// position and leave separators such as '_' and '=' padding untouched.
+func (m *masker) maskCharset(s string) string {
+	const (
+		lower  = "abcdefghijklmnopqrstuvwxyz"
+		upper  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		digits = "0123456789"
+	)
+	b := []byte(s)
+	if m.hexDigestRegex.MatchString(s) {
+		hexSet := digits + lower[:6]
+		if strings.ToUpper(s) == s {
+			hexSet = digits + upper[:6]
 		}
-		if m.creditCardRegex.MatchString(s) {
-			// Clean the string of any separators before Luhn check
-			if num, err := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(s, " ", ""), "-", "")); err == nil && luhn.Valid(num) {
-				return m.faker.CreditCardNumber(nil)
-			}
+		for i := range b {
+			b[i] = hexSet[m.faker.Rand.Intn(len(hexSet))]
 		}
-		if _, err := phonenumbers.Parse(s, ""); err == nil {
-			return m.faker.Phone()
-		}
-		if m.currencyRegex.MatchString(s) {
-			matches := m.currencyRegex.FindStringSubmatch(s)
-			if len(matches) == 3 {
-				currencySymbol := matches[1]
-				// Generate a new random amount
-				newAmount := fmt.Sprintf("%.2f", m.faker.Price(0, 1000))
-				return currencySymbol + " " + newAmount
-			}
+		return string(b)
+	}
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			b[i] = lower[m.faker.Rand.Intn(len(lower))]
+		case c >= 'A' && c <= 'Z':
+			b[i] = upper[m.faker.Rand.Intn(len(upper))]
+		case c >= '0' && c <= '9':
+			b[i] = digits[m.faker.Rand.Intn(len(digits))]
 		}
-		if m.ulidRegex.MatchString(s) {
-			return m.faker.Regex(`[0-7][0-9A-HJKMNP-TV-Z]{25}`)
+	}
+	return string(b)
+}
+
+// fakeTypes are the kinds of value detectType reports and maskString
+// generates fakes for. Rules can force values to be masked as one of them.
+var fakeTypes = []string{
+	"credit_card", "currency", "date", "datetime", "decimal", "digest", "email", "iban", "integer", "ipv4", "ipv6",
+	"ksuid", "mac_address", "number_like", "phone", "text", "token", "ulid", "unix_path", "url", "uuid", "windows_path",
+}
+
+// hintTypes are the types rules can force values to be masked as: the
+// detected ones, and names, which cannot be told apart from other text.
+var hintTypes = append(append([]string(nil), fakeTypes...), nameTypes...)
+
+// generatesFakes reports whether m generates fakes for values, as the random
+// and deterministic methods do, rather than encrypting, hashing, removing or
+// substituting them.
+func (m *masker) generatesFakes() bool {
+	return m.fpe == nil && !m.nullify && m.partial == nil && m.dictionary == nil && m.hash == nil && m.custom == nil && m.wasm == nil
+}
+
+// detectType returns the kind of value maskUncached generates a fake for,
+// such as "email", "uuid" or "text".
+func (m *masker) detectType(value any) string {
+	switch v := value.(type) {
+	case json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	case string:
+		return m.detectedType(v)
+	}
+	return "unsupported"
+}
+
+// detectedType returns detectStringType of s, which the masker remembers: a
+// value is detected to mask it as well as to report it masked, and once for
+// every rule that selects a type, and records repeat values.
+func (m *masker) detectedType(s string) string {
+	return m.types.get(s, m.detectStringType)
+}
+
+func (m *masker) detectStringType(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "empty"
+	}
+	// Digests are checked before UUIDs, since uuid.Parse also accepts 32
+	// hex characters without dashes.
+	if m.hexDigestRegex.MatchString(s) {
+		return "digest"
+	}
+	if _, err := uuid.Parse(s); err == nil {
+		return "uuid"
+	}
+	if err := iban.Validate(strings.ReplaceAll(s, " ", "")); err == nil {
+		return "iban"
+	}
+	if m.creditCardRegex.MatchString(s) {
+		// Clean the string of any separators before Luhn check
+		if num, err := strconv.Atoi(strings.ReplaceAll(strings.ReplaceAll(s, " ", ""), "-", "")); err == nil && luhn.Valid(num) {
+			return "credit_card"
 		}
-		if m.ksuidRegex.MatchString(s) {
-			return m.generateAlphanumericN(27)
+	}
+	// Without a region phone numbers only parse with the plus of their
+	// country code, and parsing is slow, so it is tried on those alone.
+	if strings.ContainsAny(s, "+\uFF0B") {
+		if _, err := phonenumbers.Parse(s, ""); err == nil {
+			return "phone"
 		}
-		if _, err := url.ParseRequestURI(s); err == nil {
-			return m.faker.URL()
+	}
+	if matches := m.currencyRegex.FindStringSubmatch(s); len(matches) == 3 {
+		return "currency"
+	}
+	if m.ulidRegex.MatchString(s) {
+		return "ulid"
+	}
+	if m.ksuidRegex.MatchString(s) {
+		return "ksuid"
+	}
+	// File paths must be checked before URLs, as an absolute Unix path is
+	// also a valid request URI.
+	if m.unixPathRegex.MatchString(s) {
+		return "unix_path"
+	}
+	if m.winPathRegex.MatchString(s) {
+		return "windows_path"
+	}
+	if m.isOpaqueToken(s) {
+		return "token"
+	}
+	if _, err := url.ParseRequestURI(s); err == nil {
+		return "url"
+	}
+	if m.emailRegex.MatchString(s) {
+		return "email"
+	}
+	if _, err := net.ParseMAC(s); err == nil {
+		return "mac_address"
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		if ip.To4() != nil {
+			return "ipv4"
 		}
-		if m.emailRegex.MatchString(s) {
-			return m.faker.Email()
+		return "ipv6"
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return "integer"
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return "decimal"
+	}
+	if strings.ContainsAny(s, "0123456789") {
+		for _, layout := range m.dateLayouts {
+			if _, err := time.Parse(layout, s); err == nil {
+				return "date"
+			}
 		}
-		if _, err := net.ParseMAC(s); err == nil {
-			return m.faker.MacAddress()
+	}
+	if m.numLikeRegex.MatchString(s) {
+		return "number_like"
+	}
+	if _, err := dateparse.ParseAny(s); err == nil {
+		return "datetime"
+	}
+	return "text"
+}
+
+func (m *masker) maskUncached(value any) any {
+	m.seeder.SeedFaker(m.faker, value)
+	switch v := value.(type) {
+	case string:
+		return m.maskString(v, m.detectedType(v))
+	case json.Number:
+		return json.Number(m.maskNumber(v.String()))
+	case bool:
+		return m.faker.Bool()
+	}
+	return "[MASKED UNSUPPORTED TYPE]"
+}
+
+// maskNumber replaces the digits of a number, keeping the number of digits
+// before and after the decimal point and, with preserveSign, its sign.
+func (m *masker) maskNumber(s string) string {
+	sign := ""
+	if m.preserveSign && (strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+")) {
+		sign, s = s[:1], s[1:]
+	}
+	integerPart, fractionalPart, _ := strings.Cut(s, ".")
+	template := strings.Repeat("#", len(integerPart))
+	if fractionalPart != "" {
+		template += "." + strings.Repeat("#", len(fractionalPart))
+	}
+	return sign + m.faker.Numerify(template)
+}
+
+// maskString generates a fake for a string of the type detectStringType
+// returned for it.
+func (m *masker) maskString(s, kind string) string {
+	switch kind {
+	case "empty":
+		return s
+	case "digest", "token":
+		return m.maskCharset(s)
+	case "uuid":
+		return m.faker.UUID()
+	case "iban":
+		if m.locale != nil {
+			return m.localeIBAN()
 		}
-		if ip := net.ParseIP(s); ip != nil {
-			if ip.To4() != nil {
-				return m.faker.IPv4Address()
-			}
-			return m.faker.IPv6Address()
+		// Generate a fake IBAN that looks plausible
+		return m.faker.Regex(`[A-Z]{2}\d{2}[A-Z\d]{4}\d{7,12}`)
+	case "credit_card":
+		return m.faker.CreditCardNumber(nil)
+	case "phone":
+		if m.locale != nil {
+			return m.localePhone()
 		}
-		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
-			return m.faker.Numerify(strings.Repeat("#", len(s)))
+		return m.faker.Phone()
+	case "currency":
+		currencySymbol := "$"
+		if matches := m.currencyRegex.FindStringSubmatch(s); matches != nil {
+			currencySymbol = matches[1]
 		}
-		if _, err := strconv.ParseFloat(s, 64); err == nil {
-			parts := strings.Split(s, ".")
-			integerPart := parts[0]
-			fractionalPart := ""
-			if len(parts) > 1 {
-				fractionalPart = parts[1]
-			}
-			template := strings.Repeat("#", len(integerPart))
-			if fractionalPart != "" {
-				template += "." + strings.Repeat("#", len(fractionalPart))
-			}
-			return m.faker.Numerify(template)
+		// Generate a new random amount
+		newAmount := fmt.Sprintf("%.2f", m.faker.Price(0, 1000))
+		return currencySymbol + " " + newAmount
+	case "ulid":
+		return m.faker.Regex(`[0-7][0-9A-HJKMNP-TV-Z]{25}`)
+	case "ksuid":
+		return m.generateAlphanumericN(27)
+	case "unix_path":
+		return m.maskPath(s, "/")
+	case "windows_path":
+		return m.maskPath(s, `\`)
+	case "url":
+		return m.faker.URL()
+	case "email":
+		if m.locale != nil {
+			return m.localeEmail()
 		}
-		for _, layout := range m.dateLayouts {
-			if _, err := time.Parse(layout, s); err == nil {
-				return m.faker.DateRange(Now().AddDate(-5, 0, 0), Now()).Format(layout)
+		return m.faker.Email()
+	case "mac_address":
+		return m.faker.MacAddress()
+	case "ipv4":
+		return m.faker.IPv4Address()
+	case "ipv6":
+		return m.faker.IPv6Address()
+	case "integer", "decimal":
+		return m.maskNumber(s)
+	case "date":
+		layout := "2006-01-02" // For values forced to be dates by a rule
+		for _, l := range m.dateLayouts {
+			if _, err := time.Parse(l, s); err == nil {
+				layout = l
+				break
 			}
 		}
-		if m.numLikeRegex.MatchString(s) {
-			var result strings.Builder
-			for _, char := range s {
-				if char >= '0' && char <= '9' {
-					result.WriteString(strconv.Itoa(m.faker.Rand.Intn(10)))
-				} else {
-					result.WriteRune(char)
-				}
-			}
-			return result.String()
-		}
-		if _, err := dateparse.ParseAny(s); err == nil {
-			return m.faker.DateRange(Now().AddDate(-5, 0, 0), Now()).Format(time.RFC3339)
-		}
-		words := strings.Split(s, " ")
-		maskedWords := make([]string, len(words))
-		caser := cases.Title(language.English)
-		for i, word := range words {
-			m.seeder.SeedFakerForWord(m.faker, word)
-			maskedWord := m.faker.Word()
-			if len(word) > 0 && word[0] >= 'A' && word[0] <= 'Z' {
-				maskedWords[i] = caser.String(maskedWord)
+		return m.faker.DateRange(Now().AddDate(-5, 0, 0), Now()).Format(layout)
+	case "number_like":
+		var result strings.Builder
+		for _, char := range s {
+			if char >= '0' && char <= '9' {
+				result.WriteString(strconv.Itoa(m.faker.Rand.Intn(10)))
 			} else {
-				maskedWords[i] = maskedWord
+				result.WriteRune(char)
 			}
 		}
-		return strings.Join(maskedWords, " ")
-	case json.Number:
-		s := v.String()
-		if strings.Contains(s, ".") {
-			parts := strings.Split(s, ".")
-			template := strings.Repeat("#", len(parts[0])) + "." + strings.Repeat("#", len(parts[1]))
-			return json.Number(m.faker.Numerify(template))
+		return result.String()
+	case "datetime":
+		return m.faker.DateRange(Now().AddDate(-5, 0, 0), Now()).Format(time.RFC3339)
+	}
+	return m.maskWords(s)
+}
+
+// maskPath masks every directory and file name in a path while keeping the
+// separator style, the depth, the root (drive letter, UNC host prefix, "~" or
+// relative dots) and the extension of the final element.
+func (m *masker) maskPath(s, sep string) string {
+	segments := strings.Split(s, sep)
+	for i, segment := range segments {
+		switch {
+		case segment == "", segment == "~", segment == ".", segment == "..":
+			continue
+		case i == 0 && sep == `\` && len(segment) == 2 && segment[1] == ':':
+			continue // Drive letter
 		}
-		return json.Number(m.faker.Numerify(strings.Repeat("#", len(s))))
-	case bool:
-		return m.faker.Bool()
+		prefix := ""
+		if strings.HasPrefix(segment, ".") {
+			prefix = "."
+			segment = segment[1:]
+		}
+		ext := ""
+		if i == len(segments)-1 {
+			if dot := strings.LastIndex(segment, "."); dot > 0 {
+				ext = segment[dot:]
+				segment = segment[:dot]
+			}
+		}
+		segments[i] = prefix + m.maskPathSegment(segment) + ext
 	}
-	return "[MASKED UNSUPPORTED TYPE]"
+	return strings.Join(segments, sep)
+}
+
+// maskPathSegment replaces a single path element with a fake word. Each
+// element is seeded on its own so a directory keeps the same masked name
+// across all paths that contain it.
+func (m *masker) maskPathSegment(segment string) string {
+	m.seeder.SeedFakerForWord(m.faker, segment)
+	masked := m.faker.Word()
+	if len(segment) > 0 && segment[0] >= 'A' && segment[0] <= 'Z' {
+		return cases.Title(language.English).String(masked)
+	}
+	return masked
 }
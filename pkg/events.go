@@ -0,0 +1,51 @@
+package pkg
+
+// MaskEvent describes a value masking changed, for embedders auditing,
+// counting or vetoing what a run masks. OnMask receives one for every such
+// value, from the worker masking it.
+type MaskEvent struct {
+	Path     string // Key path, e.g. "items[2].email", or empty for lines of text
+	Type     string // Detected type of the original, e.g. "email", "number" or "first_name"
+	Original any    // Truncated to a string if RedactEvents is set
+	Masked   any
+}
+
+// masked reports that masking changed original at key into masked, and
+// returns the value to write: masked, or original when OnMask rejects it.
+// Values rejected are not noted for Verify, as they are meant to be kept.
+func (c *AppConfig) masked(m *masker, key string, original, masked any) any {
+	// XML elements masked with their record are compared and reported by
+	// their text, as maps cannot be compared.
+	originalValue, maskedValue := leafValue(original), leafValue(masked)
+	if (c.OnMask != nil || c.stats != nil) && originalValue != maskedValue {
+		kind := m.eventType(key, originalValue)
+		if c.OnMask != nil {
+			event := MaskEvent{Path: key, Type: kind, Original: originalValue, Masked: maskedValue}
+			if c.RedactEvents && originalValue != nil {
+				event.Original = truncateExample(formatValue(originalValue))
+			}
+			if !c.OnMask(event) {
+				return original
+			}
+		}
+		if c.stats != nil {
+			c.stats.noteMasked(kind)
+		}
+	}
+	c.noteMasked(originalValue, maskedValue)
+	return masked
+}
+
+// eventType returns the type of a masked value as detection sees it, with
+// name fields typed by their key.
+func (m *masker) eventType(key string, value any) string {
+	if value == nil {
+		return "null"
+	}
+	if _, ok := value.(string); ok && key != "" {
+		if nameType := m.nameTypeOf(fieldPath(key)); nameType != "" {
+			return nameType
+		}
+	}
+	return m.detectType(value)
+}
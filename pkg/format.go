@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// FormatFunc creates the Processor of a registered format for a run. The
+// runner masks records as the run is configured: a processor decodes the
+// records of its input with a ChunkReader and passes it to runner.Run, with
+// an Assembler encoding the masked records.
+type FormatFunc func(runner *Runner) Processor
+
+// ProcessorFunc is a function processing an input, as a Processor.
+type ProcessorFunc func(ctx context.Context, r io.Reader, w io.Writer) error
+
+func (f ProcessorFunc) Process(ctx context.Context, r io.Reader, w io.Writer) error {
+	return f(ctx, r, w)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = make(map[string]FormatFunc)
+)
+
+// builtinFormats are the formats that cannot be registered.
+var builtinFormats = []string{"json", "ndjson", "xml", "csv", "text", "mysqldump"}
+
+// RegisterFormat adds a format that can be selected by name with -format and
+// AppConfig.Format, e.g. for a proprietary record format, masked concurrently
+// as the built-in ones are. -first, -last and -range select its records.
+// Plugins loaded with LoadPlugin can call it from their init functions. Names
+// of built-in formats cannot be registered, and a name can only be
+// registered once.
+func RegisterFormat(name string, fn FormatFunc) error {
+	if name == "" || fn == nil {
+		return errors.New("format needs a name and a function")
+	}
+	if slices.Contains(builtinFormats, name) {
+		return fmt.Errorf("cannot register format %q: it is a built-in format", name)
+	}
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if _, ok := formats[name]; ok {
+		return fmt.Errorf("format %q is already registered", name)
+	}
+	formats[name] = fn
+	return nil
+}
+
+func lookupFormat(name string) (FormatFunc, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	fn, ok := formats[name]
+	return fn, ok
+}
+
+// formatNames returns the names of the built-in and registered formats.
+func formatNames() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return slices.Concat(builtinFormats, slices.Sorted(maps.Keys(formats)))
+}
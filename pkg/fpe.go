@@ -0,0 +1,285 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// fpeMinDomain is the minimum number of possible values a numeral string must
+// have before it is encrypted, as required by NIST SP 800-38G Rev. 1.
+const fpeMinDomain = 1000000
+
+// FF1 implements the FF1 format-preserving encryption mode from NIST SP
+// 800-38G. It encrypts a string of numerals from an alphabet into another
+// string of the same length over the same alphabet.
+type FF1 struct {
+	block cipher.Block
+	tweak []byte
+}
+
+// NewFF1 creates an FF1 cipher from an AES-128, AES-192 or AES-256 key and an
+// optional tweak.
+func NewFF1(key, tweak []byte) (*FF1, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fpe key: %w", err)
+	}
+	return &FF1{block: block, tweak: tweak}, nil
+}
+
+// Encrypt encrypts x, whose characters must all occur in alphabet.
+func (f *FF1) Encrypt(x, alphabet string) (string, error) {
+	return f.crypt(x, alphabet, true)
+}
+
+// Decrypt reverses Encrypt.
+func (f *FF1) Decrypt(x, alphabet string) (string, error) {
+	return f.crypt(x, alphabet, false)
+}
+
+func (f *FF1) crypt(x, alphabet string, encrypt bool) (string, error) {
+	radix := len(alphabet)
+	numerals := make([]int, len(x))
+	for i := range x {
+		numerals[i] = strings.IndexByte(alphabet, x[i])
+		if numerals[i] < 0 {
+			return "", fmt.Errorf("character %q is not in the fpe alphabet", x[i])
+		}
+	}
+
+	n := len(numerals)
+	domain := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(n)), nil)
+	if n < 2 || domain.Cmp(big.NewInt(fpeMinDomain)) < 0 {
+		return "", errors.New("value is too short for format-preserving encryption")
+	}
+
+	u := n / 2
+	v := n - u
+	a, b := numerals[:u], numerals[u:]
+
+	radixV := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(v)), nil)
+	byteLen := (new(big.Int).Sub(radixV, big.NewInt(1)).BitLen() + 7) / 8
+	d := 4*((byteLen+3)/4) + 4
+
+	p := make([]byte, 16)
+	p[0], p[1], p[2] = 1, 2, 1
+	p[3], p[4], p[5] = byte(radix>>16), byte(radix>>8), byte(radix)
+	p[6], p[7] = 10, byte(u)
+	binary.BigEndian.PutUint32(p[8:12], uint32(n))
+	binary.BigEndian.PutUint32(p[12:16], uint32(len(f.tweak)))
+
+	padding := (16 - (len(f.tweak)+byteLen+1)%16) % 16
+	q := make([]byte, len(f.tweak)+padding+1+byteLen)
+	copy(q, f.tweak)
+
+	for step := range 10 {
+		i := step
+		if !encrypt {
+			i = 9 - step
+		}
+		// The round function is keyed on B when encrypting and on A when
+		// decrypting, since the halves are swapped in the opposite direction.
+		roundInput := b
+		if !encrypt {
+			roundInput = a
+		}
+		q[len(f.tweak)+padding] = byte(i)
+		num := numeralsToInt(roundInput, radix)
+		num.FillBytes(q[len(q)-byteLen:])
+
+		y := new(big.Int).SetBytes(f.roundBytes(p, q, d))
+		m := u
+		if i%2 == 1 {
+			m = v
+		}
+		modulus := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+
+		if encrypt {
+			c := numeralsToInt(a, radix)
+			c.Add(c, y).Mod(c, modulus)
+			a, b = b, intToNumerals(c, radix, m)
+		} else {
+			c := numeralsToInt(b, radix)
+			c.Sub(c, y).Mod(c, modulus)
+			a, b = intToNumerals(c, radix, m), a
+		}
+	}
+
+	out := make([]byte, 0, n)
+	for _, numeral := range a {
+		out = append(out, alphabet[numeral])
+	}
+	for _, numeral := range b {
+		out = append(out, alphabet[numeral])
+	}
+	return string(out), nil
+}
+
+// roundBytes computes the first d bytes of the FF1 round function output S
+// for the blocks P || Q.
+func (f *FF1) roundBytes(p, q []byte, d int) []byte {
+	r := make([]byte, 16)
+	for _, msg := range [][]byte{p, q} {
+		for off := 0; off < len(msg); off += 16 {
+			for j := range 16 {
+				r[j] ^= msg[off+j]
+			}
+			f.block.Encrypt(r, r)
+		}
+	}
+
+	s := append([]byte{}, r...)
+	block := make([]byte, 16)
+	for j := 1; len(s) < d; j++ {
+		copy(block, r)
+		counter := make([]byte, 16)
+		binary.BigEndian.PutUint64(counter[8:], uint64(j))
+		for k := range block {
+			block[k] ^= counter[k]
+		}
+		f.block.Encrypt(block, block)
+		s = append(s, block...)
+	}
+	return s[:d]
+}
+
+func numeralsToInt(numerals []int, radix int) *big.Int {
+	num := new(big.Int)
+	r := big.NewInt(int64(radix))
+	for _, numeral := range numerals {
+		num.Mul(num, r).Add(num, big.NewInt(int64(numeral)))
+	}
+	return num
+}
+
+func intToNumerals(num *big.Int, radix, length int) []int {
+	numerals := make([]int, length)
+	r := big.NewInt(int64(radix))
+	mod := new(big.Int)
+	num = new(big.Int).Set(num)
+	for i := length - 1; i >= 0; i-- {
+		num.DivMod(num, r, mod)
+		numerals[i] = int(mod.Int64())
+	}
+	return numerals
+}
+
+const (
+	fpeDigits = "0123456789"
+	fpeLower  = "abcdefghijklmnopqrstuvwxyz"
+	fpeUpper  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// fpeClasses returns a bitmask of the character classes (digit, lower, upper)
+// present in s.
+func fpeClasses(s string) int {
+	classes := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			classes |= 1
+		case c >= 'a' && c <= 'z':
+			classes |= 2
+		case c >= 'A' && c <= 'Z':
+			classes |= 4
+		}
+	}
+	return classes
+}
+
+func fpeAlphabet(classes int) string {
+	var alphabet string
+	if classes&1 != 0 {
+		alphabet += fpeDigits
+	}
+	if classes&2 != 0 {
+		alphabet += fpeLower
+	}
+	if classes&4 != 0 {
+		alphabet += fpeUpper
+	}
+	return alphabet
+}
+
+// fpeCipher encrypts the ASCII alphanumeric characters of a value in place,
+// leaving separators and other characters where they are.
+//
+// The alphabet is derived from the classes of characters present (digits,
+// lowercase, uppercase). Cycle walking keeps the ciphertext within the exact
+// same set of classes, so the alphabet can be derived from the ciphertext
+// again when decrypting.
+type fpeCipher struct {
+	ff1     *FF1
+	decrypt bool
+}
+
+func (c *fpeCipher) transform(s string, valid func(string) bool) (string, error) {
+	var numerals strings.Builder
+	for i := 0; i < len(s); i++ {
+		if fpeClasses(s[i:i+1]) != 0 {
+			numerals.WriteByte(s[i])
+		}
+	}
+	x := numerals.String()
+	classes := fpeClasses(x)
+	alphabet := fpeAlphabet(classes)
+	inDomain := func(y string) bool {
+		return fpeClasses(y) == classes && (valid == nil || valid(y))
+	}
+	if !inDomain(x) {
+		return "", errors.New("value is outside the fpe domain")
+	}
+
+	var err error
+	for {
+		if c.decrypt {
+			x, err = c.ff1.Decrypt(x, alphabet)
+		} else {
+			x, err = c.ff1.Encrypt(x, alphabet)
+		}
+		if err != nil {
+			return "", err
+		}
+		if inDomain(x) {
+			break
+		}
+	}
+
+	out := []byte(s)
+	j := 0
+	for i := range out {
+		if fpeClasses(s[i:i+1]) != 0 {
+			out[i] = x[j]
+			j++
+		}
+	}
+	return string(out), nil
+}
+
+// mask encrypts (or decrypts) a string or JSON number. Numbers keep a valid
+// JSON representation by never gaining a leading zero in their integer part.
+func (c *fpeCipher) mask(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return c.transform(v, nil)
+	case json.Number:
+		s := v.String()
+		if strings.ContainsAny(s, "eE") {
+			return nil, errors.New("exponent notation is not supported by fpe")
+		}
+		intLen := len(strings.TrimPrefix(s, "-"))
+		if dot := strings.IndexByte(s, '.'); dot >= 0 {
+			intLen = len(strings.TrimPrefix(s[:dot], "-"))
+		}
+		noLeadingZero := func(digits string) bool { return intLen == 1 || digits[0] != '0' }
+		out, err := c.transform(s, noLeadingZero)
+		return json.Number(out), err
+	}
+	return nil, fmt.Errorf("unsupported type %T for fpe", value)
+}
@@ -0,0 +1,340 @@
+package pkg
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// pathGlob matches dotted key paths such as "user.address.city". Every
+// segment of the pattern matches one segment of the key, with the usual glob
+// syntax (*, ?, [a-z], {a,b}) that never matches across dots. A segment that
+// is just "**" matches any number of segments, including none, so "**.email"
+// matches "email" as well as "user.contact.email", and "user.**" matches
+// "user" and everything below it. Alternatives spanning segments, as in
+// "{user.email,contact}", are matched as separate patterns.
+//
+// Elements of arrays and repeated XML elements have their index in the key,
+// as in "items[2].token". Segments ending in index selectors, such as
+// "items[0]" or "items[*]", only match those elements; other segments match
+// every element. A key segment without an index, such as an element that is
+// not repeated, counts as the first one.
+type pathGlob struct {
+	alternatives [][]globSegment
+}
+
+type globSegment struct {
+	name    glob.Glob // nil for **
+	indexes []string  // Index selectors: digits or *
+}
+
+// indexSelectorRegex matches the index selectors ending a pattern segment.
+var indexSelectorRegex = regexp.MustCompile(`(\[(\d+|\*)\])+$`)
+
+// compileGlob compiles a key pattern into a pathGlob.
+func compileGlob(pattern string) (glob.Glob, error) {
+	var g pathGlob
+	for _, alternative := range expandAlternatives(pattern) {
+		var segments []globSegment
+		for _, segment := range splitPattern(alternative) {
+			if segment == "**" {
+				if n := len(segments); n > 0 && segments[n-1].name == nil {
+					continue // Consecutive ** match the same as one
+				}
+				segments = append(segments, globSegment{})
+				continue
+			}
+			var indexes []string
+			if selectors := indexSelectorRegex.FindString(segment); selectors != "" {
+				segment = strings.TrimSuffix(segment, selectors)
+				indexes = strings.Split(strings.Trim(selectors, "[]"), "][")
+			}
+			// Within a segment ** has nothing more to cross than *.
+			compiled, err := glob.Compile(strings.ReplaceAll(segment, "**", "*"))
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, globSegment{name: compiled, indexes: indexes})
+		}
+		g.alternatives = append(g.alternatives, segments)
+	}
+	return &g, nil
+}
+
+func (g *pathGlob) Match(key string) bool {
+	segments := strings.Split(key, ".")
+	for _, alternative := range g.alternatives {
+		if matchSegments(alternative, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern []globSegment, key []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0].name == nil {
+			for i := 0; i <= len(key); i++ {
+				if matchSegments(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(key) == 0 || !pattern[0].match(key[0]) {
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
+
+// coversSubtree reports whether g matches the key of segments and every key
+// below it, as "user.**" does for "user", so the subtree at key can be left
+// alone as a whole. Keys that might be an array holding elements the pattern
+// does not select are never covered.
+func (g *pathGlob) coversSubtree(segments []string) bool {
+	for _, alternative := range g.alternatives {
+		if coversSegments(alternative, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// reaches reports whether g can match the key of segments or a key below it.
+// When it cannot, nothing in the subtree at key is selected by g. The key may
+// be an array, of which g can select elements by index.
+func (g *pathGlob) reaches(segments []string) bool {
+	for _, alternative := range g.alternatives {
+		if reachesSegments(alternative, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// reachesEverything reports whether g reaches every key, as a pattern
+// starting with ** does.
+func (g *pathGlob) reachesEverything() bool {
+	for _, alternative := range g.alternatives {
+		if len(alternative) > 0 && alternative[0].name == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func reachesSegments(pattern []globSegment, key []string) bool {
+	for len(key) > 0 {
+		switch {
+		case len(pattern) == 0:
+			return false
+		case pattern[0].name == nil:
+			return true
+		case len(key) == 1:
+			return pattern[0].reaches(key[0])
+		case !pattern[0].match(key[0]):
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return true
+}
+
+// coversSubtrees reports whether g can cover a subtree at all, which takes a
+// pattern ending in **.
+func (g *pathGlob) coversSubtrees() bool {
+	for _, alternative := range g.alternatives {
+		if n := len(alternative); n > 0 && alternative[n-1].name == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func coversSegments(pattern []globSegment, key []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0].name == nil {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if coversSegments(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(key) == 0 || !pattern[0].match(key[0]) {
+			return false
+		}
+		if _, indexes := splitIndexes(key[0]); len(key) == 1 && pattern[0].indexes != nil && len(indexes) == 0 {
+			return false // An array, of which the pattern may select only some elements
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return false
+}
+
+func (s globSegment) match(segment string) bool {
+	name, indexes := splitIndexes(segment)
+	if !s.name.Match(name) {
+		return false
+	}
+	if s.indexes == nil {
+		return true
+	}
+	if len(indexes) == 0 {
+		indexes = []int{0}
+	}
+	if len(indexes) != len(s.indexes) {
+		return false
+	}
+	for i, selector := range s.indexes {
+		if n, err := strconv.Atoi(selector); selector != "*" && (err != nil || n != indexes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// reaches reports whether s matches segment or, if it is an array, any of its
+// elements: the indexes of segment only need to match the first selectors of
+// s.
+func (s globSegment) reaches(segment string) bool {
+	name, indexes := splitIndexes(segment)
+	if !s.name.Match(name) {
+		return false
+	}
+	if s.indexes == nil {
+		return true
+	}
+	if len(indexes) > len(s.indexes) {
+		return false
+	}
+	for i, index := range indexes {
+		if n, err := strconv.Atoi(s.indexes[i]); s.indexes[i] != "*" && (err != nil || n != index) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitIndexes splits a key segment such as "items[2]" into its name and the
+// array indexes following it.
+func splitIndexes(segment string) (string, []int) {
+	var indexes []int
+	for strings.HasSuffix(segment, "]") {
+		open := strings.LastIndexByte(segment, '[')
+		if open < 0 {
+			break
+		}
+		n, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+		if err != nil || n < 0 {
+			break
+		}
+		indexes = append([]int{n}, indexes...)
+		segment = segment[:open]
+	}
+	return segment, indexes
+}
+
+// indexKey returns the key of element i of the array or repeated element at
+// key.
+func indexKey(key string, i int) string {
+	return key + "[" + strconv.Itoa(i) + "]"
+}
+
+// fieldPath returns key without array indexes: the path identifying a field
+// for seeding, uniqueness and mappings, which are shared by all elements.
+func fieldPath(key string) string {
+	if !strings.Contains(key, "]") {
+		return key
+	}
+	segments := strings.Split(key, ".")
+	for i, segment := range segments {
+		segments[i], _ = splitIndexes(segment)
+	}
+	return strings.Join(segments, ".")
+}
+
+// expandAlternatives expands the first brace group holding a dot into a
+// pattern per alternative, recursively, so segments never contain dots.
+// Groups within a single segment are left to the segment's glob.
+func expandAlternatives(pattern string) []string {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			for i < len(pattern) && pattern[i] != ']' {
+				i++
+			}
+		case '{':
+			end, alternatives := braceGroup(pattern, i)
+			if end < 0 || !strings.Contains(pattern[i:end], ".") {
+				continue
+			}
+			var expanded []string
+			for _, alternative := range alternatives {
+				expanded = append(expanded, expandAlternatives(pattern[:i]+alternative+pattern[end+1:])...)
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
+
+// braceGroup returns the index of the brace closing the group opened at
+// start, or -1, and the comma-separated alternatives within it.
+func braceGroup(pattern string, start int) (int, []string) {
+	var alternatives []string
+	depth, from := 0, start+1
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, append(alternatives, pattern[from:i])
+			}
+		case ',':
+			if depth == 1 {
+				alternatives = append(alternatives, pattern[from:i])
+				from = i + 1
+			}
+		}
+	}
+	return -1, nil
+}
+
+// splitPattern splits a pattern on the dots that separate its segments,
+// leaving dots within braces, brackets or escaped by a backslash alone.
+func splitPattern(pattern string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth > 0 {
+				depth--
+			}
+		case '.':
+			if depth == 0 {
+				segments = append(segments, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, pattern[start:])
+}
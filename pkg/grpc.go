@@ -0,0 +1,284 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MaskProto masks the fields of msg in place. Fields are keyed by their path
+// of proto field names, such as "user.email" or "items[2].sku", and masked as
+// the fields of a JSON record are. Fields annotated with debug_redact, and
+// all fields of messages so annotated, are masked unless excluded, whatever
+// the include patterns; enums are kept.
+func (e *Engine) MaskProto(msg proto.Message) {
+	e.maskers.with(func(m *masker) { e.fields.maskMessage(m, "", msg.ProtoReflect(), false) })
+}
+
+// maskMessage masks the fields of msg at key path key. redact is set in
+// messages annotated with debug_redact.
+func (c *AppConfig) maskMessage(m *masker, key string, msg protoreflect.Message, redact bool) {
+	// Fields are collected first, as msg must not change while ranging.
+	var fields []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		fieldKey := joinKey(key, string(fd.Name()))
+		redactField := redact || isRedacted(fd)
+		switch {
+		case fd.IsList():
+			list := msg.Mutable(fd).List()
+			for i := range list.Len() {
+				if fd.Message() != nil {
+					c.maskMessage(m, indexKey(fieldKey, i), list.Get(i).Message(), redactField)
+				} else if masked, ok := c.maskProtoValue(m, fd, indexKey(fieldKey, i), list.Get(i), redactField); ok {
+					list.Set(i, masked)
+				}
+			}
+		case fd.IsMap():
+			entries := msg.Mutable(fd).Map()
+			var keys []protoreflect.MapKey
+			entries.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+				keys = append(keys, k)
+				return true
+			})
+			valueField := fd.MapValue()
+			for _, k := range keys {
+				entryKey := joinKey(fieldKey, k.String())
+				if valueField.Message() != nil {
+					c.maskMessage(m, entryKey, entries.Mutable(k).Message(), redactField)
+				} else if masked, ok := c.maskProtoValue(m, valueField, entryKey, entries.Get(k), redactField); ok {
+					entries.Set(k, masked)
+				}
+			}
+		case fd.Message() != nil:
+			c.maskMessage(m, fieldKey, msg.Mutable(fd).Message(), redactField)
+		default:
+			if masked, ok := c.maskProtoValue(m, fd, fieldKey, msg.Get(fd), redactField); ok {
+				msg.Set(fd, masked)
+			}
+		}
+	}
+}
+
+// isRedacted reports whether fd is annotated with debug_redact.
+func isRedacted(fd protoreflect.FieldDescriptor) bool {
+	options, ok := fd.Options().(*descriptorpb.FieldOptions)
+	return ok && options.GetDebugRedact()
+}
+
+// maskProtoValue masks the scalar value of field fd at key, and reports
+// whether masking changed it. Masked values that do not fit the kind of fd,
+// such as text masking a number, become its default rather than being kept.
+func (c *AppConfig) maskProtoValue(m *masker, fd protoreflect.FieldDescriptor, key string, value protoreflect.Value, redact bool) (protoreflect.Value, bool) {
+	var original any
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		original = value.String()
+	case protoreflect.BytesKind:
+		original = string(value.Bytes())
+	case protoreflect.BoolKind:
+		original = value.Bool()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		original = json.Number(strconv.FormatInt(value.Int(), 10))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		original = json.Number(strconv.FormatUint(value.Uint(), 10))
+	case protoreflect.FloatKind:
+		original = json.Number(strconv.FormatFloat(value.Float(), 'g', -1, 32))
+	case protoreflect.DoubleKind:
+		original = json.Number(strconv.FormatFloat(value.Float(), 'g', -1, 64))
+	default:
+		return value, false
+	}
+	var masked any
+	if redact {
+		masked = c.maskRedacted(m, key, original)
+	} else {
+		masked = c.maskField(m, key, original)
+	}
+	if masked == original {
+		return value, false
+	}
+	if masked == nil {
+		return fd.Default(), true
+	}
+	text := formatValue(masked)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(text), true
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(text)), true
+	case protoreflect.BoolKind:
+		if b, err := strconv.ParseBool(text); err == nil {
+			return protoreflect.ValueOfBool(b), true
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return protoreflect.ValueOfInt32(int32(i)), true
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return protoreflect.ValueOfInt64(i), true
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if u, err := strconv.ParseUint(text, 10, 32); err == nil {
+			return protoreflect.ValueOfUint32(uint32(u)), true
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if u, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return protoreflect.ValueOfUint64(u), true
+		}
+	case protoreflect.FloatKind:
+		if f, err := strconv.ParseFloat(text, 32); err == nil {
+			return protoreflect.ValueOfFloat32(float32(f)), true
+		}
+	case protoreflect.DoubleKind:
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return protoreflect.ValueOfFloat64(f), true
+		}
+	}
+	return fd.Default(), true
+}
+
+// maskRedacted masks the value of a field annotated with debug_redact, as
+// maskField masks those include patterns select.
+func (c *AppConfig) maskRedacted(m *masker, key string, value any) any {
+	if c.isSafe(value) || matchesAny(key, c.ExcludeGlobs) {
+		return value
+	}
+	rule := c.ruleFor(m, key, value)
+	return c.masked(m, key, value, c.clampField(m, rule, key, c.maskFieldValue(m, rule, fieldPath(key), value)))
+}
+
+// MaskingInterceptors are gRPC interceptors masking the proto messages of
+// calls, as MaskProto masks them, in a service or a client. Sidecars and
+// debugging proxies in a service mesh use them so real data is not seen
+// past them. Messages that are not proto messages are passed on as they are.
+type MaskingInterceptors struct {
+	Engine    *Engine
+	Requests  bool // Mask requests before they are handled or sent
+	Responses bool // Mask responses before they are sent or returned
+}
+
+// maskReceived masks a message received, which no one else holds, in place.
+func (i MaskingInterceptors) maskReceived(msg any) {
+	if m, ok := msg.(proto.Message); ok {
+		i.Engine.MaskProto(m)
+	}
+}
+
+// maskSent returns a masked copy of a message to send, leaving the message of
+// the caller or handler as it is.
+func (i MaskingInterceptors) maskSent(msg any) any {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return msg
+	}
+	m = proto.Clone(m)
+	i.Engine.MaskProto(m)
+	return m
+}
+
+// UnaryServer returns an interceptor masking the requests and responses of
+// unary calls a server handles.
+func (i MaskingInterceptors) UnaryServer() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if i.Requests {
+			i.maskReceived(req)
+		}
+		resp, err := handler(ctx, req)
+		if err != nil || !i.Responses {
+			return resp, err
+		}
+		return i.maskSent(resp), nil
+	}
+}
+
+// StreamServer returns an interceptor masking the messages of streams a
+// server handles.
+func (i MaskingInterceptors) StreamServer() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &maskingServerStream{ServerStream: ss, interceptors: i})
+	}
+}
+
+// UnaryClient returns an interceptor masking the requests and responses of
+// unary calls a client makes.
+func (i MaskingInterceptors) UnaryClient() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if i.Requests {
+			req = i.maskSent(req)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil && i.Responses {
+			i.maskReceived(reply)
+		}
+		return err
+	}
+}
+
+// StreamClient returns an interceptor masking the messages of streams a
+// client opens.
+func (i MaskingInterceptors) StreamClient() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &maskingClientStream{ClientStream: cs, interceptors: i}, nil
+	}
+}
+
+// maskingServerStream masks the messages of a stream StreamServer intercepts.
+type maskingServerStream struct {
+	grpc.ServerStream
+	interceptors MaskingInterceptors
+}
+
+func (s *maskingServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.interceptors.Requests {
+		s.interceptors.maskReceived(m)
+	}
+	return nil
+}
+
+func (s *maskingServerStream) SendMsg(m any) error {
+	if s.interceptors.Responses {
+		m = s.interceptors.maskSent(m)
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// maskingClientStream masks the messages of a stream StreamClient intercepts.
+type maskingClientStream struct {
+	grpc.ClientStream
+	interceptors MaskingInterceptors
+}
+
+func (s *maskingClientStream) SendMsg(m any) error {
+	if s.interceptors.Requests {
+		m = s.interceptors.maskSent(m)
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *maskingClientStream) RecvMsg(m any) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.interceptors.Responses {
+		s.interceptors.maskReceived(m)
+	}
+	return nil
+}
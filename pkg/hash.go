@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// hasher replaces values by their keyed HMAC-SHA256, giving stable
+// pseudonyms that cannot be reversed without brute-forcing the salt.
+type hasher struct {
+	salt   []byte
+	config HashConfig
+}
+
+// sum returns the encoded HMAC of the string form of value. Numbers and
+// booleans are hashed as well, and become strings.
+func (h *hasher) sum(value any) any {
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(formatValue(value)))
+	var encoded string
+	if h.config.Encoding == "base64" {
+		encoded = base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	} else {
+		encoded = hex.EncodeToString(mac.Sum(nil))
+	}
+	if h.config.Length > 0 && h.config.Length < len(encoded) {
+		encoded = encoded[:h.config.Length]
+	}
+	return encoded
+}
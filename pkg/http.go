@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bodyFormat returns the format of a body of contentType that can be masked:
+// json for JSON media types, such as application/problem+json, and ndjson
+// for streams of JSON records. Other bodies are not masked.
+func bodyFormat(contentType string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json", true
+	case mediaType == "application/x-ndjson" || mediaType == "application/ndjson" || mediaType == "application/jsonl":
+		return "ndjson", true
+	}
+	return "", false
+}
+
+// maskBody masks body as the format of header says, or returns it as it is
+// when it does not hold JSON. Bodies with a content encoding, such as gzip,
+// cannot be masked and are an error rather than passed on.
+func (e *Engine) maskBody(ctx context.Context, header http.Header, body []byte) ([]byte, error) {
+	format, ok := bodyFormat(header.Get("Content-Type"))
+	if !ok {
+		return body, nil
+	}
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil, fmt.Errorf("cannot mask a body with content encoding %s", encoding)
+	}
+	masked, err := e.bodies[format].mask(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	if e.fields.MappingFile != "" {
+		return masked, e.fields.mappings.save(e.fields.MappingFile, e.fields.MappingKey)
+	}
+	return masked, nil
+}
+
+// MaskRequests returns a handler passing requests to next with their JSON
+// bodies masked, such as in front of a staging service that must not see
+// real data. Requests whose body cannot be masked are answered with 400 Bad
+// Request instead.
+func (e *Engine) MaskRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := bodyFormat(r.Header.Get("Content-Type")); !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "cannot read request body", http.StatusBadRequest)
+			return
+		}
+		masked, err := e.maskBody(r.Context(), r.Header, body)
+		if err != nil {
+			http.Error(w, "cannot mask request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(masked))
+		r.ContentLength = int64(len(masked))
+		r.Header.Set("Content-Length", strconv.Itoa(len(masked)))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MaskResponses returns a handler serving the responses of next with their
+// JSON bodies masked, such as in front of a debugging endpoint. Responses are
+// held until next returns, so they can be masked as a whole, and those that
+// cannot be masked are replaced by 500 Internal Server Error rather than
+// passed on unmasked.
+func (e *Engine) MaskResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held := &heldResponse{header: make(http.Header)}
+		next.ServeHTTP(held, r)
+		masked, err := e.maskBody(r.Context(), held.header, held.body.Bytes())
+		if err != nil {
+			http.Error(w, "cannot mask response body", http.StatusInternalServerError)
+			return
+		}
+		for key, values := range held.header {
+			w.Header()[key] = values
+		}
+		if held.status == 0 {
+			held.status = http.StatusOK
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(masked)))
+		w.WriteHeader(held.status)
+		w.Write(masked)
+	})
+}
+
+// heldResponse is a response held by MaskResponses until it is masked.
+type heldResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (h *heldResponse) Header() http.Header { return h.header }
+
+func (h *heldResponse) WriteHeader(status int) {
+	if h.status == 0 {
+		h.status = status
+	}
+}
+
+func (h *heldResponse) Write(p []byte) (int, error) {
+	h.WriteHeader(http.StatusOK)
+	return h.body.Write(p)
+}
+
+// MaskingTransport is an http.RoundTripper masking the JSON bodies of the
+// requests it sends, the responses it receives, or both, as its Engine
+// configures. Clients of a debugging proxy use it so real data is never sent
+// or seen.
+type MaskingTransport struct {
+	Engine    *Engine
+	Base      http.RoundTripper // http.DefaultTransport if nil
+	Requests  bool              // Mask request bodies before they are sent
+	Responses bool              // Mask response bodies before they are returned
+}
+
+// RoundTrip sends req with Base, masking the bodies MaskingTransport is set
+// to. Bodies that cannot be masked are an error; a request is then not sent.
+func (t *MaskingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if _, ok := bodyFormat(req.Header.Get("Content-Type")); ok && t.Requests && req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		masked, err := t.Engine.maskBody(req.Context(), req.Header, body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot mask request body: %w", err)
+		}
+		// A RoundTripper must not modify the request it was given.
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(masked))
+		req.ContentLength = int64(len(masked))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(masked)), nil }
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || !t.Responses {
+		return resp, err
+	}
+	if _, ok := bodyFormat(resp.Header.Get("Content-Type")); !ok {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	masked, err := t.Engine.maskBody(req.Context(), resp.Header, body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot mask response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(masked))
+	resp.ContentLength = int64(len(masked))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(masked)))
+	return resp, nil
+}
@@ -1,10 +1,16 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"strings"
+	"time"
 )
 
 type jsonProcessor struct {
@@ -15,14 +21,12 @@ type jsonProcessor struct {
 // newJSONProcessor creates a new processor for JSON files.
 func newJSONProcessor(config AppConfig) *jsonProcessor {
 	return &jsonProcessor{
-		config: config,
-		methodFactory: func() *masker {
-			return newMasker(config.Masker)
-		},
+		config:        config,
+		methodFactory: maskerFactory(config.Masker),
 	}
 }
 
-func (jp *jsonProcessor) Process(r io.Reader, w io.Writer) error {
+func (jp *jsonProcessor) Process(ctx context.Context, r io.Reader, w io.Writer) error {
 	br := newPeekingReader(r)
 	firstChar, err := br.PeekFirstChar()
 	if err == io.EOF {
@@ -32,73 +36,527 @@ func (jp *jsonProcessor) Process(r io.Reader, w io.Writer) error {
 		return err
 	}
 
+	lines := &lineReader{r: br, lines: br.skippedLines}
 	if firstChar == '[' {
-		return jp.processRootArray(br, w)
+		return jp.processRootArray(ctx, lines, w)
 	}
 
-	// Note: -first is not applied for single root object JSON as there is only one "record".
-	return jp.processConcurrentObject(br, w)
+	// Note: -first, -last and -range are not applied for single root object
+	// JSON as there is only one "record".
+	return jp.processConcurrentObject(ctx, lines, w)
 }
 
-func (jp *jsonProcessor) processRootArray(r io.Reader, w io.Writer) error {
-	runner := newConcurrentRunner(jp.methodFactory, jp.config)
+func (jp *jsonProcessor) processRootArray(ctx context.Context, lines *lineReader, w io.Writer) error {
+	runner := newRunner(jp.methodFactory, jp.config)
+	a := &jsonAssembler{isRootArray: true, verbatim: jp.config.canPrune(), style: jp.config.style(), marshal: jp.config.marshalJSON}
+	// With the preserve style, the input of every record is kept, from the
+	// end of the one before, until it is written.
+	var r io.Reader = lines
+	rec := &recordingReader{r: r}
+	if a.style == StylePreserve {
+		r = rec
+		a.originals = newOriginalRecords()
+		runner.keepsInput = true
+	}
 	decoder := json.NewDecoder(r)
 	decoder.UseNumber()
 	_, _ = decoder.Token() // consume '['
-	recordCount := 0
-	chunkReader := func() (any, error) {
-		if jp.config.FirstN > 0 && recordCount >= jp.config.FirstN {
-			return nil, io.EOF
-		}
+	end := decoder.InputOffset()
+	records := 0
+	readRecord := selectRecords(&jp.config, func() (originalRecord, error) {
 		if !decoder.More() {
 			_, err := decoder.Token()
 			if err != nil && err != io.EOF {
-				return nil, err
+				return originalRecord{}, lines.jsonError(err, 0, end)
 			}
-			return nil, io.EOF
+			if a.originals != nil && err == nil {
+				a.originals.setTail(rec.take(end, decoder.InputOffset()))
+			}
+			return originalRecord{}, io.EOF
 		}
-		var chunk any
-		err := decoder.Decode(&chunk)
-		recordCount++
-		return chunk, err
+		data, err := jp.decodeValue(decoder, "")
+		if err != nil {
+			return originalRecord{}, lines.jsonError(err, records+1, end)
+		}
+		records++
+		start := end
+		end = decoder.InputOffset()
+		lines.advance(end)
+		if a.originals == nil {
+			return originalRecord{data: data}, nil
+		}
+		return originalRecord{data: data, raw: rec.take(start, end)}, nil
+	})
+	chunkReader := func() (any, error) {
+		record, err := readRecord()
+		if err == nil && a.originals != nil {
+			a.originals.add(record.raw)
+		}
+		return record.data, err
 	}
-	return runner.Run(w, chunkReader, &jsonAssembler{isRootArray: true})
+	return runner.Run(ctx, w, chunkReader, a)
+}
+
+// originalRecord is a decoded record along with its input, when kept.
+type originalRecord struct {
+	data any
+	raw  []byte
 }
 
 // processConcurrentObject handles the masking of a single root JSON object.
 //
-// This method intentionally reads the entire object into memory rather than
-// streaming it. This is a design trade-off to ensure correctness and simplify the
-// implementation, avoiding the complexity and bugs associated with manually
-// handling nested structures.
-//
-// The primary, performance-critical use case—a root-level array of objects—is
-// handled by `processRootArray` which *is* fully streaming and concurrent.
-// This function serves as a robust fallback for the less common case of a
-// single, large root object.
-func (jp *jsonProcessor) processConcurrentObject(r io.Reader, w io.Writer) error {
+// The object is decoded into memory and masked as one record, except for the
+// arrays nested in it whose input grows larger than jsonStreamThreshold. Their
+// elements are masked concurrently as they are read, as those of a root array
+// are, and the parts of the object around them are written as they are
+// passed. With the preserve style, or when records are yielded rather than
+// written, the object is always read as a whole.
+func (jp *jsonProcessor) processConcurrentObject(ctx context.Context, lines *lineReader, w io.Writer) error {
+	a := &jsonAssembler{verbatim: jp.config.canPrune(), style: jp.config.style(), marshal: jp.config.marshalJSON}
+	var r io.Reader = lines
+	rec := &recordingReader{r: r}
+	if a.style == StylePreserve {
+		r = rec
+		a.originals = newOriginalRecords()
+	}
 	decoder := json.NewDecoder(r)
 	decoder.UseNumber()
-	encoder := json.NewEncoder(w)
-	encoder.SetIndent("  ", "  ")
 
-	var rawData map[string]any
-	if err := decoder.Decode(&rawData); err != nil {
-		return fmt.Errorf("error decoding root JSON object: %w", err)
+	var rawData any
+	var err error
+	var s *objectStreamer
+	if a.originals == nil && jp.config.emit == nil {
+		s = &objectStreamer{jp: jp, ctx: ctx, decoder: decoder, lines: lines, w: w, m: jp.methodFactory()}
+		rawData, err = s.decode("", "", 0)
+		if err != nil {
+			return err
+		}
+	} else if rawData, err = jp.decodeValue(decoder, ""); err != nil {
+		return lines.jsonError(fmt.Errorf("error decoding root JSON object: %w", err), 0, 0)
+	}
+	if a.originals != nil {
+		a.originals.add(rec.take(0, decoder.InputOffset()))
+	}
+	if decoder.More() {
+		return errors.New("input holds more than one root JSON value, use the ndjson format for a stream of records")
+	}
+	if rawData == streamedValue {
+		_, err := w.Write([]byte("\n"))
+		return err
 	}
 
-	m := newMasker(jp.config.Masker)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	start := time.Now()
+	m := jp.methodFactory()
 	maskedData := jp.recursiveMask(m, "", rawData)
+	jp.config.stats.worked(start)
+	jp.config.stats.record()
+	if jp.config.emit != nil {
+		return jp.config.emit(maskedData)
+	}
 
-	if err := encoder.Encode(maskedData); err != nil {
+	if err := a.WriteItem(w, maskedData, true); err != nil {
 		return fmt.Errorf("error encoding masked JSON object: %w", err)
 	}
 
 	return nil
 }
 
+// jsonStreamThreshold is the size of the input of an array nested in a root
+// object from which its elements are masked as they are read, rather than
+// decoded along with the rest of the object.
+const jsonStreamThreshold = 1 << 20
+
+// streamedValue is what objectStreamer.decode returns for a value it wrote
+// itself, having streamed an array in it.
+var streamedValue = &struct{}{}
+
+// objectStreamer decodes a root object token by token, as decodeValue does,
+// until an array in it grows larger than jsonStreamThreshold. The objects
+// and arrays holding it are then written up to it, with the values decoded
+// so far masked, and its elements are masked by a Runner as they are read.
+// Values after it are written once their object or array ends, so the
+// output holds them in input order around the arrays, and the fields of an
+// object are masked together, as for names and cards, on either side of one.
+type objectStreamer struct {
+	jp      *jsonProcessor
+	ctx     context.Context
+	decoder *json.Decoder
+	lines   *lineReader
+	w       io.Writer
+	m       *masker // Masks the values around streamed arrays
+	frames  []*jsonFrame
+}
+
+// jsonFrame is an object or array being decoded by an objectStreamer.
+type jsonFrame struct {
+	key      string
+	name     string // Of the member it is the value of, if any
+	array    bool
+	depth    int
+	members  map[string]any // Of an object, decoded but not yet written
+	elements []any          // Of an array, decoded but not yet written
+	index    int            // Of the next element of an array
+	opened   bool           // Whether its start has been written
+	written  int            // Members or elements written
+}
+
+// decode decodes the value at key, the member name of its object if any, at
+// depth in the root object, or returns streamedValue if it was written
+// instead.
+func (s *objectStreamer) decode(key, name string, depth int) (any, error) {
+	if s.jp.config.prunes(key) {
+		var raw json.RawMessage
+		if err := s.decoder.Decode(&raw); err != nil {
+			return nil, s.inputError(err)
+		}
+		return raw, nil
+	}
+	start := s.decoder.InputOffset()
+	token, err := s.decoder.Token()
+	if err != nil {
+		return nil, s.inputError(err)
+	}
+	switch token {
+	case json.Delim('{'):
+		f := &jsonFrame{key: key, name: name, depth: depth, members: make(map[string]any)}
+		s.frames = append(s.frames, f)
+		for s.decoder.More() {
+			k, err := s.decoder.Token()
+			if err != nil {
+				return nil, s.inputError(err)
+			}
+			value, err := s.decode(joinKey(key, k.(string)), k.(string), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if value != streamedValue {
+				f.members[k.(string)] = value
+			}
+		}
+		if _, err := s.decoder.Token(); err != nil { // consume '}'
+			return nil, s.inputError(err)
+		}
+		s.frames = s.frames[:len(s.frames)-1]
+		if !f.opened {
+			return f.members, nil
+		}
+		return streamedValue, s.close(f)
+	case json.Delim('['):
+		f := &jsonFrame{key: key, name: name, array: true, depth: depth, elements: make([]any, 0)}
+		s.frames = append(s.frames, f)
+		for s.decoder.More() {
+			value, err := s.decode(indexKey(key, f.index), "", depth+1)
+			if err != nil {
+				return nil, err
+			}
+			f.index++
+			switch {
+			case value == streamedValue:
+			case f.opened:
+				// Elements after a streamed one are not held.
+				began := time.Now()
+				masked := s.jp.recursiveMask(s.m, indexKey(key, f.index-1), value)
+				s.jp.config.stats.worked(began)
+				if err := s.write(f, "", masked); err != nil {
+					return nil, err
+				}
+			default:
+				f.elements = append(f.elements, value)
+			}
+			if !f.opened && s.decoder.InputOffset()-start > jsonStreamThreshold {
+				s.frames = s.frames[:len(s.frames)-1]
+				return streamedValue, s.stream(f)
+			}
+		}
+		if _, err := s.decoder.Token(); err != nil { // consume ']'
+			return nil, s.inputError(err)
+		}
+		s.frames = s.frames[:len(s.frames)-1]
+		if !f.opened {
+			return f.elements, nil
+		}
+		return streamedValue, s.close(f)
+	}
+	return token, nil
+}
+
+// stream writes the array of f, masking the elements decoded so far and the
+// rest of them concurrently as they are read.
+func (s *objectStreamer) stream(f *jsonFrame) error {
+	elements := f.elements
+	f.elements = nil
+	if err := s.open(f); err != nil {
+		return err
+	}
+	runner := newRunner(s.jp.methodFactory, s.jp.config)
+	runner.array = f.key
+	s.lines.advance(s.decoder.InputOffset())
+	end := s.decoder.InputOffset()
+	read := func() (any, error) {
+		if len(elements) > 0 {
+			element := elements[0]
+			elements = elements[1:]
+			return element, nil
+		}
+		if !s.decoder.More() {
+			if _, err := s.decoder.Token(); err != nil { // consume ']'
+				return nil, s.inputError(err)
+			}
+			return nil, io.EOF
+		}
+		value, err := s.jp.decodeValue(s.decoder, indexKey(f.key, f.index))
+		if err != nil {
+			located := s.lines.jsonError(fmt.Errorf("error decoding root JSON object: %w", err), 0, end)
+			if located.Path == "" {
+				located.Path = indexKey(f.key, f.index)
+			} else {
+				located.Path = joinKey(indexKey(f.key, f.index), located.Path)
+			}
+			return nil, located
+		}
+		f.index++
+		end = s.decoder.InputOffset()
+		s.lines.advance(end)
+		return value, nil
+	}
+	if err := runner.Run(s.ctx, s.w, read, &nestedAssembler{s: s, f: f}); err != nil {
+		return err
+	}
+	return s.close(f)
+}
+
+// open writes the start of f, after those of the objects and arrays holding
+// it along with the values decoded in them so far.
+func (s *objectStreamer) open(f *jsonFrame) error {
+	for i, parent := range s.frames {
+		if !parent.opened {
+			if err := s.writeStart(parent, s.frames[:i]); err != nil {
+				return err
+			}
+		}
+		if err := s.flush(parent); err != nil {
+			return err
+		}
+	}
+	return s.writeStart(f, s.frames)
+}
+
+// writeStart writes the start of f, held by the innermost of parents.
+func (s *objectStreamer) writeStart(f *jsonFrame, parents []*jsonFrame) error {
+	var buf bytes.Buffer
+	if len(parents) > 0 {
+		if err := s.writeEntry(&buf, parents[len(parents)-1], f.name); err != nil {
+			return err
+		}
+	}
+	if f.array {
+		buf.WriteByte('[')
+	} else {
+		buf.WriteByte('{')
+	}
+	f.opened = true
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+// flush writes the elements of f decoded before it was opened, or the
+// members of its object decoded since it was last written to, masked
+// together.
+func (s *objectStreamer) flush(f *jsonFrame) error {
+	if f.array {
+		start := time.Now()
+		masked := make([]any, len(f.elements))
+		for i, element := range f.elements {
+			masked[i] = s.jp.recursiveMask(s.m, indexKey(f.key, i), element)
+		}
+		s.jp.config.stats.worked(start)
+		f.elements = nil
+		for _, element := range masked {
+			if err := s.write(f, "", element); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(f.members) == 0 {
+		return nil
+	}
+	start := time.Now()
+	masked := s.jp.recursiveMask(s.m, f.key, f.members).(map[string]any)
+	s.jp.config.stats.worked(start)
+	f.members = make(map[string]any)
+	for _, k := range slices.Sorted(maps.Keys(masked)) {
+		if err := s.write(f, k, masked[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close writes the end of the opened object or array of f.
+func (s *objectStreamer) close(f *jsonFrame) error {
+	if err := s.flush(f); err != nil {
+		return err
+	}
+	end := "}"
+	if f.array {
+		end = "]"
+	}
+	if s.jp.config.style() == StylePretty && f.written > 0 {
+		end = "\n" + s.indent(f.depth) + end
+	}
+	_, err := io.WriteString(s.w, end)
+	return err
+}
+
+// write writes a masked value as the member name of the object of f, or as
+// the next element of its array.
+func (s *objectStreamer) write(f *jsonFrame, name string, value any) error {
+	var buf bytes.Buffer
+	if err := s.writeEntry(&buf, f, name); err != nil {
+		return err
+	}
+	if s.jp.config.style() == StylePretty {
+		if err := writeIndented(&buf, value, s.indent(f.depth)+"  "); err != nil {
+			return err
+		}
+	} else {
+		data, err := s.jp.config.marshalJSON(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+// writeEntry writes what comes before the next value in f: a comma after
+// the one before, the indentation, and the name of a member.
+func (s *objectStreamer) writeEntry(buf *bytes.Buffer, f *jsonFrame, name string) error {
+	if f.written > 0 {
+		buf.WriteByte(',')
+	}
+	f.written++
+	pretty := s.jp.config.style() == StylePretty
+	if pretty {
+		buf.WriteString("\n" + s.indent(f.depth) + "  ")
+	}
+	if f.array {
+		return nil
+	}
+	data, err := json.Marshal(name)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	if pretty {
+		buf.WriteString(": ")
+	} else {
+		buf.WriteByte(':')
+	}
+	return nil
+}
+
+// indent returns the indentation of the lines of a value at depth, as
+// WriteItem indents a root object.
+func (s *objectStreamer) indent(depth int) string {
+	return strings.Repeat("  ", depth+1)
+}
+
+// inputError locates err, of decoding the root object. Once part of it is
+// written, the input before is no longer held, and err is located in the
+// object or array being decoded.
+func (s *objectStreamer) inputError(err error) error {
+	located := s.lines.jsonError(fmt.Errorf("error decoding root JSON object: %w", err), 0, 0)
+	if s.lines.base > 0 && len(s.frames) > 0 {
+		located.Path = s.frames[len(s.frames)-1].key
+	}
+	return located
+}
+
+// nestedAssembler writes the masked elements of a streamed array, whose
+// start and end its objectStreamer writes.
+type nestedAssembler struct {
+	s *objectStreamer
+	f *jsonFrame
+}
+
+func (a *nestedAssembler) WriteStart(io.Writer) error { return nil }
+
+func (a *nestedAssembler) WriteItem(_ io.Writer, item any, _ bool) error {
+	return a.s.write(a.f, "", item)
+}
+
+func (a *nestedAssembler) WriteEnd(io.Writer) error { return nil }
+
+// decodeValue decodes the next value of decoder as Decode into an any would,
+// except that subtrees excluded as a whole stay raw JSON. These are copied
+// through token for token, keeping their key order and the notation of their
+// numbers and strings, without being decoded into maps and encoded again.
+func (jp *jsonProcessor) decodeValue(decoder *json.Decoder, key string) (any, error) {
+	if !jp.config.canPrune() {
+		if jp.config.jsonBackend != nil {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, err
+			}
+			return jp.config.jsonBackend.Unmarshal(raw)
+		}
+		var data any
+		err := decoder.Decode(&data)
+		return data, err
+	}
+	if jp.config.prunes(key) {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		return raw, err
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := make(map[string]any)
+		for decoder.More() {
+			k, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := jp.decodeValue(decoder, joinKey(key, k.(string)))
+			if err != nil {
+				return nil, err
+			}
+			object[k.(string)] = value
+		}
+		_, err = decoder.Token() // consume '}'
+		return object, err
+	case json.Delim('['):
+		array := make([]any, 0)
+		for decoder.More() {
+			value, err := jp.decodeValue(decoder, indexKey(key, len(array)))
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = decoder.Token() // consume ']'
+		return array, err
+	}
+	return token, nil
+}
+
 type jsonAssembler struct {
 	isRootArray bool
+	verbatim    bool // Items can hold raw excluded subtrees, written as they are
+	style       string
+	originals   *originalRecords          // The input of the records, with the preserve style
+	marshal     func(any) ([]byte, error) // Encodes compact records, with the JSON backend of the run
+	written     int                       // Records written
 }
 
 func (a *jsonAssembler) WriteStart(w io.Writer) error {
@@ -110,28 +568,135 @@ func (a *jsonAssembler) WriteStart(w io.Writer) error {
 }
 
 func (a *jsonAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
+	switch a.style {
+	case StylePreserve:
+		separator, raw := cutSeparator(a.originals.take(a.written))
+		a.written++
+		// Records that were skipped take their commas with them.
+		separator = bytes.ReplaceAll(separator, []byte(","), nil)
+		var buf bytes.Buffer
+		if !isFirst {
+			buf.WriteByte(',')
+		}
+		buf.Write(separator)
+		if err := writePreserved(&buf, raw, item); err != nil {
+			return err
+		}
+		if !a.isRootArray {
+			buf.WriteByte('\n')
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	case StyleCompact:
+		data, err := a.marshal(item)
+		if err != nil {
+			return err
+		}
+		if !isFirst {
+			data = append([]byte(","), data...)
+		}
+		if !a.isRootArray {
+			data = append(data, '\n')
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
 	if !isFirst {
 		if _, err := w.Write([]byte(",")); err != nil {
 			return err
 		}
 	}
+	if a.verbatim {
+		var buf bytes.Buffer
+		if err := writeIndented(&buf, item, "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("  ", "  ")
 	return encoder.Encode(item)
 }
 
-func (a *jsonAssembler) WriteEnd(w io.Writer) error {
-	if a.isRootArray {
-		_, err := w.Write([]byte("]\n"))
-		return err
+// writeIndented writes v indented like the encoder of WriteItem would, except
+// that raw JSON is written exactly as it was read instead of re-indented.
+func writeIndented(buf *bytes.Buffer, v any, prefix string) error {
+	switch v := v.(type) {
+	case json.RawMessage:
+		buf.Write(v)
+	case map[string]any:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteByte('{')
+		for i, k := range slices.Sorted(maps.Keys(v)) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+			buf.WriteString("\n" + prefix + "  ")
+			buf.Write(key)
+			buf.WriteString(": ")
+			if err := writeIndented(buf, v[k], prefix+"  "); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n" + prefix + "}")
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString("\n" + prefix + "  ")
+			if err := writeIndented(buf, item, prefix+"  "); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n" + prefix + "]")
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return json.Indent(buf, data, prefix, "  ")
 	}
 	return nil
 }
 
+func (a *jsonAssembler) WriteEnd(w io.Writer) error {
+	if !a.isRootArray {
+		return nil
+	}
+	end := []byte("]\n")
+	if a.style == StylePreserve {
+		// Without the end of the input, as when not all records were
+		// read, the closing bracket goes on a line of its own.
+		end = []byte("\n]\n")
+		if tail := a.originals.getTail(); tail != nil {
+			end = append(tail, '\n')
+		}
+	}
+	_, err := w.Write(end)
+	return err
+}
+
 type peekingReader struct {
-	r    io.Reader
-	peek []byte
-	err  error
+	r            io.Reader
+	peek         []byte
+	err          error
+	skippedLines int // Lines of whitespace PeekFirstChar skipped
 }
 
 func newPeekingReader(r io.Reader) *peekingReader { return &peekingReader{r: r} }
@@ -157,6 +722,9 @@ func (pr *peekingReader) PeekFirstChar() (byte, error) {
 				pr.peek = pr.peek[i:]
 				return c, nil
 			}
+			if c == '\n' {
+				pr.skippedLines++
+			}
 		}
 	}
 	buf := make([]byte, 128)
@@ -172,6 +740,9 @@ func (pr *peekingReader) PeekFirstChar() (byte, error) {
 				pr.peek = buf[i:n]
 				return c, nil
 			}
+			if c == '\n' {
+				pr.skippedLines++
+			}
 		}
 	}
 }
@@ -179,36 +750,34 @@ func isWhitespace(c byte) bool { return c == ' ' || c == '\n' || c == '\r' || c
 
 func (jp *jsonProcessor) recursiveMask(m *masker, key string, data any) any {
 	switch v := data.(type) {
-	case json.Number:
-		if shouldMask(key, jp.config.IncludeGlobs, jp.config.ExcludeGlobs) {
-			s := v.String()
-			if strings.Contains(s, ".") {
-				parts := strings.Split(s, ".")
-				template := strings.Repeat("#", len(parts[0])) + "." + strings.Repeat("#", len(parts[1]))
-				return json.Number(m.faker.Numerify(template))
+	case json.Number, string, bool, nil:
+		return jp.config.maskField(m, key, v)
+	case map[string]any:
+		maskedMap := make(map[string]any, len(v))
+		shouldMaskField := func(k string) bool {
+			return jp.config.masksAsRecordField(m, joinKey(key, k), v[k])
+		}
+		if card, ok := m.findCardFields(v); ok {
+			for k, masked := range m.forField(fieldPath(key)).maskCardFields(v, card, shouldMaskField) {
+				maskedMap[k] = jp.config.masked(m, joinKey(key, k), v[k], masked)
 			}
-			return json.Number(m.faker.Numerify(strings.Repeat("#", len(s))))
 		}
-		return v
-	case string, bool, nil:
-		if shouldMask(key, jp.config.IncludeGlobs, jp.config.ExcludeGlobs) {
-			return m.mask(v)
+		if names, ok := m.findNameFields(v); ok {
+			for k, masked := range m.forField(fieldPath(key)).maskNameFields(v, names, shouldMaskField) {
+				maskedMap[k] = jp.config.masked(m, joinKey(key, k), v[k], masked)
+			}
 		}
-		return v
-	case map[string]any:
-		maskedMap := make(map[string]any, len(v))
-		for k, value := range v {
-			fullKey := k
-			if key != "" {
-				fullKey = key + "." + k
+		for k := range jp.config.recordKeys(v) {
+			if _, done := maskedMap[k]; done {
+				continue
 			}
-			maskedMap[k] = jp.recursiveMask(m, fullKey, value)
+			maskedMap[k] = jp.recursiveMask(m, joinKey(key, k), v[k])
 		}
 		return maskedMap
 	case []any:
 		maskedSlice := make([]any, len(v))
 		for i, value := range v {
-			maskedSlice[i] = jp.recursiveMask(m, key, value)
+			maskedSlice[i] = jp.recursiveMask(m, indexKey(key, i), value)
 		}
 		return maskedSlice
 	default:
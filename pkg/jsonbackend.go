@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSONBackend decodes and encodes the records of json and ndjson input, in
+// place of encoding/json, which spends most of the time of masking wide
+// records on building and walking maps. Records are still split by
+// encoding/json, which keeps the offsets of errors and checkpoints.
+type JSONBackend interface {
+	// Unmarshal decodes a single JSON value into maps, slices, strings,
+	// json.Number, bool and nil, as encoding/json does with UseNumber.
+	Unmarshal(data []byte) (any, error)
+	// Marshal encodes a decoded value without any spaces, with the keys
+	// of maps sorted and HTML characters escaped, as json.Marshal does.
+	Marshal(v any) ([]byte, error)
+}
+
+var (
+	jsonBackendsMu sync.RWMutex
+	jsonBackends   = map[string]JSONBackend{"jsoniter": jsoniterBackend{}}
+)
+
+// builtinJSONBackends are the JSON backends that cannot be registered.
+var builtinJSONBackends = []string{"std", "jsoniter"}
+
+// RegisterJSONBackend adds a JSON backend that can be selected by name with
+// -json-backend and AppConfig.JSONBackend, such as one built on a decoder
+// with assembly for the platform. Plugins loaded with LoadPlugin can call it
+// from their init functions. Names of built-in backends cannot be
+// registered, and a name can only be registered once.
+func RegisterJSONBackend(name string, backend JSONBackend) error {
+	if name == "" || backend == nil {
+		return errors.New("JSON backend needs a name and an implementation")
+	}
+	if slices.Contains(builtinJSONBackends, name) {
+		return fmt.Errorf("cannot register JSON backend %q: it is a built-in backend", name)
+	}
+	jsonBackendsMu.Lock()
+	defer jsonBackendsMu.Unlock()
+	if _, ok := jsonBackends[name]; ok {
+		return fmt.Errorf("JSON backend %q is already registered", name)
+	}
+	jsonBackends[name] = backend
+	return nil
+}
+
+// lookupJSONBackend returns the backend registered as name, and nil for std,
+// with which records are decoded and encoded by encoding/json as they are.
+func lookupJSONBackend(name string) (JSONBackend, error) {
+	if name == "" || name == "std" {
+		return nil, nil
+	}
+	jsonBackendsMu.RLock()
+	defer jsonBackendsMu.RUnlock()
+	backend, ok := jsonBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown JSON backend %q, expected std, jsoniter or a registered one", name)
+	}
+	return backend, nil
+}
+
+// marshalJSON encodes a masked record compactly with the JSON backend of the
+// run. Records can hold excluded subtrees copied through as they were read,
+// which only encoding/json compacts, so runs that prune subtrees encode with
+// it.
+func (c *AppConfig) marshalJSON(v any) ([]byte, error) {
+	if c.jsonBackend == nil || c.canPrune() {
+		return json.Marshal(v)
+	}
+	return c.jsonBackend.Marshal(v)
+}
+
+// jsoniterConfig decodes and encodes as encoding/json does, numbers as
+// json.Number.
+var jsoniterConfig = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	UseNumber:              true,
+	ValidateJsonRawMessage: true,
+}.Froze()
+
+// jsoniterBackend is the JSON backend of github.com/json-iterator/go, which
+// decodes and encodes generic values without reflection.
+type jsoniterBackend struct{}
+
+func (jsoniterBackend) Unmarshal(data []byte) (any, error) {
+	var v any
+	err := jsoniterConfig.Unmarshal(data, &v)
+	return v, err
+}
+
+func (jsoniterBackend) Marshal(v any) ([]byte, error) {
+	return jsoniterConfig.Marshal(v)
+}
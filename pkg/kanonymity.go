@@ -0,0 +1,196 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// KAnonymityConfig enables k-anonymity post-processing for CSV. After masking,
+// the quasi-identifier columns are generalized until every combination of
+// their values appears in at least K rows.
+type KAnonymityConfig struct {
+	K                int
+	QuasiIdentifiers []string
+}
+
+// kAnonymize returns the post-processor generalizing the quasi-identifier
+// columns of the buffered records, reporting what it did to report.
+func kAnonymize(config KAnonymityConfig, report io.Writer) csvPostProcessor {
+	return func(header []string, records [][]string) error {
+		columns := make([]int, len(config.QuasiIdentifiers))
+		for i, qi := range config.QuasiIdentifiers {
+			columns[i] = indexOf(header, qi)
+		}
+		summary := generalize(records, columns, config.K)
+		if report != nil {
+			fmt.Fprintf(report, "k-anonymity (k=%d) over %d rows:\n", config.K, len(records))
+			for i, column := range columns {
+				fmt.Fprintf(report, "  %s: %s\n", header[column], summary.levels[i])
+			}
+			fmt.Fprintf(report, "  suppressed rows: %d\n", summary.suppressed)
+		}
+		return nil
+	}
+}
+
+// columnHierarchy generalizes the values of one quasi-identifier column.
+// Numeric columns are bucketed into ranges that double in width per level;
+// other columns have trailing characters replaced by '*', one more per level.
+type columnHierarchy struct {
+	original []string
+	numeric  bool
+	level    int
+	maxLevel int
+}
+
+func newColumnHierarchy(records [][]string, column int) *columnHierarchy {
+	h := &columnHierarchy{numeric: true}
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, record := range records {
+		value := record[column]
+		h.original = append(h.original, value)
+		h.maxLevel = max(h.maxLevel, len([]rune(value)))
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			h.numeric = false
+			continue
+		}
+		minValue, maxValue = math.Min(minValue, f), math.Max(maxValue, f)
+	}
+	if h.numeric && len(records) > 0 {
+		// Widths double with every level, so the range is covered by a single
+		// bucket after log2(range) levels.
+		h.maxLevel = 1
+		for width := 1.0; width <= maxValue-minValue; width *= 2 {
+			h.maxLevel++
+		}
+	}
+	return h
+}
+
+func (h *columnHierarchy) value(row int) string {
+	value := h.original[row]
+	if h.level == 0 {
+		return value
+	}
+	if h.numeric {
+		width := math.Exp2(float64(h.level - 1))
+		f, _ := strconv.ParseFloat(value, 64)
+		lo := math.Floor(f/width) * width
+		if width == 1 {
+			return strconv.FormatFloat(lo, 'f', -1, 64)
+		}
+		return fmt.Sprintf("%s-%s", strconv.FormatFloat(lo, 'f', -1, 64), strconv.FormatFloat(lo+width-1, 'f', -1, 64))
+	}
+	runes := []rune(value)
+	keep := max(len(runes)-h.level, 0)
+	return string(runes[:keep]) + strings.Repeat("*", len(runes)-keep)
+}
+
+func (h *columnHierarchy) distinct(rows int) int {
+	seen := make(map[string]struct{})
+	for row := range rows {
+		seen[h.value(row)] = struct{}{}
+	}
+	return len(seen)
+}
+
+func (h *columnHierarchy) describe() string {
+	switch {
+	case h.level == 0:
+		return "not generalized"
+	case h.numeric && h.level == 1:
+		return "rounded down to whole numbers"
+	case h.numeric:
+		return fmt.Sprintf("generalized to ranges of width %g", math.Exp2(float64(h.level-1)))
+	default:
+		return fmt.Sprintf("generalized by replacing up to %d trailing characters", h.level)
+	}
+}
+
+type generalizationSummary struct {
+	levels     []string
+	suppressed int
+}
+
+// generalize applies a greedy Datafly-style generalization in place: while
+// some combination of quasi-identifier values occurs fewer than k times, the
+// column with the most distinct values is generalized one more level. Once
+// the rows in undersized groups number k or fewer, they are suppressed by
+// replacing their quasi-identifiers with '*' instead of generalizing further.
+func generalize(records [][]string, columns []int, k int) generalizationSummary {
+	hierarchies := make([]*columnHierarchy, len(columns))
+	for i, column := range columns {
+		hierarchies[i] = newColumnHierarchy(records, column)
+	}
+
+	groupKey := func(row int) string {
+		parts := make([]string, len(hierarchies))
+		for i, h := range hierarchies {
+			parts[i] = h.value(row)
+		}
+		return strings.Join(parts, "\x00")
+	}
+	violations := func() []int {
+		counts := make(map[string]int)
+		for row := range records {
+			counts[groupKey(row)]++
+		}
+		var rows []int
+		for row := range records {
+			if counts[groupKey(row)] < k {
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	}
+
+	suppressed := make(map[int]bool)
+	for {
+		violating := violations()
+		if len(violating) == 0 {
+			break
+		}
+		next := -1
+		for i, h := range hierarchies {
+			if h.level < h.maxLevel && (next < 0 || h.distinct(len(records)) > hierarchies[next].distinct(len(records))) {
+				next = i
+			}
+		}
+		if len(violating) <= k || next < 0 {
+			for _, row := range violating {
+				suppressed[row] = true
+			}
+			break
+		}
+		hierarchies[next].level++
+	}
+
+	for row, record := range records {
+		for i, column := range columns {
+			if suppressed[row] {
+				record[column] = "*"
+			} else {
+				record[column] = hierarchies[i].value(row)
+			}
+		}
+	}
+
+	summary := generalizationSummary{suppressed: len(suppressed)}
+	for _, h := range hierarchies {
+		summary.levels = append(summary.levels, h.describe())
+	}
+	return summary
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
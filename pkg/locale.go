@@ -0,0 +1,243 @@
+package pkg
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// locale holds the data used to generate fakes that match a country and
+// language. gofakeit only generates US English data, so the values that give
+// a dataset away as such (names, addresses, phone numbers, IBANs and free
+// text) are taken from here instead when a locale is configured.
+type locale struct {
+	maleNames   []string
+	femaleNames []string
+	lastNames   []string
+	cities      []string
+	streets     []string
+	// streetFormat places the house number, e.g. "{streetname} {number}".
+	streetFormat string
+	zipFormat    string // '#' is a digit and '?' an upper case letter
+	phoneFormat  string
+	tld          string
+	// ibanCountry and ibanFormat describe the IBANs of the locale's country.
+	// In ibanFormat, '#' is a digit and '?' an upper case letter.
+	ibanCountry string
+	ibanFormat  string
+	words       []string
+}
+
+var locales = map[string]*locale{
+	"nl": {
+		maleNames:    []string{"Daan", "Sem", "Lucas", "Levi", "Finn", "Bram", "Thijs", "Jesse", "Ruben", "Noah"},
+		femaleNames:  []string{"Emma", "Julia", "Sophie", "Tess", "Anna", "Saar", "Lotte", "Fenna", "Eva", "Sanne"},
+		lastNames:    []string{"de Jong", "Jansen", "de Vries", "van den Berg", "van Dijk", "Bakker", "Janssen", "Visser", "Smit", "Meijer", "de Boer", "Mulder", "de Groot", "Bos", "Vos", "Peters", "Hendriks", "van Leeuwen", "Dekker", "Brouwer"},
+		cities:       []string{"Amsterdam", "Rotterdam", "Den Haag", "Utrecht", "Eindhoven", "Groningen", "Tilburg", "Almere", "Breda", "Nijmegen", "Apeldoorn", "Haarlem", "Arnhem", "Enschede", "Amersfoort", "Zwolle", "Leiden", "Maastricht", "Dordrecht", "Delft"},
+		streets:      []string{"Kerkstraat", "Dorpsstraat", "Schoolstraat", "Molenweg", "Stationsweg", "Julianastraat", "Beatrixlaan", "Wilhelminastraat", "Nieuwstraat", "Marktplein", "Kastanjelaan", "Eikenlaan", "Prinsengracht", "Keizersgracht", "Parallelweg"},
+		streetFormat: "{streetname} {number}",
+		zipFormat:    "#### ??",
+		phoneFormat:  "+31 6 ########",
+		tld:          "nl",
+		ibanCountry:  "NL",
+		ibanFormat:   "????##########",
+		words:        []string{"huis", "fiets", "water", "brood", "tafel", "stoel", "straat", "boek", "raam", "deur", "tuin", "bloem", "boom", "zon", "regen", "wind", "school", "werk", "vriend", "stad", "dorp", "koffie", "kaas", "melk", "trein"},
+	},
+	"de": {
+		maleNames:    []string{"Lukas", "Leon", "Finn", "Jonas", "Paul", "Felix", "Elias", "Maximilian", "Ben", "Noah"},
+		femaleNames:  []string{"Mia", "Emma", "Hannah", "Sofia", "Lina", "Marie", "Lea", "Anna", "Clara", "Greta"},
+		lastNames:    []string{"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann", "Schäfer", "Koch", "Bauer", "Richter", "Klein", "Wolf", "Schröder", "Neumann", "Schwarz", "Zimmermann"},
+		cities:       []string{"Berlin", "Hamburg", "München", "Köln", "Frankfurt am Main", "Stuttgart", "Düsseldorf", "Leipzig", "Dortmund", "Essen", "Bremen", "Dresden", "Hannover", "Nürnberg", "Duisburg", "Bochum", "Wuppertal", "Bielefeld", "Bonn", "Münster"},
+		streets:      []string{"Hauptstraße", "Schulstraße", "Gartenstraße", "Bahnhofstraße", "Dorfstraße", "Bergstraße", "Birkenweg", "Lindenstraße", "Kirchstraße", "Waldstraße", "Ringstraße", "Schillerstraße", "Goethestraße", "Am Markt", "Mühlenweg"},
+		streetFormat: "{streetname} {number}",
+		zipFormat:    "#####",
+		phoneFormat:  "+49 151 ########",
+		tld:          "de",
+		ibanCountry:  "DE",
+		ibanFormat:   "##################",
+		words:        []string{"Haus", "Stadt", "Wasser", "Brot", "Tisch", "Stuhl", "Straße", "Buch", "Fenster", "Tür", "Garten", "Blume", "Baum", "Sonne", "Regen", "Wind", "Schule", "Arbeit", "Freund", "Dorf", "Kaffee", "Käse", "Milch", "Zug", "Zeit"},
+	},
+	"fr": {
+		maleNames:    []string{"Gabriel", "Léo", "Raphaël", "Louis", "Lucas", "Jules", "Hugo", "Arthur", "Nathan", "Théo"},
+		femaleNames:  []string{"Jade", "Louise", "Emma", "Alice", "Chloé", "Léa", "Manon", "Camille", "Inès", "Zoé"},
+		lastNames:    []string{"Martin", "Bernard", "Thomas", "Petit", "Robert", "Richard", "Durand", "Dubois", "Moreau", "Laurent", "Simon", "Michel", "Lefèvre", "Leroy", "Roux", "David", "Bertrand", "Morel", "Fournier", "Girard"},
+		cities:       []string{"Paris", "Marseille", "Lyon", "Toulouse", "Nice", "Nantes", "Montpellier", "Strasbourg", "Bordeaux", "Lille", "Rennes", "Reims", "Toulon", "Grenoble", "Dijon", "Angers", "Nîmes", "Clermont-Ferrand", "Le Havre", "Brest"},
+		streets:      []string{"rue de la Paix", "rue Victor Hugo", "avenue Jean Jaurès", "rue de la République", "boulevard Gambetta", "rue Pasteur", "place de la Mairie", "rue du Moulin", "chemin des Vignes", "rue de l'Église", "avenue de la Gare", "rue des Écoles", "allée des Tilleuls", "rue Nationale", "impasse des Lilas"},
+		streetFormat: "{number} {streetname}",
+		zipFormat:    "#####",
+		phoneFormat:  "+33 6 ## ## ## ##",
+		tld:          "fr",
+		ibanCountry:  "FR",
+		ibanFormat:   "#######################",
+		words:        []string{"maison", "ville", "eau", "pain", "table", "chaise", "rue", "livre", "fenêtre", "porte", "jardin", "fleur", "arbre", "soleil", "pluie", "vent", "école", "travail", "ami", "village", "café", "fromage", "lait", "train", "temps"},
+	},
+	"es": {
+		maleNames:    []string{"Hugo", "Martín", "Lucas", "Mateo", "Leo", "Daniel", "Alejandro", "Pablo", "Manuel", "Álvaro"},
+		femaleNames:  []string{"Lucía", "Sofía", "Martina", "María", "Julia", "Paula", "Valeria", "Emma", "Daniela", "Carla"},
+		lastNames:    []string{"García", "Rodríguez", "González", "Fernández", "López", "Martínez", "Sánchez", "Pérez", "Gómez", "Martín", "Jiménez", "Ruiz", "Hernández", "Díaz", "Moreno", "Muñoz", "Álvarez", "Romero", "Alonso", "Gutiérrez"},
+		cities:       []string{"Madrid", "Barcelona", "Valencia", "Sevilla", "Zaragoza", "Málaga", "Murcia", "Palma", "Bilbao", "Alicante", "Córdoba", "Valladolid", "Vigo", "Gijón", "Granada", "Oviedo", "Santander", "Pamplona", "Salamanca", "Cádiz"},
+		streets:      []string{"Calle Mayor", "Calle Real", "Avenida de la Constitución", "Calle del Sol", "Plaza de España", "Calle de la Iglesia", "Gran Vía", "Calle Nueva", "Paseo del Prado", "Calle San Juan", "Avenida de Andalucía", "Calle de la Paz", "Calle Luna", "Camino Real", "Calle del Carmen"},
+		streetFormat: "{streetname}, {number}",
+		zipFormat:    "#####",
+		phoneFormat:  "+34 6## ### ###",
+		tld:          "es",
+		ibanCountry:  "ES",
+		ibanFormat:   "####################",
+		words:        []string{"casa", "ciudad", "agua", "pan", "mesa", "silla", "calle", "libro", "ventana", "puerta", "jardín", "flor", "árbol", "sol", "lluvia", "viento", "escuela", "trabajo", "amigo", "pueblo", "café", "queso", "leche", "tren", "tiempo"},
+	},
+	"it": {
+		maleNames:    []string{"Leonardo", "Francesco", "Alessandro", "Lorenzo", "Mattia", "Tommaso", "Gabriele", "Andrea", "Riccardo", "Edoardo"},
+		femaleNames:  []string{"Sofia", "Giulia", "Aurora", "Alice", "Ginevra", "Emma", "Giorgia", "Beatrice", "Greta", "Martina"},
+		lastNames:    []string{"Rossi", "Russo", "Ferrari", "Esposito", "Bianchi", "Romano", "Colombo", "Ricci", "Marino", "Greco", "Bruno", "Gallo", "Conti", "De Luca", "Mancini", "Costa", "Giordano", "Rizzo", "Lombardi", "Moretti"},
+		cities:       []string{"Roma", "Milano", "Napoli", "Torino", "Palermo", "Genova", "Bologna", "Firenze", "Bari", "Catania", "Venezia", "Verona", "Messina", "Padova", "Trieste", "Brescia", "Parma", "Prato", "Modena", "Perugia"},
+		streets:      []string{"Via Roma", "Via Garibaldi", "Via Mazzini", "Corso Italia", "Via Dante", "Piazza del Duomo", "Via Cavour", "Via Verdi", "Corso Vittorio Emanuele", "Via Marconi", "Via della Repubblica", "Viale Europa", "Via Manzoni", "Via San Francesco", "Via dei Mille"},
+		streetFormat: "{streetname} {number}",
+		zipFormat:    "#####",
+		phoneFormat:  "+39 3## ### ####",
+		tld:          "it",
+		ibanCountry:  "IT",
+		ibanFormat:   "?######################",
+		words:        []string{"casa", "città", "acqua", "pane", "tavolo", "sedia", "strada", "libro", "finestra", "porta", "giardino", "fiore", "albero", "sole", "pioggia", "vento", "scuola", "lavoro", "amico", "paese", "caffè", "formaggio", "latte", "treno", "tempo"},
+	},
+}
+
+// Locales returns the supported locale names, besides the default "en".
+func Locales() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func lookupLocale(name string) (*locale, error) {
+	if name == "" || name == "en" {
+		return nil, nil
+	}
+	l, ok := locales[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q, expected en or one of %s", name, strings.Join(Locales(), ", "))
+	}
+	return l, nil
+}
+
+func (m *masker) pick(values []string) string {
+	return values[m.faker.Rand.Intn(len(values))]
+}
+
+// fill replaces '#' in format with random digits and '?' with random upper
+// case letters.
+func (m *masker) fill(format string) string {
+	var b strings.Builder
+	for _, r := range format {
+		switch r {
+		case '#':
+			b.WriteByte(byte('0' + m.faker.Rand.Intn(10)))
+		case '?':
+			b.WriteByte(byte('A' + m.faker.Rand.Intn(26)))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (m *masker) localeFirstName() string {
+	if m.faker.Rand.Intn(2) == 0 {
+		return m.pick(m.locale.maleNames)
+	}
+	return m.pick(m.locale.femaleNames)
+}
+
+func (m *masker) localeStreet() string {
+	street := strings.ReplaceAll(m.locale.streetFormat, "{streetname}", m.pick(m.locale.streets))
+	return strings.ReplaceAll(street, "{number}", fmt.Sprint(1+m.faker.Rand.Intn(250)))
+}
+
+func (m *masker) localePhone() string {
+	return m.fill(m.locale.phoneFormat)
+}
+
+func (m *masker) localeEmail() string {
+	local := asciiFold(m.localeFirstName() + "." + m.pick(m.locale.lastNames))
+	return local + "@" + strings.ToLower(m.faker.Word()) + "." + m.locale.tld
+}
+
+// localeIBAN generates an IBAN of the locale's country with valid check
+// digits.
+func (m *masker) localeIBAN() string {
+	bban := m.fill(m.locale.ibanFormat)
+	numeric := ibanDigits(bban + m.locale.ibanCountry + "00")
+	remainder := new(big.Int).Mod(numeric, big.NewInt(97)).Int64()
+	return fmt.Sprintf("%s%02d%s", m.locale.ibanCountry, 98-remainder, bban)
+}
+
+// ibanDigits converts an IBAN string to the number used for its check
+// digits, replacing letters by 10 to 35.
+func ibanDigits(s string) *big.Int {
+	var digits strings.Builder
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	return n
+}
+
+// localeTemplateRegex matches the template functions a locale provides its
+// own data for.
+var localeTemplateRegex = regexp.MustCompile(`\{(firstname|lastname|name|city|street|streetname|zip|phone|email)\}`)
+
+// localizeTemplate fills in the functions of a gofakeit template for which
+// the locale has data, leaving the others to gofakeit.
+func (m *masker) localizeTemplate(template string) string {
+	if m.locale == nil {
+		return template
+	}
+	return localeTemplateRegex.ReplaceAllStringFunc(template, func(match string) string {
+		switch strings.Trim(match, "{}") {
+		case "firstname":
+			return m.localeFirstName()
+		case "lastname":
+			return m.pick(m.locale.lastNames)
+		case "name":
+			return m.localeFirstName() + " " + m.pick(m.locale.lastNames)
+		case "city":
+			return m.pick(m.locale.cities)
+		case "street":
+			return m.localeStreet()
+		case "streetname":
+			return m.pick(m.locale.streets)
+		case "zip":
+			return m.fill(m.locale.zipFormat)
+		case "phone":
+			return m.localePhone()
+		default:
+			return m.localeEmail()
+		}
+	})
+}
+
+// asciiFold lowercases s and reduces it to ASCII letters, digits and dots,
+// for use in e-mail addresses.
+func asciiFold(s string) string {
+	folded, _, _ := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), s)
+	folded = strings.NewReplacer("ß", "ss", "'", "", " ", "").Replace(strings.ToLower(folded))
+	return strings.Map(func(r rune) rune {
+		if r == '.' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, folded)
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// lineReader counts the lines of what is read from r, so the offsets a JSON
+// decoder reports can be told as lines and columns. Only the input from the
+// offset last passed to advance on is kept.
+type lineReader struct {
+	r     io.Reader
+	buf   []byte
+	base  int64 // Offset of buf[0] in the input
+	lines int   // Newlines before base
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.buf = append(lr.buf, p[:n]...)
+	return n, err
+}
+
+// advance drops the input before offset, once no error can occur in it.
+func (lr *lineReader) advance(offset int64) {
+	n := lr.index(offset)
+	lr.lines += bytes.Count(lr.buf[:n], []byte{'\n'})
+	lr.buf = lr.buf[n:]
+	lr.base += int64(n)
+}
+
+// index returns the index in buf of offset, within its bounds.
+func (lr *lineReader) index(offset int64) int {
+	return int(min(max(offset-lr.base, 0), int64(len(lr.buf))))
+}
+
+// position returns the line and column, counting from 1, of the byte at
+// offset. Columns count bytes.
+func (lr *lineReader) position(offset int64) (line, column int) {
+	before := lr.buf[:lr.index(offset)]
+	line = lr.lines + bytes.Count(before, []byte{'\n'}) + 1
+	return line, len(before) - bytes.LastIndexByte(before, '\n')
+}
+
+// jsonError locates err, of decoding the value that starts at offset start,
+// as the given record counting from 1, or 0 for a root value.
+func (lr *lineReader) jsonError(err error, record int, start int64) *InputError {
+	end := lr.base + int64(len(lr.buf))
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// The offset is that after the byte in error.
+		end = syntaxErr.Offset - 1
+	}
+	location := &InputError{Err: err, Record: record}
+	location.Line, location.Column = lr.position(end)
+	location.Path = jsonPathAt(lr.buf[lr.index(start):lr.index(end)])
+	return location
+}
+
+// jsonPathAt returns the key path of the value the JSON input ends in, such
+// as that of a value cut short, e.g. "items[2].email". Commas and whitespace
+// before the value are skipped, as an element of an array starts after them.
+func jsonPathAt(data []byte) string {
+	type level struct {
+		object  bool
+		key     string // Of the value of an object last read, if any
+		index   int    // Of the element of an array last read, from -1
+		wantKey bool   // For an object, whether the next key comes next
+	}
+	var levels []*level
+	data = bytes.TrimLeft(data, ", \t\r\n")
+	path := func() string {
+		// After a comma, the next element of an array is in error.
+		trimmed := bytes.TrimRight(data, " \t\r\n")
+		if len(levels) > 0 && !levels[len(levels)-1].object && bytes.HasSuffix(trimmed, []byte{','}) {
+			levels[len(levels)-1].index++
+		}
+		var key string
+		for _, l := range levels {
+			switch {
+			case l.object && l.key != "" && !l.wantKey:
+				key = joinKey(key, l.key)
+			case !l.object && l.index >= 0:
+				key = indexKey(key, l.index)
+			}
+		}
+		return key
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return path()
+		}
+		var top *level
+		if len(levels) > 0 {
+			top = levels[len(levels)-1]
+		}
+		if key, ok := token.(string); ok && top != nil && top.object && top.wantKey {
+			top.key, top.wantKey = key, false
+			continue
+		}
+		if token == json.Delim('}') || token == json.Delim(']') {
+			levels = levels[:len(levels)-1]
+			if len(levels) > 0 && levels[len(levels)-1].object {
+				levels[len(levels)-1].wantKey = true
+			}
+			continue
+		}
+		if top != nil && !top.object {
+			top.index++
+		}
+		switch token {
+		case json.Delim('{'):
+			levels = append(levels, &level{object: true, wantKey: true})
+		case json.Delim('['):
+			levels = append(levels, &level{index: -1})
+		default:
+			if top != nil && top.object {
+				top.wantKey = true
+			}
+		}
+	}
+}
+
+// csvError locates err, of reading the given record of CSV counting from 1,
+// or 0 for the header.
+func csvError(err error, record int) *InputError {
+	location := &InputError{Err: err, Record: record}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		location.Err, location.Line, location.Column = parseErr.Err, parseErr.Line, parseErr.Column
+	}
+	return location
+}
+
+// xmlError locates err, of decoding the XML element at key.
+func xmlError(decoder *xml.Decoder, err error, key string) *InputError {
+	location := &InputError{Err: err, Path: key}
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// The line is part of the location, and not repeated.
+		location.Err = errors.New(syntaxErr.Msg)
+	}
+	location.Line, location.Column = decoder.InputPos()
+	return location
+}
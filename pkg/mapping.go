@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Mapping records the masked value an original value of a field was given.
+type Mapping struct {
+	Field    string `json:"field"`
+	Original any    `json:"original"`
+	Masked   any    `json:"masked"`
+}
+
+// mappingStore holds the mappings of a mapping file. Fields whose original
+// value was masked before get the recorded value again, whatever the current
+// method or salt; new values are masked as usual and added. It is shared by
+// all workers.
+type mappingStore struct {
+	mu       sync.Mutex
+	mappings []Mapping
+	index    map[string]map[string]int // field -> input -> position in mappings
+	changed  bool
+}
+
+func newMappingStore(mappings []Mapping) *mappingStore {
+	s := &mappingStore{index: make(map[string]map[string]int)}
+	for _, mapping := range mappings {
+		s.add(mapping)
+	}
+	s.changed = false
+	return s
+}
+
+func (s *mappingStore) add(mapping Mapping) {
+	inputs, ok := s.index[mapping.Field]
+	if !ok {
+		inputs = make(map[string]int)
+		s.index[mapping.Field] = inputs
+	}
+	inputs[fmt.Sprintf("%T:%v", mapping.Original, mapping.Original)] = len(s.mappings)
+	s.mappings = append(s.mappings, mapping)
+	s.changed = true
+}
+
+// lookup returns the recorded masked value of value in field.
+func (s *mappingStore) lookup(field string, value any) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[field][fmt.Sprintf("%T:%v", value, value)]
+	if !ok {
+		return nil, false
+	}
+	return s.mappings[i].Masked, true
+}
+
+// record adds the masked value of value in field, unless another worker
+// recorded it first. Removed values are not recorded.
+func (s *mappingStore) record(field string, value, masked any) {
+	if masked == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[field][fmt.Sprintf("%T:%v", value, value)]; !ok {
+		s.add(Mapping{Field: field, Original: value, Masked: masked})
+	}
+}
+
+// claimAll registers the recorded outputs with u, so values masked for the
+// first time cannot collide with values masked in earlier runs.
+func (s *mappingStore) claimAll(u *uniqueOutputs) {
+	for _, mapping := range s.mappings {
+		u.claim(mapping.Field, fmt.Sprintf("%T:%v", mapping.Original, mapping.Original), fmt.Sprintf("%T:%v", mapping.Masked, mapping.Masked))
+	}
+}
+
+// MappingSet holds mappings in memory for embedders, as a mapping file holds
+// them for the command: runs with the set in AppConfig.MappingSet mask the
+// values it has mappings for as recorded, and add the mappings of the values
+// they mask for the first time. Runs can share a set, also concurrently, so
+// values are masked consistently across runs and systems without sharing a
+// salt.
+type MappingSet struct {
+	store *mappingStore
+}
+
+// NewMappingSet returns a set preloaded with mappings, such as those
+// exported from another set or read with ReadMappings.
+func NewMappingSet(mappings []Mapping) *MappingSet {
+	return &MappingSet{store: newMappingStore(mappings)}
+}
+
+// Mappings exports the mappings of the set, in the order they were added.
+func (s *MappingSet) Mappings() []Mapping {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	return slices.Clone(s.store.mappings)
+}
+
+// Len returns the number of mappings of the set.
+func (s *MappingSet) Len() int {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	return len(s.store.mappings)
+}
+
+// ReadMappings decrypts a mapping file written by a masking run with
+// AppConfig.MappingFile. A file that does not exist holds no mappings.
+func ReadMappings(path string, key []byte) ([]Mapping, error) {
+	aead, err := newMappingCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading mapping file: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("mapping file %s is corrupted", path)
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting mapping file %s: wrong key or corrupted file", path)
+	}
+
+	// Numbers are kept as json.Number, as the json processor reads them.
+	decoder := json.NewDecoder(bytes.NewReader(plaintext))
+	decoder.UseNumber()
+	var mappings []Mapping
+	if err := decoder.Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("error reading mapping file %s: %w", path, err)
+	}
+	return mappings, nil
+}
+
+// save encrypts the mappings to path if any were added. The file is replaced
+// atomically so an interrupted run cannot corrupt the mappings of earlier
+// runs.
+func (s *mappingStore) save(path string, key []byte) error {
+	if !s.changed {
+		return nil
+	}
+	return WriteMappings(path, key, s.mappings)
+}
+
+// WriteMappings encrypts mappings to a mapping file that runs with
+// AppConfig.MappingFile and ReadMappings read, such as mappings exported from
+// a MappingSet. The file is replaced atomically.
+func WriteMappings(path string, key []byte, mappings []Mapping) error {
+	aead, err := newMappingCipher(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(mappings)
+	if err != nil {
+		return fmt.Errorf("error encoding mappings: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, aead.Seal(nonce, nonce, plaintext, nil), 0o600); err != nil {
+		return fmt.Errorf("error writing mapping file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing mapping file: %w", err)
+	}
+	return nil
+}
+
+// newMappingCipher returns the AES-GCM cipher mapping files are encrypted
+// with.
+func newMappingCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
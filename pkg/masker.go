@@ -0,0 +1,43 @@
+package pkg
+
+import "sync"
+
+// Masker masks single values as a run with its config would, for embedders
+// masking values of their own rather than an input. It is safe for concurrent
+// use: every goroutine masks with a masker of its own, and deterministic
+// masking gives the same fakes whichever masks a value.
+type Masker struct {
+	pool sync.Pool
+}
+
+// NewMasker creates a Masker for config. An invalid config is reported as a
+// *ConfigError.
+func NewMasker(config MaskerConfig) (*Masker, error) {
+	if err := config.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	newMasker := maskerFactory(config)
+	return &Masker{pool: sync.Pool{New: func() any { return newMasker() }}}, nil
+}
+
+// Mask returns value masked. Values are strings, json.Number, bool or nil, as
+// decoded by encoding/json with UseNumber; others are returned as they are.
+func (m *Masker) Mask(value any) any {
+	return m.MaskKey("", value)
+}
+
+// MaskKey returns the value of key masked, as a field of a record would be.
+// Keys matter to methods that use them, such as field-scoped masking and
+// wasm modules.
+func (m *Masker) MaskKey(key string, value any) any {
+	var masked any
+	m.with(func(masker *masker) { masked = masker.maskKey(key, value) })
+	return masked
+}
+
+// with calls fn with a masker no other goroutine uses until fn returns.
+func (m *Masker) with(fn func(*masker)) {
+	masker := m.pool.Get().(*masker)
+	defer m.pool.Put(masker)
+	fn(masker)
+}
@@ -0,0 +1,33 @@
+package pkg
+
+// memoSize is the number of keys a memo remembers the result for, beyond
+// which it starts over, so keys that hardly repeat, such as the paths of the
+// elements of long arrays, take no more memory than that.
+const memoSize = 1 << 14
+
+// memoKeyLimit is the length of the longest key a memo remembers the result
+// for, so that long values, such as lines of text, are not held on to.
+const memoKeyLimit = 256
+
+// memo remembers the results of a function of strings that records repeat,
+// such as the patterns matching a key. It belongs to the masker of a worker,
+// so it is not locked.
+type memo[T any] struct {
+	results map[string]T
+}
+
+// get returns find(key), found once and remembered.
+func (c *memo[T]) get(key string, find func(string) T) T {
+	if len(key) > memoKeyLimit {
+		return find(key)
+	}
+	if result, ok := c.results[key]; ok {
+		return result
+	}
+	if c.results == nil || len(c.results) >= memoSize {
+		c.results = make(map[string]T)
+	}
+	result := find(key)
+	c.results[key] = result
+	return result
+}
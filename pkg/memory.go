@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteUnits are the suffixes ParseByteSize accepts, longest first so "MB"
+// is not read as "B".
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size in bytes, written as a number with an
+// optional unit as in "512MB" or "2GiB". Units are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	number, size := strings.TrimSpace(s), int64(1)
+	for _, unit := range byteUnits {
+		if rest, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, size = strings.TrimSpace(rest), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/size {
+		return 0, fmt.Errorf("invalid size %q, expected bytes or a number such as 512MB", s)
+	}
+	return n * size, nil
+}
+
+// recordSize estimates the memory a decoded record takes, of its values and
+// the maps and slices holding them. The estimate counts the headers Go keeps
+// of every value, so a record of many short values takes several times the
+// size of its input.
+func recordSize(data any) int64 {
+	switch v := data.(type) {
+	case string:
+		return 16 + int64(len(v))
+	case json.Number:
+		return 16 + int64(len(v))
+	case []byte:
+		return 24 + int64(len(v))
+	case map[string]any:
+		size := int64(48)
+		for k, value := range v {
+			size += 16 + int64(len(k)) + recordSize(value)
+		}
+		return size
+	case []any:
+		size := int64(24)
+		for _, value := range v {
+			size += recordSize(value)
+		}
+		return size
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+)
+
+// MappedInput is a regular file mapped into memory, to pass to Start as the
+// input. The csv and ndjson formats slice their records out of the mapping
+// instead of copying the file through read buffers, and the other formats
+// read it as any input.
+type MappedInput struct {
+	mapping []byte       // As mapped, from the start of the file
+	data    []byte       // The input, from the offset of the file when mapped
+	offset  atomic.Int64 // Bytes of data read or sliced out
+}
+
+// MapInput maps f from its offset to its end, so input that was seeked, as
+// that of a resumed run, starts where a read of f would. f can be closed once
+// it is mapped, but the file must not shrink until the mapping is closed.
+func MapInput(f *os.File) (*MappedInput, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, errors.New("not a regular file")
+	}
+	if info.Size() > math.MaxInt {
+		return nil, errors.New("file too large to map")
+	}
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedInput{}
+	// An empty file cannot be mapped, and has no input to map.
+	if info.Size() > 0 {
+		if m.mapping, err = mapFile(f, int(info.Size())); err != nil {
+			return nil, err
+		}
+	}
+	m.data = m.mapping[min(start, int64(len(m.mapping))):]
+	return m, nil
+}
+
+func (m *MappedInput) Read(p []byte) (int, error) {
+	rest := m.rest()
+	if len(rest) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, rest)
+	m.advance(n)
+	return n, nil
+}
+
+// Offset returns the bytes of the input read or sliced out so far.
+func (m *MappedInput) Offset() int64 { return m.offset.Load() }
+
+// rest returns the input that is not read yet.
+func (m *MappedInput) rest() []byte { return m.data[m.offset.Load():] }
+
+// advance takes the next n bytes of the input as read.
+func (m *MappedInput) advance(n int) { m.offset.Add(int64(n)) }
+
+// Close unmaps the file. Neither the input nor records sliced out of it can
+// be used after, so it is closed once the run ends.
+func (m *MappedInput) Close() error {
+	if m.mapping == nil {
+		return nil
+	}
+	err := unmapFile(m.mapping)
+	m.mapping, m.data = nil, nil
+	m.offset.Store(0)
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package pkg
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first size bytes of f read-only.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func unmapFile(data []byte) error { return syscall.Munmap(data) }
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd)
+
+package pkg
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile reports that files cannot be mapped on this platform. Input can
+// still be read as it is.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("memory-mapped input is not supported on this platform")
+}
+
+func unmapFile(data []byte) error { return nil }
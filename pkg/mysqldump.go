@@ -0,0 +1,566 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mysqldumpProcessor masks the rows of the INSERT statements of a dump
+// written by mysqldump, keeping everything else of it as it was, so the
+// masked dump restores like the original. Rows are records keyed by table
+// and column, as in "customers.email", with the columns named by the INSERT
+// or, for extended INSERTs without them, by the CREATE TABLE before it.
+type mysqldumpProcessor struct {
+	config        AppConfig
+	methodFactory func() *masker
+}
+
+func newMySQLDumpProcessor(config AppConfig) *mysqldumpProcessor {
+	return &mysqldumpProcessor{
+		config:        config,
+		methodFactory: maskerFactory(config.Masker),
+	}
+}
+
+func (p *mysqldumpProcessor) Process(ctx context.Context, r io.Reader, w io.Writer) error {
+	d := &dumpReader{r: bufio.NewReaderSize(r, 64*1024), line: 1, tables: make(map[string][]string)}
+	a := &dumpAssembler{rows: newDumpRows()}
+	chunkReader := func() (any, error) {
+		row, err := d.next()
+		if err == io.EOF {
+			a.rows.setTail(d.pending.Bytes())
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Streamed records are not written, so their layout is not kept.
+		if p.config.emit == nil {
+			a.rows.add(row)
+		}
+		return row.record(), nil
+	}
+	return newRunner(p.methodFactory, p.config).Run(ctx, w, chunkReader, a)
+}
+
+// dumpRow is a row of an INSERT statement, with the dump before it.
+type dumpRow struct {
+	prefix  []byte // The dump from the end of the row before
+	table   string
+	columns []string
+	values  []dumpValue
+}
+
+// dumpValue is a value of a row: a string, json.Number or nil that is
+// masked, or a literal that is kept as it is, such as a blob.
+type dumpValue struct {
+	value any
+	raw   string // The literal kept, if not empty
+}
+
+// record returns the values of the row that are masked, keyed by table and
+// column.
+func (row dumpRow) record() map[string]any {
+	values := make(map[string]any, len(row.columns))
+	for i, column := range row.columns {
+		if row.values[i].raw == "" {
+			values[column] = row.values[i].value
+		}
+	}
+	return map[string]any{row.table: values}
+}
+
+// dumpReader splits a dump into the rows of its INSERT statements and the
+// dump between them.
+type dumpReader struct {
+	r       *bufio.Reader
+	line    int                 // Line of the next byte, counting from 1
+	tables  map[string][]string // Columns of the tables created so far
+	created string              // Table of the CREATE TABLE statement being read
+	columns []string            // Columns of created read so far
+
+	pending  bytes.Buffer // The dump read since the last row
+	table    string       // Table of the INSERT statement being read, if any
+	insert   []string     // Columns of the rows of that statement
+	afterRow bool         // A row of it was read, so a comma or semicolon follows
+}
+
+// next returns the next row of the dump, and io.EOF after the last one.
+func (d *dumpReader) next() (dumpRow, error) {
+	for {
+		if d.table != "" {
+			d.skipSpace(true)
+			c, err := d.readByte()
+			switch {
+			case err == io.EOF:
+				return dumpRow{}, &InputError{Err: fmt.Errorf("INSERT into %s is not terminated", d.table), Line: d.line}
+			case err != nil:
+				return dumpRow{}, err
+			case c == '(' && !d.afterRow:
+				d.afterRow = true
+				return d.readRow()
+			case c == ',' && d.afterRow:
+				d.pending.WriteByte(c)
+				d.afterRow = false
+			case c == ';' && d.afterRow:
+				d.pending.WriteByte(c)
+				d.table, d.afterRow = "", false
+			default:
+				return dumpRow{}, &InputError{Err: fmt.Errorf("unexpected %q between rows of INSERT into %s", c, d.table), Line: d.line}
+			}
+			continue
+		}
+		start, _ := d.r.Peek(8)
+		if head := strings.ToUpper(string(start)); strings.HasPrefix(head, "INSERT ") || strings.HasPrefix(head, "REPLACE ") {
+			if err := d.readInsert(); err != nil {
+				return dumpRow{}, err
+			}
+			continue
+		}
+		line, err := d.r.ReadBytes('\n')
+		d.line += bytes.Count(line, []byte{'\n'})
+		d.pending.Write(line)
+		d.noteColumns(line)
+		if err != nil {
+			return dumpRow{}, err
+		}
+	}
+}
+
+// noteColumns records the columns of the tables created, from the lines of
+// CREATE TABLE statements as mysqldump writes them: a line per column that
+// starts with its quoted name, and one closing the statement.
+func (d *dumpReader) noteColumns(line []byte) {
+	text := strings.TrimSpace(string(line))
+	switch {
+	case strings.HasPrefix(text, "CREATE TABLE "):
+		// The name is the last word before the columns, after any IF NOT
+		// EXISTS.
+		words := parseIdentifiers(strings.TrimPrefix(text, "CREATE TABLE "))
+		d.created, d.columns = "", nil
+		if len(words) > 0 {
+			d.created = words[len(words)-1]
+		}
+	case d.created == "":
+	case strings.HasPrefix(text, "`"):
+		if words := parseIdentifiers(text); len(words) > 0 {
+			d.columns = append(d.columns, words[0])
+		}
+	case strings.HasPrefix(text, ")"):
+		d.tables[d.created] = d.columns
+		d.created, d.columns = "", nil
+	}
+}
+
+// readInsert reads the start of an INSERT statement, up to its VALUES, and
+// the table and columns it names.
+func (d *dumpReader) readInsert() error {
+	var header bytes.Buffer
+	quoted := false
+	for {
+		c, err := d.readByte()
+		if err == io.EOF {
+			return &InputError{Err: errors.New("INSERT statement has no VALUES"), Line: d.line}
+		}
+		if err != nil {
+			return err
+		}
+		header.WriteByte(c)
+		if c == '`' {
+			quoted = !quoted
+		}
+		if !quoted && bytes.HasSuffix(bytes.ToUpper(header.Bytes()), []byte("VALUES")) {
+			if next, err := d.r.Peek(1); err != nil || next[0] == '(' || isSpace(next[0]) {
+				break
+			}
+		}
+	}
+	d.pending.Write(header.Bytes())
+	table, columns := parseInsert(header.String())
+	if table == "" {
+		return &InputError{Err: fmt.Errorf("INSERT statement %q names no table", header.String()), Line: d.line}
+	}
+	d.table, d.insert = table, columns
+	if d.insert == nil {
+		d.insert = d.tables[table]
+	}
+	return nil
+}
+
+// insertKeywords are the words of an INSERT statement before its table.
+var insertKeywords = []string{"INSERT", "REPLACE", "IGNORE", "INTO", "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "VALUES", "VALUE"}
+
+// parseInsert returns the table and, if listed, the columns of the start of
+// an INSERT statement.
+func parseInsert(header string) (table string, columns []string) {
+	listStart := strings.Index(header, "(")
+	names := header
+	if listStart >= 0 {
+		names = header[:listStart]
+	}
+	for _, word := range parseIdentifiers(names) {
+		if !containsFold(insertKeywords, word) {
+			table = word
+		}
+	}
+	if listStart >= 0 {
+		columns = parseIdentifiers(header[listStart+1 : strings.LastIndex(header, ")")])
+	}
+	return table, columns
+}
+
+// parseIdentifiers returns the identifiers of text, quoted in backticks or
+// not, leaving out the database of qualified names such as `db`.`table`.
+func parseIdentifiers(text string) []string {
+	var words []string
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '`':
+			var word strings.Builder
+			i++
+			for i < len(text) {
+				if text[i] == '`' {
+					if i+1 < len(text) && text[i+1] == '`' {
+						word.WriteByte('`')
+						i += 2
+						continue
+					}
+					break
+				}
+				word.WriteByte(text[i])
+				i++
+			}
+			words = append(words, word.String())
+			i++
+		case c == '.':
+			if len(words) > 0 {
+				words = words[:len(words)-1]
+			}
+			i++
+		case c == '(' || c == ')':
+			return words
+		case isSpace(c) || c == ',':
+			i++
+		default:
+			start := i
+			for i < len(text) && !isSpace(text[i]) && !strings.ContainsRune("`.,()", rune(text[i])) {
+				i++
+			}
+			words = append(words, text[start:i])
+		}
+	}
+	return words
+}
+
+func containsFold(words []string, word string) bool {
+	for _, w := range words {
+		if strings.EqualFold(w, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// readRow reads the values of a row after its opening parenthesis.
+func (d *dumpReader) readRow() (dumpRow, error) {
+	row := dumpRow{prefix: bytes.Clone(d.pending.Bytes()), table: d.table}
+	d.pending.Reset()
+	for {
+		d.skipSpace(false)
+		value, err := d.readValue()
+		if err != nil {
+			return dumpRow{}, err
+		}
+		row.values = append(row.values, value)
+		d.skipSpace(false)
+		c, err := d.readByte()
+		if err != nil {
+			return dumpRow{}, d.unterminated(err)
+		}
+		if c == ')' {
+			break
+		}
+		if c != ',' {
+			return dumpRow{}, &InputError{Err: fmt.Errorf("unexpected %q in a row of %s", c, d.table), Line: d.line}
+		}
+	}
+	row.columns = d.insert
+	switch {
+	case row.columns == nil:
+		row.columns = columnKeys(len(row.values))
+	case len(row.columns) != len(row.values):
+		return dumpRow{}, &InputError{Err: fmt.Errorf("row of %s has %d values for %d columns", d.table, len(row.values), len(row.columns)), Line: d.line}
+	}
+	return row, nil
+}
+
+// readValue reads a value of a row. Strings, numbers and NULL are masked;
+// blobs, whether hexadecimal, bit or _binary strings, and expressions are
+// kept as they are.
+func (d *dumpReader) readValue() (dumpValue, error) {
+	next, err := d.r.Peek(2)
+	if len(next) == 0 {
+		return dumpValue{}, d.unterminated(err)
+	}
+	switch {
+	case next[0] == '\'':
+		_, value, err := d.readString()
+		if err != nil {
+			return dumpValue{}, err
+		}
+		return dumpValue{value: value}, nil
+	case next[0] == '_' || len(next) == 2 && next[1] == '\'' && strings.ContainsRune("xXbBnN", rune(next[0])):
+		// Introducers such as _binary, and X'', B'' and N'' literals.
+		var raw strings.Builder
+		for {
+			c, err := d.r.Peek(1)
+			if err != nil {
+				return dumpValue{}, d.unterminated(err)
+			}
+			if c[0] == '\'' {
+				break
+			}
+			b, _ := d.readByte()
+			raw.WriteByte(b)
+		}
+		quoted, _, err := d.readString()
+		if err != nil {
+			return dumpValue{}, err
+		}
+		return dumpValue{raw: raw.String() + quoted}, nil
+	}
+	var token strings.Builder
+	for {
+		c, err := d.r.Peek(1)
+		if err != nil {
+			return dumpValue{}, d.unterminated(err)
+		}
+		if c[0] == ',' || c[0] == ')' || isSpace(c[0]) {
+			break
+		}
+		b, _ := d.readByte()
+		token.WriteByte(b)
+	}
+	text := token.String()
+	switch {
+	case strings.EqualFold(text, "NULL"):
+		return dumpValue{}, nil
+	case text == "":
+		return dumpValue{}, &InputError{Err: fmt.Errorf("missing value in a row of %s", d.table), Line: d.line}
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil && !strings.HasPrefix(text, "0x") {
+		return dumpValue{value: json.Number(text)}, nil
+	}
+	return dumpValue{raw: text}, nil
+}
+
+// readString reads a quoted string, returning it as it was written and
+// unescaped.
+func (d *dumpReader) readString() (raw, value string, err error) {
+	var written, unescaped strings.Builder
+	c, _ := d.readByte()
+	written.WriteByte(c)
+	for {
+		c, err := d.readByte()
+		if err != nil {
+			return "", "", d.unterminated(err)
+		}
+		written.WriteByte(c)
+		switch c {
+		case '\'':
+			if next, err := d.r.Peek(1); err == nil && next[0] == '\'' {
+				d.readByte()
+				written.WriteByte('\'')
+				unescaped.WriteByte('\'')
+				continue
+			}
+			return written.String(), unescaped.String(), nil
+		case '\\':
+			escaped, err := d.readByte()
+			if err != nil {
+				return "", "", d.unterminated(err)
+			}
+			written.WriteByte(escaped)
+			switch escaped {
+			case '0':
+				unescaped.WriteByte(0)
+			case 'b':
+				unescaped.WriteByte('\b')
+			case 'n':
+				unescaped.WriteByte('\n')
+			case 'r':
+				unescaped.WriteByte('\r')
+			case 't':
+				unescaped.WriteByte('\t')
+			case 'Z':
+				unescaped.WriteByte(0x1a)
+			case '%', '_':
+				// Kept escaped, as MySQL does outside of LIKE patterns.
+				unescaped.WriteByte('\\')
+				unescaped.WriteByte(escaped)
+			default:
+				unescaped.WriteByte(escaped)
+			}
+		default:
+			unescaped.WriteByte(c)
+		}
+	}
+}
+
+// skipSpace skips whitespace, keeping it in the dump between rows when keep
+// is set.
+func (d *dumpReader) skipSpace(keep bool) {
+	for {
+		c, err := d.r.Peek(1)
+		if err != nil || !isSpace(c[0]) {
+			return
+		}
+		d.readByte()
+		if keep {
+			d.pending.WriteByte(c[0])
+		}
+	}
+}
+
+func (d *dumpReader) readByte() (byte, error) {
+	c, err := d.r.ReadByte()
+	if c == '\n' && err == nil {
+		d.line++
+	}
+	return c, err
+}
+
+// unterminated reports the end of the input within a row.
+func (d *dumpReader) unterminated(err error) error {
+	if err == io.EOF {
+		return &InputError{Err: fmt.Errorf("row of %s is not terminated", d.table), Line: d.line}
+	}
+	return err
+}
+
+// dumpRows holds the rows read, by index, until they are written.
+type dumpRows struct {
+	mu    sync.Mutex
+	rows  map[int]dumpRow
+	count int    // Rows added
+	tail  []byte // The dump after the last row
+}
+
+func newDumpRows() *dumpRows {
+	return &dumpRows{rows: make(map[int]dumpRow)}
+}
+
+func (s *dumpRows) add(row dumpRow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows[s.count] = row
+	s.count++
+}
+
+func (s *dumpRows) take(index int) dumpRow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row := s.rows[index]
+	delete(s.rows, index)
+	return row
+}
+
+func (s *dumpRows) setTail(tail []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tail = bytes.Clone(tail)
+}
+
+// dumpAssembler writes masked rows in the layout they were read with.
+type dumpAssembler struct {
+	rows    *dumpRows
+	written int
+	buf     bytes.Buffer
+}
+
+func (a *dumpAssembler) WriteStart(w io.Writer) error {
+	return nil
+}
+
+func (a *dumpAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
+	row := a.rows.take(a.written)
+	a.written++
+	masked, _ := item.(map[string]any)[row.table].(map[string]any)
+	a.buf.Reset()
+	a.buf.Write(row.prefix)
+	a.buf.WriteByte('(')
+	for i, column := range row.columns {
+		if i > 0 {
+			a.buf.WriteByte(',')
+		}
+		if raw := row.values[i].raw; raw != "" {
+			a.buf.WriteString(raw)
+			continue
+		}
+		writeDumpValue(&a.buf, masked[column])
+	}
+	a.buf.WriteByte(')')
+	_, err := w.Write(a.buf.Bytes())
+	return err
+}
+
+func (a *dumpAssembler) WriteEnd(w io.Writer) error {
+	a.rows.mu.Lock()
+	defer a.rows.mu.Unlock()
+	_, err := w.Write(a.rows.tail)
+	return err
+}
+
+// writeDumpValue writes a masked value as a MySQL literal, escaped as
+// mysqldump escapes strings.
+func writeDumpValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("NULL")
+		return
+	case json.Number:
+		buf.WriteString(v.String())
+		return
+	case bool:
+		if v {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+		return
+	}
+	s := formatValue(value)
+	buf.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			buf.WriteString(`\0`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case 0x1a:
+			buf.WriteString(`\Z`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+}
@@ -0,0 +1,317 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type gender int
+
+const (
+	genderUnknown gender = iota
+	genderMale
+	genderFemale
+)
+
+// englishMaleNames and englishFemaleNames are used for gendered first names
+// when no locale is set, since gofakeit's first names carry no gender.
+var (
+	englishMaleNames   = []string{"James", "John", "Robert", "Michael", "William", "David", "Richard", "Joseph", "Thomas", "Charles", "Daniel", "Matthew", "Anthony", "Mark", "Steven", "Paul", "Andrew", "Joshua", "Kevin", "Brian"}
+	englishFemaleNames = []string{"Mary", "Patricia", "Jennifer", "Linda", "Elizabeth", "Barbara", "Susan", "Jessica", "Sarah", "Karen", "Emily", "Michelle", "Amanda", "Melissa", "Laura", "Rebecca", "Emma", "Olivia", "Hannah", "Rachel"}
+)
+
+// genderedValue is a title or gender value: the gender it denotes and the
+// value used for the other gender.
+type genderedValue struct {
+	gender      gender
+	counterpart string
+}
+
+// titleCounterparts maps lower case titles, without a trailing dot, to their
+// gender and the title used for the other gender.
+var titleCounterparts = map[string]genderedValue{
+	"mr": {genderMale, "mrs"}, "mister": {genderMale, "madam"}, "sir": {genderMale, "madam"},
+	"mrs": {genderFemale, "mr"}, "ms": {genderFemale, "mr"}, "miss": {genderFemale, "mr"}, "madam": {genderFemale, "mister"},
+	"dhr": {genderMale, "mevr"}, "mevr": {genderFemale, "dhr"},
+	"herr": {genderMale, "frau"}, "frau": {genderFemale, "herr"},
+	"m": {genderMale, "mme"}, "mme": {genderFemale, "m"}, "mlle": {genderFemale, "m"},
+	"sr": {genderMale, "sra"}, "sra": {genderFemale, "sr"}, "srta": {genderFemale, "sr"},
+	"sig": {genderMale, "sig.ra"}, "sig.ra": {genderFemale, "sig"},
+}
+
+// genderCounterparts does the same for the values of gender fields.
+var genderCounterparts = map[string]genderedValue{
+	"m": {genderMale, "f"}, "male": {genderMale, "female"}, "man": {genderMale, "woman"},
+	"f": {genderFemale, "m"}, "female": {genderFemale, "male"}, "woman": {genderFemale, "man"},
+	"v": {genderFemale, "m"}, "vrouw": {genderFemale, "man"}, "w": {genderFemale, "m"},
+}
+
+var (
+	firstNameKeyRegex = regexp.MustCompile(`(?i)^(first_?name|given_?name|forename|voornaam)$`)
+	lastNameKeyRegex  = regexp.MustCompile(`(?i)^(last_?name|surname|family_?name|achternaam)$`)
+	fullNameKeyRegex  = regexp.MustCompile(`(?i)^(full_?name|name|display_?name)$`)
+	titleKeyRegex     = regexp.MustCompile(`(?i)^(title|salutation|honorific|aanhef)$`)
+	genderKeyRegex    = regexp.MustCompile(`(?i)^(gender|sex|geslacht)$`)
+)
+
+// keyRoles are the fields of a card or a person the name of a key declares
+// its value to be.
+type keyRoles uint8
+
+const (
+	firstNameKey keyRoles = 1 << iota
+	lastNameKey
+	fullNameKey
+	titleKey
+	genderKey
+	cvvKey
+	expiryKey
+)
+
+// keyRolePatterns are the patterns of the names of keys of every role.
+var keyRolePatterns = []struct {
+	role  keyRoles
+	regex *regexp.Regexp
+}{
+	{firstNameKey, firstNameKeyRegex},
+	{lastNameKey, lastNameKeyRegex},
+	{fullNameKey, fullNameKeyRegex},
+	{titleKey, titleKeyRegex},
+	{genderKey, genderKeyRegex},
+	{cvvKey, cvvKeyRegex},
+	{expiryKey, expiryKeyRegex},
+}
+
+// rolesOf matches the name of a key against the patterns of the fields of
+// cards and persons.
+func rolesOf(name string) keyRoles {
+	var roles keyRoles
+	for _, p := range keyRolePatterns {
+		if p.regex.MatchString(name) {
+			roles |= p.role
+		}
+	}
+	return roles
+}
+
+// keyRoles returns the roles of the name of a key, which the masker
+// remembers: objects are searched for cards and persons by the names of all
+// their keys, which records repeat.
+func (m *masker) keyRoles(name string) keyRoles {
+	return m.roles.get(name, rolesOf)
+}
+
+// nameTypeOf returns the name type the last segment of path declares, such as
+// "first_name" for "customer.firstName", or "" for other keys.
+func nameTypeOf(path string) string {
+	return nameType(rolesOf(path[strings.LastIndexByte(path, '.')+1:]))
+}
+
+// nameTypeOf returns the name type of the last segment of path, as the
+// package-level nameTypeOf does, with the roles of keys remembered per masker.
+func (m *masker) nameTypeOf(path string) string {
+	return nameType(m.keyRoles(path[strings.LastIndexByte(path, '.')+1:]))
+}
+
+// nameType returns the name type of a key of roles.
+func nameType(roles keyRoles) string {
+	switch {
+	case roles&firstNameKey != 0:
+		return "first_name"
+	case roles&lastNameKey != 0:
+		return "last_name"
+	case roles&fullNameKey != 0:
+		return "name"
+	}
+	return ""
+}
+
+// nameFields holds the map keys of the fields that describe a person.
+type nameFields struct {
+	first, last, full, title, gender string
+}
+
+// findNameFields looks for name fields among the direct children of an
+// object: at least two of a first, last and full name, or one of them next
+// to a recognized title or gender. Title fields only count when they hold a
+// title such as "Mrs", since "title" is as often a job or book title.
+func (m *masker) findNameFields(fields map[string]any) (nameFields, bool) {
+	var names nameFields
+	for k, v := range fields {
+		s, ok := leafString(v)
+		if !ok {
+			continue
+		}
+		roles := m.keyRoles(strings.TrimPrefix(k, "-"))
+		switch {
+		case roles&firstNameKey != 0:
+			names.first = k
+		case roles&lastNameKey != 0:
+			names.last = k
+		case roles&fullNameKey != 0:
+			names.full = k
+		case roles&titleKey != 0 && lookupTitle(s).gender != genderUnknown:
+			names.title = k
+		case roles&genderKey != 0 && lookupGender(s).gender != genderUnknown:
+			names.gender = k
+		}
+	}
+	count := 0
+	for _, k := range []string{names.first, names.last, names.full} {
+		if k != "" {
+			count++
+		}
+	}
+	return names, count >= 2 || (count == 1 && (names.title != "" || names.gender != ""))
+}
+
+func lookupTitle(s string) genderedValue {
+	return titleCounterparts[strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")]
+}
+
+func lookupGender(s string) genderedValue {
+	return genderCounterparts[strings.ToLower(strings.TrimSpace(s))]
+}
+
+// maskNameFields generates a coherent fake person for a record: the fake first
+// name matches the gender given by the title or gender field, and the full
+// name is made of the same fake first and last name. Masked titles and
+// genders are replaced by a random gender, written in the style of the
+// original, and the names follow that gender instead. Everything is seeded on
+// the original names so a person masks to the same fake across records in
+// deterministic mode. Only fields for which shouldMaskField returns true are
+// replaced; the returned map holds the masked values by field key.
+func (m *masker) maskNameFields(fields map[string]any, names nameFields, shouldMaskField func(k string) bool) map[string]any {
+	masked := make(map[string]any, 5)
+	if m.nullify || m.partial != nil || m.dictionary != nil || m.hash != nil || m.custom != nil || m.wasm != nil {
+		return masked
+	}
+
+	var seed strings.Builder
+	for _, k := range []string{names.first, names.last, names.full} {
+		if k != "" {
+			s, _ := leafString(fields[k])
+			seed.WriteString(s + "\x00")
+		}
+	}
+	m.seeder.SeedFakerForWord(m.faker, seed.String())
+
+	g := genderUnknown
+	title, _ := leafString(fields[names.title])
+	genderValue, _ := leafString(fields[names.gender])
+	if names.title != "" {
+		g = lookupTitle(title).gender
+	} else if names.gender != "" {
+		g = lookupGender(genderValue).gender
+	}
+	if (names.title != "" && shouldMaskField(names.title)) || (names.gender != "" && shouldMaskField(names.gender)) {
+		fake := genderMale + gender(m.faker.Rand.Intn(2))
+		if names.title != "" && shouldMaskField(names.title) {
+			masked[names.title] = withLeafString(fields[names.title], switchTitle(title, g != fake))
+		}
+		if names.gender != "" && shouldMaskField(names.gender) {
+			masked[names.gender] = withLeafString(fields[names.gender], switchGender(genderValue, g != fake))
+		}
+		g = fake
+	}
+
+	first, last := m.fakeFirstName(g), m.fakeLastName()
+	if names.first != "" && shouldMaskField(names.first) {
+		masked[names.first] = withLeafString(fields[names.first], first)
+	}
+	if names.last != "" && shouldMaskField(names.last) {
+		masked[names.last] = withLeafString(fields[names.last], last)
+	}
+	if names.full != "" && shouldMaskField(names.full) {
+		full, _ := leafString(fields[names.full])
+		if strings.Contains(full, ",") {
+			masked[names.full] = withLeafString(fields[names.full], last+", "+first)
+		} else {
+			masked[names.full] = withLeafString(fields[names.full], first+" "+last)
+		}
+	}
+	return masked
+}
+
+// nameTypes are the types of rules masking single name values, which are not
+// part of a record's name fields.
+var nameTypes = []string{"name", "first_name", "last_name"}
+
+// fakeName generates a fake name of the given type. Full names keep the
+// "Last, First" order of the original.
+func (m *masker) fakeName(original, kind string) string {
+	switch kind {
+	case "first_name":
+		return m.fakeFirstName(genderUnknown)
+	case "last_name":
+		return m.fakeLastName()
+	}
+	first, last := m.fakeFirstName(genderUnknown), m.fakeLastName()
+	if strings.Contains(original, ",") {
+		return last + ", " + first
+	}
+	return first + " " + last
+}
+
+func (m *masker) fakeFirstName(g gender) string {
+	male, female := englishMaleNames, englishFemaleNames
+	if m.locale != nil {
+		male, female = m.locale.maleNames, m.locale.femaleNames
+	}
+	switch g {
+	case genderMale:
+		return m.pick(male)
+	case genderFemale:
+		return m.pick(female)
+	}
+	if m.faker.Rand.Intn(2) == 0 {
+		return m.pick(male)
+	}
+	return m.pick(female)
+}
+
+func (m *masker) fakeLastName() string {
+	if m.locale != nil {
+		return m.pick(m.locale.lastNames)
+	}
+	return m.faker.LastName()
+}
+
+// switchTitle returns the counterpart of a title for the other gender when
+// swap is set, keeping the capitalization and trailing dot of the original.
+func switchTitle(title string, swap bool) string {
+	if !swap {
+		return title
+	}
+	counterpart := lookupTitle(title).counterpart
+	if strings.HasSuffix(title, ".") && !strings.HasSuffix(counterpart, ".") {
+		counterpart += "."
+	}
+	return matchTitleCase(title, counterpart)
+}
+
+func switchGender(value string, swap bool) string {
+	if !swap {
+		return value
+	}
+	return matchTitleCase(value, lookupGender(value).counterpart)
+}
+
+// matchTitleCase writes s in upper case, capitalized or lower case like
+// original.
+func matchTitleCase(original, s string) string {
+	letters := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, original)
+	switch {
+	case len(letters) > 1 && strings.ToUpper(letters) == letters:
+		return strings.ToUpper(s)
+	case letters != "" && unicode.IsUpper([]rune(letters)[0]):
+		return strings.ToUpper(s[:1]) + s[1:]
+	}
+	return s
+}
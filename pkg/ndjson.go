@@ -0,0 +1,256 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// checkpointInterval is the number of records between checkpoints.
+const checkpointInterval = 10000
+
+// Checkpoint records how far a run got: the input up to Input and the output
+// up to Output hold the first Records records, completely masked. Offsets
+// count bytes from where the run started reading and writing.
+type Checkpoint struct {
+	Input   int64 `json:"input"`
+	Output  int64 `json:"output"`
+	Records int   `json:"records"`
+}
+
+type ndjsonProcessor struct {
+	config        AppConfig
+	methodFactory func() *masker
+}
+
+// newNDJSONProcessor creates a new processor for streams of JSON records, one
+// per line.
+func newNDJSONProcessor(config AppConfig) *ndjsonProcessor {
+	return &ndjsonProcessor{
+		config:        config,
+		methodFactory: maskerFactory(config.Masker),
+	}
+}
+
+// Process masks the records concurrently and writes them in order, each on
+// a line of its own. Records are read with a JSON decoder, so blank lines and
+// records spanning lines are accepted as well.
+func (np *ndjsonProcessor) Process(ctx context.Context, r io.Reader, w io.Writer) error {
+	runner := newRunner(np.methodFactory, np.config)
+	a := &ndjsonAssembler{out: bufferedOutput(w), checkpoint: np.config.Checkpoint, ends: make(map[int]int64), marshal: np.config.marshalJSON}
+	if np.config.style() == StylePreserve {
+		a.originals = newOriginalRecords()
+		runner.keepsInput = true
+	}
+	var next func() (originalRecord, error)
+	if mapped, ok := r.(*MappedInput); ok {
+		next = np.sliceRecords(mapped, a)
+	} else {
+		next = np.decodeRecords(r, a)
+	}
+	readRecord := selectRecords(&np.config, next)
+	chunkReader := func() (any, error) {
+		record, err := readRecord()
+		if err == nil && a.originals != nil {
+			a.originals.add(record.raw)
+		}
+		return record.data, err
+	}
+	if err := runner.Run(ctx, a.out, chunkReader, a); err != nil {
+		return err
+	}
+	return a.out.Flush()
+}
+
+// decodeRecords returns the function reading the records of r one at a time.
+func (np *ndjsonProcessor) decodeRecords(r io.Reader, a *ndjsonAssembler) func() (originalRecord, error) {
+	lines := &lineReader{r: r}
+	r = lines
+	rec := &recordingReader{r: r}
+	if a.originals != nil {
+		r = rec
+	}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	jp := &jsonProcessor{config: np.config}
+
+	recordCount := 0
+	var end int64
+	return func() (originalRecord, error) {
+		if !decoder.More() {
+			return originalRecord{}, io.EOF
+		}
+		data, err := jp.decodeValue(decoder, "")
+		if err != nil {
+			return originalRecord{}, lines.jsonError(err, recordCount+1, end)
+		}
+		start := end
+		end = decoder.InputOffset()
+		lines.advance(end)
+		a.recordEnd(recordCount, end)
+		recordCount++
+		if a.originals == nil {
+			return originalRecord{data: data}, nil
+		}
+		return originalRecord{data: data, raw: rec.take(start, end)}, nil
+	}
+}
+
+// sliceRecords returns the function reading the records of mapped input one
+// at a time, as decodeRecords does, but taking a line holding a record out of
+// the mapping as it is. A record is only split from the rest of the input by
+// a JSON decoder when its line holds more, such as a record spanning lines.
+func (np *ndjsonProcessor) sliceRecords(mapped *MappedInput, a *ndjsonAssembler) func() (originalRecord, error) {
+	data := mapped.rest()
+	jp := &jsonProcessor{config: np.config}
+	backend := np.config.jsonBackend
+	if np.config.canPrune() {
+		backend = nil // Pruned subtrees are split by the decoder
+	}
+	var line bytes.Reader
+
+	recordCount := 0
+	end := 0 // Offset in data after the last record
+	return func() (originalRecord, error) {
+		start := end
+		i := start
+		for i < len(data) && isJSONSpace(data[i]) {
+			i++
+		}
+		// The decoder stops at the end of a value it is not in, too.
+		if i == len(data) || data[i] == ']' || data[i] == '}' {
+			mapped.advance(len(data) - start)
+			return originalRecord{}, io.EOF
+		}
+		value := data[i:]
+		if n := bytes.IndexByte(value, '\n'); n >= 0 {
+			value = value[:n]
+		}
+		value = bytes.TrimRight(value, " \t\r")
+
+		var record any
+		var err error
+		sliced := false
+		if backend != nil {
+			if json.Valid(value) {
+				record, err = backend.Unmarshal(value)
+				sliced = err == nil
+			}
+		} else {
+			line.Reset(value)
+			decoder := json.NewDecoder(&line)
+			decoder.UseNumber()
+			if record, err = jp.decodeValue(decoder, ""); err == nil {
+				value, sliced = value[:decoder.InputOffset()], true
+			}
+		}
+		if !sliced {
+			// The rest of the input tells where the record ends or what is
+			// wrong with it.
+			decoder := json.NewDecoder(bytes.NewReader(data[i:]))
+			decoder.UseNumber()
+			if record, err = jp.decodeValue(decoder, ""); err != nil {
+				return originalRecord{}, mappedJSONError(data, err, recordCount+1, start, i)
+			}
+			value = data[i : i+int(decoder.InputOffset())]
+		}
+		end = i + len(value)
+		mapped.advance(end - start)
+		a.recordEnd(recordCount, int64(end))
+		recordCount++
+		if a.originals == nil {
+			return originalRecord{data: record}, nil
+		}
+		return originalRecord{data: record, raw: data[start:end]}, nil
+	}
+}
+
+// isJSONSpace reports whether c is whitespace between JSON values.
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// mappedJSONError locates err, of decoding data from offset from as the
+// given record, which starts after the previous one ends at start.
+func mappedJSONError(data []byte, err error, record, start, from int) *InputError {
+	// The input of the decoder is the rest of the mapping, taken from the
+	// start of the line it starts on.
+	lineStart := bytes.LastIndexByte(data[:from], '\n') + 1
+	lines := &lineReader{
+		buf:   data[lineStart:],
+		base:  int64(lineStart - from),
+		lines: bytes.Count(data[:lineStart], []byte{'\n'}),
+	}
+	return lines.jsonError(err, record, int64(start-from))
+}
+
+// ndjsonAssembler writes records a line each. With a checkpoint function, it
+// reports every checkpointInterval records how far input and output got.
+type ndjsonAssembler struct {
+	out        flushWriter
+	checkpoint func(Checkpoint) error
+	originals  *originalRecords          // The input of the records, with the preserve style
+	marshal    func(any) ([]byte, error) // Encodes records, with the JSON backend of the run
+	written    int64                     // Bytes of output
+	records    int                       // Records written
+
+	mu   sync.Mutex
+	ends map[int]int64 // Input offsets after records not yet written, by index
+}
+
+func (a *ndjsonAssembler) recordEnd(index int, offset int64) {
+	if a.checkpoint == nil {
+		return
+	}
+	a.mu.Lock()
+	a.ends[index] = offset
+	a.mu.Unlock()
+}
+
+func (a *ndjsonAssembler) WriteStart(w io.Writer) error { return nil }
+
+func (a *ndjsonAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
+	var data []byte
+	if a.originals != nil {
+		// Records keep their layout, but every one starts a line.
+		_, raw := cutSeparator(a.originals.take(a.records))
+		var buf bytes.Buffer
+		if err := writePreserved(&buf, raw, item); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	} else {
+		var err error
+		if data, err = a.marshal(item); err != nil {
+			return err
+		}
+	}
+	n, err := w.Write(append(data, '\n'))
+	a.written += int64(n)
+	if err != nil {
+		return err
+	}
+	index := a.records
+	a.records++
+
+	if a.checkpoint == nil {
+		return nil
+	}
+	a.mu.Lock()
+	end := a.ends[index]
+	delete(a.ends, index)
+	a.mu.Unlock()
+	if a.records%checkpointInterval != 0 {
+		return nil
+	}
+	// The output is flushed first, so a checkpoint never covers records
+	// that only exist in a buffer.
+	if err := a.out.Flush(); err != nil {
+		return err
+	}
+	return a.checkpoint(Checkpoint{Input: end, Output: a.written, Records: a.records})
+}
+
+func (a *ndjsonAssembler) WriteEnd(w io.Writer) error { return nil }
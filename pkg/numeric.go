@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// NumericRange bounds the masked numbers of keys matching Pattern, so masked
+// percentages stay within 0-100 or masked ages stay plausible. Fakes outside
+// the range are wrapped into it, keeping their number of decimals.
+type NumericRange struct {
+	Pattern string  `json:"pattern" yaml:"pattern"`
+	Min     float64 `json:"min" yaml:"min"`
+	Max     float64 `json:"max" yaml:"max"`
+
+	glob glob.Glob
+}
+
+// percentRange is inferred for keys that hold percentages.
+var (
+	percentRange    = &NumericRange{Min: 0, Max: 100}
+	percentKeyRegex = regexp.MustCompile(`(?i)(^|[._-])(percent(age)?|pct)$`)
+)
+
+// ParseRange parses a range as accepted by the -clamp flag: "PATTERN=MIN:MAX".
+func ParseRange(spec string) (NumericRange, error) {
+	pattern, bounds, ok := strings.Cut(spec, "=")
+	minimum, maximum, hasMax := strings.Cut(bounds, ":")
+	if !ok || !hasMax {
+		return NumericRange{}, fmt.Errorf("invalid range %q, expected PATTERN=MIN:MAX", spec)
+	}
+	lo, err := strconv.ParseFloat(minimum, 64)
+	if err != nil {
+		return NumericRange{}, fmt.Errorf("invalid minimum in range %q: %w", spec, err)
+	}
+	hi, err := strconv.ParseFloat(maximum, 64)
+	if err != nil {
+		return NumericRange{}, fmt.Errorf("invalid maximum in range %q: %w", spec, err)
+	}
+	return NumericRange{Pattern: pattern, Min: lo, Max: hi}, nil
+}
+
+func (r *NumericRange) compile() error {
+	if r.Min > r.Max {
+		return fmt.Errorf("range for %q has a minimum above its maximum", r.Pattern)
+	}
+	g, err := compileGlob(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid range pattern %q: %w", r.Pattern, err)
+	}
+	r.glob = g
+	return nil
+}
+
+// clamp wraps a masked number into the range. Numbers are wrapped rather than
+// cut off at the bounds, so clamped fakes do not all pile up on them. Values
+// that are not numbers are returned unchanged.
+func (r *NumericRange) clamp(value any) any {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return value
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || (f >= r.Min && f <= r.Max) {
+		return value
+	}
+
+	decimals := 0
+	if _, fraction, ok := strings.Cut(s, "."); ok {
+		decimals = len(fraction)
+	}
+	span := r.Max - r.Min
+	if decimals == 0 && r.Min == math.Trunc(r.Min) && r.Max == math.Trunc(r.Max) {
+		span++ // Integers can take the maximum too
+	}
+	clamped := r.Min
+	if span > 0 {
+		clamped = math.Min(r.Min+math.Mod(math.Abs(f), span), r.Max)
+	}
+	out := strconv.FormatFloat(clamped, 'f', decimals, 64)
+	if _, ok := value.(json.Number); ok {
+		return json.Number(out)
+	}
+	return out
+}
+
+// rangeFor returns the range masked numbers of key are clamped to, or nil.
+func (c *AppConfig) rangeFor(key string) *NumericRange {
+	for i := range c.Ranges {
+		if c.Ranges[i].glob.Match(key) {
+			return &c.Ranges[i]
+		}
+	}
+	if c.InferRanges && percentKeyRegex.MatchString(fieldPath(key)) {
+		return percentRange
+	}
+	return nil
+}
+
+// clampField clamps the masked value of key to its range. Only generated
+// fakes are clamped: encrypted, hashed and partially masked values must stay
+// as they are, as must values of rules that only mask part of them.
+func (c *AppConfig) clampField(m *masker, rule *Rule, key string, masked any) any {
+	r := c.rangeFor(key)
+	if r == nil {
+		return masked
+	}
+	if rule != nil {
+		if rule.regex != nil {
+			return masked
+		}
+		m = m.forRule(rule)
+	}
+	if !m.generatesFakes() {
+		return masked
+	}
+	return r.clamp(masked)
+}
@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+)
+
+// Option sets part of the configuration New creates an Engine with.
+type Option func(*AppConfig)
+
+// WithConfig starts from config, such as one a Config file describes, so the
+// options after it can adjust it.
+func WithConfig(config AppConfig) Option {
+	return func(c *AppConfig) { *c = config }
+}
+
+// WithFormat sets the format of the input: json, ndjson, xml, csv, text or
+// mysqldump.
+func WithFormat(format string) Option {
+	return func(c *AppConfig) { c.Format = format }
+}
+
+// WithCPUCount sets the most records masked concurrently, or
+// runtime.GOMAXPROCS with 0.
+func WithCPUCount(n int) Option {
+	return func(c *AppConfig) { c.CPUCount = n }
+}
+
+// WithMaxMemory bounds the bytes of the records a run holds, read but not yet
+// written, after which it stops reading until records are written.
+func WithMaxMemory(n int64) Option {
+	return func(c *AppConfig) { c.MaxMemory = n }
+}
+
+// WithBatchSize sets the number of records a worker masks at a time, passed
+// to it at once.
+func WithBatchSize(n int) Option {
+	return func(c *AppConfig) { c.BatchSize = n }
+}
+
+// WithMaxTextLine sets the longest line of text input masked as a whole, in
+// bytes. Longer lines are masked in parts of at most this size.
+func WithMaxTextLine(n int) Option {
+	return func(c *AppConfig) { c.MaxTextLine = n }
+}
+
+// WithJSONBackend sets the backend decoding and encoding json and ndjson
+// records: std, jsoniter or one registered with RegisterJSONBackend.
+func WithJSONBackend(name string) Option {
+	return func(c *AppConfig) { c.JSONBackend = name }
+}
+
+// WithInclude adds patterns of the keys to mask. Without any, all keys are.
+func WithInclude(patterns ...string) Option {
+	return func(c *AppConfig) { c.Include = slices.Concat(c.Include, patterns) }
+}
+
+// WithExclude adds patterns of the keys never to mask.
+func WithExclude(patterns ...string) Option {
+	return func(c *AppConfig) { c.Exclude = slices.Concat(c.Exclude, patterns) }
+}
+
+// WithRules adds rules, as the rules of a config file.
+func WithRules(rules ...Rule) Option {
+	return func(c *AppConfig) { c.Rules = slices.Concat(c.Rules, rules) }
+}
+
+// WithFieldMasker masks the values of keys matching pattern with fn.
+func WithFieldMasker(pattern string, fn MaskFunc) Option {
+	return func(c *AppConfig) {
+		// The map may be that of a config passed to WithConfig.
+		fieldMaskers := maps.Clone(c.FieldMaskers)
+		if fieldMaskers == nil {
+			fieldMaskers = make(map[string]MaskFunc)
+		}
+		fieldMaskers[pattern] = fn
+		c.FieldMaskers = fieldMaskers
+	}
+}
+
+// WithMasker sets the masking method and its settings.
+func WithMasker(masker MaskerConfig) Option {
+	return func(c *AppConfig) { c.Masker = masker }
+}
+
+// WithDeterministic masks the same values the same way for the same salt.
+func WithDeterministic(salt []byte) Option {
+	return func(c *AppConfig) { c.Masker.Method, c.Masker.Salt = MethodDeterministic, salt }
+}
+
+// WithMappingSet masks the values set has mappings for as recorded, and adds
+// the mappings of those masked for the first time to it.
+func WithMappingSet(set *MappingSet) Option {
+	return func(c *AppConfig) { c.MappingSet = set }
+}
+
+// WithOutputStyle sets the layout of JSON and XML output: pretty, compact or
+// preserve.
+func WithOutputStyle(style string) Option {
+	return func(c *AppConfig) { c.OutputStyle = style }
+}
+
+// WithOnMask calls fn for every value masking changes, as AppConfig.OnMask.
+func WithOnMask(fn func(MaskEvent) bool) Option {
+	return func(c *AppConfig) { c.OnMask = fn }
+}
+
+// Engine masks input as configured once by New. It can be used for any
+// number of runs, also concurrently, each masking as Start would.
+type Engine struct {
+	config  AppConfig
+	fields  *AppConfig              // Prepared for masking the fields of messages
+	bodies  map[string]*preparedRun // Of HTTP requests and responses, by format
+	maskers *Masker
+}
+
+// New creates an Engine from options, applied in order to a config of json
+// input masked randomly, by as many workers as runtime.GOMAXPROCS allows when
+// a run starts, as with Start. An invalid configuration is reported as a
+// *ConfigError, as Start would report it.
+func New(options ...Option) (*Engine, error) {
+	config := AppConfig{Format: "json", Masker: MaskerConfig{Method: MethodRandom}}
+	for _, option := range options {
+		option(&config)
+	}
+	// Dictionaries and modules are loaded once, for all runs, and the rest
+	// is prepared again by every run.
+	if err := config.Masker.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	validated := config
+	if _, err := validated.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	fields := config
+	fields.Format = "json"
+	if _, err := fields.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	// Bodies are written compact, and record mappings along with the
+	// fields of messages.
+	bodies := make(map[string]*preparedRun)
+	for _, format := range []string{"json", "ndjson"} {
+		body := config
+		body.Format = format
+		if body.OutputStyle == "" || body.OutputStyle == StylePretty {
+			body.OutputStyle = StyleCompact
+		}
+		if body.MappingFile != "" {
+			body.MappingFile, body.MappingSet = "", &MappingSet{store: fields.mappings}
+		}
+		bodies[format] = prepareRun(body)
+	}
+	maskers, err := NewMasker(config.Masker)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{config: config, fields: &fields, bodies: bodies, maskers: maskers}, nil
+}
+
+// Config returns the configuration of the engine.
+func (e *Engine) Config() AppConfig {
+	return e.config
+}
+
+// Mask masks r into w and returns the metrics of the run, as StartContext
+// does.
+func (e *Engine) Mask(ctx context.Context, r io.Reader, w io.Writer) (*Stats, error) {
+	return StartContext(ctx, r, w, e.config)
+}
+
+// Masker returns a Masker for single values, masking them with the method of
+// the engine.
+func (e *Engine) Masker() *Masker {
+	return e.maskers
+}
+
+// Stream returns the masked records of r, as NewRecordStream does.
+func (e *Engine) Stream(ctx context.Context, r io.Reader) *RecordStream {
+	return NewRecordStream(ctx, r, e.config)
+}
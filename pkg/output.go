@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// outputBufferSize is the size of the buffers the output of a run is
+// collected in before it is written.
+const outputBufferSize = 256 << 10
+
+// outputBuffers is the number of full buffers that wait to be written before
+// writing the output holds up the run.
+const outputBuffers = 4
+
+// flushWriter is a buffered writer, such as the output of a run.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// bufferedOutput returns w buffered, as it is already when it is the output
+// of a run.
+func bufferedOutput(w io.Writer) flushWriter {
+	if fw, ok := w.(flushWriter); ok {
+		return fw
+	}
+	return bufio.NewWriterSize(w, outputBufferSize)
+}
+
+// outputWriter buffers the output of a run and writes every buffer once it
+// is full from a goroutine of its own. Records go on being masked and written
+// to the next buffer meanwhile, so a slow destination, such as a network
+// filesystem or S3, holds up the run only once outputBuffers wait for it.
+// An error writing w is returned by every later call.
+type outputWriter struct {
+	w       io.Writer
+	buf     []byte
+	pending chan outputChunk
+	free    chan []byte
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error // Of the first write of w that failed
+}
+
+// outputChunk is a buffer to write, or, with flushed, a request to be told
+// once all buffers before it are written.
+type outputChunk struct {
+	data    []byte
+	flushed chan struct{}
+}
+
+func newOutputWriter(w io.Writer) *outputWriter {
+	ow := &outputWriter{
+		w:       w,
+		pending: make(chan outputChunk, outputBuffers),
+		free:    make(chan []byte, outputBuffers+1),
+		done:    make(chan struct{}),
+	}
+	go ow.run()
+	return ow
+}
+
+func (ow *outputWriter) run() {
+	defer close(ow.done)
+	for chunk := range ow.pending {
+		if chunk.flushed != nil {
+			close(chunk.flushed)
+			continue
+		}
+		if ow.error() == nil {
+			if _, err := ow.w.Write(chunk.data); err != nil {
+				ow.mu.Lock()
+				ow.err = err
+				ow.mu.Unlock()
+			}
+		}
+		select {
+		case ow.free <- chunk.data[:0]:
+		default:
+		}
+	}
+}
+
+func (ow *outputWriter) error() error {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	return ow.err
+}
+
+func (ow *outputWriter) Write(p []byte) (int, error) {
+	if err := ow.error(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		if ow.buf == nil {
+			select {
+			case ow.buf = <-ow.free:
+			default:
+				ow.buf = make([]byte, 0, outputBufferSize)
+			}
+		}
+		copied := min(len(p), cap(ow.buf)-len(ow.buf))
+		ow.buf, p = append(ow.buf, p[:copied]...), p[copied:]
+		if len(ow.buf) == cap(ow.buf) {
+			ow.send()
+		}
+	}
+	return n, nil
+}
+
+// send passes the buffer on to be written.
+func (ow *outputWriter) send() {
+	if len(ow.buf) > 0 {
+		ow.pending <- outputChunk{data: ow.buf}
+	}
+	ow.buf = nil
+}
+
+// Flush writes what was written so far to w, and returns once it is.
+func (ow *outputWriter) Flush() error {
+	ow.send()
+	flushed := make(chan struct{})
+	ow.pending <- outputChunk{flushed: flushed}
+	<-flushed
+	return ow.error()
+}
+
+// Close flushes the output and stops writing it.
+func (ow *outputWriter) Close() error {
+	ow.send()
+	close(ow.pending)
+	<-ow.done
+	return ow.error()
+}
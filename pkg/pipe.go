@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// DefaultMaxLine is the longest line a Pipe masks unless told otherwise.
+const DefaultMaxLine = 1 << 20
+
+// Pipe masks line-delimited JSON a line at a time, for the exec filters of
+// log forwarders such as Fluent Bit, Vector and Logstash. Every line is
+// masked as soon as it is read and the output is flushed whenever no more
+// input is waiting, so records are held up no longer than masking them takes.
+// Records are masked as those of ndjson input are; lines that are not JSON
+// have the words detected as personal data masked, as MaskingWriter masks
+// them. Lines longer than MaxLine are dropped rather than held in memory, and
+// reported to the Report writer of the config.
+type Pipe struct {
+	MaxLine int // Longest line masked, in bytes; DefaultMaxLine if 0
+
+	current atomic.Pointer[pipeEngine]
+}
+
+// pipeEngine is an engine a Pipe masks with.
+type pipeEngine struct {
+	engine *Engine
+	runner *Runner
+}
+
+// NewPipe creates a Pipe masking with engine.
+func NewPipe(engine *Engine) *Pipe {
+	p := &Pipe{}
+	p.current.Store(&pipeEngine{engine: engine, runner: newRunner(nil, *engine.fields)})
+	return p
+}
+
+// Reload makes the pipe mask with engine from the next line on, such as one
+// with rules reloaded on SIGHUP. The mappings of a mapping file of the engine
+// replaced are saved.
+func (p *Pipe) Reload(engine *Engine) error {
+	old := p.current.Swap(&pipeEngine{engine: engine, runner: newRunner(nil, *engine.fields)})
+	return old.saveMappings()
+}
+
+// Run masks the lines of r to w until r ends or ctx is done, between lines.
+func (p *Pipe) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	in := bufio.NewReaderSize(r, 64*1024)
+	out := bufio.NewWriter(w)
+	maxLine := cmp.Or(p.MaxLine, DefaultMaxLine)
+	var buf []byte
+	lines := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			out.Flush()
+			return err
+		}
+		line, n, err := readLine(in, buf[:0], maxLine)
+		if err != nil && err != io.EOF {
+			out.Flush()
+			return &InputError{Err: err, Line: lines + 1}
+		}
+		if n > 0 || err == nil {
+			lines++
+			current := p.current.Load()
+			if line == nil {
+				if report := current.engine.fields.Report; report != nil {
+					fmt.Fprintf(report, "Dropped line %d of %d bytes, longer than %d\n", lines, n, maxLine)
+				}
+			} else {
+				masked, maskErr := current.maskLine(line)
+				if maskErr != nil {
+					out.Flush()
+					return maskErr
+				}
+				out.Write(masked)
+				if _, err := out.Write([]byte{'\n'}); err != nil {
+					return err
+				}
+			}
+			buf = line
+		}
+		if err == io.EOF {
+			break
+		}
+		if in.Buffered() == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	return p.current.Load().saveMappings()
+}
+
+// readLine reads a line into buf, without its newline, and returns it along
+// with its length. Lines longer than max are skipped without holding them,
+// and returned as nil.
+func readLine(r *bufio.Reader, buf []byte, max int) ([]byte, int, error) {
+	n := 0
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += len(chunk)
+		if n <= max+1 {
+			buf = append(buf, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(chunk) > 0 && chunk[len(chunk)-1] == '\n' {
+			n--
+		}
+		if n > max {
+			return nil, n, err
+		}
+		return buf[:n], n, err
+	}
+}
+
+// maskLine masks a line of JSON as a record, or another line as text.
+func (e *pipeEngine) maskLine(line []byte) ([]byte, error) {
+	var record any
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil || decoder.More() {
+		var masked string
+		e.engine.maskers.with(func(m *masker) { masked = e.engine.fields.maskWords(m, "", string(line)) })
+		return []byte(masked), nil
+	}
+	var masked any
+	e.engine.maskers.with(func(m *masker) { masked = e.runner.recursiveMask(m, "", record) })
+	return json.Marshal(masked)
+}
+
+// saveMappings saves the mappings of a mapping file of the engine.
+func (e *pipeEngine) saveMappings() error {
+	if e.engine.fields.MappingFile == "" {
+		return nil
+	}
+	return e.engine.fields.mappings.save(e.engine.fields.MappingFile, e.engine.fields.MappingKey)
+}
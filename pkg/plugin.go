@@ -0,0 +1,17 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package pkg
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPlugin opens a Go plugin built with -buildmode=plugin. Its init
+// functions register its maskers with RegisterMasker.
+func LoadPlugin(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("error loading plugin %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package pkg
+
+import "fmt"
+
+// LoadPlugin reports that Go plugins are not supported on this platform.
+// Maskers can still be registered with RegisterMasker in a custom build.
+func LoadPlugin(path string) error {
+	return fmt.Errorf("error loading plugin %s: plugins are not supported on this platform", path)
+}
@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Output styles of JSON and XML. Pretty output is indented by two spaces,
+// compact output holds no whitespace at all, and preserved output keeps the
+// layout of the input, down to the key order and the notation of values that
+// were not masked, so it can be reviewed with a diff against the input.
+const (
+	StylePretty   = "pretty"
+	StyleCompact  = "compact"
+	StylePreserve = "preserve"
+)
+
+var outputStyles = []string{StylePretty, StyleCompact, StylePreserve}
+
+// style returns the style output is written in, pretty unless one is set,
+// except for ndjson records, which are one to a line.
+func (c *AppConfig) style() string {
+	switch {
+	case c.OutputStyle != "":
+		return c.OutputStyle
+	case c.Format == "ndjson":
+		return StyleCompact
+	}
+	return StylePretty
+}
+
+// recordingReader keeps what is read from r, so the input between two
+// offsets can be taken once a decoder reading it got past them.
+type recordingReader struct {
+	r    io.Reader
+	buf  []byte
+	base int64 // Offset of buf[0] in the input
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+// take returns the input from start to end, dropping what came before.
+func (rr *recordingReader) take(start, end int64) []byte {
+	data := bytes.Clone(rr.buf[start-rr.base : end-rr.base])
+	rr.buf = rr.buf[end-rr.base:]
+	rr.base = end
+	return data
+}
+
+// originalRecords holds records as they were read, by index, until they are
+// written in the preserve style.
+type originalRecords struct {
+	mu      sync.Mutex
+	records map[int][]byte
+	count   int    // Records added
+	tail    []byte // The input after the last record, up to the end of the root value
+}
+
+func newOriginalRecords() *originalRecords {
+	return &originalRecords{records: make(map[int][]byte)}
+}
+
+func (o *originalRecords) add(raw []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.records[o.count] = raw
+	o.count++
+}
+
+func (o *originalRecords) take(index int) []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	raw := o.records[index]
+	delete(o.records, index)
+	return raw
+}
+
+func (o *originalRecords) setTail(tail []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.tail = tail
+}
+
+func (o *originalRecords) getTail() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.tail
+}
+
+// cutSeparator splits raw, the input from the end of one JSON value to the end
+// of the next, into the whitespace and commas separating them and the value.
+func cutSeparator(raw []byte) ([]byte, []byte) {
+	value := bytes.TrimLeft(raw, " \t\r\n,")
+	return raw[:len(raw)-len(value)], value
+}
+
+// writePreserved writes raw, a JSON value as it was read, replacing the
+// scalars masking changed by their value in masked, the same value masked.
+// Everything else, whitespace included, is copied as it was.
+func writePreserved(buf *bytes.Buffer, raw []byte, masked any) error {
+	p := &preserver{decoder: json.NewDecoder(bytes.NewReader(raw)), raw: raw, buf: buf}
+	p.decoder.UseNumber()
+	return p.value(masked, true)
+}
+
+type preserver struct {
+	decoder *json.Decoder
+	raw     []byte
+	offset  int64 // Offset in raw up to which the input was copied
+	buf     *bytes.Buffer
+}
+
+// next reads the next token and returns it with the input leading up to it,
+// such as whitespace, a colon or comma, and the token itself.
+func (p *preserver) next() (json.Token, []byte, error) {
+	token, err := p.decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	end := p.decoder.InputOffset()
+	segment := p.raw[p.offset:end]
+	p.offset = end
+	return token, segment, nil
+}
+
+// value copies the next value, where masked is its masked counterpart if
+// found is set.
+func (p *preserver) value(masked any, found bool) error {
+	token, segment, err := p.next()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		p.buf.Write(segment)
+		object, isObject := masked.(map[string]any)
+		for p.decoder.More() {
+			key, segment, err := p.next()
+			if err != nil {
+				return err
+			}
+			p.buf.Write(segment)
+			value, ok := object[key.(string)]
+			if err := p.value(value, found && isObject && ok); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		p.buf.Write(segment)
+		array, isArray := masked.([]any)
+		for i := 0; p.decoder.More(); i++ {
+			var value any
+			if i < len(array) {
+				value = array[i]
+			}
+			if err := p.value(value, found && isArray && i < len(array)); err != nil {
+				return err
+			}
+		}
+	default:
+		if !found || reflect.DeepEqual(token, masked) {
+			p.buf.Write(segment)
+			return nil
+		}
+		data, err := json.Marshal(masked)
+		if err != nil {
+			return fmt.Errorf("error encoding masked value: %w", err)
+		}
+		// The literal is preceded by nothing but whitespace and
+		// separators, none of which it can start with.
+		literal := bytes.TrimLeft(segment, " \t\r\n,:")
+		p.buf.Write(segment[:len(segment)-len(literal)])
+		p.buf.Write(data)
+		return nil
+	}
+	_, segment, err = p.next() // The closing brace or bracket
+	p.buf.Write(segment)
+	return err
+}
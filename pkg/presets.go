@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Key patterns of the fields presets target, shared between regimes.
+const (
+	presetNames      = "**.{name,full_name,fullname,fullName}"
+	presetFirstNames = "**.{first_name,firstname,firstName,given_name,givenName}"
+	presetLastNames  = "**.{last_name,lastname,lastName,surname,family_name,familyName,maiden_name}"
+	presetEmails     = "**.{email,email_address,emailAddress,mail}"
+	presetPhones     = "**.{phone,phone_number,phoneNumber,mobile,cell,telephone,fax}"
+	presetAddresses  = "**.{address,street,street_address,streetAddress,address_line1,address_line2,city,zip,zipcode,zip_code,postcode,postal_code,postalCode}"
+	presetBirthDates = "**.{dob,date_of_birth,dateOfBirth,birth_date,birthdate,birthday}"
+	presetNationalID = "**.{ssn,social_security_number,national_id,nationalId,bsn,nino,tax_id,taxId,passport,passport_number,drivers_license,license_number}"
+	presetNetwork    = "**.{ip,ip_address,ipAddress,ipv4,ipv6,mac,mac_address,device_id,deviceId}"
+	presetCards      = "**.{card_number,cardNumber,card_no,cc_number,credit_card,creditcard,pan}"
+)
+
+// presets are curated rules for the fields that common regulations protect,
+// selected by field names and by the detected type of values under any key.
+// They come after the rules of the policy, so those take precedence.
+var presets = map[string][]Rule{
+	// Personal data as meant by the GDPR.
+	"gdpr": {
+		{Pattern: presetNames, Type: "name"},
+		{Pattern: presetFirstNames, Type: "first_name"},
+		{Pattern: presetLastNames, Type: "last_name"},
+		{Pattern: presetEmails, Type: "email"},
+		{Pattern: presetPhones, Type: "phone"},
+		{Pattern: presetAddresses},
+		{Pattern: presetBirthDates, Type: "date"},
+		{Pattern: presetNationalID, Method: "null"},
+		{Pattern: presetNetwork},
+		{Pattern: "**.{iban,bank_account,account_number}", Type: "iban"},
+		{Detected: "email"},
+		{Detected: "phone"},
+		{Detected: "iban"},
+		{Detected: "ipv4"},
+		{Detected: "ipv6"},
+	},
+	// The identifiers of the HIPAA Safe Harbor method.
+	"hipaa": {
+		{Pattern: presetNames, Type: "name"},
+		{Pattern: presetFirstNames, Type: "first_name"},
+		{Pattern: presetLastNames, Type: "last_name"},
+		{Pattern: presetEmails, Type: "email"},
+		{Pattern: presetPhones, Type: "phone"},
+		{Pattern: presetAddresses},
+		{Pattern: presetBirthDates, Type: "date"},
+		{Pattern: presetNationalID, Method: "null"},
+		{Pattern: presetNetwork},
+		{Pattern: "**.{mrn,medical_record_number,patient_id,patientId,health_plan_id,member_id,beneficiary_id,account_number}", Method: "hash"},
+		{Pattern: "**.{admission_date,discharge_date,date_of_death}", Type: "date"},
+		{Pattern: "**.{vin,license_plate,serial_number,url,website}"},
+		{Detected: "email"},
+		{Detected: "phone"},
+		{Detected: "ipv4"},
+		{Detected: "ipv6"},
+		{Detected: "url"},
+	},
+	// Cardholder and sensitive authentication data as meant by PCI DSS.
+	"pci": {
+		{Pattern: presetCards, Method: "partial:last4"},
+		{Pattern: "**.{cvv,cvv2,cvc,cvc2,card_verification,security_code,pin,pin_block,track1,track2,track_data}", Method: "null"},
+		{Pattern: "**.{cardholder,cardholder_name,card_holder,name_on_card}", Type: "name"},
+		{Pattern: "**.{expiry,expiration,exp_date,card_expiry,expiry_date}"},
+		{Detected: "credit_card", Method: "partial:last4"},
+	},
+}
+
+// Presets returns the names of the built-in presets.
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// PresetRules returns the rules of the named preset.
+func PresetRules(name string) ([]Rule, error) {
+	rules, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q, expected one of %s", name, strings.Join(Presets(), ", "))
+	}
+	return slices.Clone(rules), nil
+}
@@ -0,0 +1,463 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/gobwas/glob"
+)
+
+// Rule customizes how the values of keys matching Pattern are masked. An empty
+// Pattern matches every key, and is the only kind of rule applied to text
+// input, which has no keys.
+//
+// Rules are evaluated by descending Priority, and rules of equal priority in
+// the order they are listed; the first rule matching a value is applied. A key
+// matching an exclude pattern is never masked, whatever its rules, and a key
+// matching a rule is masked even when no include pattern selects it.
+//
+// Value and Detected restrict the rule to values matching a regular
+// expression or detected as a type such as "email", wherever they occur, for
+// documents whose keys are not known up front.
+//
+// A Template generates the fake value from a gofakeit template such as
+// "{firstname} {lastname}" or "EMP-####" instead of detecting the type of the
+// original value.
+//
+// A Type, such as "phone", "email" or "name", overrides the detected type of
+// the value, for values the detector would misclassify.
+//
+// A Method, such as "null" or "partial:last4", overrides the masking method
+// for the matched keys. It shares the salt and keys of the global method, so
+// deterministic values stay consistent with other fields.
+//
+// When Regex is set, only the parts of a value it matches are changed:
+// with a Replacement, every match is replaced by the expanded template
+// (using $1 or ${name} for capture groups, as in regexp.Expand); without one,
+// the capture groups of every match, or the whole match if the expression
+// has no groups, are masked or generated from the Template. Values the
+// expression does not match are left as they are.
+type Rule struct {
+	Pattern     string `json:"pattern" yaml:"pattern"`
+	Regex       string `json:"regex" yaml:"regex"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+	Template    string `json:"template" yaml:"template"`
+	Method      string `json:"method" yaml:"method"`
+	Type        string `json:"type" yaml:"type"`
+	Value       string `json:"value" yaml:"value"`
+	Detected    string `json:"detected" yaml:"detected"`
+	Priority    int    `json:"priority" yaml:"priority"`
+
+	glob       glob.Glob
+	regex      *regexp.Regexp
+	valueRegex *regexp.Regexp
+	masker     *MaskerConfig
+	fn         MaskFunc // Set for field maskers
+}
+
+// ParseRule parses a rule as accepted by the -rule flag: "PATTERN=REGEX" to
+// mask what the expression captures, or "PATTERN=REGEX=>REPLACEMENT".
+func ParseRule(spec string) (Rule, error) {
+	pattern, expr, ok := strings.Cut(spec, "=")
+	if !ok || expr == "" {
+		return Rule{}, fmt.Errorf("invalid rule %q, expected PATTERN=REGEX or PATTERN=REGEX=>REPLACEMENT", spec)
+	}
+	rule := Rule{Pattern: pattern, Regex: expr}
+	if expr, replacement, ok := strings.Cut(expr, "=>"); ok {
+		rule.Regex, rule.Replacement = expr, replacement
+	}
+	return rule, nil
+}
+
+// ParseTemplateRule parses a rule as accepted by the -template flag:
+// "PATTERN=TEMPLATE".
+func ParseTemplateRule(spec string) (Rule, error) {
+	pattern, template, ok := strings.Cut(spec, "=")
+	if !ok || template == "" {
+		return Rule{}, fmt.Errorf("invalid template %q, expected PATTERN=TEMPLATE", spec)
+	}
+	return Rule{Pattern: pattern, Template: template}, nil
+}
+
+// ParseTypeRule parses a rule as accepted by the -type flag: "PATTERN=TYPE".
+func ParseTypeRule(spec string) (Rule, error) {
+	pattern, kind, ok := strings.Cut(spec, "=")
+	if !ok || kind == "" {
+		return Rule{}, fmt.Errorf("invalid type %q, expected PATTERN=TYPE", spec)
+	}
+	return Rule{Pattern: pattern, Type: kind}, nil
+}
+
+// ParseValueRule parses a rule as accepted by the -match-value flag: a regex
+// selecting the values to mask under any key.
+func ParseValueRule(spec string) (Rule, error) {
+	if spec == "" {
+		return Rule{}, fmt.Errorf("invalid value rule, expected REGEX")
+	}
+	return Rule{Value: spec}, nil
+}
+
+// ParseDetectedRule parses a rule as accepted by the -match-type flag: the
+// detected type of the values to mask under any key.
+func ParseDetectedRule(spec string) (Rule, error) {
+	if spec == "" {
+		return Rule{}, fmt.Errorf("invalid type rule, expected TYPE")
+	}
+	return Rule{Detected: spec}, nil
+}
+
+// ParseMethodRule parses a rule as accepted by the -field-method flag:
+// "PATTERN=METHOD".
+func ParseMethodRule(spec string) (Rule, error) {
+	pattern, method, ok := strings.Cut(spec, "=")
+	if !ok || method == "" {
+		return Rule{}, fmt.Errorf("invalid field method %q, expected PATTERN=METHOD", spec)
+	}
+	return Rule{Pattern: pattern, Method: method}, nil
+}
+
+// templateFuncRegex matches the {function} and {function:params} lookups of a
+// gofakeit template.
+var templateFuncRegex = regexp.MustCompile(`\{([^{}:]+)(?::[^{}]*)?\}`)
+
+func (r *Rule) compile(base MaskerConfig) error {
+	if r.Pattern != "" {
+		g, err := compileGlob(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid rule pattern %q: %w", r.Pattern, err)
+		}
+		r.glob = g
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid rule regex %q: %w", r.Regex, err)
+		}
+		r.regex = re
+	} else if r.Replacement != "" {
+		return fmt.Errorf("rule for %q has a replacement but no regex", r.Pattern)
+	}
+	if r.Template != "" && r.Replacement != "" {
+		return fmt.Errorf("rule for %q cannot have both a replacement and a template", r.Pattern)
+	}
+	if r.Value != "" {
+		re, err := regexp.Compile(r.Value)
+		if err != nil {
+			return fmt.Errorf("invalid rule value regex %q: %w", r.Value, err)
+		}
+		r.valueRegex = re
+	}
+	if r.Detected != "" && !slices.Contains(fakeTypes, r.Detected) {
+		return fmt.Errorf("unknown detected type %q for rule %q, expected one of %s", r.Detected, r.Pattern, strings.Join(fakeTypes, ", "))
+	}
+	if r.Type != "" && !slices.Contains(hintTypes, r.Type) {
+		return fmt.Errorf("unknown type %q for rule %q, expected one of %s", r.Type, r.Pattern, strings.Join(hintTypes, ", "))
+	}
+	if r.Type != "" && (r.Template != "" || r.Replacement != "") {
+		return fmt.Errorf("rule for %q cannot have both a type and a template or replacement", r.Pattern)
+	}
+	// gofakeit leaves unknown lookups in the output as they are, which would
+	// silently leak the template into masked data.
+	for _, match := range templateFuncRegex.FindAllStringSubmatch(r.Template, -1) {
+		if gofakeit.GetFuncLookup(match[1]) == nil {
+			return fmt.Errorf("unknown function %q in template %q", match[1], r.Template)
+		}
+	}
+	if r.fn != nil {
+		// The seeding of the global method decides whether fakes drawn
+		// from the faker are consistent, as for registered methods.
+		config := base
+		config.Method, config.custom = "", r.fn
+		r.masker = &config
+	}
+	if r.Method != "" {
+		method, err := ParseMethod(r.Method)
+		if err != nil {
+			return fmt.Errorf("invalid method for rule %q: %w", r.Pattern, err)
+		}
+		config := base
+		config.Method = method.Method
+		config.Partial = method.Partial
+		config.Hash = method.Hash
+		if method.DictionaryFile != "" {
+			config.DictionaryFile, config.Dictionary = method.DictionaryFile, nil
+		}
+		if method.WasmFile != "" {
+			config.WasmFile, config.Wasm = method.WasmFile, nil
+		}
+		if err := config.prepare(); err != nil {
+			return fmt.Errorf("invalid method for rule %q: %w", r.Pattern, err)
+		}
+		r.masker = &config
+	}
+	return nil
+}
+
+// matchesValue reports whether the value of a key the rule's pattern matches
+// is one the rule selects.
+func (r *Rule) matchesValue(m *masker, value any) bool {
+	if r.valueRegex == nil && r.Detected == "" {
+		return true
+	}
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return false
+	}
+	if r.valueRegex != nil && !r.valueRegex.MatchString(s) {
+		return false
+	}
+	return r.Detected == "" || m.detectedType(s) == r.Detected
+}
+
+// apply masks a value of key according to the rule. Regexes only apply to
+// strings and numbers; other values are masked as usual or generated from the
+// Template.
+func (r *Rule) apply(m *masker, key string, value any) any {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		if value != nil && r.Template != "" {
+			return m.fakeTemplate(r.Template, value)
+		}
+		return m.maskKey(key, value)
+	}
+	if r.regex == nil {
+		return r.maskValue(m, key, value)
+	}
+
+	var out string
+	if r.Replacement != "" {
+		out = r.regex.ReplaceAllString(s, r.Replacement)
+	} else {
+		out = r.maskSubmatches(m, key, s)
+	}
+
+	// Numbers stay numbers as long as the result is still a valid JSON number.
+	if _, ok := value.(json.Number); ok && isJSONNumber(out) {
+		return json.Number(out)
+	}
+	return out
+}
+
+// maskSubmatches masks the capture groups of every match of the rule's regex
+// in s, or the whole matches if the regex has no groups.
+func (r *Rule) maskSubmatches(m *masker, key, s string) string {
+	var b strings.Builder
+	last := 0
+	for _, match := range r.regex.FindAllStringSubmatchIndex(s, -1) {
+		groups := match[2:]
+		if len(groups) == 0 {
+			groups = match[:2]
+		}
+		for i := 0; i < len(groups); i += 2 {
+			start, end := groups[i], groups[i+1]
+			// Skip groups that did not participate in the match, or that are
+			// nested within a group that was already masked.
+			if start < 0 || start < last || start == end {
+				continue
+			}
+			b.WriteString(s[last:start])
+			b.WriteString(formatValue(r.maskValue(m, key, s[start:end])))
+			last = end
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func (r *Rule) maskValue(m *masker, key string, value any) any {
+	if r.Template != "" {
+		return m.fakeTemplate(r.Template, value)
+	}
+	if r.Type != "" {
+		return m.maskAs(key, value, r.Type)
+	}
+	return m.maskKey(key, value)
+}
+
+// fakeTemplate generates a fake value from a gofakeit template, seeded on the
+// original value so deterministic runs stay consistent.
+func (m *masker) fakeTemplate(template string, original any) string {
+	m.seeder.SeedFaker(m.faker, original)
+	return m.faker.Generate(m.localizeTemplate(template))
+}
+
+// maskAs masks a string or number as a value of the given type instead of its
+// detected one. Methods that do not generate fakes ignore the type.
+func (m *masker) maskAs(key string, value any, kind string) any {
+	m = m.forField(key)
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return m.maskKey(key, value)
+	}
+	if !m.generatesFakes() {
+		return m.maskKey(key, value)
+	}
+	m.seeder.SeedFaker(m.faker, value)
+	var masked string
+	if slices.Contains(nameTypes, kind) {
+		masked = m.fakeName(s, kind)
+	} else {
+		masked = m.maskString(s, kind)
+	}
+	if _, ok := value.(json.Number); ok && isJSONNumber(masked) {
+		return json.Number(masked)
+	}
+	return masked
+}
+
+func isJSONNumber(s string) bool {
+	return s != "" && (s[0] == '-' || (s[0] >= '0' && s[0] <= '9')) && json.Valid([]byte(s))
+}
+
+// keyMatch is what the patterns of a config select of a key path, whatever
+// its value.
+type keyMatch struct {
+	rules    []int // Indexes of the rules whose pattern matches the key
+	excluded bool  // By an -exclude pattern
+	selected bool  // By the -include and -exclude patterns
+}
+
+// keyMatch returns what the patterns of c select of key, which the masker
+// remembers: every pattern is matched against every key of every record
+// otherwise, and records repeat their keys.
+func (c *AppConfig) keyMatch(m *masker, key string) *keyMatch {
+	if m.keysFor != c {
+		m.keys, m.keysFor = memo[*keyMatch]{}, c
+	}
+	return m.keys.get(key, func(key string) *keyMatch {
+		match := &keyMatch{
+			excluded: matchesAny(key, c.ExcludeGlobs),
+			selected: shouldMask(key, c.IncludeGlobs, c.ExcludeGlobs),
+		}
+		for i, r := range c.Rules {
+			if r.glob == nil || r.glob.Match(key) {
+				match.rules = append(match.rules, i)
+			}
+		}
+		return match
+	})
+}
+
+// ruleFor returns the first rule matching key and its value, or nil.
+func (c *AppConfig) ruleFor(m *masker, key string, value any) *Rule {
+	return c.matchingRule(m, c.keyMatch(m, key), value)
+}
+
+// matchingRule returns the first rule of a match that matches value, or nil.
+func (c *AppConfig) matchingRule(m *masker, match *keyMatch, value any) *Rule {
+	for _, i := range match.rules {
+		if c.Rules[i].matchesValue(m, value) {
+			return &c.Rules[i]
+		}
+	}
+	return nil
+}
+
+// maskField masks the value of a single key. Keys matching a rule are masked
+// according to that rule even when -include patterns or value types do not
+// select them, but -exclude and safe values still take precedence. Masked numbers are clamped to the range of
+// the key, and values recorded in the mapping file get their recorded masked
+// value.
+func (c *AppConfig) maskField(m *masker, key string, value any) any {
+	if c.isSafe(value) {
+		return value
+	}
+	match := c.keyMatch(m, key)
+	rule := c.matchingRule(m, match, value)
+	if rule == nil || match.excluded {
+		if !match.selected || !c.selectsType(value) {
+			return value
+		}
+		rule = nil
+	}
+	// Patterns can select array elements, but the elements are one field.
+	field := fieldPath(key)
+	if c.mappings == nil {
+		masked := c.clampField(m, rule, key, c.maskFieldValue(m, rule, field, value))
+		return c.masked(m, key, value, masked)
+	}
+	if masked, ok := c.mappings.lookup(field, value); ok {
+		return c.masked(m, key, value, masked)
+	}
+	masked := c.masked(m, key, value, c.clampField(m, rule, key, c.maskFieldValue(m, rule, field, value)))
+	if masked != value {
+		c.mappings.record(field, value, masked)
+	}
+	return masked
+}
+
+func (c *AppConfig) maskFieldValue(m *masker, rule *Rule, key string, value any) any {
+	if rule != nil {
+		ruleMasker := m.forRule(rule)
+		if c.unique != nil && rule.regex == nil && rule.Template == "" && rule.Type == "" {
+			return c.unique.maskUnique(ruleMasker, key, value)
+		}
+		return rule.apply(ruleMasker, key, value)
+	}
+	if c.unique != nil {
+		return c.unique.maskUnique(m, key, value)
+	}
+	return m.maskKey(key, value)
+}
+
+// masksAsRecordField reports whether a card or name field is masked together
+// with the other fields of its record. Fields matching a rule are left to the
+// rule instead, unless the rule only declares them a name, which the record
+// masks more coherently.
+func (c *AppConfig) masksAsRecordField(m *masker, key string, value any) bool {
+	if c.isSafe(value) {
+		return false
+	}
+	match := c.keyMatch(m, key)
+	rule := c.matchingRule(m, match, value)
+	if rule == nil {
+		return match.selected && c.selectsType(value)
+	}
+	onlyName := slices.Contains(nameTypes, rule.Type) && rule.Method == "" && rule.Regex == ""
+	return onlyName && !match.excluded
+}
+
+// forRule returns the masker for values matched by rule, which is created on
+// first use when the rule overrides the masking method.
+func (m *masker) forRule(rule *Rule) *masker {
+	if rule.masker == nil {
+		return m
+	}
+	if override, ok := m.overrides[rule.masker]; ok {
+		return override
+	}
+	if m.overrides == nil {
+		m.overrides = make(map[*MaskerConfig]*masker)
+	}
+	override := newMasker(*rule.masker)
+	m.overrides[rule.masker] = override
+	return override
+}
+
+func matchesAny(key string, globs []glob.Glob) bool {
+	for _, g := range globs {
+		if g.Match(key) {
+			return true
+		}
+	}
+	return false
+}
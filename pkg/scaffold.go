@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxSampleRecords bounds the CSV records and array elements InspectSample
+// reads, so init stays fast on large files.
+const maxSampleRecords = 1000
+
+// exampleLength is the number of characters of a sample value shown in a
+// summary. Samples hold real data, so examples only give an impression.
+const exampleLength = 6
+
+// FieldSummary describes a key path found in a sample, as listed by init.
+type FieldSummary struct {
+	Path     string
+	Type     string // Most common detected type of the values
+	Example  string // Truncated first non-empty value
+	Count    int    // Number of values seen
+	Distinct int    // Number of distinct values seen
+	Mask     bool   // Whether masking is suggested
+	Method   string // Masking method of the field, if not the one of the run
+
+	types  map[string]int
+	values map[string]bool
+}
+
+// InspectSample reads a json or csv sample and summarizes every key path it
+// holds, in order of appearance, with a suggestion whether to mask it. Errors
+// are reported as by Start.
+func InspectSample(r io.Reader, format string) ([]FieldSummary, error) {
+	s := &sampleInspector{masker: newMasker(MaskerConfig{Method: MethodRandom}), fields: make(map[string]*FieldSummary)}
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		var data any
+		if err := decoder.Decode(&data); err != nil {
+			return nil, &InputError{Err: fmt.Errorf("error decoding sample: %w", err)}
+		}
+		s.walk("", data)
+	case "csv":
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, &InputError{Err: fmt.Errorf("error reading sample header: %w", err)}
+		}
+		for i := 0; i < maxSampleRecords; i++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, &InputError{Err: fmt.Errorf("error reading sample: %w", err)}
+			}
+			for j, column := range header {
+				if j < len(record) {
+					s.add(column, record[j])
+				}
+			}
+		}
+	default:
+		return nil, &ConfigError{Err: fmt.Errorf("init supports json and csv samples, not %s", format)}
+	}
+
+	summaries := make([]FieldSummary, 0, len(s.order))
+	for _, path := range s.order {
+		summaries = append(summaries, s.fields[path].finish())
+	}
+	return summaries, nil
+}
+
+type sampleInspector struct {
+	masker *masker
+	fields map[string]*FieldSummary
+	order  []string
+}
+
+// walk adds the leaves of data, visiting object keys in sorted order so the
+// summary does not depend on map iteration.
+func (s *sampleInspector) walk(key string, data any) {
+	switch v := data.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			s.walk(joinKey(key, k), v[k])
+		}
+	case []any:
+		for i, item := range v {
+			if i == maxSampleRecords {
+				break
+			}
+			s.walk(key, item)
+		}
+	default:
+		s.add(key, data)
+	}
+}
+
+func (s *sampleInspector) add(path string, value any) {
+	field, ok := s.fields[path]
+	if !ok {
+		field = &FieldSummary{Path: path, types: make(map[string]int), values: make(map[string]bool)}
+		s.fields[path] = field
+		s.order = append(s.order, path)
+	}
+	kind := "empty"
+	if value != nil {
+		kind = s.masker.detectType(value)
+	}
+	field.types[kind]++
+	field.Count++
+	formatted := fmt.Sprint(value)
+	field.values[formatted] = true
+	if field.Example == "" && kind != "empty" {
+		field.Example = truncateExample(formatted)
+	}
+}
+
+// finish settles the type and the suggestion of a field. Fields are masked
+// unless all their values are booleans or empty, or they are plain text or
+// numbers that look categorical: few distinct values, each repeated often,
+// such as a status or a currency code. Names are recognized by their key,
+// since their values are just text, and are always masked.
+func (f *FieldSummary) finish() FieldSummary {
+	f.Distinct = len(f.values)
+	for kind, n := range f.types {
+		if kind != "empty" && (f.Type == "" || n > f.types[f.Type] || (n == f.types[f.Type] && kind < f.Type)) {
+			f.Type = kind
+		}
+	}
+	if f.Type == "" {
+		f.Type = "empty"
+	}
+	if kind := nameTypeOf(f.Path); f.Type == "text" && kind != "" {
+		f.Type = kind
+	}
+	categorical := slices.Contains([]string{"text", "number", "integer", "decimal"}, f.Type) &&
+		f.Count >= 10 && f.Distinct <= 5 && f.Distinct*4 <= f.Count
+	f.Mask = f.Type != "bool" && f.Type != "empty" && !categorical
+	return *f
+}
+
+func truncateExample(s string) string {
+	if utf8.RuneCountInString(s) <= exampleLength {
+		return s
+	}
+	return string([]rune(s)[:exampleLength]) + "…"
+}
+
+// ScaffoldConfig writes a starter config for the fields of a sample: fields
+// to keep are excluded, and every field to mask gets a rule fixing its
+// detected type and, if set, its method. Comments show what the decision was
+// based on.
+func ScaffoldConfig(w io.Writer, format string, fields []FieldSummary) error {
+	var exclude, rules yaml.Node
+	exclude.Kind, rules.Kind = yaml.SequenceNode, yaml.SequenceNode
+	for _, field := range fields {
+		comment := describeField(field)
+		if !field.Mask {
+			exclude.Content = append(exclude.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: field.Path, LineComment: comment})
+			continue
+		}
+		rule := &yaml.Node{Kind: yaml.MappingNode}
+		rule.Content = append(rule.Content, scalarNode("pattern"), &yaml.Node{Kind: yaml.ScalarNode, Value: field.Path, LineComment: comment})
+		if slices.Contains(hintTypes, field.Type) {
+			rule.Content = append(rule.Content, scalarNode("type"), scalarNode(field.Type))
+		}
+		if field.Method != "" {
+			// Tagged as a string, so "null" is not written as null.
+			method := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field.Method}
+			rule.Content = append(rule.Content, scalarNode("method"), method)
+		}
+		rules.Content = append(rules.Content, rule)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, HeadComment: "Starter policy generated by unaware init. Review every field before use: the\n" +
+		"fields under exclude are kept as they are, every other field is masked."}
+	root.Content = append(root.Content, scalarNode("format"), scalarNode(format))
+	if len(exclude.Content) > 0 {
+		root.Content = append(root.Content, scalarNode("exclude"), &exclude)
+	}
+	if len(rules.Content) > 0 {
+		root.Content = append(root.Content, scalarNode("rules"), &rules)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func describeField(field FieldSummary) string {
+	description := fmt.Sprintf("%s, %d distinct of %d", field.Type, field.Distinct, field.Count)
+	if field.Example != "" {
+		description += ", e.g. " + strconv.Quote(field.Example)
+	}
+	return description
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
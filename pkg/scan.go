@@ -0,0 +1,223 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// piiTypes are the detected types scan reports. Other types, such as dates
+// or UUIDs, are seldom personal data by themselves.
+var piiTypes = []string{"credit_card", "email", "iban", "ipv4", "ipv6", "mac_address", "phone"}
+
+// Finding is a key path holding personal data of one type, as reported by
+// scan.
+type Finding struct {
+	Path     string // Key path without array indexes
+	Type     string // Detected type, or a name type recognized by the key
+	Count    int    // Number of values found
+	Location string // Where the first value was found, e.g. "record 3, items[2].email"
+	Line     int    // Line of the first value, or of the record holding it, counting from 1
+}
+
+// Scan reads json, ndjson, csv, xml or mysqldump input without masking it and
+// reports where it holds personal data, ordered by path and type. Keys are
+// those masking uses: the columns of mysqldump rows are keyed by table, and
+// attributes of XML elements by "-" and their name. Keys matching an exclude
+// pattern are not reported. Errors are reported as by Start.
+func Scan(r io.Reader, format string, exclude []string) ([]Finding, error) {
+	s := &scanner{masker: newMasker(MaskerConfig{Method: MethodRandom}), findings: make(map[[2]string]*Finding)}
+	for _, pattern := range exclude {
+		g, err := compileGlob(pattern)
+		if err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)}
+		}
+		s.exclude = append(s.exclude, g)
+	}
+	switch format {
+	case "json", "ndjson":
+		if err := s.scanJSON(r); err != nil {
+			return nil, err
+		}
+	case "xml":
+		if err := s.scanXML(r); err != nil {
+			return nil, err
+		}
+	case "mysqldump":
+		d := &dumpReader{r: bufio.NewReaderSize(r, 64*1024), line: 1, tables: make(map[string][]string)}
+		for {
+			line := d.line
+			row, err := d.next()
+			if err == io.EOF {
+				break
+			}
+			var inputErr *InputError
+			if err != nil && !errors.As(err, &inputErr) {
+				err = &InputError{Err: err}
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.line = line + bytes.Count(row.prefix, []byte{'\n'})
+			s.walk("", row.record(), fmt.Sprintf("line %d", s.line))
+		}
+	case "csv":
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, &InputError{Err: fmt.Errorf("error reading header: %w", err)}
+		}
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, &InputError{Err: fmt.Errorf("error reading record: %w", err)}
+			}
+			for j, column := range header {
+				if j < len(record) {
+					s.line, _ = reader.FieldPos(j)
+					s.add(column, record[j], fmt.Sprintf("line %d", s.line))
+				}
+			}
+		}
+	default:
+		return nil, &ConfigError{Err: fmt.Errorf("scan supports json, ndjson, csv, xml and mysqldump input, not %s", format)}
+	}
+
+	findings := make([]Finding, 0, len(s.findings))
+	for _, finding := range s.findings {
+		findings = append(findings, *finding)
+	}
+	slices.SortFunc(findings, func(a, b Finding) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Type, b.Type))
+	})
+	return findings, nil
+}
+
+type scanner struct {
+	masker   *masker
+	exclude  []glob.Glob
+	findings map[[2]string]*Finding // By path and type
+	line     int                    // Of the values added next
+}
+
+// scanJSON scans the elements of a root array, or a stream of root values
+// such as ndjson, record by record, so input of any size can be scanned.
+func (s *scanner) scanJSON(r io.Reader) error {
+	lines := &lineReader{r: r}
+	br := newPeekingReader(lines)
+	firstChar, err := br.PeekFirstChar()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return &InputError{Err: err}
+	}
+	decoder := json.NewDecoder(br)
+	decoder.UseNumber()
+	if firstChar == '[' {
+		_, _ = decoder.Token() // consume '['
+	}
+	for record := 1; decoder.More(); record++ {
+		start := decoder.InputOffset()
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return lines.jsonError(err, record, start)
+		}
+		// The record starts after the whitespace and comma before it.
+		start = decoder.InputOffset() - int64(len(raw))
+		s.line, _ = lines.position(start)
+		lines.advance(start)
+		var data any
+		values := json.NewDecoder(bytes.NewReader(raw))
+		values.UseNumber()
+		if err := values.Decode(&data); err != nil {
+			return &InputError{Err: err, Record: record, Line: s.line}
+		}
+		s.walk("", data, fmt.Sprintf("record %d", record))
+	}
+	return nil
+}
+
+// scanXML scans the text and attributes of the elements of XML input, keyed
+// by the path of element names below the root, as masking keys them.
+func (s *scanner) scanXML(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	var path []string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return xmlError(decoder, err, strings.Join(path, "."))
+		}
+		s.line, _ = decoder.InputPos()
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			key := strings.Join(path[1:], ".")
+			for _, attr := range t.Attr {
+				s.add(joinKey(key, "-"+attr.Name.Local), attr.Value, fmt.Sprintf("line %d", s.line))
+			}
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		case xml.CharData:
+			if len(path) > 1 {
+				s.add(strings.Join(path[1:], "."), strings.TrimSpace(string(t)), fmt.Sprintf("line %d", s.line))
+			}
+		}
+	}
+}
+
+func (s *scanner) walk(key string, data any, location string) {
+	switch v := data.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			s.walk(joinKey(key, k), v[k], location)
+		}
+	case []any:
+		for i, item := range v {
+			s.walk(indexKey(key, i), item, location)
+		}
+	default:
+		if key != "" && key != fieldPath(key) {
+			location += ", " + key
+		}
+		s.add(key, data, location)
+	}
+}
+
+func (s *scanner) add(key string, value any, location string) {
+	text, ok := value.(string)
+	if !ok || strings.TrimSpace(text) == "" || matchesAny(key, s.exclude) {
+		return
+	}
+	kind := s.masker.detectStringType(text)
+	path := fieldPath(key)
+	if name := nameTypeOf(path); kind == "text" && name != "" {
+		kind = name
+	}
+	if !slices.Contains(piiTypes, kind) && !slices.Contains(nameTypes, kind) {
+		return
+	}
+	finding, ok := s.findings[[2]string{path, kind}]
+	if !ok {
+		finding = &Finding{Path: path, Type: kind, Location: location, Line: s.line}
+		s.findings[[2]string{path, kind}] = finding
+	}
+	finding.Count++
+}
@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxFrame is the largest input a Server masks in one request unless
+// told otherwise.
+const DefaultMaxFrame = 64 << 20
+
+// Server masks the framed requests of clients connected to a listener, such
+// as a Unix socket, with an engine configured once, so frequent small
+// requests do not pay for starting a process and reading its secrets. A
+// connection can send any number of requests, one after the other, each
+// written as a header line naming the format of the input and its length in
+// bytes, followed by the input:
+//
+//	json 28\n{"email":"jane@example.com"}
+//
+// The format "-" masks as the format of the engine, and others are those
+// built in or registered when the Server is created. Every request is answered
+// with a header line of ok and the length of the masked output, followed by
+// it, or of error and the length of the message, followed by it:
+//
+//	ok 29\n{"email":"colby@brekke.biz"}\n
+//
+// A header that cannot be read, or an input longer than MaxFrame, is answered
+// with an error and the connection is closed. Mappings of a mapping file are
+// shared by all requests and saved when Serve returns.
+type Server struct {
+	MaxFrame int // Largest input of a request, in bytes; DefaultMaxFrame if 0
+
+	engine *Engine
+	config AppConfig               // Of requests, sharing the mappings of a mapping file
+	runs   map[string]*preparedRun // Of requests, by format
+}
+
+// NewServer creates a Server masking with engine.
+func NewServer(engine *Engine) (*Server, error) {
+	config := engine.config
+	// Requests run concurrently, so they record mappings in one set rather
+	// than each reading and saving the file.
+	if config.MappingFile != "" {
+		mappings, err := ReadMappings(config.MappingFile, config.MappingKey)
+		if err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		config.MappingSet = NewMappingSet(mappings)
+		config.MappingFile = ""
+	}
+	// Every format is prepared once, rather than by every request. A record
+	// is answered on one line unless a style was asked for.
+	runs := make(map[string]*preparedRun)
+	for _, format := range formatNames() {
+		run := config
+		run.Format = format
+		if run.OutputStyle == "" && (format == "json" || format == "ndjson") {
+			run.OutputStyle = StyleCompact
+		}
+		runs[format] = prepareRun(run)
+	}
+	runs["-"] = runs[config.Format]
+	return &Server{engine: engine, config: config, runs: runs}, nil
+}
+
+// Serve answers the connections accepted from l until ctx is done, closing
+// l, and waits for the requests being masked then.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	var wg sync.WaitGroup
+	var err error
+	for {
+		var conn net.Conn
+		if conn, err = l.Accept(); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			closing := context.AfterFunc(ctx, func() { conn.Close() })
+			defer closing()
+			s.serveConn(ctx, conn)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		err = nil
+	}
+	if saveErr := s.saveMappings(); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// serveConn answers the requests of conn until it is closed or sends a
+// request that cannot be read.
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		format, input, err := s.readRequest(r)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			writeFrame(w, "error", []byte(err.Error()))
+			w.Flush()
+			return
+		}
+		masked, err := s.mask(ctx, format, input)
+		if err != nil {
+			writeFrame(w, "error", []byte(err.Error()))
+		} else {
+			writeFrame(w, "ok", masked)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// readRequest reads the format and input of a request. io.EOF is returned
+// when the connection is closed between requests.
+func (s *Server) readRequest(r *bufio.Reader) (string, []byte, error) {
+	header, err := r.ReadSlice('\n')
+	if err == io.EOF && len(header) == 0 {
+		return "", nil, io.EOF
+	}
+	if err != nil {
+		return "", nil, errors.New("malformed request header")
+	}
+	format, length, ok := strings.Cut(strings.TrimSpace(string(header)), " ")
+	n, err := strconv.Atoi(length)
+	if !ok || format == "" || err != nil || n < 0 {
+		return "", nil, fmt.Errorf("malformed request header %q, want <format> <length>", strings.TrimSpace(string(header)))
+	}
+	if maxFrame := cmp.Or(s.MaxFrame, DefaultMaxFrame); n > maxFrame {
+		return "", nil, fmt.Errorf("request of %d bytes is larger than %d", n, maxFrame)
+	}
+	input := make([]byte, n)
+	if read, err := io.ReadFull(r, input); err != nil {
+		return "", nil, fmt.Errorf("request ended after %d of %d bytes", read, n)
+	}
+	return format, input, nil
+}
+
+// mask masks the input of a request as format.
+func (s *Server) mask(ctx context.Context, format string, input []byte) ([]byte, error) {
+	run, ok := s.runs[format]
+	if !ok {
+		return nil, &ConfigError{Err: fmt.Errorf("unsupported format: %s", format)}
+	}
+	return run.mask(ctx, input)
+}
+
+// saveMappings saves the mappings of a mapping file of the engine.
+func (s *Server) saveMappings() error {
+	if s.engine.config.MappingFile == "" {
+		return nil
+	}
+	return s.config.MappingSet.store.save(s.engine.config.MappingFile, s.engine.config.MappingKey)
+}
+
+// writeFrame writes a response of status and body to w.
+func writeFrame(w io.Writer, status string, body []byte) {
+	fmt.Fprintf(w, "%s %d\n", status, len(body))
+	w.Write(body)
+}
@@ -0,0 +1,42 @@
+package pkg
+
+import "math/rand/v2"
+
+// columnShuffle implements permutation masking for CSV: the real values of
+// each shuffled column are redistributed across the rows at random, keeping
+// the exact distribution of every column while breaking the link with the
+// rest of the row. Columns are shuffled independently of each other.
+type columnShuffle struct {
+	columns []int
+	// values holds the original values of the shuffled columns per row. It is
+	// filled by the chunk reader and read once all rows have been assembled.
+	values [][]string
+	perm   func(n int) []int // rand.Perm unless the faker of the masker is set
+}
+
+func (s *columnShuffle) collect(record []string) {
+	if len(s.columns) == 0 {
+		return
+	}
+	values := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		if column < len(record) {
+			values[i] = record[column]
+		}
+	}
+	s.values = append(s.values, values)
+}
+
+func (s *columnShuffle) apply(header []string, records [][]string) error {
+	for i, column := range s.columns {
+		perm := rand.Perm
+		if s.perm != nil {
+			perm = s.perm
+		}
+		permutation := perm(len(records))
+		for row, record := range records {
+			record[column] = s.values[permutation[row]][i]
+		}
+	}
+	return nil
+}
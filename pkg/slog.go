@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// MaskingHandler is an slog.Handler masking records before passing them to
+// another handler, so personal data never reaches structured logs.
+//
+// Attributes are keyed by their path through groups, such as "user.email".
+// Those of keys an include pattern or a rule selects are masked as fields of
+// a record are, and excluded keys are kept. In the values of other string
+// attributes and in messages, only the words detected as personal data are
+// masked, as MaskingWriter masks lines.
+type MaskingHandler struct {
+	next    slog.Handler
+	config  *AppConfig
+	maskers *Masker
+	group   string // Key path of the attributes added, from WithGroup
+}
+
+// NewMaskingHandler creates a MaskingHandler passing records to next. Its
+// format is ignored. An invalid config is reported as a *ConfigError.
+//
+// Deprecated: Use New and Engine.Handler.
+func NewMaskingHandler(next slog.Handler, config AppConfig) (*MaskingHandler, error) {
+	return newMaskingHandler(next, config)
+}
+
+// Handler creates a MaskingHandler masking records as the engine masks
+// fields, and passing them to next. The format of the engine is ignored.
+func (e *Engine) Handler(next slog.Handler) (*MaskingHandler, error) {
+	return newMaskingHandler(next, e.config)
+}
+
+func newMaskingHandler(next slog.Handler, config AppConfig) (*MaskingHandler, error) {
+	config.Format = "json"
+	if _, err := config.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	maskers, err := NewMasker(config.Masker)
+	if err != nil {
+		return nil, err
+	}
+	return &MaskingHandler{next: next, config: &config, maskers: maskers}, nil
+}
+
+func (h *MaskingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *MaskingHandler) Handle(ctx context.Context, r slog.Record) error {
+	var masked slog.Record
+	h.maskers.with(func(m *masker) {
+		masked = slog.NewRecord(r.Time, r.Level, h.config.maskWords(m, "", r.Message), r.PC)
+		r.Attrs(func(a slog.Attr) bool {
+			masked.AddAttrs(h.maskAttr(m, h.group, a))
+			return true
+		})
+	})
+	return h.next.Handle(ctx, masked)
+}
+
+func (h *MaskingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	h.maskers.with(func(m *masker) {
+		for i, a := range attrs {
+			masked[i] = h.maskAttr(m, h.group, a)
+		}
+	})
+	return &MaskingHandler{next: h.next.WithAttrs(masked), config: h.config, maskers: h.maskers, group: h.group}
+}
+
+func (h *MaskingHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &MaskingHandler{next: h.next.WithGroup(name), config: h.config, maskers: h.maskers, group: joinKey(h.group, name)}
+}
+
+// maskAttr masks attribute a of the group at key path group.
+func (h *MaskingHandler) maskAttr(m *masker, group string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	key := joinKey(group, a.Key)
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		masked := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			// Attributes of an inline group, without a key, are of the
+			// group around it.
+			if a.Key == "" {
+				masked[i] = h.maskAttr(m, group, attr)
+			} else {
+				masked[i] = h.maskAttr(m, key, attr)
+			}
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(masked...)}
+	}
+	c := h.config
+	value := attrValue(a.Value)
+	switch {
+	case matchesAny(key, c.ExcludeGlobs):
+		return a
+	case matchesAny(key, c.IncludeGlobs) || c.ruleFor(m, key, value) != nil:
+		masked := c.maskField(m, key, value)
+		if masked == value {
+			return a
+		}
+		return slog.Attr{Key: a.Key, Value: slogValue(masked)}
+	}
+	if text, ok := value.(string); ok {
+		if masked := c.maskWords(m, key, text); masked != text {
+			return slog.String(a.Key, masked)
+		}
+	}
+	return a
+}
+
+// attrValue returns value as masking takes values: numbers as json.Number,
+// and times, durations and other values as the text they are logged as.
+func attrValue(value slog.Value) any {
+	switch value.Kind() {
+	case slog.KindString:
+		return value.String()
+	case slog.KindBool:
+		return value.Bool()
+	case slog.KindInt64:
+		return json.Number(strconv.FormatInt(value.Int64(), 10))
+	case slog.KindUint64:
+		return json.Number(strconv.FormatUint(value.Uint64(), 10))
+	case slog.KindFloat64:
+		return json.Number(strconv.FormatFloat(value.Float64(), 'g', -1, 64))
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if value.Any() == nil {
+			return nil
+		}
+	}
+	return fmt.Sprint(value.Any())
+}
+
+// slogValue returns a masked value as a slog.Value, of the kind it has.
+func slogValue(value any) slog.Value {
+	switch v := value.(type) {
+	case nil:
+		return slog.AnyValue(nil)
+	case bool:
+		return slog.BoolValue(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return slog.Int64Value(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return slog.Float64Value(f)
+		}
+	}
+	return slog.StringValue(formatValue(value))
+}
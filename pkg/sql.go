@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Rows are the rows of a query, as *sql.Rows reads them.
+type Rows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// MaskedRows reads rows with the values of their columns masked, as the
+// columns of CSV are: columns are keyed by name, and include and exclude
+// patterns and rules select those masked. Tools exporting from a production
+// replica use it so real values never leave the query.
+type MaskedRows struct {
+	Rows
+	config  *AppConfig
+	masker  *masker
+	columns []string
+}
+
+// NewMaskedRows reads rows, masking them as config describes. Its format is
+// ignored. An invalid config is reported as a *ConfigError.
+//
+// Deprecated: Use New and Engine.Rows.
+func NewMaskedRows(rows Rows, config AppConfig) (*MaskedRows, error) {
+	return newMaskedRows(rows, config)
+}
+
+// Rows reads rows, masking their columns as the engine masks those of CSV.
+// The format of the engine is ignored, and options that do not apply to CSV
+// are reported as a *ConfigError.
+func (e *Engine) Rows(rows Rows) (*MaskedRows, error) {
+	return newMaskedRows(rows, e.config)
+}
+
+func newMaskedRows(rows Rows, config AppConfig) (*MaskedRows, error) {
+	config.Format = "csv"
+	if _, err := config.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	return &MaskedRows{Rows: rows, config: &config, masker: newMasker(config.Masker), columns: columns}, nil
+}
+
+// Scan reads the masked columns of the current row into dest, as
+// sql.Rows.Scan does. Destinations implementing sql.Scanner are passed
+// driver values; numbers that were masked keep their type.
+func (r *MaskedRows) Scan(dest ...any) error {
+	if len(dest) != len(r.columns) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(r.columns), len(dest))
+	}
+	values := make([]any, len(r.columns))
+	pointers := make([]any, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := r.Rows.Scan(pointers...); err != nil {
+		return err
+	}
+	for i, column := range r.columns {
+		value := r.maskColumn(column, values[i])
+		if err := assignColumn(dest[i], value); err != nil {
+			return fmt.Errorf("cannot scan column %s: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// maskColumn masks a driver value of column, and returns the masked value as
+// a driver value of the same type where it can be.
+func (r *MaskedRows) maskColumn(column string, value driver.Value) driver.Value {
+	var original any
+	switch v := value.(type) {
+	case int64:
+		original = json.Number(strconv.FormatInt(v, 10))
+	case float64:
+		original = json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case []byte:
+		original = string(v)
+	case time.Time:
+		original = v.Format(time.RFC3339Nano)
+	case string, bool, nil:
+		original = v
+	default:
+		original = fmt.Sprint(v)
+	}
+	masked := r.config.maskField(r.masker, column, original)
+	if masked == original {
+		return value
+	}
+	switch v := masked.(type) {
+	case json.Number:
+		if _, ok := value.(float64); !ok {
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	case string:
+		if _, ok := value.(time.Time); ok {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	case bool, nil:
+		return v
+	}
+	return formatValue(masked)
+}
+
+// assignColumn stores a driver value in dest, as sql.Rows.Scan would for the
+// pointer types it takes.
+func assignColumn(dest any, value driver.Value) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+	if d, ok := dest.(*any); ok {
+		*d = value
+		return nil
+	}
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return errors.New("destination not a pointer")
+	}
+	target = target.Elem()
+	if value == nil {
+		if target.Kind() != reflect.Pointer {
+			return fmt.Errorf("cannot store NULL in %s", target.Type())
+		}
+		target.SetZero()
+		return nil
+	}
+	if target.Kind() == reflect.Pointer {
+		elem := reflect.New(target.Type().Elem())
+		if err := assignColumn(elem.Interface(), value); err != nil {
+			return err
+		}
+		target.Set(elem)
+		return nil
+	}
+	if v := reflect.ValueOf(value); v.Type().AssignableTo(target.Type()) {
+		target.Set(v)
+		return nil
+	}
+	text := formatDriverValue(value)
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(text)
+	case reflect.Slice:
+		if target.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot store %T in %s", value, target.Type())
+		}
+		target.SetBytes([]byte(text))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		target.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot store %T in %s", value, target.Type())
+	}
+	return nil
+}
+
+// formatDriverValue returns a driver value as text.
+func formatDriverValue(value driver.Value) string {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
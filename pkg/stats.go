@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"io"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the metrics of a run, as Start returns them.
+type Stats struct {
+	Records     int            `json:"records"`     // Records masked: elements, rows, lines or documents
+	Masked      map[string]int `json:"masked"`      // Values masking changed, by detected type, e.g. "email"
+	BytesIn     int64          `json:"bytes_in"`    // Bytes of input read
+	BytesOut    int64          `json:"bytes_out"`   // Bytes of output written
+	Duration    time.Duration  `json:"duration"`    // Time the run took
+	Workers     int            `json:"workers"`     // Records masked concurrently
+	Utilization float64        `json:"utilization"` // Share of the run the workers spent masking, from 0 to 1
+}
+
+// MaskedValues returns the number of values masking changed.
+func (s *Stats) MaskedValues() int {
+	total := 0
+	for _, n := range s.Masked {
+		total += n
+	}
+	return total
+}
+
+// runStats collects the metrics of a run from its workers.
+type runStats struct {
+	records atomic.Int64
+	busy    atomic.Int64 // Nanoseconds the workers spent masking
+	in, out atomic.Int64 // Bytes read and written
+
+	mu     sync.Mutex
+	masked map[string]int
+}
+
+func newRunStats() *runStats {
+	return &runStats{masked: make(map[string]int)}
+}
+
+// record counts a record masked. Runs without stats count nothing.
+func (s *runStats) record() {
+	if s != nil {
+		s.records.Add(1)
+	}
+}
+
+// worked counts the time a worker spent masking since start.
+func (s *runStats) worked(start time.Time) {
+	if s != nil {
+		s.busy.Add(int64(time.Since(start)))
+	}
+}
+
+// noteMasked counts a value of kind masked.
+func (s *runStats) noteMasked(kind string) {
+	s.mu.Lock()
+	s.masked[kind]++
+	s.mu.Unlock()
+}
+
+// snapshot returns the metrics of a run of workers that started at start.
+func (s *runStats) snapshot(start time.Time, workers int) *Stats {
+	s.mu.Lock()
+	masked := maps.Clone(s.masked)
+	s.mu.Unlock()
+	stats := &Stats{
+		Records:  int(s.records.Load()),
+		Masked:   masked,
+		BytesIn:  s.in.Load(),
+		BytesOut: s.out.Load(),
+		Duration: time.Since(start),
+		Workers:  workers,
+	}
+	if stats.Duration > 0 && workers > 0 {
+		stats.Utilization = min(1, float64(s.busy.Load())/float64(stats.Duration)/float64(workers))
+	}
+	return stats
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"context"
+	"io"
+)
+
+// RecordStream yields the masked records of an input one at a time, for
+// embedding masking into a pipeline that does not write the records out as
+// unaware would. Records are masked ahead concurrently, as by Start.
+type RecordStream struct {
+	records chan any
+	done    chan struct{}
+	cancel  context.CancelFunc
+	err     error  // Set before done is closed
+	stats   *Stats // Set before done is closed
+}
+
+// NewRecordStream starts masking r as config describes and returns the stream
+// of its masked records, until ctx is done or the stream is closed.
+//
+// Records are decoded as by encoding/json with UseNumber: the elements of a
+// root JSON array, or the root value itself, NDJSON records, and the repeated
+// elements of an XML root, keyed by their name. CSV rows are maps keyed by
+// column and lines of text are strings; lines are yielded in the order they
+// are masked, which is that of the input only with a CPUCount of 1. Records
+// cannot be streamed with shuffled columns, k-anonymity or checkpoints.
+func NewRecordStream(ctx context.Context, r io.Reader, config AppConfig) *RecordStream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &RecordStream{records: make(chan any), done: make(chan struct{}), cancel: cancel}
+	config.emit = func(record any) error {
+		select {
+		case s.records <- record:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	go func() {
+		defer close(s.done)
+		defer close(s.records)
+		s.stats, s.err = StartContext(ctx, r, io.Discard, config)
+	}()
+	return s
+}
+
+// Next returns the next masked record, or io.EOF once all were returned.
+// Other errors are reported as by Start, and end the stream.
+func (s *RecordStream) Next() (any, error) {
+	if record, ok := <-s.records; ok {
+		return record, nil
+	}
+	<-s.done
+	if s.err != nil {
+		return nil, s.err
+	}
+	return nil, io.EOF
+}
+
+// Close stops masking and waits for it to stop. Records not yet returned are
+// dropped, and a mapping file is only saved when masking completed.
+func (s *RecordStream) Close() error {
+	s.cancel()
+	for range s.records {
+	}
+	<-s.done
+	return nil
+}
+
+// Stats returns the metrics of masking, once Next returned io.EOF or another
+// error or the stream was closed, and nil before.
+func (s *RecordStream) Stats() *Stats {
+	select {
+	case <-s.done:
+		return s.stats
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RecordRange selects the records Start through End, counting from 1. A zero
+// Start selects from the first record, a zero End up to the last one.
+type RecordRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// ParseRecordRange parses a range written as "start:end", where either side
+// may be left out, as in "100:" or ":50".
+func ParseRecordRange(s string) (RecordRange, error) {
+	start, end, ok := strings.Cut(s, ":")
+	if !ok {
+		return RecordRange{}, fmt.Errorf("invalid range %q, expected start:end", s)
+	}
+	var r RecordRange
+	for _, side := range []struct {
+		text  string
+		value *int
+	}{{start, &r.Start}, {end, &r.End}} {
+		if side.text == "" {
+			continue
+		}
+		n, err := strconv.Atoi(side.text)
+		if err != nil || n < 1 {
+			return RecordRange{}, fmt.Errorf("invalid range %q, records count from 1", s)
+		}
+		*side.value = n
+	}
+	if r.End > 0 && r.End < r.Start {
+		return RecordRange{}, fmt.Errorf("invalid range %q, the end comes before the start", s)
+	}
+	return r, nil
+}
+
+func (r RecordRange) String() string {
+	var s string
+	if r.Start > 0 {
+		s = strconv.Itoa(r.Start)
+	}
+	s += ":"
+	if r.End > 0 {
+		s += strconv.Itoa(r.End)
+	}
+	return s
+}
+
+// selectsSubset reports whether FirstN, LastN or Range select only some of
+// the records.
+func (c *AppConfig) selectsSubset() bool {
+	return c.FirstN > 0 || c.LastN > 0 || c.Range != (RecordRange{})
+}
+
+// validateSubset checks that at most one way of selecting records is used.
+func (c *AppConfig) validateSubset() error {
+	if c.FirstN < 0 || c.LastN < 0 || c.Range.Start < 0 || c.Range.End < 0 {
+		return errors.New("record counts cannot be negative")
+	}
+	selections := 0
+	for _, set := range []bool{c.FirstN > 0, c.LastN > 0, c.Range != (RecordRange{})} {
+		if set {
+			selections++
+		}
+	}
+	if selections > 1 {
+		return errors.New("first, last and range cannot be combined")
+	}
+	if c.Range.End > 0 && c.Range.End < c.Range.Start {
+		return fmt.Errorf("invalid range %s, the end comes before the start", c.Range)
+	}
+	return nil
+}
+
+// selectRecords wraps read, which returns records until io.EOF, so it only
+// returns those selected by FirstN, LastN or Range. Skipped records are still
+// read, and with LastN the last records are held in memory until the input
+// ends.
+func selectRecords[T any](c *AppConfig, read func() (T, error)) func() (T, error) {
+	switch {
+	case c.LastN > 0:
+		return lastRecords(c.LastN, read)
+	case c.FirstN > 0:
+		return recordRange(RecordRange{End: c.FirstN}, read)
+	case c.Range != (RecordRange{}):
+		return recordRange(c.Range, read)
+	}
+	return read
+}
+
+func recordRange[T any](r RecordRange, read func() (T, error)) func() (T, error) {
+	count := 0
+	return func() (T, error) {
+		var zero T
+		for {
+			if r.End > 0 && count >= r.End {
+				return zero, io.EOF
+			}
+			record, err := read()
+			if err != nil {
+				return zero, err
+			}
+			count++
+			if count >= r.Start {
+				return record, nil
+			}
+		}
+	}
+}
+
+func lastRecords[T any](n int, read func() (T, error)) func() (T, error) {
+	var records []T
+	buffered := false
+	return func() (T, error) {
+		var zero T
+		if !buffered {
+			// The oldest record is overwritten once n are held, so
+			// records are in order from next on.
+			next := 0
+			for {
+				record, err := read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return zero, err
+				}
+				if len(records) < n {
+					records = append(records, record)
+				} else {
+					records[next] = record
+					next = (next + 1) % n
+				}
+			}
+			records = slices.Concat(records[next:], records[:next])
+			buffered = true
+		}
+		if len(records) == 0 {
+			return zero, io.EOF
+		}
+		record := records[0]
+		records = records[1:]
+		return record, nil
+	}
+}
@@ -2,78 +2,192 @@ package pkg
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"io"
-	"runtime"
-	"sync"
+	"iter"
+	"strings"
+	"unicode/utf8"
 )
 
 type textProcessor struct {
-	config AppConfig
+	config        AppConfig
+	methodFactory func() *masker
 }
 
 func newTextProcessor(config AppConfig) *textProcessor {
 	return &textProcessor{
-		config: config,
+		config:        config,
+		methodFactory: maskerFactory(config.Masker),
 	}
 }
 
 // Process reads newline-delimited text from r, masks each line concurrently, and writes to w.
-func (p *textProcessor) Process(r io.Reader, w io.Writer) error {
-	cpuCount := p.config.CPUCount
-	if cpuCount <= 0 {
-		cpuCount = runtime.NumCPU()
-	}
-
-	jobs := make(chan string, cpuCount)
-	results := make(chan string, cpuCount)
+func (p *textProcessor) Process(ctx context.Context, r io.Reader, w io.Writer) error {
+	// Returning, for whatever reason, stops the reader and the workers.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan string)
+	results := make(chan string, p.config.CPUCount)
 
-	// Start worker pool
-	wg := &sync.WaitGroup{}
-	for i := 0; i < cpuCount; i++ {
-		wg.Add(1)
-		go p.worker(wg, jobs, results)
-	}
+	// Start the worker pool, which grows while the lines keep it busy
+	workers := &workerPool{max: p.config.CPUCount}
+	workers.start = func() { p.worker(ctx, workers, jobs, results) }
+	workers.spawn()
 
 	// Start a goroutine to read the file and send lines to the jobs channel
+	var readErr error
 	go func() {
-		scanner := bufio.NewScanner(r)
-		const maxCapacity = 1024 * 1024 // 1MB
-		buf := make([]byte, maxCapacity)
-		scanner.Buffer(buf, maxCapacity)
-		lineCount := 0
-		for scanner.Scan() {
-			if p.config.FirstN > 0 && lineCount >= p.config.FirstN {
-				break
+		defer close(jobs)
+		reader := bufio.NewReaderSize(r, 64*1024)
+		lines := 0
+		readLine := selectRecords(&p.config, func() (string, error) {
+			line, err := readTextLine(reader)
+			if err == io.EOF {
+				return "", io.EOF
+			} else if err != nil {
+				return "", &InputError{Err: err, Line: lines + 1}
+			}
+			lines++
+			return line, nil
+		})
+		for {
+			line, err := readLine()
+			if err != nil {
+				if err != io.EOF {
+					readErr = err
+				}
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if !dispatch(ctx, workers, jobs, line) {
+				return
 			}
-			jobs <- scanner.Text()
-			lineCount++
 		}
-		close(jobs)
 	}()
 
 	// Start a goroutine to close the results channel once all workers are done
 	go func() {
-		wg.Wait()
+		workers.wg.Wait()
 		close(results)
 	}()
 
 	// Write results to the output
-	writer := bufio.NewWriter(w)
+	writer := bufferedOutput(w)
 	defer writer.Flush()
 	for result := range results {
-		if _, err := writer.WriteString(result + "\n"); err != nil {
+		p.config.stats.record()
+		if p.config.emit != nil {
+			if err := p.config.emit(result); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.WriteString(writer, result+"\n"); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// The reader is done once the workers are.
+	return readErr
 }
 
-func (p *textProcessor) worker(wg *sync.WaitGroup, jobs <-chan string, results chan<- string) {
-	defer wg.Done()
-	masker := newMasker(p.config.Masker)
+func (p *textProcessor) worker(ctx context.Context, workers *workerPool, jobs <-chan string, results chan<- string) {
+	masker := p.methodFactory()
+	maxLine := cmp.Or(p.config.MaxTextLine, DefaultMaxLine)
 	for line := range jobs {
-		maskedLine := masker.mask(line)
-		results <- maskedLine.(string)
+		start := workers.busy()
+		var masked string
+		if len(line) <= maxLine {
+			masked = p.config.maskLine(masker, line)
+		} else {
+			var parts strings.Builder
+			for part := range splitLine(line, maxLine) {
+				parts.WriteString(p.config.maskLine(masker, part))
+			}
+			masked = parts.String()
+		}
+		workers.idle()
+		p.config.stats.worked(start)
+		select {
+		case results <- masked:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readTextLine reads a line of any length, without the newline ending it, or
+// a carriage return before that newline.
+func readTextLine(r *bufio.Reader) (string, error) {
+	var long []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = append(long, chunk...)
+			continue
+		}
+		if err == io.EOF && len(chunk) == 0 && long == nil {
+			return "", io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if long != nil {
+			chunk = append(long, chunk...)
+		}
+		chunk = bytes.TrimSuffix(chunk, []byte("\n"))
+		chunk = bytes.TrimSuffix(chunk, []byte("\r"))
+		return string(chunk), nil
+	}
+}
+
+// splitLine splits a line longer than size, such as minified JSON logged on
+// one line, into parts of at most size bytes that are masked one by one. A
+// part ends after the last space, tab, comma or semicolon in its second half,
+// so the values in it are rarely cut in two, and otherwise between two
+// characters.
+func splitLine(line string, size int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for len(line) > size {
+			end := strings.LastIndexAny(line[size/2:size], " \t,;") + 1
+			if end > 0 {
+				end += size / 2
+			} else {
+				end = size
+				for end > 0 && !utf8.RuneStart(line[end]) {
+					end--
+				}
+				if end == 0 {
+					end = size
+				}
+			}
+			if !yield(line[:end]) {
+				return
+			}
+			line = line[end:]
+		}
+		if line != "" {
+			yield(line)
+		}
+	}
+}
+
+// maskLine masks a line of text, as a whole unless a rule matches part of it.
+func (c *AppConfig) maskLine(m *masker, line string) string {
+	var masked any
+	if c.isSafe(line) {
+		masked = line
+	} else if rule := c.ruleFor(m, "", line); rule != nil {
+		masked = rule.apply(m.forRule(rule), "", line)
+	} else {
+		masked = m.mask(line)
 	}
+	return formatValue(c.masked(m, "", line, masked))
 }
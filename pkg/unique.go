@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxUniqueAttempts bounds how often a colliding value is re-derived. Fields
+// with more distinct values than fakes of their format exist keep the
+// collision after that.
+const maxUniqueAttempts = 100
+
+// uniqueOutputs records which input every masked output of a field was
+// derived from, so two different inputs never share an output. It is shared
+// by all workers.
+type uniqueOutputs struct {
+	mu     sync.Mutex
+	fields map[string]map[string]string // field -> output -> input
+}
+
+func newUniqueOutputs() *uniqueOutputs {
+	return &uniqueOutputs{fields: make(map[string]map[string]string)}
+}
+
+// claim reports whether output may be used for input in field, registering it
+// if it was still free.
+func (u *uniqueOutputs) claim(field, input, output string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	outputs, ok := u.fields[field]
+	if !ok {
+		outputs = make(map[string]string)
+		u.fields[field] = outputs
+	}
+	owner, taken := outputs[output]
+	if !taken {
+		outputs[output] = input
+	}
+	return !taken || owner == input
+}
+
+// maskUnique masks value and re-derives the result with a different seed as
+// long as it collides with the output of another input in the same field.
+// Only the deterministic method is checked, recognized by its cache: random
+// output is not stable in the first place, and dictionary replacements come
+// from a fixed list. Re-derivation is itself deterministic, but
+// which of two colliding inputs keeps the original output depends on the
+// order in which they are processed.
+func (u *uniqueOutputs) maskUnique(m *masker, field string, value any) any {
+	m = m.forField(field)
+	masked := m.maskKey(field, value)
+	seeder, ok := m.seeder.(*deterministicSeeder)
+	if !ok || masked == nil || m.cache == nil {
+		return masked
+	}
+	input := fmt.Sprintf("%T:%v", value, value)
+	for attempt := 1; attempt <= maxUniqueAttempts; attempt++ {
+		if u.claim(field, input, fmt.Sprintf("%T:%v", masked, masked)) {
+			return masked
+		}
+		// The words of text are derived again, rather than taken from the
+		// cache.
+		cache := m.cache
+		m.seeder, m.cache = &deterministicSeeder{salt: fmt.Appendf(append([]byte(nil), seeder.salt...), "\x00%d", attempt)}, nil
+		masked = m.maskUncached(value)
+		m.seeder, m.cache = seeder, cache
+	}
+	return masked
+}
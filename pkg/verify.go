@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// minLeakLength is the length in bytes of the shortest value checked for
+// leaks. Shorter values, such as initials or small numbers, turn up in any
+// output by chance.
+const minLeakLength = 5
+
+// MaskedValues collects the values a run masked, so its output can be
+// checked for any that survived with Verify.
+type MaskedValues struct {
+	mu       sync.Mutex
+	values   map[string]string   // Values by the forms they are looked for in
+	prefixes map[string][]string // Forms by their first minLeakLength bytes
+}
+
+// NewMaskedValues creates an empty collection of masked values.
+func NewMaskedValues() *MaskedValues {
+	return &MaskedValues{values: make(map[string]string), prefixes: make(map[string][]string)}
+}
+
+// noteMasked records original when masking changed it into masked, if the
+// run collects masked values, as it is and as the output would escape it.
+func (c *AppConfig) noteMasked(original, masked any) {
+	original, masked = leafValue(original), leafValue(masked)
+	if c.Verify == nil || original == nil {
+		return
+	}
+	text := formatValue(original)
+	if len(text) < minLeakLength || text == formatValue(masked) {
+		return
+	}
+	v := c.Verify
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.values[text]; ok {
+		return
+	}
+	for _, form := range append([]string{text}, c.escapedForms(text)...) {
+		if _, ok := v.values[form]; !ok {
+			v.values[form] = text
+			prefix := form[:minLeakLength]
+			v.prefixes[prefix] = append(v.prefixes[prefix], form)
+		}
+	}
+}
+
+// escapedForms returns the forms other than itself that text takes in the
+// output of the format of the run, where the format escapes it.
+func (c *AppConfig) escapedForms(text string) []string {
+	var forms []string
+	add := func(form string) {
+		if form != text && !slices.Contains(forms, form) {
+			forms = append(forms, form)
+		}
+	}
+	switch c.Format {
+	case "json", "ndjson":
+		if data, err := json.Marshal(text); err == nil {
+			add(string(data[1 : len(data)-1]))
+		}
+	case "xml":
+		// Attributes escape line feeds, text does not.
+		var buf strings.Builder
+		xml.EscapeText(&buf, []byte(text))
+		add(buf.String())
+		add(strings.ReplaceAll(buf.String(), "&#xA;", "\n"))
+	case "csv":
+		quote := string(c.CSV.quote())
+		add(strings.ReplaceAll(text, quote, quote+quote))
+	case "mysqldump":
+		var buf bytes.Buffer
+		writeDumpValue(&buf, text)
+		add(buf.String()[1 : buf.Len()-1])
+	}
+	return forms
+}
+
+// Leak is a masked value found in the output of a run.
+type Leak struct {
+	Example string // Truncated value, so reports do not repeat it
+	Line    int    // Line of the output it was first found on
+	Count   int    // Number of times it was found
+}
+
+// Verify reads the output of a run and reports the masked values it still
+// holds anywhere, including within longer values, in order of appearance.
+func (v *MaskedValues) Verify(r io.Reader) ([]Leak, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	found := make(map[string]*Leak)
+	var order []string
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		for i := 0; i+minLeakLength <= len(text); i++ {
+			for _, form := range v.prefixes[text[i:i+minLeakLength]] {
+				if len(text)-i < len(form) || text[i:i+len(form)] != form {
+					continue
+				}
+				value := v.values[form]
+				leak, ok := found[value]
+				if !ok {
+					leak = &Leak{Example: truncateExample(value), Line: line}
+					found[value] = leak
+					order = append(order, value)
+				}
+				leak.Count++
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading output: %w", err)
+		}
+	}
+	leaks := make([]Leak, 0, len(order))
+	for _, value := range order {
+		leaks = append(leaks, *found[value])
+	}
+	return leaks, nil
+}
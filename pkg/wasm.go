@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WasmModule is a compiled WebAssembly module implementing the wasm method.
+// The module exports its memory as "memory" and two functions:
+//
+//	alloc(size i32) i32
+//	mask(keyPtr, keyLen, valuePtr, valueLen, typePtr, typeLen i32) i64
+//
+// alloc returns the address of size bytes the key, the value and its detected
+// type, such as "email" or "text", are written to; mask returns the address of
+// the masked value in the upper and its length in the lower 32 bits. Modules
+// that export dealloc(ptr, len i32) get every buffer back once it is read.
+// WASI is available, and reactor modules are initialized with _initialize.
+type WasmModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// LoadWasmModule compiles the WebAssembly module at path and checks that it
+// implements the interface described at WasmModule.
+func LoadWasmModule(path string) (*WasmModule, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening wasm module: %w", err)
+	}
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("error loading wasm module %s: %w", path, err)
+	}
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("error loading wasm module %s: %w", path, err)
+	}
+	w := &WasmModule{runtime: runtime, compiled: compiled}
+	hook, err := w.instantiate()
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("error loading wasm module %s: %w", path, err)
+	}
+	hook.module.Close(ctx)
+	return w, nil
+}
+
+// wasmHook is an instance of a WasmModule. Instances are not safe for
+// concurrent use, so every masker has its own.
+type wasmHook struct {
+	module               api.Module
+	memory               api.Memory
+	alloc, mask, dealloc api.Function
+}
+
+func (w *WasmModule) instantiate() (*wasmHook, error) {
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	module, err := w.runtime.InstantiateModule(context.Background(), w.compiled, config)
+	if err != nil {
+		return nil, err
+	}
+	hook := &wasmHook{
+		module:  module,
+		memory:  module.ExportedMemory("memory"),
+		alloc:   module.ExportedFunction("alloc"),
+		mask:    module.ExportedFunction("mask"),
+		dealloc: module.ExportedFunction("dealloc"),
+	}
+	if hook.memory == nil || hook.alloc == nil || hook.mask == nil {
+		module.Close(context.Background())
+		return nil, fmt.Errorf("module must export memory, alloc and mask")
+	}
+	return hook, nil
+}
+
+// call passes key, value and kind to the module's mask function and returns
+// the masked value.
+func (h *wasmHook) call(key, value, kind string) (string, error) {
+	ctx := context.Background()
+	params := make([]uint64, 0, 6)
+	for _, s := range []string{key, value, kind} {
+		ptr, err := h.write(ctx, s)
+		if err != nil {
+			return "", err
+		}
+		defer h.free(ctx, ptr, uint32(len(s)))
+		params = append(params, uint64(ptr), uint64(len(s)))
+	}
+	results, err := h.mask.Call(ctx, params...)
+	if err != nil {
+		return "", err
+	}
+	ptr, size := uint32(results[0]>>32), uint32(results[0])
+	masked, ok := h.memory.Read(ptr, size)
+	if !ok {
+		return "", fmt.Errorf("masked value at %d with length %d is out of memory range", ptr, size)
+	}
+	s := string(masked) // Copied before the module can reuse its memory
+	h.free(ctx, ptr, size)
+	return s, nil
+}
+
+func (h *wasmHook) write(ctx context.Context, s string) (uint32, error) {
+	results, err := h.alloc.Call(ctx, uint64(len(s)))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(results[0])
+	if !h.memory.Write(ptr, []byte(s)) {
+		return 0, fmt.Errorf("allocation at %d with length %d is out of memory range", ptr, len(s))
+	}
+	return ptr, nil
+}
+
+func (h *wasmHook) free(ctx context.Context, ptr, size uint32) {
+	if h.dealloc != nil {
+		h.dealloc.Call(ctx, uint64(ptr), uint64(size))
+	}
+}
+
+// maskWasm masks a value of key with the wasm module. Numbers and booleans
+// keep their type when the module returns a valid number or boolean. Values
+// the module fails on are masked as usual, so they never pass unmasked.
+func (m *masker) maskWasm(key string, value any) any {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		return value
+	}
+	masked, err := m.wasm.call(key, s, m.detectType(value))
+	if err != nil {
+		return m.maskUncached(value)
+	}
+	switch value.(type) {
+	case json.Number:
+		if isJSONNumber(masked) {
+			return json.Number(masked)
+		}
+	case bool:
+		if b, err := strconv.ParseBool(masked); err == nil {
+			return b
+		}
+	}
+	return masked
+}
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// scriptWords holds small vocabularies of common words per Unicode script so
+// masked free text stays in the script of the original. Scripts without an
+// entry fall back to random letters drawn from the script itself.
+var scriptWords = map[string][]string{
+	"Cyrillic":   {"дом", "город", "река", "солнце", "книга", "окно", "дерево", "море", "улица", "время", "работа", "вода", "земля", "небо", "друг", "школа", "письмо", "ветер", "поле", "утро"},
+	"Greek":      {"σπίτι", "πόλη", "θάλασσα", "ήλιος", "βιβλίο", "δέντρο", "νερό", "δρόμος", "φίλος", "χρόνος", "ουρανός", "βουνό", "ψωμί", "σχολείο", "λουλούδι"},
+	"Arabic":     {"بيت", "مدينة", "كتاب", "شمس", "بحر", "شجرة", "ماء", "طريق", "صديق", "وقت", "سماء", "جبل", "مدرسة", "قلم", "باب"},
+	"Hebrew":     {"בית", "עיר", "ספר", "שמש", "ים", "עץ", "מים", "דרך", "חבר", "זמן", "שמיים", "הר", "כיתה", "עט", "דלת"},
+	"Han":        {"天空", "河流", "城市", "书本", "太阳", "大海", "树木", "道路", "朋友", "时间", "山", "水", "花", "月亮", "学校"},
+	"Japanese":   {"さくら", "やま", "かわ", "そら", "うみ", "はな", "ねこ", "いぬ", "みず", "ほし", "カメラ", "テレビ", "パン", "コーヒー", "ノート"},
+	"Hangul":     {"하늘", "바다", "도시", "나무", "책", "사람", "시간", "친구", "학교", "물", "산", "꽃", "길", "집", "별"},
+	"Devanagari": {"घर", "शहर", "किताब", "सूरज", "समुद्र", "पेड़", "पानी", "रास्ता", "दोस्त", "समय", "आकाश", "पहाड़", "फूल", "स्कूल", "चाँद"},
+	"Thai":       {"บ้าน", "เมือง", "หนังสือ", "ดวงอาทิตย์", "ทะเล", "ต้นไม้", "น้ำ", "ถนน", "เพื่อน", "เวลา", "ท้องฟ้า", "ภูเขา", "ดอกไม้", "โรงเรียน", "ดวงจันทร์"},
+}
+
+// unspacedScripts are written without spaces between words. A run of these
+// characters is masked as a whole with the same number of graphemes.
+var unspacedScripts = map[string]bool{"Han": true, "Japanese": true, "Thai": true}
+
+// scriptOf returns the name of the Unicode script r belongs to, reporting
+// Hiragana and Katakana as "Japanese".
+func scriptOf(r rune) string {
+	if r < unicode.MaxASCII || unicode.Is(unicode.Latin, r) {
+		return "Latin"
+	}
+	for _, name := range []string{"Cyrillic", "Greek", "Arabic", "Hebrew", "Han", "Hangul", "Devanagari", "Thai"} {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+		return "Japanese"
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return "Common"
+}
+
+// maskWords masks free text word by word. Words are separated by Unicode
+// whitespace, which is kept as is, and punctuation at either end of a word is
+// preserved. Each word is seeded on its own so repeated words mask
+// consistently in deterministic mode.
+func (m *masker) maskWords(s string) string {
+	var out strings.Builder
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				out.WriteString(m.maskToken(s[start:i]))
+				start = -1
+			}
+			out.WriteRune(r)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		out.WriteString(m.maskToken(s[start:]))
+	}
+	return out.String()
+}
+
+// maskToken masks a single whitespace-delimited token, keeping leading and
+// trailing punctuation around the masked word.
+func (m *masker) maskToken(token string) string {
+	isPunct := func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }
+	word := strings.TrimLeftFunc(token, isPunct)
+	leading := token[:len(token)-len(word)]
+	word = strings.TrimRightFunc(word, isPunct)
+	trailing := token[len(leading)+len(word):]
+	if word == "" {
+		return token
+	}
+	return leading + m.maskWord(word) + trailing
+}
+
+// wordScript returns the script of the first letter in word. Words mixing Han
+// with Hiragana or Katakana are reported as "Japanese".
+func wordScript(word string) string {
+	script := "Common"
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			script = scriptOf(r)
+			break
+		}
+	}
+	if script == "Han" && strings.IndexFunc(word, func(r rune) bool { return unicode.In(r, unicode.Hiragana, unicode.Katakana) }) >= 0 {
+		return "Japanese"
+	}
+	return script
+}
+
+// maskWord returns a fake replacement for word in the same script. Words in
+// scripts written without spaces, and all words when the length is to be
+// preserved, are replaced by fakes with the same number of grapheme clusters.
+// Deterministic fakes of words are cached, as those of whole values are, since
+// the words of free text repeat far more often than the text does.
+func (m *masker) maskWord(word string) string {
+	if m.cache == nil {
+		return m.fakeWord(word)
+	}
+	cacheKey := m.cachePrefix + "\x00w" + word
+	if masked, ok := m.cache.Get(cacheKey); ok {
+		return masked.(string)
+	}
+	masked := m.fakeWord(word)
+	m.cache.Set(cacheKey, masked)
+	return masked
+}
+
+// fakeWord generates the fake replacement of word that maskWord returns.
+func (m *masker) fakeWord(word string) string {
+	m.seeder.SeedFakerForWord(m.faker, word)
+
+	if isDigits(word) {
+		return m.faker.Numerify(strings.Repeat("#", len(word)))
+	}
+
+	script := wordScript(word)
+	graphemeCount := uniseg.GraphemeClusterCount(word)
+	var masked string
+	switch vocabulary, ok := scriptWords[script]; {
+	case script == "Latin" || script == "Common":
+		masked = m.latinWord()
+		if m.preserveLength {
+			masked = m.fillGraphemes(masked, m.latinWord, graphemeCount)
+		}
+	case (unspacedScripts[script] || m.preserveLength) && ok:
+		masked = m.fillGraphemes("", m.vocabularyWord(vocabulary), graphemeCount)
+	case ok:
+		masked = vocabulary[m.faker.Rand.Intn(len(vocabulary))]
+	default:
+		masked = m.randomScriptLetters(script, graphemeCount)
+	}
+	return matchCase(word, masked)
+}
+
+// fillGraphemes appends the letters of words from next to those of prefix
+// until the result holds exactly n grapheme clusters.
+func (m *masker) fillGraphemes(prefix string, next func() string, n int) string {
+	var clusters []string
+	for word := prefix; len(clusters) < n; word = next() {
+		graphemes := uniseg.NewGraphemes(word)
+		for graphemes.Next() && len(clusters) < n {
+			// Skip punctuation in fakes such as "e.g.".
+			if cluster := graphemes.Str(); unicode.IsLetter([]rune(cluster)[0]) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+	return strings.Join(clusters, "")
+}
+
+// latinWord returns a random word in the language of the locale, or in
+// English.
+func (m *masker) latinWord() string {
+	if m.locale != nil {
+		return m.pick(m.locale.words)
+	}
+	return m.faker.Word()
+}
+
+// vocabularyWord returns a function picking random words from vocabulary.
+func (m *masker) vocabularyWord(vocabulary []string) func() string {
+	return func() string { return vocabulary[m.faker.Rand.Intn(len(vocabulary))] }
+}
+
+// randomScriptLetters generates n random letters from the given script.
+func (m *masker) randomScriptLetters(script string, n int) string {
+	table := unicode.Scripts[script]
+	if table == nil {
+		return m.faker.Word()
+	}
+	var ranges [][2]rune
+	for _, r16 := range table.R16 {
+		ranges = append(ranges, [2]rune{rune(r16.Lo), rune(r16.Hi)})
+	}
+	for _, r32 := range table.R32 {
+		ranges = append(ranges, [2]rune{rune(r32.Lo), rune(r32.Hi)})
+	}
+	var b strings.Builder
+	for written := 0; written < n; {
+		rng := ranges[m.faker.Rand.Intn(len(ranges))]
+		r := rng[0] + rune(m.faker.Rand.Intn(int(rng[1]-rng[0])+1))
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+			written++
+		}
+	}
+	return b.String()
+}
+
+// matchCase applies the capitalization of original to masked: all-caps words
+// stay all-caps and capitalized words, including accented and non-Latin
+// capitals, stay capitalized.
+func matchCase(original, masked string) string {
+	runes := []rune(original)
+	if len(runes) == 0 || !unicode.IsUpper(runes[0]) {
+		return masked
+	}
+	if len(runes) > 1 && strings.ToUpper(original) == original {
+		return strings.ToUpper(masked)
+	}
+	maskedRunes := []rune(strings.ToLower(masked))
+	maskedRunes[0] = unicode.ToUpper(maskedRunes[0])
+	return string(maskedRunes)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -1,45 +1,143 @@
 package pkg
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"io"
+	"iter"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
 )
 
-type chunkReader func() (any, error)
-type assembler interface {
+// ChunkReader reads the next record of an input for a Runner, and returns
+// io.EOF once there are none left. Records are values as encoding/json
+// decodes them with UseNumber: maps keyed by field, slices, strings,
+// json.Number, bool and nil. Other errors stop the run; an *InputError tells
+// where in the input it occurred.
+type ChunkReader func() (any, error)
+
+// Assembler writes the masked records of a Runner to the output, in the order
+// they were read. WriteStart is called before the first record and WriteEnd
+// after the last, once all were read without error.
+type Assembler interface {
 	WriteStart(w io.Writer) error
 	WriteItem(w io.Writer, item any, isFirst bool) error
 	WriteEnd(w io.Writer) error
 }
 
+// Runner masks the records of a ChunkReader on CPUCount workers and passes
+// them to an Assembler, as the built-in formats do. Records are masked as the
+// fields of JSON records are, keyed by their path.
+type Runner struct {
+	methodFactory func() *masker
+	config        AppConfig
+	root          string // Key of the records of XML, the name of their root element
+	array         string // Key of an array nested in a JSON object whose elements are the records
+	subset        bool   // Runs of registered formats apply -first, -last and -range
+	keepsInput    bool   // The input of every record is kept until it is written, with the preserve style
+}
+
+// newRunner creates a Runner masking the records of a run of config with the
+// maskers of methodFactory.
+func newRunner(methodFactory func() *masker, config AppConfig) *Runner {
+	return &Runner{
+		methodFactory: methodFactory,
+		config:        config,
+	}
+}
+
+// recordsPerWorker is the number of records, per worker, that are read ahead
+// of the record written next, unless batches of more than half of it are.
+const recordsPerWorker = 16
+
+// DefaultBatchSize is the number of records a worker masks in a batch unless
+// told otherwise.
+const DefaultBatchSize = 8
+
+// job is a batch of records read one after another, the first of which is
+// the record at index.
 type job struct {
 	index int
-	data  any
+	data  []any
+	size  int64 // Of the budget of MaxMemory, released once the records are written
 }
 
 type result struct {
 	index int
-	data  any
+	data  []any
+	size  int64
 }
 
-// Run orchestrates the concurrent masking process.
-func (cr *concurrentRunner) Run(w io.Writer, crr chunkReader, a assembler) error {
+// Run masks the records read by read and writes them to w with a, until the
+// reader returns io.EOF or ctx is done. Records are yielded instead of written
+// by record streams.
+//
+// Records are passed to the workers in batches of BatchSize, so the cost of
+// handing them over is shared by small records such as the rows of CSV. A
+// batch is passed on early when reading waits for records to be written, but
+// not while a Read of the input blocks: a batch size of 1 masks every record
+// as soon as it is read.
+//
+// Records are read at most recordsPerWorker, or two batches, per worker ahead
+// of the one written next, so a record that takes long to mask holds up the
+// reader rather than leaving every record after it buffered. With a
+// MaxMemory, records are read only while those read but not yet written,
+// waiting for a worker, being masked or for the records before them, fit in
+// it. A slow output, or a record that takes long to mask, then stops the
+// reader instead of growing the records held. A record larger than MaxMemory
+// on its own is read once all before it are written.
+func (cr *Runner) Run(ctx context.Context, w io.Writer, read ChunkReader, a Assembler) error {
+	// Returning, for whatever reason, stops the reader and the workers.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if cr.subset {
+		read = selectRecords(&cr.config, read)
+	}
 	jobs := make(chan job)
 	results := make(chan result)
 
-	var wg sync.WaitGroup
-	for range cr.config.CPUCount {
-		wg.Add(1)
-		go cr.worker(&wg, jobs, results)
+	workers := &workerPool{max: cr.config.CPUCount}
+	workers.start = func() { cr.worker(ctx, workers, jobs, results) }
+	workers.spawn()
+
+	batchSize := cmp.Or(cr.config.BatchSize, DefaultBatchSize)
+	window := semaphore.NewWeighted(int64(max(cr.config.CPUCount, 1) * max(recordsPerWorker, 2*batchSize)))
+	var budget *semaphore.Weighted
+	if cr.config.MaxMemory > 0 {
+		budget = semaphore.NewWeighted(cr.config.MaxMemory)
 	}
 
 	var dispatchErr error
 	go func() {
-		jobIndex := 0
-		for {
-			dataChunk, err := crr()
+		defer close(jobs)
+		batch := job{}
+		send := func() bool {
+			if len(batch.data) == 0 {
+				return true
+			}
+			if !dispatch(ctx, workers, jobs, batch) {
+				return false
+			}
+			batch = job{index: batch.index + len(batch.data)}
+			return true
+		}
+		// acquire takes n of sem, first passing on the batch read so far
+		// when it has to wait: the records it waits for may be in it.
+		acquire := func(sem *semaphore.Weighted, n int64) bool {
+			if sem.TryAcquire(n) {
+				return true
+			}
+			return send() && sem.Acquire(ctx, n) == nil
+		}
+		for acquire(window, 1) {
+			dataChunk, err := read()
 			if err == io.EOF {
 				break
 			}
@@ -47,38 +145,65 @@ func (cr *concurrentRunner) Run(w io.Writer, crr chunkReader, a assembler) error
 				dispatchErr = err
 				break
 			}
-			jobs <- job{index: jobIndex, data: dataChunk}
-			jobIndex++
+			if budget != nil {
+				size := recordSize(dataChunk)
+				if cr.keepsInput {
+					size *= 2
+				}
+				size = min(size, cr.config.MaxMemory)
+				if !acquire(budget, size) {
+					return
+				}
+				batch.size += size
+			}
+			batch.data = append(batch.data, dataChunk)
+			if len(batch.data) == batchSize && !send() {
+				return
+			}
 		}
-		close(jobs)
+		send()
 	}()
 
-	go func() { wg.Wait(); close(results) }()
+	go func() { workers.wg.Wait(); close(results) }()
 
 	if err := a.WriteStart(w); err != nil {
 		return err
 	}
 
-	resultsBuffer := make(map[int]any)
+	resultsBuffer := make(map[int]result)
 	nextIndexToWrite := 0
 	isFirst := true
 
 	for res := range results {
-		resultsBuffer[res.index] = res.data
+		resultsBuffer[res.index] = res
 		for {
-			maskedData, ok := resultsBuffer[nextIndexToWrite]
+			next, ok := resultsBuffer[nextIndexToWrite]
 			if !ok {
 				break
 			}
-			if err := a.WriteItem(w, maskedData, isFirst); err != nil {
-				return err
+			for _, maskedData := range next.data {
+				if cr.config.emit != nil {
+					if err := cr.config.emit(maskedData); err != nil {
+						return err
+					}
+				} else if err := a.WriteItem(w, maskedData, isFirst); err != nil {
+					return err
+				}
+				isFirst = false
+				cr.config.stats.record()
+			}
+			window.Release(int64(len(next.data)))
+			if budget != nil {
+				budget.Release(next.size)
 			}
-			isFirst = false
 			delete(resultsBuffer, nextIndexToWrite)
-			nextIndexToWrite++
+			nextIndexToWrite += len(next.data)
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if dispatchErr != nil {
 		return dispatchErr
 	}
@@ -86,54 +211,157 @@ func (cr *concurrentRunner) Run(w io.Writer, crr chunkReader, a assembler) error
 	return a.WriteEnd(w)
 }
 
-func (cr *concurrentRunner) worker(wg *sync.WaitGroup, jobs <-chan job, results chan<- result) {
-	defer wg.Done()
+func (cr *Runner) worker(ctx context.Context, workers *workerPool, jobs <-chan job, results chan<- result) {
 	workerMasker := cr.methodFactory()
 	for j := range jobs {
-		results <- result{index: j.index, data: cr.recursiveMask(workerMasker, cr.Root, j.data)}
+		start := workers.busy()
+		for i, data := range j.data {
+			// Batches are not reused, so the masked records replace the
+			// records read.
+			j.data[i] = cr.maskItem(workerMasker, j.index+i, data)
+		}
+		workers.idle()
+		cr.config.stats.worked(start)
+		select {
+		case results <- result{index: j.index, data: j.data, size: j.size}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// workerPool starts the workers of a run as they are needed, up to max: one
+// at first, and another whenever a job waits while all those started are
+// masking. A run held up by its input or output, rather than by masking, so
+// starts no more workers than keep up with it.
+type workerPool struct {
+	wg      sync.WaitGroup
+	start   func() // Runs a worker until its jobs are closed
+	max     int
+	started int
+	masking atomic.Int32 // Workers masking rather than waiting for a job or to pass it on
+}
+
+// spawn starts another worker.
+func (p *workerPool) spawn() {
+	p.started++
+	p.wg.Go(p.start)
+}
+
+// busy marks a worker as masking, and returns the time it started.
+func (p *workerPool) busy() time.Time {
+	p.masking.Add(1)
+	return time.Now()
+}
+
+// idle marks a worker as done masking.
+func (p *workerPool) idle() {
+	p.masking.Add(-1)
+}
+
+// dispatch passes j on to the workers of p, starting another one when all
+// are masking. It returns false if ctx is done first.
+func dispatch[T any](ctx context.Context, p *workerPool, jobs chan<- T, j T) bool {
+	if p.started < p.max && int(p.masking.Load()) == p.started {
+		select {
+		case jobs <- j:
+			return true
+		default:
+			p.spawn()
+		}
 	}
+	select {
+	case jobs <- j:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// maskItem masks the record at index. The repeated elements of an XML list,
+// and those of an array nested in a JSON object, are keyed by their index, as
+// they would be when the document is processed serially.
+func (cr *Runner) maskItem(m *masker, index int, data any) any {
+	if cr.array != "" {
+		return cr.recursiveMask(m, indexKey(cr.array, index), data)
+	}
+	item, ok := data.(map[string]any)
+	if cr.root == "" || !ok || index == 0 {
+		return cr.recursiveMask(m, cr.root, data)
+	}
+	masked := make(map[string]any, len(item))
+	for k, value := range item {
+		masked[k] = cr.recursiveMask(m, indexKey(joinKey(cr.root, k), index), value)
+	}
+	return masked
 }
 
-func (cr *concurrentRunner) recursiveMask(m *masker, key string, data any) any {
+func (cr *Runner) recursiveMask(m *masker, key string, data any) any {
+	if cr.config.prunes(key) {
+		return data
+	}
 	switch v := data.(type) {
 	case json.Number, string, bool, nil:
-		if shouldMask(key, cr.config.IncludeGlobs, cr.config.ExcludeGlobs) {
-			return m.mask(v)
-		}
-		return v
+		return cr.config.maskField(m, key, v)
 	case map[string]any:
 		maskedMap := make(map[string]any, len(v))
-		for k, value := range v {
-			if k == "#text" {
+		shouldMaskField := func(k string) bool {
+			return cr.config.masksAsRecordField(m, joinKey(key, strings.TrimPrefix(k, "-")), v[k])
+		}
+		if card, ok := m.findCardFields(v); ok {
+			for k, masked := range m.forField(fieldPath(key)).maskCardFields(v, card, shouldMaskField) {
+				maskedMap[k] = cr.config.masked(m, joinKey(key, strings.TrimPrefix(k, "-")), v[k], masked)
+			}
+		}
+		if names, ok := m.findNameFields(v); ok {
+			for k, masked := range m.forField(fieldPath(key)).maskNameFields(v, names, shouldMaskField) {
+				maskedMap[k] = cr.config.masked(m, joinKey(key, strings.TrimPrefix(k, "-")), v[k], masked)
+			}
+		}
+		for k := range cr.config.recordKeys(v) {
+			value := v[k]
+			if _, done := maskedMap[k]; done {
+				continue
+			}
+			if markup, ok := value.(map[string]any); ok && k == "#cdata" {
+				// A CDATA section holding markup, whose elements are under the parent's key.
+				maskedMap[k] = cr.recursiveMask(m, key, markup)
+			} else if k == "#text" || k == "#cdata" {
 				// This is the text content of the parent element (e.g., the "2002" in <year>2002</year>).
 				// The key for filtering is the parent's key, which is already in the 'key' variable.
-				if shouldMask(key, cr.config.IncludeGlobs, cr.config.ExcludeGlobs) {
-					maskedMap[k] = m.mask(value)
-				} else {
-					maskedMap[k] = value
-				}
+				maskedMap[k] = cr.config.maskField(m, key, value)
 			} else {
 				// This is a nested element or an attribute.
 				// Attributes from the XML decoder are prefixed with '-'.
-				nestedKey := strings.TrimPrefix(k, "-")
-				fullKey := nestedKey
-				if key != "" {
-					fullKey = key + "." + nestedKey
-				}
-				maskedMap[k] = cr.recursiveMask(m, fullKey, value)
+				maskedMap[k] = cr.recursiveMask(m, joinKey(key, strings.TrimPrefix(k, "-")), value)
 			}
 		}
 		return maskedMap
 	case []any:
 		maskedSlice := make([]any, len(v))
 		for i, value := range v {
-			maskedSlice[i] = cr.recursiveMask(m, key, value)
+			maskedSlice[i] = cr.recursiveMask(m, indexKey(key, i), value)
 		}
 		return maskedSlice
 	default:
-		if shouldMask(key, cr.config.IncludeGlobs, cr.config.ExcludeGlobs) {
-			return m.mask(v)
-		}
-		return v
+		return cr.config.maskField(m, key, v)
+	}
+}
+
+// recordKeys returns the keys of record in the order its fields are masked:
+// any, unless fakes are drawn from an injected faker, whose fakes then follow
+// each other in the same order every run.
+func (c *AppConfig) recordKeys(record map[string]any) iter.Seq[string] {
+	if c.Masker.faker == nil {
+		return maps.Keys(record)
+	}
+	return slices.Values(slices.Sorted(maps.Keys(record)))
+}
+
+// joinKey appends a child key to a dotted parent path.
+func joinKey(parent, child string) string {
+	if parent == "" {
+		return child
 	}
+	return parent + "." + child
 }
@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaskingWriter masks what is written to it line by line before writing it
+// to another writer. It can stand in for the output of a logger, so personal
+// data never reaches the log. Lines a rule changes are masked as lines of
+// text input are; in others only the words detected as one of logTypes are,
+// so the rest of every message stays readable. It is safe for concurrent use.
+type MaskingWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	config  AppConfig
+	masker  *masker
+	partial []byte // The start of a line not yet ended
+}
+
+// NewMaskingWriter creates a MaskingWriter writing to w, masking lines as
+// config describes for text. An invalid config is reported as a *ConfigError.
+//
+// Deprecated: Use New and Engine.Writer.
+func NewMaskingWriter(w io.Writer, config AppConfig) (*MaskingWriter, error) {
+	return newMaskingWriter(w, config)
+}
+
+// Writer creates a MaskingWriter writing to w, masking lines as the engine
+// masks text. Options that do not apply to text are reported as a
+// *ConfigError.
+func (e *Engine) Writer(w io.Writer) (*MaskingWriter, error) {
+	return newMaskingWriter(w, e.config)
+}
+
+func newMaskingWriter(w io.Writer, config AppConfig) (*MaskingWriter, error) {
+	config.Format = "text"
+	if _, err := config.prepare(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	return &MaskingWriter{w: w, config: config, masker: newMasker(config.Masker)}, nil
+}
+
+// Write masks the lines p ends and writes them. The rest of p is held until a
+// later write ends its line, or until Close.
+func (mw *MaskingWriter) Write(p []byte) (int, error) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	var out []byte
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		line := data[:i]
+		if len(mw.partial) > 0 {
+			line = append(mw.partial, line...)
+			mw.partial = nil
+		}
+		out = append(out, mw.maskLine(line)...)
+		out = append(out, '\n')
+		data = data[i+1:]
+	}
+	mw.partial = append(mw.partial, data...)
+	if len(out) > 0 {
+		if _, err := mw.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// maskLine masks a line, keeping a carriage return ending it.
+func (mw *MaskingWriter) maskLine(line []byte) string {
+	text, cr := string(line), ""
+	if n := len(text); n > 0 && text[n-1] == '\r' {
+		text, cr = text[:n-1], "\r"
+	}
+	if mw.config.ruleFor(mw.masker, "", text) != nil {
+		if masked := mw.config.maskLine(mw.masker, text); masked != text {
+			return masked + cr
+		}
+	}
+	return mw.config.maskWords(mw.masker, "", text) + cr
+}
+
+// logTypes are the detected types MaskingWriter masks within lines.
+var logTypes = []string{"email", "phone", "iban", "credit_card", "ipv4", "ipv6", "mac_address", "token"}
+
+// maskWords masks the words of line, the value of key, detected as one of
+// logTypes. Words are separated by whitespace, quotes, brackets, commas,
+// semicolons and equals signs, as in key=value pairs, and lose a trailing
+// period or colon.
+func (c *AppConfig) maskWords(m *masker, key, line string) string {
+	var b strings.Builder
+	word := func(w string) {
+		trimmed := strings.TrimRight(w, ".:")
+		if trimmed == "" || c.isSafe(trimmed) || !slices.Contains(logTypes, m.detectStringType(trimmed)) {
+			b.WriteString(w)
+			return
+		}
+		masked := c.masked(m, key, trimmed, m.maskKey(key, trimmed))
+		b.WriteString(formatValue(masked) + w[len(trimmed):])
+	}
+	start := 0
+	for i, r := range line {
+		if unicode.IsSpace(r) || strings.ContainsRune("\"'`,;=()[]{}<>", r) {
+			word(line[start:i])
+			b.WriteRune(r)
+			start = i + utf8.RuneLen(r)
+		}
+	}
+	word(line[start:])
+	return b.String()
+}
+
+// Close masks and writes a last line that was not ended, and saves the
+// mappings of a mapping file. It does not close the writer written to.
+func (mw *MaskingWriter) Close() error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	if len(mw.partial) > 0 {
+		line := mw.maskLine(mw.partial)
+		mw.partial = nil
+		if _, err := io.WriteString(mw.w, line); err != nil {
+			return err
+		}
+	}
+	if mw.config.MappingFile != "" {
+		return mw.config.mappings.save(mw.config.MappingFile, mw.config.MappingKey)
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package pkg
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 )
 
 type xmlProcessor struct {
@@ -15,19 +19,22 @@ type xmlProcessor struct {
 
 func newXMLProcessor(config AppConfig) *xmlProcessor {
 	return &xmlProcessor{
-		config: config,
-		methodFactory: func() *masker {
-			return newMasker(config.Masker)
-		},
+		config:        config,
+		methodFactory: maskerFactory(config.Masker),
 	}
 }
 
+// xmlPeekLimit bounds the input the list pattern detector reads, and holds
+// until masking starts, looking for the second element below the root.
+// Documents whose first element is larger are masked serially.
+const xmlPeekLimit = 4 << 20
+
 // Process determines if the XML can be processed concurrently or if it should
 // fall back to a serial approach. Concurrency is only possible if the XML
 // consists of a simple list of repeating elements directly under the root.
-func (xp *xmlProcessor) Process(r io.Reader, w io.Writer) error {
+func (xp *xmlProcessor) Process(ctx context.Context, r io.Reader, w io.Writer) error {
 	var buf bytes.Buffer
-	tee := io.TeeReader(r, &buf)
+	tee := io.TeeReader(io.LimitReader(r, xmlPeekLimit), &buf)
 
 	decoder := xml.NewDecoder(tee)
 	root, firstChild, _, ok := detectXMLListPattern(decoder)
@@ -36,30 +43,45 @@ func (xp *xmlProcessor) Process(r io.Reader, w io.Writer) error {
 	// with the original reader to provide the full XML stream to the next stage.
 	combinedReader := io.MultiReader(&buf, r)
 
-	if ok {
+	// Preserving the layout takes the whitespace between elements, which
+	// only the serial processor keeps.
+	if ok && xp.config.style() != StylePreserve {
 		// If a repeating pattern is found, process the elements concurrently.
-		runner := newConcurrentRunner(xp.methodFactory, xp.config)
-		runner.Root = root.Name.Local
-		chunkDecoder := xml.NewDecoder(combinedReader)
-		chunkReader := xp.createXMLChunkReader(chunkDecoder, root.Name, firstChild.Name, xp.config.FirstN)
-		assembler := &xmlAssembler{Root: root}
-		return runner.Run(w, chunkReader, assembler)
+		runner := newRunner(xp.methodFactory, xp.config)
+		runner.root = root.Name.Local
+		chunkDecoder := newXMLDecoder(combinedReader)
+		chunkReader := selectRecords(&xp.config, xp.createXMLChunkReader(chunkDecoder, root.Name, firstChild.Name))
+		assembler := &xmlAssembler{Root: root, indent: xp.config.style() == StylePretty}
+		return runner.Run(ctx, w, chunkReader, assembler)
+	}
+
+	if xp.config.emit != nil {
+		return errors.New("record streams need XML whose root holds repeated elements")
 	}
 
 	// For complex or non-list XML, fall back to a serial, streaming processor.
-	// Note: Subsetting with -first is not supported in this mode.
-	serialDecoder := xml.NewDecoder(combinedReader)
-	return xp.processSerially(serialDecoder, w)
+	// Note: Subsetting with -first, -last or -range is not supported in this mode.
+	serialDecoder := newXMLDecoder(combinedReader)
+	start := time.Now()
+	err := xp.processSerially(ctx, serialDecoder, w)
+	xp.config.stats.worked(start)
+	if err == nil {
+		xp.config.stats.record() // The document is the one record
+	}
+	return err
 }
 
 type xmlAssembler struct {
 	Root    xml.StartElement
+	indent  bool
 	encoder *xml.Encoder
 }
 
 func (a *xmlAssembler) WriteStart(w io.Writer) error {
 	a.encoder = xml.NewEncoder(w)
-	a.encoder.Indent("", "  ")
+	if a.indent {
+		a.encoder.Indent("", "  ")
+	}
 	if _, err := w.Write([]byte(xml.Header)); err != nil {
 		return err
 	}
@@ -73,7 +95,7 @@ func (a *xmlAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
 	}
 	for key, val := range itemMap {
 		if valMap, ok := val.(map[string]any); ok {
-			return mapToXML(key, valMap, a.encoder)
+			return mapToXML(w, a.encoder, key, valMap)
 		}
 	}
 	return fmt.Errorf("unexpected structure in item map for XML assembler")
@@ -86,51 +108,103 @@ func (a *xmlAssembler) WriteEnd(w io.Writer) error {
 	return a.encoder.Flush()
 }
 
-func mapToXML(key string, m map[string]any, enc *xml.Encoder) error {
+// mapToXML encodes the element key decoded into m with enc, which writes to
+// w.
+func mapToXML(w io.Writer, enc *xml.Encoder, key string, m map[string]any) error {
 	start := xml.StartElement{Name: xml.Name{Local: key}}
 	for k, v := range m {
 		if after, ok := strings.CutPrefix(k, "-"); ok {
 			attrName := after
-			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrName}, Value: fmt.Sprintf("%v", v)})
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrName}, Value: formatValue(v)})
 		}
 	}
 	if err := enc.EncodeToken(start); err != nil {
 		return err
 	}
-	if text, ok := m["#text"]; ok {
-		if err := enc.EncodeToken(xml.CharData(fmt.Sprintf("%v", text))); err != nil {
+	if err := contentToXML(w, enc, m); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// contentToXML encodes the text, CDATA section and elements of an element
+// decoded into m.
+func contentToXML(w io.Writer, enc *xml.Encoder, m map[string]any) error {
+	if text, ok := m["#text"]; ok && text != nil {
+		if err := enc.EncodeToken(xml.CharData(formatValue(text))); err != nil {
+			return err
+		}
+	}
+	if cdata, ok := m["#cdata"]; ok && cdata != nil {
+		var data []byte
+		if markup, ok := cdata.(map[string]any); ok {
+			var buf bytes.Buffer
+			markupEnc := xml.NewEncoder(&buf)
+			if err := contentToXML(&buf, markupEnc, markup); err != nil {
+				return err
+			}
+			if err := markupEnc.Flush(); err != nil {
+				return err
+			}
+			data = buf.Bytes()
+		} else {
+			data = []byte(formatValue(cdata))
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		if err := writeCDATA(w, data); err != nil {
 			return err
 		}
 	}
 	for k, v := range m {
-		if !strings.HasPrefix(k, "-") && k != "#text" {
+		if !strings.HasPrefix(k, "-") && k != "#text" && k != "#cdata" {
 			if slice, ok := v.([]any); ok {
 				for _, item := range slice {
 					if itemMap, ok := item.(map[string]any); ok {
-						if err := mapToXML(k, itemMap, enc); err != nil {
+						if err := mapToXML(w, enc, k, itemMap); err != nil {
 							return err
 						}
 					}
 				}
 			} else if nestedMap, ok := v.(map[string]any); ok {
-				if err := mapToXML(k, nestedMap, enc); err != nil {
+				if err := mapToXML(w, enc, k, nestedMap); err != nil {
 					return err
 				}
 			} else {
-				if err := mapToXML(k, map[string]any{"#text": v}, enc); err != nil {
+				if err := mapToXML(w, enc, k, map[string]any{"#text": v}); err != nil {
 					return err
 				}
 			}
 		}
 	}
-	return enc.EncodeToken(start.End())
+	return nil
+}
+
+// writeCDATA writes data as a CDATA section, split where data holds the ]]>
+// that would end it.
+func writeCDATA(w io.Writer, data []byte) error {
+	section := make([]byte, 0, len(data)+len("<![CDATA[]]>"))
+	section = append(section, "<![CDATA["...)
+	for {
+		i := bytes.Index(data, []byte("]]>"))
+		if i < 0 {
+			break
+		}
+		section = append(append(section, data[:i+2]...), "]]><![CDATA["...)
+		data = data[i+2:]
+	}
+	section = append(append(section, data...), "]]>"...)
+	_, err := w.Write(section)
+	return err
 }
 
 // detectXMLListPattern heuristically checks if an XML document is a simple list.
 // It does this by checking if the first two elements directly under the root have
 // the same tag name. This is an optimization to enable concurrent processing for
 // simple list-like XML structures while gracefully falling back to a serial
-// processor for more complex ones. It does not parse the full document.
+// processor for more complex ones. It does not parse the full document, and
+// reports no list if its input ends before the second element.
 func detectXMLListPattern(decoder *xml.Decoder) (xml.StartElement, xml.StartElement, xml.StartElement, bool) {
 	var root, firstChild, secondChild xml.StartElement
 	depth := 0
@@ -166,18 +240,18 @@ func detectXMLListPattern(decoder *xml.Decoder) (xml.StartElement, xml.StartElem
 	}
 }
 
-func (xp *xmlProcessor) createXMLChunkReader(decoder *xml.Decoder, rootName, listItemName xml.Name, firstN int) chunkReader {
+func (xp *xmlProcessor) createXMLChunkReader(decoder *xmlDecoder, rootName, listItemName xml.Name) ChunkReader {
 	var started bool
-	recordCount := 0
+	records := 0
 	return func() (any, error) {
 		for {
-			if firstN > 0 && recordCount >= firstN {
-				return nil, io.EOF
-			}
 			token, err := decoder.Token()
-			if err != nil {
+			if err == io.EOF {
 				return nil, err
 			}
+			if err != nil {
+				return nil, xmlError(decoder.Decoder, err, rootName.Local)
+			}
 			switch se := token.(type) {
 			case xml.StartElement:
 				if !started {
@@ -187,11 +261,12 @@ func (xp *xmlProcessor) createXMLChunkReader(decoder *xml.Decoder, rootName, lis
 					}
 				}
 				if se.Name.Local == listItemName.Local {
-					elementMap, err := decodeElementToMap(decoder, se)
+					records++
+					elementMap, err := xp.decodeElementToMap(decoder, se, se.Name.Local)
 					if err != nil {
+						err.Record = records
 						return nil, err
 					}
-					recordCount++
 					return map[string]any{se.Name.Local: elementMap}, nil
 				}
 			case xml.EndElement:
@@ -203,21 +278,35 @@ func (xp *xmlProcessor) createXMLChunkReader(decoder *xml.Decoder, rootName, lis
 	}
 }
 
-func decodeElementToMap(decoder *xml.Decoder, start xml.StartElement) (map[string]any, error) {
+// decodeElementToMap decodes the element started by start, at key, into a
+// map. Errors are located in the input.
+func (xp *xmlProcessor) decodeElementToMap(decoder *xmlDecoder, start xml.StartElement, key string) (map[string]any, *InputError) {
 	m := make(map[string]any)
 	for _, attr := range start.Attr {
 		m["-"+attr.Name.Local] = attr.Value
 	}
+	if err := xp.decodeContent(decoder, m, &start, key); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// decodeContent decodes the content of the element started by start into m,
+// or without start, that of markup up to its end.
+func (xp *xmlProcessor) decodeContent(decoder *xmlDecoder, m map[string]any, start *xml.StartElement, key string) *InputError {
 	for {
 		token, err := decoder.Token()
+		if err == io.EOF && start == nil {
+			return nil
+		}
 		if err != nil {
-			return nil, err
+			return xmlError(decoder.Decoder, err, key)
 		}
 		switch se := token.(type) {
 		case xml.StartElement:
-			nestedMap, err := decodeElementToMap(decoder, se)
+			nestedMap, err := xp.decodeElementToMap(decoder, se, joinKey(key, se.Name.Local))
 			if err != nil {
-				return nil, err
+				return err
 			}
 			key := se.Name.Local
 			if existing, ok := m[key]; ok {
@@ -231,77 +320,392 @@ func decodeElementToMap(decoder *xml.Decoder, start xml.StartElement) (map[strin
 			}
 		case xml.CharData:
 			text := strings.TrimSpace(string(se))
-			if text != "" {
+			switch {
+			case text == "":
+			case !decoder.cdata():
 				m["#text"] = text
+			case xp.config.CDATAMarkup:
+				// Markup is masked as the elements under key it holds.
+				if markup, ok := xp.decodeMarkup(text, key); ok {
+					m["#cdata"] = markup
+					break
+				}
+				fallthrough
+			default:
+				m["#cdata"] = text
 			}
 		case xml.EndElement:
-			if se.Name.Local == start.Name.Local && se.Name.Space == start.Name.Space {
-				return m, nil
+			if start != nil && se.Name.Local == start.Name.Local && se.Name.Space == start.Name.Space {
+				return nil
 			}
 		}
 	}
 }
 
-func (xp *xmlProcessor) processSerially(decoder *xml.Decoder, w io.Writer) error {
+// decodeMarkup decodes the markup held by a CDATA section at key into a map
+// of its elements and text, and reports false for text that is not markup.
+func (xp *xmlProcessor) decodeMarkup(text, key string) (map[string]any, bool) {
+	if !strings.HasPrefix(text, "<") {
+		return nil, false
+	}
+	m := make(map[string]any)
+	if err := xp.decodeContent(newXMLDecoder(strings.NewReader(text)), m, nil, key); err != nil {
+		return nil, false
+	}
+	return m, true
+}
+
+// xmlDecoder is an xml.Decoder telling CDATA sections from other character
+// data, which xml.Decoder returns alike.
+type xmlDecoder struct {
+	*xml.Decoder
+	input *cdataReader
+	start int64 // Offset of the token last returned
+}
+
+func newXMLDecoder(r io.Reader) *xmlDecoder {
+	input := &cdataReader{r: bufio.NewReader(r)}
+	return &xmlDecoder{Decoder: xml.NewDecoder(input), input: input}
+}
+
+func (d *xmlDecoder) Token() (xml.Token, error) {
+	d.start = d.InputOffset()
+	return d.Decoder.Token()
+}
+
+// cdata reports whether the character data last returned by Token is a CDATA
+// section.
+func (d *xmlDecoder) cdata() bool { return d.input.startsCDATA(d.start) }
+
+// cdataOpen starts a CDATA section.
+const cdataOpen = "<![CDATA["
+
+// cdataReader reads the input of an xml.Decoder, which reads an io.ByteReader
+// a byte at a time, noting where CDATA sections start.
+type cdataReader struct {
+	r       *bufio.Reader
+	offset  int64   // Of the next byte
+	matched int     // Bytes of cdataOpen just read
+	starts  []int64 // Offsets of the sections not yet asked about
+}
+
+func (cr *cdataReader) ReadByte() (byte, error) {
+	c, err := cr.r.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	cr.offset++
+	switch {
+	case c == cdataOpen[cr.matched]:
+		if cr.matched++; cr.matched == len(cdataOpen) {
+			cr.starts = append(cr.starts, cr.offset-int64(len(cdataOpen)))
+			cr.matched = 0
+		}
+	case c == '<':
+		cr.matched = 1
+	default:
+		cr.matched = 0
+	}
+	return c, nil
+}
+
+func (cr *cdataReader) Read(p []byte) (int, error) {
+	for i := range p {
+		c, err := cr.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		p[i] = c
+	}
+	return len(p), nil
+}
+
+// startsCDATA reports whether a CDATA section starts at offset. Sections
+// before it are forgotten, so offsets asked about must not go back.
+func (cr *cdataReader) startsCDATA(offset int64) bool {
+	for len(cr.starts) > 0 && cr.starts[0] < offset {
+		cr.starts = cr.starts[1:]
+	}
+	return len(cr.starts) > 0 && cr.starts[0] == offset
+}
+
+// xmlToken is a token of a document masked serially, as the decoding stage
+// passes it on to be masked and encoded.
+type xmlToken struct {
+	token  xml.Token
+	key    string // Path of the element the attributes or text are of, when masked
+	mask   bool   // The attributes of a start element or text are masked
+	layout bool   // Whitespace between elements, outside of excluded subtrees
+	cdata  bool   // The text is a CDATA section
+	err    error  // Of decoding the input, ending the document
+}
+
+// xmlTokenBatch is the number of tokens passed from one stage of serial
+// processing to the next at a time.
+const xmlTokenBatch = 256
+
+// processSerially masks a document token by token, in three stages run
+// concurrently: decoding the tokens and tracking the path of each, masking
+// their attributes and text, and encoding them. Values are masked in the
+// order of the document by a single masker, as they would be on one
+// goroutine, so documents that are not a list of records still use up to
+// three cores.
+func (xp *xmlProcessor) processSerially(ctx context.Context, decoder *xmlDecoder, w io.Writer) error {
+	// Returning, for whatever reason, stops the other stages.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	decoded := make(chan []xmlToken, 4)
+	masked := make(chan []xmlToken, 4)
+	go xp.decodeTokens(ctx, decoder, decoded)
+	go xp.maskTokens(ctx, decoded, masked)
+
 	encoder := xml.NewEncoder(w)
-	encoder.Indent("", "  ")
-	serialMasker := newMasker(xp.config.Masker)
-	var path []string
-	for {
+	if xp.config.style() == StylePretty {
+		encoder.Indent("", "  ")
+	}
+	for batch := range masked {
+		for _, t := range batch {
+			if t.err != nil {
+				return t.err
+			}
+			if err := writeXMLToken(w, encoder, t, xp.config.style()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+// writeXMLToken encodes a masked token with encoder, which writes to w, in
+// the layout of style.
+func writeXMLToken(w io.Writer, encoder *xml.Encoder, t xmlToken, style string) error {
+	switch {
+	case t.token == nil:
+		// Text masked to nothing.
+	case t.cdata:
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		return writeCDATA(w, t.token.(xml.CharData))
+	case t.layout && style == StylePreserve:
+		// The encoder would escape tabs and carriage returns, so layout is
+		// written as it was, after what was encoded.
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		_, err := w.Write(t.token.(xml.CharData))
+		return err
+	case t.layout && style == StyleCompact:
+	default:
+		return encoder.EncodeToken(t.token)
+	}
+	return nil
+}
+
+// decodeTokens decodes the tokens of a document into batches, with the path
+// of the elements they are in, until the document ends, decoding fails or ctx
+// is done.
+func (xp *xmlProcessor) decodeTokens(ctx context.Context, decoder *xmlDecoder, out chan<- []xmlToken) {
+	defer close(out)
+	batch := make([]xmlToken, 0, xmlTokenBatch)
+	send := func() bool {
+		select {
+		case out <- batch:
+			batch = make([]xmlToken, 0, xmlTokenBatch)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	paths := newXMLPaths(&xp.config, "")
+	for ctx.Err() == nil {
 		token, err := decoder.Token()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			batch = append(batch, xmlToken{err: xmlError(decoder.Decoder, err, paths.key())})
+			break
 		}
-		switch se := token.(type) {
+		t := paths.visit(xml.CopyToken(token), decoder)
+		if batch = append(batch, t); len(batch) == xmlTokenBatch && !send() {
+			return
+		}
+	}
+	if len(batch) > 0 {
+		send()
+	}
+}
+
+// xmlPaths tracks the path of the element every token of a document is in,
+// and the subtrees excluded as a whole, which are copied through.
+type xmlPaths struct {
+	config *AppConfig
+	path   []string
+	// siblings counts the elements of every name under each open element,
+	// so repeated elements get their index in the key.
+	siblings []map[string]int
+	// pruned is the depth within an element whose subtree is excluded as a
+	// whole.
+	pruned int
+}
+
+// newXMLPaths returns the paths of the tokens of a document, or of markup
+// embedded in the element at key.
+func newXMLPaths(config *AppConfig, key string) *xmlPaths {
+	p := &xmlPaths{config: config, siblings: []map[string]int{{}}}
+	if key != "" {
+		p.path = []string{key}
+	}
+	return p
+}
+
+func (p *xmlPaths) key() string { return strings.Join(p.path, ".") }
+
+// visit returns the token decoded last by decoder, copied, with its path and
+// what of it is masked.
+func (p *xmlPaths) visit(token xml.Token, decoder *xmlDecoder) xmlToken {
+	t := xmlToken{token: token}
+	if p.pruned > 0 {
+		switch token.(type) {
 		case xml.StartElement:
-			path = append(path, se.Name.Local)
-			startElem := se.Copy()
-			for i := range startElem.Attr {
-				attr := &startElem.Attr[i]
-				fullKey := strings.Join(path, ".") + "." + attr.Name.Local
-				if shouldMask(fullKey, xp.config.IncludeGlobs, xp.config.ExcludeGlobs) {
-					maskedValue := serialMasker.mask(attr.Value)
-					attr.Value = fmt.Sprintf("%v", maskedValue)
-				}
-			}
-			if err := encoder.EncodeToken(startElem); err != nil {
-				return err
-			}
-		case xml.CharData:
-			trimmedData := strings.TrimSpace(string(se))
-			if len(trimmedData) > 0 {
-				fullKey := strings.Join(path, ".")
-				if shouldMask(fullKey, xp.config.IncludeGlobs, xp.config.ExcludeGlobs) {
-					maskedValue := serialMasker.mask(trimmedData)
-					maskedString := fmt.Sprintf("%v", maskedValue)
-					if err := encoder.EncodeToken(xml.CharData(maskedString)); err != nil {
-						return err
-					}
-				} else {
-					if err := encoder.EncodeToken(se); err != nil {
-						return err
-					}
-				}
-			} else {
-				if err := encoder.EncodeToken(se); err != nil {
-					return err
-				}
-			}
+			p.pruned++
 		case xml.EndElement:
-			if len(path) > 0 {
-				path = path[:len(path)-1]
-			}
-			if err := encoder.EncodeToken(token); err != nil {
-				return err
+			if p.pruned--; p.pruned == 0 {
+				p.path = p.path[:len(p.path)-1]
+				p.siblings = p.siblings[:len(p.siblings)-1]
 			}
-		default:
-			if err := encoder.EncodeToken(token); err != nil {
-				return err
+		case xml.CharData:
+			t.cdata = decoder.cdata()
+		}
+		return t
+	}
+	switch se := token.(type) {
+	case xml.StartElement:
+		segment := se.Name.Local
+		if i := p.siblings[len(p.siblings)-1][segment]; i > 0 {
+			segment = indexKey(segment, i)
+		}
+		p.siblings[len(p.siblings)-1][se.Name.Local]++
+		p.siblings = append(p.siblings, map[string]int{})
+		p.path = append(p.path, segment)
+		t.key = p.key()
+		if p.config.canPrune() && p.config.prunes(t.key) {
+			p.pruned = 1
+		} else {
+			t.mask = len(se.Attr) > 0
+		}
+	case xml.CharData:
+		t.cdata = decoder.cdata()
+		if len(bytes.TrimSpace(se)) > 0 {
+			t.key, t.mask = p.key(), true
+		} else {
+			t.layout = !t.cdata
+		}
+	case xml.EndElement:
+		if len(p.path) > 0 {
+			p.path = p.path[:len(p.path)-1]
+			p.siblings = p.siblings[:len(p.siblings)-1]
+		}
+	}
+	return t
+}
+
+// maskTokens masks the attributes and text of the batches of tokens in, in
+// order, and passes them on. Tokens of elements that have not ended yet may
+// be held back to the next batch, so their fields are masked together.
+func (xp *xmlProcessor) maskTokens(ctx context.Context, in <-chan []xmlToken, out chan<- []xmlToken) {
+	defer close(out)
+	records := newXMLRecords(xp, xp.methodFactory())
+	send := func(batch []xmlToken) bool {
+		if len(batch) == 0 {
+			return true
+		}
+		select {
+		case out <- batch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for batch := range in {
+		for _, t := range batch {
+			records.add(t)
+		}
+		if !send(records.release()) {
+			return
+		}
+	}
+	send(records.flush())
+}
+
+// maskToken masks the attributes or text of t.
+func (xp *xmlProcessor) maskToken(m *masker, t *xmlToken) {
+	if !t.mask {
+		return
+	}
+	switch se := t.token.(type) {
+	case xml.StartElement:
+		for i := range se.Attr {
+			attr := &se.Attr[i]
+			attr.Value = formatValue(xp.config.maskField(m, t.key+"."+attr.Name.Local, attr.Value))
+		}
+	case xml.CharData:
+		if t.cdata && xp.config.CDATAMarkup {
+			if markup, ok := xp.maskMarkup(m, t.key, se); ok {
+				t.token = xml.CharData(markup)
+				return
 			}
 		}
+		trimmedData := strings.TrimSpace(string(se))
+		maskedValue := xp.config.maskField(m, t.key, trimmedData)
+		if maskedValue == nil {
+			t.token = nil
+		} else if maskedValue != trimmedData {
+			// Unmasked text keeps its original surrounding whitespace.
+			t.token = xml.CharData(formatValue(maskedValue))
+		}
 	}
-	return encoder.Flush()
+}
+
+// maskMarkup masks the markup held by a CDATA section at key, as the
+// elements under key it holds, keeping its layout. It reports false for text
+// that is not markup, which is masked as it is.
+func (xp *xmlProcessor) maskMarkup(m *masker, key string, data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return nil, false
+	}
+	// The markup is decoded as a whole first, so text that only starts as
+	// markup is not partly masked.
+	decoder := newXMLDecoder(bytes.NewReader(data))
+	paths := newXMLPaths(&xp.config, key)
+	var tokens []xmlToken
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		tokens = append(tokens, paths.visit(xml.CopyToken(token), decoder))
+	}
+	records := newXMLRecords(xp, m)
+	for _, t := range tokens {
+		records.add(t)
+	}
+	var buf bytes.Buffer
+	encoder := xml.NewEncoder(&buf)
+	for _, t := range records.flush() {
+		if err := writeXMLToken(&buf, encoder, t, StylePreserve); err != nil {
+			return nil, false
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
 }
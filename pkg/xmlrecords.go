@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// xmlRecordLimit is the number of tokens an element of a document masked
+// serially is held back for. Beyond it, the leaves of the element are masked
+// each on their own.
+const xmlRecordLimit = 4096
+
+// xmlRecords masks the tokens of a document serially, holding those of every
+// element back until it ends, so the name and card fields among the leaves of
+// an element are masked together, as those of the records of a list are.
+type xmlRecords struct {
+	xp   *xmlProcessor
+	m    *masker
+	held []xmlToken
+	base int // Position in the document of held[0]
+	open []*xmlRecord
+	// given is the number of the outermost open elements given up on, as
+	// they held more than xmlRecordLimit tokens.
+	given int
+}
+
+// xmlRecord is an open element, and the leaves among its attributes and
+// children.
+type xmlRecord struct {
+	start    int // Position of the start element
+	key      string
+	name     string
+	attrs    bool
+	leaves   map[string]int // Text of the leaves by name, attributes prefixed with '-'
+	children map[string]int // Child elements by name, as repeated ones are no leaves
+	text     int            // Position of the text of the element, or -1
+	texts    int            // Pieces of text masked
+}
+
+func newXMLRecords(xp *xmlProcessor, m *masker) *xmlRecords {
+	return &xmlRecords{xp: xp, m: m}
+}
+
+// add takes the next token of the document.
+func (r *xmlRecords) add(t xmlToken) {
+	pos := r.base + len(r.held)
+	r.held = append(r.held, t)
+	switch token := t.token.(type) {
+	case xml.StartElement:
+		if n := len(r.open); n > 0 {
+			r.open[n-1].children[token.Name.Local]++
+		}
+		record := &xmlRecord{start: pos, key: t.key, name: token.Name.Local, attrs: len(token.Attr) > 0, leaves: map[string]int{}, children: map[string]int{}, text: -1}
+		if t.mask {
+			for _, attr := range token.Attr {
+				record.leaves["-"+attr.Name.Local] = pos
+			}
+		}
+		r.open = append(r.open, record)
+	case xml.CharData:
+		if n := len(r.open); n > 0 && t.mask && !(t.cdata && r.xp.config.CDATAMarkup) {
+			r.open[n-1].text, r.open[n-1].texts = pos, r.open[n-1].texts+1
+		}
+	case xml.EndElement:
+		n := len(r.open)
+		if n == 0 {
+			break
+		}
+		record := r.open[n-1]
+		r.open = r.open[:n-1]
+		if n > r.given {
+			r.maskRecord(record)
+		}
+		r.given = min(r.given, len(r.open))
+		if n > 1 && len(record.children) == 0 && !record.attrs && record.texts == 1 {
+			r.open[n-2].leaves[record.name] = record.text
+		}
+	}
+	for r.given < len(r.open) && pos-r.open[r.given].start >= xmlRecordLimit {
+		r.given++
+	}
+}
+
+// release returns the tokens no open element holds back, masked.
+func (r *xmlRecords) release() []xmlToken {
+	end := r.base + len(r.held)
+	if r.given < len(r.open) {
+		end = r.open[r.given].start
+	}
+	released := make([]xmlToken, end-r.base)
+	copy(released, r.held)
+	for i := range released {
+		r.xp.maskToken(r.m, &released[i])
+	}
+	r.held = append(r.held[:0], r.held[end-r.base:]...)
+	r.base = end
+	return released
+}
+
+// flush gives up on the elements still open, at the end of the document, and
+// returns the tokens held back, masked.
+func (r *xmlRecords) flush() []xmlToken {
+	r.given = len(r.open)
+	return r.release()
+}
+
+// maskRecord masks the name and card fields among the leaves of an element
+// that ended together, as recursiveMask does those of a record.
+func (r *xmlRecords) maskRecord(record *xmlRecord) {
+	if len(record.leaves) < 2 {
+		return
+	}
+	fields := make(map[string]any, len(record.leaves))
+	for k, pos := range record.leaves {
+		if record.children[k] > 1 {
+			continue
+		}
+		t := r.held[pos-r.base]
+		if name, ok := strings.CutPrefix(k, "-"); ok {
+			for _, attr := range t.token.(xml.StartElement).Attr {
+				if attr.Name.Local == name {
+					fields[k] = attr.Value
+				}
+			}
+		} else {
+			fields[k] = strings.TrimSpace(string(t.token.(xml.CharData)))
+		}
+	}
+	m, config := r.m, &r.xp.config
+	keyOf := func(k string) string { return joinKey(record.key, strings.TrimPrefix(k, "-")) }
+	shouldMaskField := func(k string) bool { return config.masksAsRecordField(m, keyOf(k), fields[k]) }
+	masked := make(map[string]any)
+	if card, ok := m.findCardFields(fields); ok {
+		for k, value := range m.forField(fieldPath(record.key)).maskCardFields(fields, card, shouldMaskField) {
+			masked[k] = config.masked(m, keyOf(k), fields[k], value)
+		}
+	}
+	if names, ok := m.findNameFields(fields); ok {
+		for k, value := range m.forField(fieldPath(record.key)).maskNameFields(fields, names, shouldMaskField) {
+			masked[k] = config.masked(m, keyOf(k), fields[k], value)
+		}
+	}
+	attrs := false
+	for k, value := range masked {
+		if strings.HasPrefix(k, "-") {
+			attrs = true
+			continue
+		}
+		t := &r.held[record.leaves[k]-r.base]
+		t.token, t.mask = xml.CharData(formatValue(value)), false
+	}
+	if !attrs {
+		return
+	}
+	// The other attributes of the element are masked along, as an element is
+	// masked once.
+	t := &r.held[record.start-r.base]
+	start := t.token.(xml.StartElement)
+	for i := range start.Attr {
+		attr := &start.Attr[i]
+		if value, ok := masked["-"+attr.Name.Local]; ok {
+			attr.Value = formatValue(value)
+		} else {
+			attr.Value = formatValue(config.maskField(m, t.key+"."+attr.Name.Local, attr.Value))
+		}
+	}
+	t.mask = false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+)
+
+// profileFlags are the flags capturing profiles of a run, to attach to a
+// report of a slow one.
+type profileFlags struct {
+	pprofAddr, cpuProfile, memProfile *string
+}
+
+func addProfileFlags(flags *flag.FlagSet) *profileFlags {
+	return &profileFlags{
+		pprofAddr:  flags.String("pprof", "", "Address to serve the profiles of the running process on, e.g. localhost:6060, under /debug/pprof/"),
+		cpuProfile: flags.String("cpuprofile", "", "File to write a CPU profile of the run to, for go tool pprof"),
+		memProfile: flags.String("memprofile", "", "File to write a profile of the memory in use when the run ends to, for go tool pprof"),
+	}
+}
+
+// start starts the profiles the flags ask for, and returns the function that
+// writes them once the run ends.
+func (p *profileFlags) start() (stop func(), err error) {
+	if *p.pprofAddr != "" {
+		// The profiles are served on a mux of their own, so nothing else
+		// registered with net/http is.
+		lis, err := net.Listen("tcp", *p.pprofAddr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot serve profiles: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		go http.Serve(lis, mux)
+		fmt.Fprintf(os.Stderr, "Serving profiles on http://%s/debug/pprof/\n", lis.Addr())
+	}
+	var cpu *os.File
+	if *p.cpuProfile != "" {
+		if cpu, err = os.Create(*p.cpuProfile); err != nil {
+			return nil, fmt.Errorf("cannot write CPU profile: %w", err)
+		}
+		if err := runtimepprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("cannot write CPU profile: %w", err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			runtimepprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: cannot write CPU profile:", err)
+			}
+		}
+		if *p.memProfile != "" {
+			if err := writeHeapProfile(*p.memProfile); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: cannot write memory profile:", err)
+			}
+		}
+	}, nil
+}
+
+// writeHeapProfile writes a profile of the memory in use to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// Collecting first leaves out what is garbage already.
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"unaware/pkg"
+)
+
+// reviewFields asks on out what to do with every field of a sample, reading
+// the answers from in: mask or keep it, or mask it with a method such as
+// "null" or "partial:last4". An empty answer takes the suggestion, and once
+// in ends, the suggestions stand for the remaining fields.
+func reviewFields(in io.Reader, out io.Writer, fields []pkg.FieldSummary) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintln(out, "For every field, answer m to mask it, k to keep it, or a method to mask it with")
+	fmt.Fprintln(out, "(random, deterministic, fpe, null, partial:last4, hash:hex, ...). Press enter for the suggestion.")
+	for i := range fields {
+		field := &fields[i]
+		fmt.Fprintf(out, "\n%s\n  type %s, %d distinct of %d", field.Path, field.Type, field.Distinct, field.Count)
+		if field.Example != "" {
+			fmt.Fprintf(out, ", e.g. %q", field.Example)
+		}
+		fmt.Fprintln(out)
+		for {
+			suggestion := "keep"
+			if field.Mask {
+				suggestion = "mask"
+			}
+			fmt.Fprintf(out, "  mask, keep or method [%s]: ", suggestion)
+			if !scanner.Scan() {
+				fmt.Fprintln(out)
+				return scanner.Err()
+			}
+			answer := strings.TrimSpace(scanner.Text())
+			switch strings.ToLower(answer) {
+			case "":
+			case "m", "mask":
+				field.Mask, field.Method = true, ""
+			case "k", "keep":
+				field.Mask, field.Method = false, ""
+			default:
+				if _, err := pkg.ParseMethod(answer); err != nil {
+					fmt.Fprintln(out, " ", err)
+					continue
+				}
+				field.Mask, field.Method = true, answer
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// isS3 reports whether path is an s3://bucket/key URL rather than a file.
+func isS3(path string) bool {
+	return strings.HasPrefix(path, "s3://")
+}
+
+// isS3Prefix reports whether path is an s3:// URL naming every object below
+// it rather than one object: one with a key ending in a slash, or none.
+func isS3Prefix(path string) bool {
+	_, key, _ := strings.Cut(strings.TrimPrefix(path, "s3://"), "/")
+	return isS3(path) && (key == "" || strings.HasSuffix(key, "/"))
+}
+
+// splitS3 returns the bucket and key of an s3://bucket/key URL.
+func splitS3(url string) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(url, "s3://"), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("%s names no bucket", url)
+	}
+	return bucket, key, nil
+}
+
+// s3API is the part of the S3 API objects are listed, read and uploaded
+// with, as the client of s3Client implements it.
+type s3API interface {
+	manager.UploadAPIClient
+	s3.ListObjectsV2APIClient
+	GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// s3Client returns the client all objects are read and written with,
+// configured like the AWS CLI: from the environment, shared config and
+// credential files, or the instance role.
+var s3Client = sync.OnceValues(func() (s3API, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("cannot load AWS config: %w", err)
+	}
+	return s3.NewFromConfig(cfg), nil
+})
+
+// listS3 returns the URLs of the objects below prefix, an s3://bucket/prefix/
+// URL, in key order. Keys ending in a slash, which consoles create as
+// folders, are left out.
+func listS3(ctx context.Context, prefix string) ([]string, error) {
+	bucket, key, err := splitS3(prefix)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s3Client()
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(key)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list %s: %w", prefix, err)
+		}
+		for _, object := range page.Contents {
+			if name := aws.ToString(object.Key); !strings.HasSuffix(name, "/") {
+				urls = append(urls, "s3://"+bucket+"/"+name)
+			}
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no objects below %s", prefix)
+	}
+	return urls, nil
+}
+
+// openS3 streams the object at url. The size is -1 when S3 does not report
+// one.
+func openS3(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	bucket, key, err := splitS3(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	client, err := s3Client()
+	if err != nil {
+		return nil, 0, err
+	}
+	object, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, 0, err
+	}
+	size := int64(-1)
+	if object.ContentLength != nil {
+		size = *object.ContentLength
+	}
+	return object.Body, size, nil
+}
+
+// s3Writer uploads what is written to it to an object in parts, so output of
+// any size streams through memory without touching local disk. The object
+// only appears once Close completes the upload.
+type s3Writer struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+// createS3 starts the upload of the object at url.
+func createS3(ctx context.Context, url string) (*s3Writer, error) {
+	if isS3Prefix(url) {
+		return nil, fmt.Errorf("%s names a prefix, not an object", url)
+	}
+	bucket, key, err := splitS3(url)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s3Client()
+	if err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: r})
+		// A failed upload must not leave the masker blocked on the pipe.
+		r.CloseWithError(err)
+		done <- err
+	}()
+	return &s3Writer{pipe: w, done: done}, nil
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close completes the upload and returns its error.
+func (w *s3Writer) Close() error {
+	w.pipe.Close()
+	return <-w.done
+}
+
+// Abort fails the upload with err, so no object is written and the parts
+// uploaded so far are removed.
+func (w *s3Writer) Abort(err error) {
+	w.pipe.CloseWithError(err)
+	<-w.done
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitS3(t *testing.T) {
+	tests := []struct {
+		url, bucket, key string
+	}{
+		{"s3://exports/customers.csv", "exports", "customers.csv"},
+		{"s3://exports/2024/03/customers.csv", "exports", "2024/03/customers.csv"},
+		{"s3://exports/2024/", "exports", "2024/"},
+		{"s3://exports", "exports", ""},
+	}
+	for _, tt := range tests {
+		bucket, key, err := splitS3(tt.url)
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.bucket, bucket, tt.url)
+		assert.Equal(t, tt.key, key, tt.url)
+	}
+	_, _, err := splitS3("s3:///customers.csv")
+	assert.ErrorContains(t, err, "names no bucket")
+}
+
+func TestIsS3Prefix(t *testing.T) {
+	assert.True(t, isS3Prefix("s3://exports"), "A bucket names every object in it")
+	assert.True(t, isS3Prefix("s3://exports/"))
+	assert.True(t, isS3Prefix("s3://exports/2024/"))
+	assert.False(t, isS3Prefix("s3://exports/customers.csv"))
+	assert.False(t, isS3Prefix("exports/"), "Directories are no prefixes")
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{
+		"exports/2024/":              nil,
+		"exports/2024/customers.csv": []byte("email\njane@example.com\n"),
+		"exports/2024/orders.csv":    []byte("id\n1\n"),
+		"exports/2025/customers.csv": []byte("email\n"),
+	}}
+	client := s3Client
+	s3Client = func() (s3API, error) { return fake, nil }
+	t.Cleanup(func() { s3Client = client })
+	ctx := context.Background()
+
+	t.Run("List", func(t *testing.T) {
+		urls, err := listS3(ctx, "s3://exports/2024/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"s3://exports/2024/customers.csv", "s3://exports/2024/orders.csv"}, urls, "Folders are left out")
+		_, err = listS3(ctx, "s3://exports/2023/")
+		assert.ErrorContains(t, err, "no objects below s3://exports/2023/")
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		r, size, err := openS3(ctx, "s3://exports/2024/customers.csv")
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "email\njane@example.com\n", string(data))
+		assert.Equal(t, int64(len(data)), size)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		w, err := createS3(ctx, "s3://masked/customers.csv")
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "email\ncolby@brekke.biz\n")
+		require.NoError(t, err)
+		assert.NotContains(t, fake.keys(), "masked/customers.csv", "Objects appear once the upload completes")
+		require.NoError(t, w.Close())
+		assert.Equal(t, "email\ncolby@brekke.biz\n", string(fake.object("masked/customers.csv")))
+	})
+
+	t.Run("Close in parts", func(t *testing.T) {
+		w, err := createS3(ctx, "s3://masked/large.csv")
+		require.NoError(t, err)
+		large := bytes.Repeat([]byte("colby@brekke.biz\n"), 400_000)
+		_, err = w.Write(large)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, large, fake.object("masked/large.csv"))
+		assert.Empty(t, fake.uploads)
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		w, err := createS3(ctx, "s3://masked/aborted.csv")
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "email\n")
+		require.NoError(t, err)
+		w.Abort(errors.New("masking failed"))
+		assert.NotContains(t, fake.keys(), "masked/aborted.csv")
+	})
+
+	t.Run("Abort in parts", func(t *testing.T) {
+		w, err := createS3(ctx, "s3://masked/aborted.csv")
+		require.NoError(t, err)
+		_, err = w.Write(bytes.Repeat([]byte("colby@brekke.biz\n"), 400_000))
+		require.NoError(t, err)
+		w.Abort(errors.New("masking failed"))
+		assert.NotContains(t, fake.keys(), "masked/aborted.csv")
+		assert.Equal(t, 1, fake.aborted, "The parts uploaded are removed")
+		assert.Empty(t, fake.uploads)
+	})
+
+	t.Run("Prefix", func(t *testing.T) {
+		_, err := createS3(ctx, "s3://masked/2024/")
+		assert.ErrorContains(t, err, "names a prefix, not an object")
+	})
+}
+
+// fakeS3 keeps objects in memory, by bucket/key.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string][][]byte // Parts of the multipart uploads in progress, by ID
+	aborted int                 // Multipart uploads aborted
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Sorted(maps.Keys(f.objects))
+}
+
+func (f *fakeS3) object(key string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[key]
+}
+
+func (f *fakeS3) ListObjectsV2(_ context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var contents []types.Object
+	for _, key := range f.keys() {
+		if name, ok := strings.CutPrefix(key, aws.ToString(in.Bucket)+"/"); ok && strings.HasPrefix(name, aws.ToString(in.Prefix)) {
+			contents = append(contents, types.Object{Key: aws.String(name)})
+		}
+	}
+	return &s3.ListObjectsV2Output{Contents: contents, IsTruncated: aws.Bool(false)}, nil
+}
+
+func (f *fakeS3) GetObject(_ context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ContentLength: aws.Int64(int64(len(data)))}, nil
+}
+
+func (f *fakeS3) PutObject(_ context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(_ context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.uploads == nil {
+		f.uploads = make(map[string][][]byte)
+	}
+	id := fmt.Sprintf("upload-%d", len(f.uploads)+f.aborted)
+	f.uploads[id] = nil
+	return &s3.CreateMultipartUploadOutput{Bucket: in.Bucket, Key: in.Key, UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) UploadPart(_ context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := f.uploads[aws.ToString(in.UploadId)]
+	n := int(aws.ToInt32(in.PartNumber))
+	if len(parts) < n {
+		parts = append(parts, make([][]byte, n-len(parts))...)
+	}
+	parts[n-1] = data
+	f.uploads[aws.ToString(in.UploadId)] = parts
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf(`"%d"`, n))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(_ context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)] = bytes.Join(f.uploads[aws.ToString(in.UploadId)], nil)
+	delete(f.uploads, aws.ToString(in.UploadId))
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(_ context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.uploads, aws.ToString(in.UploadId))
+	f.aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
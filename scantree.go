@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gobwas/glob"
+	"unaware/pkg"
+)
+
+// scanFormats are the formats scan reads files of by their extension.
+var scanFormats = map[string]string{
+	".json":   "json",
+	".ndjson": "ndjson",
+	".jsonl":  "ndjson",
+	".csv":    "csv",
+	".xml":    "xml",
+	".sql":    "mysqldump",
+}
+
+// fileFindings are the findings of scanning one file, or stdin if File is
+// empty.
+type fileFindings struct {
+	File     string
+	Findings []pkg.Finding
+}
+
+// scanTree scans the data files below root, those with an extension of
+// scanFormats, and returns the findings of those holding personal data in
+// path order. Directories of dependencies and hidden ones, such as .git, are
+// not entered, nor are files and directories matching a skip pattern. Files
+// that cannot be read as their extension says, such as SQL other than INSERT
+// statements mysqldump writes, are reported on stderr and skipped.
+func scanTree(root string, skip, exclude []string) ([]fileFindings, error) {
+	var skipGlobs []glob.Glob
+	for _, pattern := range skip {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, &pkg.ConfigError{Err: fmt.Errorf("invalid skip pattern %q: %w", pattern, err)}
+		}
+		skipGlobs = append(skipGlobs, g)
+	}
+	var results []fileFindings
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		skipped := slices.ContainsFunc(skipGlobs, func(g glob.Glob) bool { return g.Match(rel) })
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != root && (skipped || strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		format, ok := scanFormats[strings.ToLower(filepath.Ext(path))]
+		if !ok || skipped || !entry.Type().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		findings, err := pkg.Scan(f, format, exclude)
+		if err != nil {
+			var configErr *pkg.ConfigError
+			if errors.As(err, &configErr) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: skipped %s: %v\n", rel, err)
+			return nil
+		}
+		if len(findings) > 0 {
+			results = append(results, fileFindings{File: rel, Findings: findings})
+		}
+		return nil
+	})
+	return results, err
+}
+
+// writeScanReport writes the findings of files to w as a table, with a
+// column of the file if byFile is set, JSON or SARIF, the format code
+// scanning of CI systems reads.
+func writeScanReport(w io.Writer, report string, results []fileFindings, byFile bool) error {
+	switch report {
+	case "table":
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		if byFile {
+			fmt.Fprintln(table, "FILE\tPATH\tTYPE\tCOUNT\tFIRST SEEN")
+		} else {
+			fmt.Fprintln(table, "PATH\tTYPE\tCOUNT\tFIRST SEEN")
+		}
+		for _, result := range results {
+			for _, finding := range result.Findings {
+				if byFile {
+					fmt.Fprintf(table, "%s\t", result.File)
+				}
+				fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", finding.Path, finding.Type, finding.Count, finding.Location)
+			}
+		}
+		return table.Flush()
+	case "json":
+		type jsonFinding struct {
+			File     string `json:"file,omitempty"`
+			Path     string `json:"path"`
+			Type     string `json:"type"`
+			Count    int    `json:"count"`
+			Location string `json:"location"`
+			Line     int    `json:"line,omitempty"`
+		}
+		findings := []jsonFinding{}
+		for _, result := range results {
+			for _, f := range result.Findings {
+				findings = append(findings, jsonFinding{result.File, f.Path, f.Type, f.Count, f.Location, f.Line})
+			}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(findings)
+	case "sarif":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sarifLog(results))
+	default:
+		return &pkg.ConfigError{Err: fmt.Errorf("unknown report %q, want table, json or sarif", report)}
+	}
+}
+
+// sarif is a SARIF 2.1.0 log, of the properties code scanning reads.
+type sarif struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string      `json:"name"`
+			Rules []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string    `json:"id"`
+	ShortDescription sarifText `json:"shortDescription"`
+	Help             sarifText `json:"help"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifLog returns the findings of files as a SARIF log, with a rule for
+// every type of personal data found and a result for every finding.
+func sarifLog(results []fileFindings) sarif {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "unaware"
+	run.Tool.Driver.Rules = []sarifRule{}
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			id := "pii/" + finding.Type
+			if !slices.ContainsFunc(run.Tool.Driver.Rules, func(rule sarifRule) bool { return rule.ID == id }) {
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+					ID:               id,
+					ShortDescription: sarifText{"Personal data of type " + finding.Type + " in a data file"},
+					Help:             sarifText{"Replace the values by fakes, for example with unaware mask, or exclude the key with -exclude if it holds no real data."},
+				})
+			}
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = result.File
+			if finding.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line}
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    id,
+				Level:     "warning",
+				Message:   sarifText{fmt.Sprintf("%d %s values at %s, first in %s", finding.Count, finding.Type, finding.Path, finding.Location)},
+				Locations: []sarifLocation{location},
+			})
+		}
+	}
+	slices.SortFunc(run.Tool.Driver.Rules, func(a, b sarifRule) int { return strings.Compare(a.ID, b.ID) })
+	return sarif{Schema: "https://json.schemastore.org/sarif-2.1.0.json", Version: "2.1.0", Runs: []sarifRun{run}}
+}
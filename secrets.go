@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"golang.org/x/oauth2/google"
+)
+
+// readSecret reads a salt or key from location, a file or the URI of a
+// secret held by a key manager:
+//
+//	vault://<path>#<field>                field of a secret of HashiCorp Vault
+//	awskms://<key>?ciphertext=<file>      file decrypted with an AWS KMS key
+//	gcpkms://<key name>?ciphertext=<file> file decrypted with a GCP KMS key
+//
+// Vault is reached at VAULT_ADDR with VAULT_TOKEN, or the token the vault CLI
+// stored in ~/.vault-token; paths of KV version 2 secrets include data/, as
+// in vault://secret/data/unaware#salt. AWS credentials are found as the AWS
+// CLI finds them, and GCP ones as gcloud's application default credentials.
+// Ciphertext files hold what aws kms encrypt or gcloud kms encrypt wrote,
+// base64-encoded or not.
+func readSecret(location string) ([]byte, error) {
+	scheme, rest, ok := strings.Cut(location, "://")
+	if !ok {
+		return os.ReadFile(location)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var secret []byte
+	var err error
+	switch scheme {
+	case "vault":
+		secret, err = readVault(ctx, rest)
+	case "awskms":
+		secret, err = decryptAWSKMS(ctx, rest)
+	case "gcpkms":
+		secret, err = decryptGCPKMS(ctx, rest)
+	default:
+		return nil, fmt.Errorf("unsupported secret URI %s, want vault://, awskms:// or gcpkms://", location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return secret, nil
+}
+
+// readVault reads the field of the secret at path#field from Vault.
+func readVault(ctx context.Context, location string) ([]byte, error) {
+	path, field, ok := strings.Cut(location, "#")
+	if !ok || path == "" || field == "" {
+		return nil, errors.New("want vault://<path>#<field>")
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			stored, _ := os.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(stored))
+		}
+	}
+	if token == "" {
+		return nil, errors.New("VAULT_TOKEN is not set and there is no ~/.vault-token")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault answered %s", resp.Status)
+	}
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("cannot decode the answer of vault: %w", err)
+	}
+	// KV version 2 nests the fields of a secret below its metadata.
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]any); ok && data[field] == nil {
+		data = nested
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("the secret has no string field %s", field)
+	}
+	return []byte(value), nil
+}
+
+// splitKMS returns the key and the content of the ciphertext file of a
+// <key>?ciphertext=<file> location, the content decoded if it is base64.
+func splitKMS(location string) (string, []byte, error) {
+	key, query, _ := strings.Cut(location, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil || key == "" || values.Get("ciphertext") == "" {
+		return "", nil, errors.New("want <key>?ciphertext=<file>")
+	}
+	data, err := os.ReadFile(values.Get("ciphertext"))
+	if err != nil {
+		return "", nil, err
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		data = decoded
+	}
+	return key, data, nil
+}
+
+// decryptAWSKMS decrypts the ciphertext file of location with an AWS KMS key,
+// named by its ID, ARN or alias/ name.
+func decryptAWSKMS(ctx context.Context, location string) ([]byte, error) {
+	key, ciphertext, err := splitKMS(location)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load AWS config: %w", err)
+	}
+	out, err := kms.NewFromConfig(cfg).Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: ciphertext, KeyId: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// decryptGCPKMS decrypts the ciphertext file of location with a GCP KMS key,
+// named projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.
+func decryptGCPKMS(ctx context.Context, location string) ([]byte, error) {
+	key, ciphertext, err := splitKMS(location)
+	if err != nil {
+		return nil, err
+	}
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloudkms")
+	if err != nil {
+		return nil, fmt.Errorf("cannot find GCP credentials: %w", err)
+	}
+	body, err := json.Marshal(map[string][]byte{"ciphertext": ciphertext})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://cloudkms.googleapis.com/v1/"+key+":decrypt", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("cloud KMS answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("cannot decode the answer of cloud KMS: %w", err)
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// isSFTP reports whether path is an sftp://[user@]host[:port]/path URL
+// rather than a file.
+func isSFTP(path string) bool {
+	return strings.HasPrefix(path, "sftp://")
+}
+
+// isRemote reports whether path is the URL of an S3 object or an SFTP file,
+// which is streamed rather than written to local disk.
+func isRemote(path string) bool {
+	return isS3(path) || isSFTP(path)
+}
+
+// urlDir returns the URL of the prefix or directory holding the object or
+// file at url, as filepath.Dir would for a file, without collapsing the
+// slashes of s3:// or sftp://.
+func urlDir(url string) string {
+	return url[:strings.LastIndex(url, "/")]
+}
+
+// splitSFTP returns the user@host:port of an sftp:// URL, with the user and
+// port filled in, and the path on the server. Paths are absolute, except
+// those starting with /~/, which are relative to the home directory of the
+// user.
+func splitSFTP(rawURL string) (user, addr, remotePath string, err error) {
+	authority, remotePath, _ := strings.Cut(strings.TrimPrefix(rawURL, "sftp://"), "/")
+	u, err := url.Parse("sftp://" + authority)
+	if err != nil || u.Hostname() == "" {
+		return "", "", "", fmt.Errorf("%s names no host", rawURL)
+	}
+	user = u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	if rest, ok := strings.CutPrefix(remotePath, "~/"); ok {
+		remotePath = rest
+	} else {
+		remotePath = "/" + remotePath
+	}
+	if remotePath == "" || strings.HasSuffix(remotePath, "/") {
+		return "", "", "", fmt.Errorf("%s names no file", rawURL)
+	}
+	return user, net.JoinHostPort(u.Hostname(), port), remotePath, nil
+}
+
+// sftpClients are the connections to the servers of all files, by
+// user@host:port, opened on first use and kept for the run.
+var sftpClients = struct {
+	sync.Mutex
+	byAddr map[string]*sftp.Client
+}{byAddr: make(map[string]*sftp.Client)}
+
+// sftpClient returns the client for the server of the sftp:// URL, and the
+// path of the file on it. Servers are authenticated by ~/.ssh/known_hosts,
+// and users as ssh authenticates them: by the keys of the SSH agent or the
+// default, unencrypted keys of ~/.ssh, or by the password of SFTP_PASSWORD,
+// which is kept out of the URLs printed and logged.
+func sftpClient(ctx context.Context, rawURL string) (*sftp.Client, string, error) {
+	user, addr, remotePath, err := splitSFTP(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	sftpClients.Lock()
+	defer sftpClients.Unlock()
+	if client, ok := sftpClients.byAddr[user+"@"+addr]; ok {
+		return client, remotePath, nil
+	}
+	home, _ := os.UserHomeDir()
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read known hosts: %w", err)
+	}
+	var auth []ssh.AuthMethod
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if password := os.Getenv("SFTP_PASSWORD"); password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	config := &ssh.ClientConfig{User: user, Auth: auth, HostKeyCallback: hostKeys}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, "", fmt.Errorf("%s is not a known host, add its key to ~/.ssh/known_hosts, such as with ssh-keyscan", addr)
+		}
+		return nil, "", err
+	}
+	client, err := sftp.NewClient(ssh.NewClient(sshConn, chans, reqs), sftp.UseConcurrentWrites(true))
+	if err != nil {
+		sshConn.Close()
+		return nil, "", err
+	}
+	sftpClients.byAddr[user+"@"+addr] = client
+	return client, remotePath, nil
+}
+
+// globSFTP returns the URLs of the files matching the shell-style pattern of
+// an sftp:// URL, in name order.
+func globSFTP(ctx context.Context, pattern string) ([]string, error) {
+	client, remotePath, err := sftpClient(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := client.Glob(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no input files match %q", pattern)
+	}
+	prefix := strings.TrimSuffix(pattern, remotePath)
+	urls := make([]string, len(matches))
+	for i, match := range matches {
+		urls[i] = prefix + match
+	}
+	return urls, nil
+}
+
+// openSFTP streams the file at url, and returns its size.
+func openSFTP(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	client, remotePath, err := sftpClient(ctx, url)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := client.Open(remotePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	// Large reads are requested concurrently, which hides the latency of
+	// the link to the server.
+	return struct {
+		io.Reader
+		io.Closer
+	}{bufio.NewReaderSize(f, 1<<20), f}, info.Size(), nil
+}
+
+// sftpWriter writes to a temporary file next to a file on an SFTP server,
+// which replaces the file once Close completes, so a failed run leaves any
+// existing file untouched.
+type sftpWriter struct {
+	client *sftp.Client
+	file   *sftp.File
+	buf    *bufio.Writer
+	path   string
+}
+
+// createSFTP starts writing the file at url.
+func createSFTP(ctx context.Context, url string) (*sftpWriter, error) {
+	client, remotePath, err := sftpClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	dir, name := path.Split(remotePath)
+	if dir != "" {
+		if err := client.MkdirAll(dir); err != nil {
+			return nil, err
+		}
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	f, err := client.Create(dir + "." + name + "." + hex.EncodeToString(suffix) + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &sftpWriter{client: client, file: f, buf: bufio.NewWriterSize(f, 1<<20), path: remotePath}, nil
+}
+
+func (w *sftpWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close writes the rest of the file and renames it over the file at its URL.
+func (w *sftpWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.Abort(err)
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		w.client.Remove(w.file.Name())
+		return err
+	}
+	// Servers without the POSIX rename extension cannot rename over an
+	// existing file.
+	if err := w.client.PosixRename(w.file.Name(), w.path); err != nil {
+		if err := w.client.Rename(w.file.Name(), w.path); err != nil {
+			w.client.Remove(w.file.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort removes the temporary file, leaving the file at its URL as it was.
+func (w *sftpWriter) Abort(error) {
+	w.file.Close()
+	w.client.Remove(w.file.Name())
+}
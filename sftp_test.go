@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSFTP(t *testing.T) {
+	t.Setenv("USER", "operator")
+	tests := []struct {
+		url, user, addr, path string
+	}{
+		{"sftp://partner@files.example.com/exports/customers.csv", "partner", "files.example.com:22", "/exports/customers.csv"},
+		{"sftp://files.example.com:2222/customers.csv", "operator", "files.example.com:2222", "/customers.csv"},
+		{"sftp://partner@files.example.com/~/customers.csv", "partner", "files.example.com:22", "customers.csv"},
+		{"sftp://partner%40corp@files.example.com/customers.csv", "partner@corp", "files.example.com:22", "/customers.csv"},
+		{"sftp://[2001:db8::1]:2222/customers.csv", "operator", "[2001:db8::1]:2222", "/customers.csv"},
+	}
+	for _, tt := range tests {
+		user, addr, remotePath, err := splitSFTP(tt.url)
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.user, user, tt.url)
+		assert.Equal(t, tt.addr, addr, tt.url)
+		assert.Equal(t, tt.path, remotePath, tt.url)
+	}
+
+	_, _, _, err := splitSFTP("sftp:///customers.csv")
+	assert.ErrorContains(t, err, "names no host")
+	_, _, _, err = splitSFTP("sftp://files.example.com/exports/")
+	assert.ErrorContains(t, err, "names no file")
+	_, _, _, err = splitSFTP("sftp://files.example.com")
+	assert.ErrorContains(t, err, "names no file")
+}
+
+func TestURLDir(t *testing.T) {
+	assert.Equal(t, "sftp://files.example.com/exports", urlDir("sftp://files.example.com/exports/customers.csv"))
+	assert.Equal(t, "s3://exports/2024", urlDir("s3://exports/2024/customers.csv"))
+}
+
+func TestSFTP(t *testing.T) {
+	// The client of the server is connected over a pipe, rather than SSH.
+	server, conn := net.Pipe()
+	s, err := sftp.NewServer(server)
+	require.NoError(t, err)
+	go s.Serve()
+	client, err := sftp.NewClientPipe(conn, conn)
+	require.NoError(t, err)
+	sftpClients.Lock()
+	sftpClients.byAddr["partner@files.example.com:22"] = client
+	sftpClients.Unlock()
+	t.Cleanup(func() {
+		sftpClients.Lock()
+		delete(sftpClients.byAddr, "partner@files.example.com:22")
+		sftpClients.Unlock()
+		client.Close()
+		s.Close()
+	})
+	dir := t.TempDir()
+	url := func(name string) string {
+		return "sftp://partner@files.example.com" + filepath.ToSlash(filepath.Join(dir, name))
+	}
+	ctx := context.Background()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "customers.csv"), []byte("email\njane@example.com\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.csv"), []byte("id\n1\n"), 0o644))
+	entries := func(t *testing.T, dir string) []string {
+		names, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var files []string
+		for _, name := range names {
+			files = append(files, name.Name())
+		}
+		return files
+	}
+
+	t.Run("Glob", func(t *testing.T) {
+		urls, err := globSFTP(ctx, url("*.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{url("customers.csv"), url("orders.csv")}, urls)
+		_, err = globSFTP(ctx, url("*.json"))
+		assert.ErrorContains(t, err, "no input files match")
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		r, size, err := openSFTP(ctx, url("customers.csv"))
+		require.NoError(t, err)
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "email\njane@example.com\n", string(data))
+		assert.Equal(t, int64(len(data)), size)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		w, err := createSFTP(ctx, url("masked/customers.csv"))
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "email\ncolby@brekke.biz\n")
+		require.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(dir, "masked", "customers.csv"), "Files appear once they are written")
+		require.NoError(t, w.Close())
+		data, err := os.ReadFile(filepath.Join(dir, "masked", "customers.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, "email\ncolby@brekke.biz\n", string(data))
+		assert.Equal(t, []string{"customers.csv"}, entries(t, filepath.Join(dir, "masked")), "The temporary file is renamed")
+	})
+
+	t.Run("Close over a file", func(t *testing.T) {
+		w, err := createSFTP(ctx, url("orders.csv"))
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "id\n2\n")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		data, err := os.ReadFile(filepath.Join(dir, "orders.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, "id\n2\n", string(data))
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		w, err := createSFTP(ctx, url("customers.csv"))
+		require.NoError(t, err)
+		_, err = io.WriteString(w, "email\n")
+		require.NoError(t, err)
+		w.Abort(errors.New("masking failed"))
+		data, err := os.ReadFile(filepath.Join(dir, "customers.csv"))
+		require.NoError(t, err)
+		assert.Equal(t, "email\njane@example.com\n", string(data), "The file is left as it was")
+		assert.ElementsMatch(t, []string{"customers.csv", "masked", "orders.csv"}, entries(t, dir), "The temporary file is removed")
+	})
+}
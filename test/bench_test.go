@@ -0,0 +1,52 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestGenerateSample(t *testing.T) {
+	shape := pkg.SampleShape{Records: 25, Fields: 12, Depth: 1}
+
+	for _, format := range []string{"json", "ndjson", "csv", "xml", "text"} {
+		t.Run(format, func(t *testing.T) {
+			var first, second bytes.Buffer
+			require.NoError(t, pkg.GenerateSample(&first, format, shape, 7))
+			require.NoError(t, pkg.GenerateSample(&second, format, shape, 7))
+			assert.Equal(t, first.String(), second.String(), "The same seed generates the same input")
+
+			appConfig := pkg.AppConfig{Format: format, CPUCount: 2, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+			_, err := pkg.Start(bytes.NewReader(first.Bytes()), &bytes.Buffer{}, appConfig)
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("Shape", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, pkg.GenerateSample(&buf, "json", shape, 7))
+		var records []map[string]map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &records))
+		require.Len(t, records, 25)
+		fields := records[0]["level_1"]
+		assert.Len(t, fields, 12)
+		assert.Contains(t, fields, "email")
+		assert.Contains(t, fields, "email_2", "Fields after the first ten repeat their types")
+
+		buf.Reset()
+		require.NoError(t, pkg.GenerateSample(&buf, "csv", shape, 7))
+		assert.Equal(t, 26, strings.Count(buf.String(), "\n"), "CSV has a header and a row per record")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, pkg.GenerateSample(&bytes.Buffer{}, "yaml", shape, 7), &configErr)
+		assert.ErrorAs(t, pkg.GenerateSample(&bytes.Buffer{}, "json", pkg.SampleShape{Records: 1}, 7), &configErr)
+	})
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestCreditCardObjectMasking(t *testing.T) {
+	input := `[
+		{"card": {"number": "4111111111111111", "expiry": "2024-03", "cvv": "123"}},
+		{"card": {"number": "4111111111111111", "expiry": "2024-03", "cvv": "123"}}
+	]`
+
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 2,
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodDeterministic,
+			Salt:   []byte("card-salt"),
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	require.Len(t, output, 2)
+
+	card := output[0]["card"]
+	assert.NotEqual(t, "4111111111111111", card["number"])
+
+	expiry, err := time.Parse("2006-01", card["expiry"])
+	require.NoError(t, err, "Expiry should keep the YYYY-MM layout")
+	assert.True(t, expiry.After(pkg.Now()), "Expiry should be in the future")
+
+	expectedCVVLength := 3
+	if strings.HasPrefix(card["number"], "34") || strings.HasPrefix(card["number"], "37") {
+		expectedCVVLength = 4
+	}
+	assert.Regexp(t, `^\d+$`, card["cvv"])
+	assert.Len(t, card["cvv"], expectedCVVLength, "CVV length should match the card brand")
+
+	assert.Equal(t, output[0], output[1], "Identical cards should mask to identical card objects")
+}
+
+func TestCreditCardObjectMasking_CSVWithExclude(t *testing.T) {
+	input := `name,card_number,exp,cvc
+Alice,4111111111111111,12/25,123`
+
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		Exclude:  []string{"cvc"},
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	assert.NotEqual(t, "4111111111111111", records[1][1])
+	expiry, err := time.Parse("01/06", records[1][2])
+	require.NoError(t, err, "Expiry should keep the MM/YY layout")
+	assert.True(t, expiry.After(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "123", records[1][3], "Excluded CVV should be preserved")
+}
@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfig_MasksWithPolicyFromFile(t *testing.T) {
+	path := writeConfig(t, `
+format: csv
+method: deterministic
+exclude: [country]
+rules:
+  - pattern: ssn
+    method: "null"
+  - pattern: mobile
+    type: email
+`)
+	config, err := pkg.LoadConfig(path)
+	require.NoError(t, err)
+	appConfig, err := config.AppConfig()
+	require.NoError(t, err)
+	appConfig.CPUCount = 1
+	appConfig.Masker.Salt = []byte("config-test")
+
+	input := "name,ssn,mobile,country\nAlice,123-45-6789,31612345678,NL\n"
+	run := func() [][]string {
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		return records
+	}
+
+	records := run()
+	assert.Equal(t, []string{"name", "ssn", "mobile", "country"}, records[0])
+	assert.NotEqual(t, "Alice", records[1][0])
+	assert.Empty(t, records[1][1], "ssn rule removes the value")
+	assert.Contains(t, records[1][2], "@", "type overrides the detected number")
+	assert.Equal(t, "NL", records[1][3], "excluded column stays as is")
+	assert.Equal(t, records, run(), "deterministic method from the file")
+}
+
+func TestConfig_RejectsUnknownKeys(t *testing.T) {
+	_, err := pkg.LoadConfig(writeConfig(t, "formt: csv\n"))
+	assert.ErrorContains(t, err, "formt")
+}
+
+func TestConfig_RejectsInvalidPolicies(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown type":      "rules:\n  - pattern: id\n    type: passport\n",
+		"type and regex":    "rules:\n  - pattern: id\n    type: uuid\n    regex: '(\\d+)'\n    replacement: x\n",
+		"shuffle non-csv":   "format: json\nshuffle: [salary]\n",
+		"cdata non-xml":     "format: json\ncdata_markup: true\n",
+		"columns header":    "format: csv\ncolumns: [id, name]\n",
+		"delimiter non-csv": "format: json\ndelimiter: ';'\n",
+		"long delimiter":    "format: csv\ndelimiter: ';;'\n",
+		"quote delimiter":   "format: csv\ndelimiter: \"'\"\nquote: \"'\"\n",
+		"unknown method":    "method: scramble\n",
+		"invalid range":     "ranges:\n  - pattern: age\n    min: 99\n    max: 18\n",
+		"k without quasis":  "format: csv\nk_anonymity: 5\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			config, err := pkg.LoadConfig(writeConfig(t, content))
+			require.NoError(t, err)
+			appConfig, err := config.AppConfig()
+			if err == nil {
+				_, err = pkg.Start(strings.NewReader("{}"), &bytes.Buffer{}, appConfig)
+			}
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConfig_Profiles(t *testing.T) {
+	config, err := pkg.LoadConfig(writeConfig(t, `
+format: csv
+method: deterministic
+unique: true
+rules:
+  - pattern: ssn
+    method: "null"
+profiles:
+  analytics: {}
+  vendor-export:
+    method: "null"
+    salt_env: VENDOR_SALT
+    fpe_key_file: vault://secret/data/vendor#fpe_key
+    rules:
+      - pattern: name
+        method: random
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"analytics", "vendor-export"}, config.ProfileNames())
+
+	analytics, err := config.Profile("analytics")
+	require.NoError(t, err)
+	assert.Equal(t, "deterministic", analytics.Method)
+	assert.Len(t, analytics.Rules, 1)
+
+	vendor, err := config.Profile("vendor-export")
+	require.NoError(t, err)
+	assert.Equal(t, "csv", vendor.Format, "keys the profile does not set are kept")
+	assert.True(t, vendor.Unique)
+	assert.Equal(t, "null", vendor.Method)
+	assert.Equal(t, "VENDOR_SALT", vendor.SaltEnv)
+	assert.Equal(t, "vault://secret/data/vendor#fpe_key", vendor.FPEKeyFile)
+	require.Len(t, vendor.Rules, 1, "lists replace those of the file")
+	assert.Equal(t, "name", vendor.Rules[0].Pattern)
+	assert.Len(t, config.Rules, 1, "the file itself is unchanged")
+	assert.Empty(t, config.SaltEnv)
+
+	appConfig, err := vendor.AppConfig()
+	require.NoError(t, err)
+	appConfig.CPUCount = 1
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader("name,ssn\nAlice,123-45-6789\n"), &buf, appConfig)
+	require.NoError(t, err)
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.NotEqual(t, "Alice", records[1][0])
+	assert.NotEmpty(t, records[1][0])
+	assert.Empty(t, records[1][1])
+
+	_, err = config.Profile("dev-share")
+	assert.ErrorContains(t, err, "analytics, vendor-export")
+}
+
+func TestConfig_RejectsInvalidProfiles(t *testing.T) {
+	_, err := pkg.LoadConfig(writeConfig(t, "profiles:\n  dev:\n    formt: csv\n"))
+	assert.ErrorContains(t, err, "formt")
+
+	_, err = pkg.LoadConfig(writeConfig(t, "profiles:\n  dev:\n    profiles:\n      nested: {}\n"))
+	assert.ErrorContains(t, err, "cannot hold profiles")
+}
+
+func TestStartErrorKinds(t *testing.T) {
+	appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+
+	invalid := appConfig
+	invalid.Include = []string{"user.[a"}
+	var configErr *pkg.ConfigError
+	_, err := pkg.Start(strings.NewReader(`{}`), &bytes.Buffer{}, invalid)
+	assert.ErrorAs(t, err, &configErr)
+
+	var inputErr *pkg.InputError
+	_, err = pkg.Start(strings.NewReader(`{"user": `), &bytes.Buffer{}, appConfig)
+	assert.ErrorAs(t, err, &inputErr)
+	_, err = pkg.Start(strings.NewReader(`{"user": "jan"}`), &bytes.Buffer{}, appConfig)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// cancelingReader cancels a context once more than limit bytes were read.
+type cancelingReader struct {
+	r      io.Reader
+	limit  int
+	read   int
+	cancel context.CancelFunc
+}
+
+func (c *cancelingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p[:min(len(p), 512)])
+	if c.read += n; c.read > c.limit {
+		c.cancel()
+	}
+	return n, err
+}
+
+func TestStartContext(t *testing.T) {
+	for _, format := range []string{"json", "ndjson", "csv", "xml", "text"} {
+		t.Run(format, func(t *testing.T) {
+			var input bytes.Buffer
+			require.NoError(t, pkg.GenerateSample(&input, format, pkg.SampleShape{Records: 2000, Fields: 5}, 1))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			appConfig := pkg.AppConfig{Format: format, CPUCount: 2, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+
+			var out bytes.Buffer
+			r := &cancelingReader{r: &input, limit: input.Len() / 4, cancel: cancel}
+			_, err := pkg.StartContext(ctx, r, &out, appConfig)
+			assert.ErrorIs(t, err, context.Canceled)
+			var inputErr *pkg.InputError
+			assert.NotErrorAs(t, err, &inputErr, "Canceling is not a problem of the input")
+			assert.Less(t, r.read, input.Len(), "Reading stops once canceled")
+		})
+	}
+
+	t.Run("Canceled before the start", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+		var out bytes.Buffer
+		_, err := pkg.StartContext(ctx, strings.NewReader(`[{"a": "b"}]`), &out, appConfig)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, out.String())
+	})
+}
@@ -3,8 +3,10 @@ package test
 import (
 	"bytes"
 	"encoding/csv"
+	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,7 +30,7 @@ func TestCSVProcessing_Deterministic(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
 	require.NoError(t, err)
 
 	output := buf.String()
@@ -71,7 +73,7 @@ func TestCSVProcessing_WithInclude(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
 	require.NoError(t, err)
 
 	output := buf.String()
@@ -115,7 +117,7 @@ func TestCSVProcessing_WithExclude(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
 	require.NoError(t, err)
 
 	output := buf.String()
@@ -140,6 +142,168 @@ func TestCSVProcessing_WithExclude(t *testing.T) {
 	assert.Equal(t, "some notes", records[1][4])              // Preserved
 }
 
+func TestCSVProcessing_NoHeader(t *testing.T) {
+	input := "a1,Alice,keep,31612345678\na2,Bob,keep,31687654321\n"
+	rules, err := pkg.ParseTypeRule("col:4=email")
+	require.NoError(t, err)
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		NoHeader: true,
+		Include:  []string{"col:2"},
+		Rules:    []pkg.Rule{rules},
+		Shuffle:  []string{"col:1"},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2, "No header should be added")
+	assert.ElementsMatch(t, []string{"a1", "a2"}, []string{records[0][0], records[1][0]}, "Shuffled columns are addressed by position")
+	for i, original := range []string{"Alice", "Bob"} {
+		assert.NotEqual(t, original, records[i][1], "The first row is data and is masked too")
+		assert.Equal(t, "keep", records[i][2])
+		assert.Contains(t, records[i][3], "@")
+	}
+}
+
+func TestCSVProcessing_Columns(t *testing.T) {
+	input := "a1,Alice,keep,31612345678\na2,Bob,keep,31687654321\n"
+	rules, err := pkg.ParseTypeRule("mobile=email")
+	require.NoError(t, err)
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		NoHeader: true,
+		Columns:  []string{"id", "name"},
+		Include:  []string{"name"},
+		Rules:    []pkg.Rule{rules},
+		Shuffle:  []string{"id"},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2, "The names are not written as a header")
+	assert.ElementsMatch(t, []string{"a1", "a2"}, []string{records[0][0], records[1][0]}, "Shuffled columns are addressed by name")
+	for i, original := range []string{"Alice", "Bob"} {
+		assert.NotEqual(t, original, records[i][1], "Included columns are addressed by name")
+		assert.Equal(t, "keep", records[i][2])
+		assert.NotContains(t, records[i][3], "@", "Names are not given to columns beyond the last")
+	}
+
+	appConfig.Rules = nil
+	appConfig.Include = []string{"col:4"}
+	buf.Reset()
+	_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+	records, err = csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", records[0][1])
+	assert.NotEqual(t, "31612345678", records[0][3], "Columns beyond the last name keep their position")
+
+	t.Run("Errors", func(t *testing.T) {
+		for name, columns := range map[string][]string{
+			"too many":   {"id", "name", "notes", "mobile", "extra"},
+			"duplicate":  {"id", "id"},
+			"positional": {"col:4", "name"},
+		} {
+			config := appConfig
+			config.Columns, config.Shuffle = columns, nil
+			_, err := pkg.Start(strings.NewReader(input), io.Discard, config)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestCSVProcessing_Dialect(t *testing.T) {
+	input := "name;email;note\n# exported 2024-01-01\n'De Vries; Jan';jan@example.com;'it''s \"ok\"'\nPiet;piet@example.com;#1\n'#2';x@example.com;\n"
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 2,
+		Include:  []string{"email"},
+		CSV:      pkg.CSVDialect{Delimiter: ';', Quote: '\'', Comment: '#'},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+	output := buf.String()
+	assert.NotContains(t, output, "exported", "Comments are skipped")
+	assert.Contains(t, output, "'De Vries; Jan';", "Fields are quoted with the quote of the input")
+	assert.Contains(t, output, ";'it''s \"ok\"'\n", "Quotes of the dialect are doubled, and double quotes are not")
+	assert.Contains(t, output, "\n'#2';", "First fields starting with the comment are quoted")
+
+	lines := strings.Split(output, "\n")
+	require.Len(t, lines, 5)
+	assert.Regexp(t, `^Piet;[^;]+@[^;]+;#1$`, lines[2], "Fields that are not the first of a row can start with the comment")
+
+	t.Run("Errors", func(t *testing.T) {
+		appConfig := pkg.AppConfig{Format: "csv", CPUCount: 1, Exclude: []string{"a"}, CSV: pkg.CSVDialect{Quote: '\''}}
+		_, err := pkg.Start(strings.NewReader("a,b\n'x'y,z\n"), io.Discard, appConfig)
+		assert.ErrorContains(t, err, "extraneous or missing ' in quoted-field", "Errors tell the quote of the dialect")
+
+		appConfig.CSV.LazyQuotes = true
+		var buf bytes.Buffer
+		_, err = pkg.Start(strings.NewReader("a,b\nx'y,z\n"), &buf, appConfig)
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "'x''y',", "Lazy quotes are read as part of the field")
+
+		for _, dialect := range []pkg.CSVDialect{{Quote: ','}, {Quote: 'é'}, {Delimiter: '\n'}, {Comment: ','}} {
+			_, err := pkg.Start(strings.NewReader("a\n"), io.Discard, pkg.AppConfig{Format: "csv", CSV: dialect})
+			var configErr *pkg.ConfigError
+			assert.ErrorAs(t, err, &configErr, "%+v is invalid", dialect)
+		}
+	})
+}
+
+func TestCSVProcessing_Layout(t *testing.T) {
+	long := strings.Repeat("x", 200_000)
+	input := "id,\"name\",note\r\n" +
+		"\"1\",Jan,\"first line\r\nsays \"\"hi\"\"\"\r\n" +
+		"2,\"\",\"" + long + "\"\n" +
+		"3,Piet, spaced"
+	run := func(r io.Reader, include ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		_, err := pkg.Start(r, &buf, pkg.AppConfig{
+			Format:   "csv",
+			CPUCount: 2,
+			Include:  include,
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+		})
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	assert.Equal(t, input, run(strings.NewReader(input), "nothing"), "Rows keep their quotes and line endings")
+	assert.Equal(t, input, run(iotest.OneByteReader(strings.NewReader(input)), "nothing"), "Rows are read as the input arrives")
+
+	output := run(strings.NewReader(input), "name", "note")
+	lines := strings.Split(output, "\r\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, `id,"name",note`, lines[0])
+	assert.Regexp(t, `^"1",[^",]+,"[^\n]+$`, lines[1], "Masked fields keep their quotes")
+	assert.Regexp(t, `^[^"]+ ""[^"]+"""$`, lines[2], "Quotes and line endings in masked text are kept")
+	assert.True(t, strings.HasPrefix(lines[3], `2,"","`))
+	assert.NotContains(t, output, "Jan")
+	assert.Regexp(t, `\n3,[^",\n]+,[^",\n]+$`, output, "A row ending the input without a line ending is written without one")
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader("a\n1\n2\n"), &buf, pkg.AppConfig{Format: "csv", CPUCount: 1, Masker: pkg.MaskerConfig{Method: pkg.MethodNull}})
+	require.NoError(t, err)
+	assert.Equal(t, "a\n\"\"\n\"\"\n", buf.String(), "Rows of an empty field are quoted, so they are not read as empty lines")
+}
+
 func TestEmptyReader_CSV(t *testing.T) {
 	appConfig := pkg.AppConfig{
 		Format:   "csv",
@@ -150,7 +314,7 @@ func TestEmptyReader_CSV(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(""), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(""), &buf, appConfig)
 	require.NoError(t, err)
 	assert.Equal(t, "", buf.String())
 }
@@ -165,6 +329,6 @@ func TestReaderError_CSV(t *testing.T) {
 		},
 	}
 	var buf bytes.Buffer
-	err := pkg.Start(errorReader, &buf, appConfig)
+	_, err := pkg.Start(errorReader, &buf, appConfig)
 	require.Error(t, err)
 }
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func init() {
+	if err := pkg.RegisterMasker("test-employee-id", func(value any, faker *gofakeit.Faker) any {
+		return fmt.Sprintf("EMP-%06d", faker.Number(0, 999999))
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestCustomMasker_FieldMethod(t *testing.T) {
+	input := `employee_id,name
+E-1,Alice
+E-2,Bob
+E-1,Carol`
+
+	rule, err := pkg.ParseMethodRule("employee_id=test-employee-id")
+	require.NoError(t, err)
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 2,
+		Rules:    []pkg.Rule{rule},
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+			Salt:   []byte("custom-salt"),
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	for _, record := range records[1:] {
+		assert.Regexp(t, `^EMP-\d{6}$`, record[0])
+	}
+	assert.Equal(t, records[1][0], records[3][0], "Identical ids should get identical fakes when a salt is set")
+	assert.NotEqual(t, "Alice", records[1][1], "Other columns should use the global method")
+}
+
+func TestCustomMasker_Registration(t *testing.T) {
+	config, err := pkg.ParseMethod("test-employee-id")
+	require.NoError(t, err)
+	assert.Equal(t, pkg.MaskingMethod("test-employee-id"), config.Method)
+
+	_, err = pkg.ParseMethod("test-employee-id:6")
+	assert.ErrorContains(t, err, "does not take options")
+
+	mask := func(value any, faker *gofakeit.Faker) any { return value }
+	assert.ErrorContains(t, pkg.RegisterMasker("test-employee-id", mask), "already registered")
+	assert.ErrorContains(t, pkg.RegisterMasker("hash", mask), "built-in")
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestDetectors_ExamplesAreDetected(t *testing.T) {
+	for _, detector := range pkg.Detectors() {
+		text, ok := detector.Example.(string)
+		if !ok {
+			continue // JSON numbers and booleans
+		}
+		// Names are recognized by their key, other types by their value.
+		column := "value"
+		if detector.Type == "name" || detector.Type == "first_name" || detector.Type == "last_name" {
+			column = detector.Type
+		}
+		var sample bytes.Buffer
+		w := csv.NewWriter(&sample)
+		require.NoError(t, w.WriteAll([][]string{{column}, {text}}))
+		fields, err := pkg.InspectSample(&sample, "csv")
+		require.NoError(t, err)
+		require.Len(t, fields, 1)
+		assert.Equal(t, detector.Type, fields[0].Type, "Example %q", text)
+	}
+}
+
+func TestMaskExample(t *testing.T) {
+	salt := []byte("salt")
+	masked, err := pkg.MaskExample(pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: salt}, "email", "jane.doe@example.com")
+	require.NoError(t, err)
+	again, err := pkg.MaskExample(pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: salt}, "email", "jane.doe@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, masked, again)
+	assert.Contains(t, masked, "@")
+
+	masked, err = pkg.MaskExample(pkg.MaskerConfig{Method: pkg.MethodPartial, Partial: pkg.PartialConfig{KeepLast: 2}}, "number", json.Number("1234"))
+	require.NoError(t, err)
+	assert.Equal(t, "**34", masked)
+
+	_, err = pkg.MaskExample(pkg.MaskerConfig{Method: pkg.MethodRandom}, "zodiac", "Leo")
+	assert.Error(t, err)
+}
+
+func TestDetect(t *testing.T) {
+	for _, detector := range pkg.Detectors() {
+		text, ok := detector.Example.(string)
+		if !ok || detector.Type == "name" || detector.Type == "first_name" || detector.Type == "last_name" {
+			continue // JSON values and names, which are recognized by their key
+		}
+		kind, confidence := pkg.Detect(text)
+		assert.Equal(t, detector.Type, kind, "Example %q", text)
+		assert.Equal(t, detector.Confidence, confidence)
+	}
+	kind, confidence := pkg.Detect(" ")
+	assert.Equal(t, "empty", kind)
+	assert.Equal(t, 1.0, confidence)
+	_, textConfidence := pkg.Detect("Call me")
+	_, emailConfidence := pkg.Detect("jane@example.com")
+	assert.Less(t, textConfidence, emailConfidence)
+}
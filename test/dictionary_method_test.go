@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestDictionaryMethod_List(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "companies.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Acme Corp\nGlobex\n\nInitech\n"), 0o644))
+
+	input := `id,company
+1,Umbrella
+2,Cyberdyne
+3,Umbrella`
+	maskerConfig, err := pkg.ParseMethod("dictionary:" + path)
+	require.NoError(t, err)
+	maskerConfig.Salt = []byte("dictionary-salt")
+	appConfig := pkg.AppConfig{Format: "csv", CPUCount: 2, Include: []string{"company"}, Masker: maskerConfig}
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	for _, record := range records[1:] {
+		assert.Contains(t, []string{"Acme Corp", "Globex", "Initech"}, record[1])
+	}
+	assert.Equal(t, records[1][1], records[3][1], "Identical values should get identical replacements")
+	assert.Equal(t, "1", records[1][0])
+}
+
+func TestDictionaryMethod_Mapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.csv")
+	require.NoError(t, os.WriteFile(path, []byte("Alice,Jane Roe\nBob,John Doe\n"), 0o644))
+
+	input := `[{"name": "Alice"}, {"name": "Bob"}, {"name": "Carol"}]`
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodDictionary, DictionaryFile: path},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+	output := buf.String()
+	assert.Contains(t, output, `"Jane Roe"`)
+	assert.Contains(t, output, `"John Doe"`)
+	assert.NotContains(t, output, "Carol", "Unmapped values should be replaced by one of the fakes")
+
+	appConfig.Masker.DictionaryFile = filepath.Join(t.TempDir(), "missing.txt")
+	_, err = pkg.Start(strings.NewReader(input), &bytes.Buffer{}, appConfig)
+	assert.Error(t, err)
+}
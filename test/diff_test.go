@@ -0,0 +1,48 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		original := `[{"id": 1, "email": "jane@example.com", "items": [{"sku": "A1"}, {"sku": "B2"}]}, {"id": 2, "email": "bob@example.com", "items": []}]`
+		masked := `[{"id": 1, "email": "kim@example.org", "items": [{"sku": "A1"}, {"sku": "Z9"}]}, {"id": 2, "items": []}]`
+		report, err := pkg.Diff(strings.NewReader(original), strings.NewReader(masked), "json", false)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Records)
+		assert.Equal(t, []pkg.Change{
+			{Record: 1, Path: "email", Original: `"jane@e…"`, Masked: `"kim@ex…"`},
+			{Record: 1, Path: "items[1].sku", Original: `"B2"`, Masked: `"Z9"`},
+			{Record: 2, Path: "email", Original: `"bob@ex…"`},
+		}, report.Changes)
+		assert.Equal(t, []pkg.FieldDiff{
+			{Path: "email", Values: 2, Changed: 2},
+			{Path: "id", Values: 2, Changed: 0},
+			{Path: "items.sku", Values: 2, Changed: 1},
+		}, report.Fields)
+	})
+
+	t.Run("CSV hashed", func(t *testing.T) {
+		original := "name,city\nJane Doe,Utrecht\nJane Doe,Delft\n"
+		masked := "name,city\nKim Roe,Utrecht\nKim Roe,Delft\n"
+		report, err := pkg.Diff(strings.NewReader(original), strings.NewReader(masked), "csv", true)
+		require.NoError(t, err)
+		require.Len(t, report.Changes, 2)
+		assert.Equal(t, report.Changes[0], pkg.Change{Record: 1, Path: "name", Original: report.Changes[1].Original, Masked: report.Changes[1].Masked}, "Equal values hash the same")
+		assert.True(t, strings.HasPrefix(report.Changes[0].Original, "sha256:"))
+		assert.NotContains(t, report.Changes[0].Original, "Jane")
+	})
+
+	t.Run("Different records", func(t *testing.T) {
+		_, err := pkg.Diff(strings.NewReader("{\"a\": 1}\n{\"a\": 2}\n"), strings.NewReader("{\"a\": 1}\n"), "ndjson", false)
+		var inputErr *pkg.InputError
+		assert.ErrorAs(t, err, &inputErr)
+	})
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestFieldMaskers(t *testing.T) {
+	employeeID := func(value any, faker *gofakeit.Faker) any {
+		return "EMP-" + faker.DigitN(4)
+	}
+	redact := func(value any, faker *gofakeit.Faker) any { return "[redacted]" }
+
+	t.Run("JSON", func(t *testing.T) {
+		appConfig := pkg.AppConfig{
+			Format:       "json",
+			CPUCount:     2,
+			Exclude:      []string{"team"},
+			FieldMaskers: map[string]pkg.MaskFunc{"**.employee_id": employeeID, "team": redact},
+			Masker:       pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+		}
+		input := `[{"employee_id": "A-17", "team": "ops", "manager": {"employee_id": "A-17"}, "email": "jane@example.com"}]`
+		var out bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &out, appConfig)
+		require.NoError(t, err)
+		var records []map[string]any
+		require.NoError(t, json.Unmarshal(out.Bytes(), &records))
+		record := records[0]
+		assert.Regexp(t, `^EMP-\d{4}$`, record["employee_id"])
+		assert.Equal(t, record["employee_id"], record["manager"].(map[string]any)["employee_id"], "Seeded as the global method is")
+		assert.Equal(t, "ops", record["team"], "Excluded keys are never masked")
+		assert.NotEqual(t, "jane@example.com", record["email"])
+		assert.Contains(t, record["email"], "@", "Other fields are masked by the engine")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		appConfig := pkg.AppConfig{
+			Format:       "csv",
+			CPUCount:     1,
+			FieldMaskers: map[string]pkg.MaskFunc{"note": redact},
+			Masker:       pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		var out bytes.Buffer
+		_, err := pkg.Start(strings.NewReader("note\nCall Jane\n"), &out, appConfig)
+		require.NoError(t, err)
+		assert.Equal(t, "note\n[redacted]\n", out.String())
+	})
+
+	t.Run("Without a function", func(t *testing.T) {
+		appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, FieldMaskers: map[string]pkg.MaskFunc{"a": nil}, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+		var configErr *pkg.ConfigError
+		_, err := pkg.Start(strings.NewReader(`{}`), &bytes.Buffer{}, appConfig)
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestFieldMethods(t *testing.T) {
+	input := `[
+		{"customer_id": "C-1001", "ssn": "123-45-6789", "card": {"number": "4111111111111111", "cvv": "123"}, "notes": "call back"},
+		{"customer_id": "C-1001", "ssn": "987-65-4321", "card": {"number": "4111111111111111", "cvv": "123"}, "notes": "call back"}
+	]`
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 2,
+		Rules: []pkg.Rule{
+			{Pattern: "customer_id", Method: "deterministic"},
+			{Pattern: "ssn", Method: "null"},
+			{Pattern: "card.number", Method: "partial:last4"},
+		},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodRandom, Salt: []byte("field-salt")},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	require.Len(t, output, 2)
+
+	assert.NotEqual(t, "C-1001", output[0]["customer_id"])
+	assert.Equal(t, output[0]["customer_id"], output[1]["customer_id"], "Deterministic fields should be consistent")
+	assert.Nil(t, output[0]["ssn"])
+	assert.Nil(t, output[1]["ssn"])
+	card := output[0]["card"].(map[string]any)
+	assert.Equal(t, "************1111", card["number"])
+	assert.Regexp(t, `^\d{3}$`, card["cvv"])
+	assert.NotEqual(t, "call back", output[0]["notes"], "Other fields should use the global method")
+
+	// Deterministic field values match a fully deterministic run with the same salt.
+	appConfig.Rules = nil
+	appConfig.Include = []string{"customer_id"}
+	appConfig.Masker.Method = pkg.MethodDeterministic
+	var deterministic bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &deterministic, appConfig)
+	require.NoError(t, err)
+	var expected []map[string]any
+	require.NoError(t, json.Unmarshal(deterministic.Bytes(), &expected))
+	assert.Equal(t, expected[0]["customer_id"], output[0]["customer_id"])
+}
+
+func TestFieldMethods_Invalid(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Rules:    []pkg.Rule{{Pattern: "ssn", Method: "redact"}},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+	_, err := pkg.Start(strings.NewReader(`{"ssn": "x"}`), &bytes.Buffer{}, appConfig)
+	assert.Error(t, err)
+
+	rule, err := pkg.ParseMethodRule("ssn=null")
+	require.NoError(t, err)
+	assert.Equal(t, pkg.Rule{Pattern: "ssn", Method: "null"}, rule)
+}
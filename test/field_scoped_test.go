@@ -0,0 +1,51 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestFieldScopedSeeding(t *testing.T) {
+	input := `[
+		{"phone": "+31 20 123 4567", "fax": "+31 20 123 4567", "user_id": "u-1234567890"},
+		{"phone": "+31 20 123 4567", "fax": "+31 20 123 4567", "user_id": "u-1234567890"}
+	]`
+
+	run := func(method pkg.MaskingMethod, fieldScoped bool) []map[string]string {
+		appConfig := pkg.AppConfig{
+			Format:   "json",
+			CPUCount: 2,
+			Masker: pkg.MaskerConfig{
+				Method:      method,
+				Salt:        []byte("scope-salt"),
+				FieldScoped: fieldScoped,
+			},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		var output []map[string]string
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+		require.Len(t, output, 2)
+		return output
+	}
+
+	unscoped := run(pkg.MethodDeterministic, false)
+	assert.Equal(t, unscoped[0]["phone"], unscoped[0]["fax"], "Without scoping equal values should get equal fakes")
+
+	scoped := run(pkg.MethodDeterministic, true)
+	assert.NotEqual(t, scoped[0]["phone"], scoped[0]["fax"], "Equal values under different keys should get different fakes")
+	assert.Equal(t, scoped[0], scoped[1], "Fakes should stay stable per field")
+	assert.Equal(t, scoped, run(pkg.MethodDeterministic, true), "Fakes should stay stable across runs")
+
+	hashed := run(pkg.MethodHash, true)
+	assert.NotEqual(t, hashed[0]["phone"], hashed[0]["fax"], "Hashes should be keyed on the field too")
+	assert.Equal(t, hashed[0], hashed[1])
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestFieldTypes(t *testing.T) {
+	input := `[{"mobile": 31612345678, "contact": "x1", "holder": "Doe, Jane", "given": "J", "account": "12345", "note": "call back"}]`
+	var rules []pkg.Rule
+	for _, spec := range []string{"mobile=phone", "contact=name", "holder=name", "given=first_name", "account=iban", "note=email"} {
+		rule, err := pkg.ParseTypeRule(spec)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Rules:    rules,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("type-salt")},
+	}
+
+	run := func() map[string]any {
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		var output []map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+		require.Len(t, output, 1)
+		return output[0]
+	}
+
+	output := run()
+	assert.NotEqual(t, float64(31612345678), output["mobile"])
+	assert.Regexp(t, `^[A-Z][a-z]+ [A-Z][a-z]+$`, output["contact"])
+	assert.Regexp(t, `^[A-Z][a-z]+, [A-Z][a-z]+$`, output["holder"], "Full names keep the order of the original")
+	assert.Regexp(t, `^[A-Z][a-z]+$`, output["given"])
+	assert.Regexp(t, `^[A-Z]{2}\d{2}[A-Z0-9]+$`, output["account"])
+	assert.Contains(t, output["note"], "@")
+	assert.Equal(t, output, run(), "Typed fields are deterministic")
+
+	// Methods that do not generate fakes ignore the type.
+	appConfig.Masker = pkg.MaskerConfig{Method: pkg.MethodNull}
+	output = run()
+	assert.Nil(t, output["contact"])
+	assert.Nil(t, output["account"])
+}
+
+func TestFieldTypes_Invalid(t *testing.T) {
+	_, err := pkg.ParseTypeRule("mobile")
+	assert.Error(t, err)
+
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Rules:    []pkg.Rule{{Pattern: "id", Type: "passport"}},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+	_, err = pkg.Start(strings.NewReader(`{}`), &bytes.Buffer{}, appConfig)
+	assert.ErrorContains(t, err, "first_name")
+}
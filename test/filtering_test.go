@@ -2,10 +2,12 @@ package test
 
 import (
 	"bytes"
+	"encoding/json"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"unaware/pkg"
 )
@@ -66,12 +68,12 @@ func TestFilteringScenarios(t *testing.T) {
 			format: "json",
 			input:  jsonInput,
 			expected: []string{
-				`"id": "chapter"`,
-				`"name": "Cute His"`,
-				`"email": "clevelandsenger@sawayn.io"`,
-				`"last_login": "2023-01-26T11:37:04Z"`,
-				`"ip_address": "113.186.161.194"`,
-				`"transaction_id": "without"`,
+				`"id": "some"`,
+				`"name": "Consequently Empty"`,
+				`"email": "jordangoyette@bailey.io"`,
+				`"last_login": "2022-10-27T00:51:55Z"`,
+				`"ip_address": "78.247.141.11"`,
+				`"transaction_id": "as"`,
 			},
 			notExpected: []string{
 				`"id": "user-123"`,
@@ -86,8 +88,8 @@ func TestFilteringScenarios(t *testing.T) {
 			expected: []string{
 				`"id": "user-123"`,
 				`"ip_address": "203.0.113.195"`,
-				`"name": "Cute His"`,
-				`"transaction_id": "without"`,
+				`"name": "Consequently Empty"`,
+				`"transaction_id": "as"`,
 			},
 		},
 		{
@@ -96,8 +98,8 @@ func TestFilteringScenarios(t *testing.T) {
 			include: []string{"user.personal.*"},
 			expected: []string{
 				`"id": "user-123"`,
-				`"name": "Cute His"`,
-				`"email": "clevelandsenger@sawayn.io"`,
+				`"name": "Consequently Empty"`,
+				`"email": "jordangoyette@bailey.io"`,
 				`"ip_address": "203.0.113.195"`,
 			},
 		},
@@ -109,7 +111,7 @@ func TestFilteringScenarios(t *testing.T) {
 			exclude: []string{"user.id", "user.metadata.last_login"},
 			expected: []string{
 				`"id": "user-123"`,
-				`"name": "Cute His"`,
+				`"name": "Consequently Empty"`,
 				`"last_login": "2023-10-27T10:00:00Z"`,
 				`"transaction_id": "txn-abc-456"`,
 			},
@@ -120,11 +122,11 @@ func TestFilteringScenarios(t *testing.T) {
 			format: "xml",
 			input:  xmlInput,
 			expected: []string{
-				`<user id="constantly">`,
-				`<name>Finally His</name>`,
-				`<email>alfredofritsch@dickinson.net</email>`,
-				`<last_login>2023-01-13T21:11:17Z</last_login>`, `<ip_address>238.108.102.226</ip_address>`,
-				`<transaction_id>her</transaction_id>`,
+				`<user id="mine">`,
+				`<name>From Empty</name>`,
+				`<email>raegutkowski@schmeler.com</email>`,
+				`<last_login>2022-03-25T10:23:43Z</last_login>`, `<ip_address>195.37.63.208</ip_address>`,
+				`<transaction_id>straightaway</transaction_id>`,
 			},
 		},
 		{
@@ -135,7 +137,7 @@ func TestFilteringScenarios(t *testing.T) {
 			expected: []string{
 				`<user id="user-xyz">`, // Not masked
 				`<name>Jane Doe</name>`,
-				`<email>alfredofritsch@dickinson.net</email>`,
+				`<email>raegutkowski@schmeler.com</email>`,
 			},
 		},
 		{
@@ -145,8 +147,8 @@ func TestFilteringScenarios(t *testing.T) {
 			include: []string{"root.user.metadata.*"},
 			expected: []string{
 				`<name>Jane Doe</name>`,
-				`<last_login>2023-01-13T21:11:17Z</last_login>`,
-				`<ip_address>238.108.102.226</ip_address>`,
+				`<last_login>2022-03-25T10:23:43Z</last_login>`,
+				`<ip_address>195.37.63.208</ip_address>`,
 			},
 		},
 		{
@@ -157,7 +159,7 @@ func TestFilteringScenarios(t *testing.T) {
 			exclude: []string{"root.user.id", "root.user.metadata.ip_address"},
 			expected: []string{
 				`<user id="user-xyz">`,
-				`<name>Finally His</name>`,
+				`<name>From Empty</name>`,
 				`<ip_address>198.51.100.22</ip_address>`,
 				`<transaction_id>txn-def-789</transaction_id>`,
 			},
@@ -175,7 +177,7 @@ func TestFilteringScenarios(t *testing.T) {
 			}
 
 			var buf bytes.Buffer
-			err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
+			_, err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
 			require.NoError(t, err)
 
 			output := buf.String()
@@ -188,3 +190,138 @@ func TestFilteringScenarios(t *testing.T) {
 		})
 	}
 }
+
+func TestValueTypeFiltering(t *testing.T) {
+	input := `{"message": "call me", "latency_ms": 1234, "retried": true, "owner": null, "user": {"email": "jane@example.com", "age": 42}}`
+	run := func(only, skip []string, rules []pkg.Rule) map[string]any {
+		appConfig := pkg.AppConfig{
+			Format:    "json",
+			CPUCount:  1,
+			OnlyTypes: only,
+			SkipTypes: skip,
+			Rules:     rules,
+			Masker:    pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		var output map[string]any
+		decoder := json.NewDecoder(&buf)
+		decoder.UseNumber()
+		require.NoError(t, decoder.Decode(&output))
+		return output
+	}
+
+	output := run([]string{"string"}, nil, []pkg.Rule{{Pattern: "user.age"}})
+	assert.NotEqual(t, "call me", output["message"])
+	assert.NotEqual(t, "jane@example.com", output["user"].(map[string]any)["email"])
+	assert.Equal(t, json.Number("1234"), output["latency_ms"], "Numbers are left alone")
+	assert.Equal(t, true, output["retried"])
+	assert.NotEqual(t, json.Number("42"), output["user"].(map[string]any)["age"], "Rules apply whatever the type")
+
+	output = run(nil, []string{"number", "bool"}, nil)
+	assert.NotEqual(t, "call me", output["message"])
+	assert.Equal(t, json.Number("1234"), output["latency_ms"])
+	assert.Equal(t, json.Number("42"), output["user"].(map[string]any)["age"])
+	assert.Equal(t, true, output["retried"])
+
+	_, err := pkg.Start(strings.NewReader(input), &bytes.Buffer{}, pkg.AppConfig{Format: "json", CPUCount: 1, SkipTypes: []string{"integer"}, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}})
+	assert.ErrorContains(t, err, "string, number, bool, null")
+}
+
+func TestExcludedSubtreePruning(t *testing.T) {
+	run := func(format, input string, exclude ...string) string {
+		appConfig := pkg.AppConfig{
+			Format:   format,
+			CPUCount: 1,
+			Exclude:  exclude,
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	input := `[{"user": {"email": "jane@example.com"}, "meta": {"zeta": 1.50, "alpha": "café", "tags": ["b", "a"]}}]`
+	output := run("json", input, "meta.**")
+	assert.Contains(t, output, `{"zeta": 1.50, "alpha": "café", "tags": ["b", "a"]}`, "Excluded subtrees keep their keys and notation")
+	assert.NotContains(t, output, "jane@example.com")
+
+	output = run("json", `{"items": [{"id": 1.0}, {"id": 2.0}], "user": "jane"}`, "items[0].**")
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(output), &decoded), "Output should be valid JSON. Got: %s", output)
+	assert.Contains(t, output, `"id": 1.0`, "Only the selected element is copied through")
+	assert.NotContains(t, output, `"id": 2.0`)
+
+	output = run("json", `{"b": "1e2", "a": "x"}`, "**")
+	assert.Equal(t, "{\"b\": \"1e2\", \"a\": \"x\"}\n", output, "An excluded root is copied as a whole")
+
+	output = run("xml", `<root><user>jane</user><meta><note>kept</note></meta></root>`, "root.meta.**")
+	assert.Contains(t, output, "<note>kept</note>")
+	assert.NotContains(t, output, "<user>jane</user>")
+}
+
+func TestUnselectedSubtreePruning(t *testing.T) {
+	run := func(format, input string, rules []pkg.Rule, include ...string) string {
+		appConfig := pkg.AppConfig{
+			Format:   format,
+			CPUCount: 1,
+			Include:  include,
+			Rules:    rules,
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	input := `[{"user": {"email": "jane@example.com"}, "meta": {"zeta": 1.50, "alpha": "café", "tags": ["b", "a"]}}]`
+	output := run("json", input, nil, "user.email")
+	assert.Contains(t, output, `{"zeta": 1.50, "alpha": "café", "tags": ["b", "a"]}`, "Subtrees no include pattern reaches keep their keys and notation")
+	assert.NotContains(t, output, "jane@example.com")
+
+	output = run("ndjson", `{"items": [{"id": 1.0, "b": 2}, {"id": 2.0}], "user": "jane"}`+"\n", nil, "items[1].id")
+	assert.Contains(t, output, `{"id":1.0,"b":2}`, "Elements the index selectors leave out are copied through, compacted")
+	assert.NotContains(t, output, `"id":2.0`)
+
+	rules := []pkg.Rule{{Pattern: "meta.alpha", Template: "ALPHA"}}
+	output = run("json", input, rules, "user.email")
+	assert.Contains(t, output, `"alpha": "ALPHA"`, "Rules reach into subtrees as include patterns do")
+	assert.Contains(t, output, `["b", "a"]`)
+
+	output = run("json", input, []pkg.Rule{{Value: "^café$", Template: "CAFE"}}, "user.email")
+	assert.Contains(t, output, `"alpha": "CAFE"`, "Rules without a pattern reach every key")
+
+	output = run("xml", `<root><user>jane</user><meta><note>kept</note></meta></root>`, nil, "root.user")
+	assert.Contains(t, output, "<note>kept</note>")
+	assert.NotContains(t, output, "<user>jane</user>")
+}
+
+func TestSafeValues(t *testing.T) {
+	input := `[{"status": "ACTIVE", "note": "N/A", "comment": "call me", "code": 0, "customer": {"first_name": "unknown", "last_name": "Smit"}}]`
+	appConfig := pkg.AppConfig{
+		Format:     "json",
+		CPUCount:   1,
+		SafeValues: []string{"ACTIVE", "N/A", "unknown", "0"},
+		Rules:      []pkg.Rule{{Pattern: "status", Method: "null"}},
+		Masker:     pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]any
+	decoder := json.NewDecoder(&buf)
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&output))
+	record := output[0]
+	assert.Equal(t, "ACTIVE", record["status"], "Safe values precede rules")
+	assert.Equal(t, "N/A", record["note"])
+	assert.Equal(t, json.Number("0"), record["code"])
+	assert.NotEqual(t, "call me", record["comment"])
+	customer := record["customer"].(map[string]any)
+	assert.Equal(t, "unknown", customer["first_name"], "Safe values are kept within records")
+	assert.NotEqual(t, "Smit", customer["last_name"])
+}
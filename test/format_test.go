@@ -0,0 +1,105 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// kvAssembler writes records of the kv format: a line of key=value pairs
+// separated by semicolons per record.
+type kvAssembler struct{}
+
+func (kvAssembler) WriteStart(w io.Writer) error { return nil }
+func (kvAssembler) WriteEnd(w io.Writer) error   { return nil }
+
+func (kvAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
+	record := item.(map[string]any)
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(record)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, record[key]))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(pairs, ";"))
+	return err
+}
+
+func init() {
+	err := pkg.RegisterFormat("kv", func(runner *pkg.Runner) pkg.Processor {
+		return pkg.ProcessorFunc(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			scanner := bufio.NewScanner(r)
+			line := 0
+			read := func() (any, error) {
+				if !scanner.Scan() {
+					if err := scanner.Err(); err != nil {
+						return nil, err
+					}
+					return nil, io.EOF
+				}
+				line++
+				record := make(map[string]any)
+				for pair := range strings.SplitSeq(scanner.Text(), ";") {
+					key, value, ok := strings.Cut(pair, "=")
+					if !ok {
+						return nil, &pkg.InputError{Err: fmt.Errorf("pair %q has no value", pair), Line: line}
+					}
+					record[key] = value
+				}
+				return record, nil
+			}
+			return runner.Run(ctx, w, read, kvAssembler{})
+		})
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	input := "email=jane@example.com;plan=pro\nemail=john@example.com;plan=free\nemail=mary@example.com;plan=pro\n"
+	run := func(appConfig pkg.AppConfig) ([]string, error) {
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), err
+	}
+
+	lines, err := run(pkg.AppConfig{Format: "kv", CPUCount: 2, Include: []string{"email"}})
+	require.NoError(t, err)
+	require.Len(t, lines, 3)
+	for i, plan := range []string{"plan=pro", "plan=free", "plan=pro"} {
+		assert.True(t, strings.HasSuffix(lines[i], ";"+plan), "Records are written in order: %s", lines[i])
+		assert.NotContains(t, lines[i], "@example.com;")
+	}
+
+	t.Run("Subsets", func(t *testing.T) {
+		lines, err := run(pkg.AppConfig{Format: "kv", CPUCount: 1, FirstN: 2, Include: []string{"email"}})
+		require.NoError(t, err)
+		assert.Len(t, lines, 2)
+	})
+
+	t.Run("Input errors", func(t *testing.T) {
+		input := "email=jane@example.com\nemail\n"
+		_, err := pkg.Start(strings.NewReader(input), io.Discard, pkg.AppConfig{Format: "kv", CPUCount: 1})
+		var inputErr *pkg.InputError
+		require.ErrorAs(t, err, &inputErr)
+		assert.Equal(t, 2, inputErr.Line)
+	})
+
+	t.Run("Registration", func(t *testing.T) {
+		assert.Error(t, pkg.RegisterFormat("kv", func(*pkg.Runner) pkg.Processor { return nil }), "Already registered")
+		assert.Error(t, pkg.RegisterFormat("csv", func(*pkg.Runner) pkg.Processor { return nil }), "Built in")
+		_, err := pkg.Start(strings.NewReader(input), io.Discard, pkg.AppConfig{Format: "yaml"})
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
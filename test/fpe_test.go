@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// TestFF1_NISTVectors checks the FF1 implementation against the AES-128
+// samples published by NIST for SP 800-38G.
+func TestFF1_NISTVectors(t *testing.T) {
+	key, err := hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		tweak      string
+		alphabet   string
+		plaintext  string
+		ciphertext string
+	}{
+		{name: "Sample 1", tweak: "", alphabet: "0123456789", plaintext: "0123456789", ciphertext: "2433477484"},
+		{name: "Sample 2", tweak: "39383736353433323130", alphabet: "0123456789", plaintext: "0123456789", ciphertext: "6124200773"},
+		{name: "Sample 3", tweak: "3737373770717273373737", alphabet: "0123456789abcdefghijklmnopqrstuvwxyz", plaintext: "0123456789abcdefghi", ciphertext: "a9tv40mll9kdu509eum"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tweak, err := hex.DecodeString(tc.tweak)
+			require.NoError(t, err)
+			ff1, err := pkg.NewFF1(key, tweak)
+			require.NoError(t, err)
+
+			ciphertext, err := ff1.Encrypt(tc.plaintext, tc.alphabet)
+			require.NoError(t, err)
+			assert.Equal(t, tc.ciphertext, ciphertext)
+
+			plaintext, err := ff1.Decrypt(ciphertext, tc.alphabet)
+			require.NoError(t, err)
+			assert.Equal(t, tc.plaintext, plaintext)
+		})
+	}
+}
+
+func TestFPEMethod_RoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	input := `{"card": "4111-1111-1111-1111", "customer_id": "AB12cd34", "account": 1234567, "balance": 1050.25}`
+
+	run := func(t *testing.T, in string, decrypt bool) string {
+		appConfig := pkg.AppConfig{
+			Format:   "json",
+			CPUCount: 1,
+			Masker: pkg.MaskerConfig{
+				Method:  pkg.MethodFPE,
+				Key:     key,
+				Decrypt: decrypt,
+			},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(in), &buf, appConfig)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	encrypted := run(t, input, false)
+	var masked map[string]any
+	decoder := json.NewDecoder(strings.NewReader(encrypted))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&masked), "Output should be valid JSON. Got: %s", encrypted)
+
+	assert.NotEqual(t, "4111-1111-1111-1111", masked["card"])
+	assert.Regexp(t, `^\d{4}-\d{4}-\d{4}-\d{4}$`, masked["card"], "Separators and length should be preserved")
+	assert.Equal(t, charClassSet("AB12cd34"), charClassSet(masked["customer_id"].(string)), "Character classes should be preserved")
+	assert.Len(t, masked["customer_id"], 8)
+	assert.Regexp(t, `^[1-9]\d{6}$`, masked["account"].(json.Number).String())
+	assert.Regexp(t, `^[1-9]\d{3}\.\d{2}$`, masked["balance"].(json.Number).String())
+
+	decrypted := run(t, encrypted, true)
+	assert.JSONEq(t, input, decrypted, "Decrypting should restore the original values")
+}
+
+func TestFPEMethod_InvalidKey(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodFPE,
+			Key:    []byte("short"),
+		},
+	}
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(`{"a": "b"}`), &buf, appConfig)
+	require.Error(t, err)
+}
+
+// charClassSet returns which of the classes lowercase, uppercase and digit
+// occur in s.
+func charClassSet(s string) [3]bool {
+	var set [3]bool
+	for _, c := range charClasses(s) {
+		switch c {
+		case 'a':
+			set[0] = true
+		case 'A':
+			set[1] = true
+		case '0':
+			set[2] = true
+		}
+	}
+	return set
+}
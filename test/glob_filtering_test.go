@@ -50,6 +50,24 @@ func TestGlobFilteringScenarios(t *testing.T) {
 		"metadata": { "audit": { "user": { "name": "AuditBot" } } }
 	}`
 
+	emailsInput := `{
+		"email": "root@example.com",
+		"user": { "email": "nested@example.com", "contact": { "email": "deep@example.com" } },
+		"name": "Keep Me"
+	}`
+
+	xmlInput := `<root><email>x@example.com</email><user><email>y@example.com</email></user><note>keep-it</note></root>`
+
+	arrayInput := `{
+		"items": [
+			{ "secret": "secret-zero", "token": "token-zero" },
+			{ "secret": "secret-one", "token": "token-one" }
+		],
+		"tags": ["tag-zero", "tag-one"]
+	}`
+
+	xmlListInput := `<root><item><secret>secret-zero</secret><token>token-zero</token></item><item><secret>secret-one</secret><token>token-one</token></item></root>`
+
 	csvInput := `id,name,email,transaction_id
 user-1,Alice,alice@example.com,txn-1
 user-2,Bob,bob@example.com,txn-2`
@@ -105,6 +123,119 @@ user-2,Bob,bob@example.com,txn-2`
 				"engineer": "Engineering",
 			},
 		},
+		{
+			name:    "JSON - Double star matches at any depth, including none",
+			format:  "json",
+			input:   emailsInput,
+			include: []string{"**.email"},
+			shouldBeMasked: map[string]string{
+				"root":   "root@example.com",
+				"nested": "nested@example.com",
+				"deep":   "deep@example.com",
+			},
+			shouldBeKept: map[string]string{"name": "Keep Me"},
+		},
+		{
+			name:    "JSON - Double star in the middle",
+			format:  "json",
+			input:   emailsInput,
+			include: []string{"user.**.email"},
+			shouldBeMasked: map[string]string{
+				"nested": "nested@example.com",
+				"deep":   "deep@example.com",
+			},
+			shouldBeKept: map[string]string{
+				"root": "root@example.com",
+				"name": "Keep Me",
+			},
+		},
+		{
+			name:           "JSON - Single star stays within a segment",
+			format:         "json",
+			input:          emailsInput,
+			include:        []string{"user.*"},
+			shouldBeMasked: map[string]string{"nested": "nested@example.com"},
+			shouldBeKept: map[string]string{
+				"root": "root@example.com",
+				"deep": "deep@example.com",
+			},
+		},
+		{
+			name:    "JSON - Alternatives spanning segments",
+			format:  "json",
+			input:   emailsInput,
+			include: []string{"{user.email,name}"},
+			shouldBeMasked: map[string]string{
+				"nested": "nested@example.com",
+				"name":   "Keep Me",
+			},
+			shouldBeKept: map[string]string{
+				"root": "root@example.com",
+				"deep": "deep@example.com",
+			},
+		},
+		// --- XML ---
+		{
+			name:    "XML - Double star matches at any depth",
+			format:  "xml",
+			input:   xmlInput,
+			include: []string{"**.email"},
+			shouldBeMasked: map[string]string{
+				"email":      "x@example.com",
+				"user.email": "y@example.com",
+			},
+			shouldBeKept: map[string]string{"note": "keep-it"},
+		},
+		{
+			name:    "JSON - Index selectors pick array elements",
+			format:  "json",
+			input:   arrayInput,
+			include: []string{"items[0].secret", "items[*].token", "tags[1]"},
+			shouldBeMasked: map[string]string{
+				"items[0].secret": "secret-zero",
+				"items[0].token":  "token-zero",
+				"items[1].token":  "token-one",
+				"tags[1]":         "tag-one",
+			},
+			shouldBeKept: map[string]string{
+				"items[1].secret": "secret-one",
+				"tags[0]":         "tag-zero",
+			},
+		},
+		{
+			name:    "JSON - Patterns without index match every element",
+			format:  "json",
+			input:   arrayInput,
+			include: []string{"items.secret"},
+			shouldBeMasked: map[string]string{
+				"items[0].secret": "secret-zero",
+				"items[1].secret": "secret-one",
+			},
+			shouldBeKept: map[string]string{"items[0].token": "token-zero"},
+		},
+		{
+			name:    "XML - Index selectors pick repeated elements",
+			format:  "xml",
+			input:   xmlListInput,
+			include: []string{"root.item[1].secret", "root.item[*].token"},
+			shouldBeMasked: map[string]string{
+				"item[1].secret": "secret-one",
+				"item[0].token":  "token-zero",
+				"item[1].token":  "token-one",
+			},
+			shouldBeKept: map[string]string{"item[0].secret": "secret-zero"},
+		},
+		{
+			name:           "XML - Index selectors in a serially processed document",
+			format:         "xml",
+			input:          "<root><meta>m</meta>" + strings.TrimPrefix(xmlListInput, "<root>"),
+			include:        []string{"root.item[1].secret"},
+			shouldBeMasked: map[string]string{"item[1].secret": "secret-one"},
+			shouldBeKept: map[string]string{
+				"item[0].secret": "secret-zero",
+				"item[0].token":  "token-zero",
+			},
+		},
 		// --- CSV ---
 		{
 			name:   "CSV - No flags (mask all)",
@@ -158,7 +289,7 @@ user-2,Bob,bob@example.com,txn-2`
 			}
 
 			var buf bytes.Buffer
-			err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
+			_, err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
 			require.NoError(t, err)
 
 			output := buf.String()
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"unaware/pkg"
+)
+
+// userDescriptor describes, without generated code:
+//
+//	message User {
+//	  string name = 1;
+//	  string email = 2 [debug_redact = true];
+//	  int64 age = 3;
+//	  repeated string phones = 4;
+//	  Address address = 5;
+//	}
+//	message Address { string city = 1; }
+func userDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(name), Number: proto.Int32(number), Type: kind.Enum(), Label: label.Enum()}
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	email := field("email", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional)
+	email.Options = &descriptorpb.FieldOptions{DebugRedact: proto.Bool(true)}
+	address := field("address", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, optional)
+	address.TypeName = proto.String(".test.Address")
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("user.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+				email,
+				field("age", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional),
+				field("phones", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated),
+				address,
+			},
+		}, {
+			Name:  proto.String("Address"),
+			Field: []*descriptorpb.FieldDescriptorProto{field("city", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional)},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	return file.Messages().ByName("User")
+}
+
+func newUser(desc protoreflect.MessageDescriptor) *dynamicpb.Message {
+	user := dynamicpb.NewMessage(desc)
+	user.Set(desc.Fields().ByName("name"), protoreflect.ValueOfString("Jane Doe"))
+	user.Set(desc.Fields().ByName("email"), protoreflect.ValueOfString("jane@example.com"))
+	user.Set(desc.Fields().ByName("age"), protoreflect.ValueOfInt64(42))
+	phones := user.Mutable(desc.Fields().ByName("phones")).List()
+	phones.Append(protoreflect.ValueOfString("+31 6 12345678"))
+	phones.Append(protoreflect.ValueOfString("+31 6 87654321"))
+	address := user.Mutable(desc.Fields().ByName("address")).Message()
+	address.Set(address.Descriptor().Fields().ByName("city"), protoreflect.ValueOfString("Amsterdam"))
+	return user
+}
+
+func protoField(msg protoreflect.Message, path ...string) protoreflect.Value {
+	for _, name := range path[:len(path)-1] {
+		msg = msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(name))).Message()
+	}
+	return msg.Get(msg.Descriptor().Fields().ByName(protoreflect.Name(path[len(path)-1])))
+}
+
+func TestMaskProto(t *testing.T) {
+	desc := userDescriptor(t)
+
+	t.Run("Path config", func(t *testing.T) {
+		engine, err := pkg.New(pkg.WithCPUCount(1), pkg.WithInclude("address.city", "phones", "age"), pkg.WithExclude("email"))
+		require.NoError(t, err)
+		user := newUser(desc)
+		engine.MaskProto(user)
+		assert.Equal(t, "Jane Doe", protoField(user, "name").String())
+		assert.Equal(t, "jane@example.com", protoField(user, "email").String(), "Excluded despite debug_redact")
+		assert.NotEqual(t, "Amsterdam", protoField(user, "address", "city").String())
+		assert.NotEqual(t, int64(42), protoField(user, "age").Int())
+		phones := protoField(user, "phones").List()
+		require.Equal(t, 2, phones.Len())
+		assert.NotEqual(t, "+31 6 12345678", phones.Get(0).String())
+		assert.NotEqual(t, "+31 6 87654321", phones.Get(1).String())
+	})
+
+	t.Run("Annotated fields", func(t *testing.T) {
+		engine, err := pkg.New(pkg.WithCPUCount(1), pkg.WithInclude("name"))
+		require.NoError(t, err)
+		user := newUser(desc)
+		engine.MaskProto(user)
+		assert.NotEqual(t, "Jane Doe", protoField(user, "name").String())
+		assert.NotEqual(t, "jane@example.com", protoField(user, "email").String())
+		assert.Contains(t, protoField(user, "email").String(), "@")
+		assert.Equal(t, "Amsterdam", protoField(user, "address", "city").String())
+		assert.Equal(t, int64(42), protoField(user, "age").Int())
+	})
+
+	t.Run("Null masking clears fields", func(t *testing.T) {
+		engine, err := pkg.New(pkg.WithCPUCount(1), pkg.WithMasker(pkg.MaskerConfig{Method: pkg.MethodNull}), pkg.WithInclude("age"))
+		require.NoError(t, err)
+		user := newUser(desc)
+		engine.MaskProto(user)
+		assert.False(t, user.Has(desc.Fields().ByName("age")))
+		assert.False(t, user.Has(desc.Fields().ByName("email")))
+	})
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	received proto.Message
+	sent     []any
+}
+
+func (s *fakeServerStream) Context() context.Context { return context.Background() }
+
+func (s *fakeServerStream) RecvMsg(m any) error {
+	proto.Merge(m.(proto.Message), s.received)
+	return nil
+}
+
+func (s *fakeServerStream) SendMsg(m any) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestMaskingInterceptors(t *testing.T) {
+	desc := userDescriptor(t)
+	engine, err := pkg.New(pkg.WithCPUCount(1), pkg.WithInclude("name"))
+	require.NoError(t, err)
+	email := func(m any) string { return protoField(m.(proto.Message).ProtoReflect(), "email").String() }
+
+	t.Run("Unary server", func(t *testing.T) {
+		interceptors := pkg.MaskingInterceptors{Engine: engine, Requests: true, Responses: true}
+		resp := newUser(desc)
+		var handled any
+		masked, err := interceptors.UnaryServer()(context.Background(), newUser(desc), &grpc.UnaryServerInfo{}, func(ctx context.Context, req any) (any, error) {
+			handled = req
+			return resp, nil
+		})
+		require.NoError(t, err)
+		assert.NotEqual(t, "jane@example.com", email(handled))
+		assert.NotEqual(t, "jane@example.com", email(masked))
+		assert.Equal(t, "jane@example.com", email(resp), "The handler's response is copied")
+	})
+
+	t.Run("Unary client", func(t *testing.T) {
+		interceptors := pkg.MaskingInterceptors{Engine: engine, Responses: true}
+		req, reply := newUser(desc), dynamicpb.NewMessage(desc)
+		var sent any
+		err := interceptors.UnaryClient()(context.Background(), "/test.Users/Get", req, reply, nil, func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			sent = req
+			proto.Merge(reply.(proto.Message), newUser(desc))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "jane@example.com", email(sent), "Requests are not masked")
+		assert.NotEqual(t, "jane@example.com", email(reply))
+	})
+
+	t.Run("Stream server", func(t *testing.T) {
+		interceptors := pkg.MaskingInterceptors{Engine: engine, Requests: true, Responses: true}
+		stream := &fakeServerStream{received: newUser(desc)}
+		resp := newUser(desc)
+		err := interceptors.StreamServer()(nil, stream, &grpc.StreamServerInfo{}, func(srv any, ss grpc.ServerStream) error {
+			req := dynamicpb.NewMessage(desc)
+			require.NoError(t, ss.RecvMsg(req))
+			assert.NotEqual(t, "jane@example.com", email(req))
+			return ss.SendMsg(resp)
+		})
+		require.NoError(t, err)
+		require.Len(t, stream.sent, 1)
+		assert.NotEqual(t, "jane@example.com", email(stream.sent[0]))
+		assert.Equal(t, "jane@example.com", email(resp))
+	})
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestHashMethod(t *testing.T) {
+	salt := []byte("hash-salt")
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte("alice"))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	testCases := []struct {
+		spec    string
+		pattern string
+	}{
+		{spec: "hash", pattern: `^[0-9a-f]{64}$`},
+		{spec: "hash:16", pattern: `^[0-9a-f]{16}$`},
+		{spec: "hash:base64", pattern: `^[A-Za-z0-9_-]{43}$`},
+		{spec: "hash:base64,12", pattern: `^[A-Za-z0-9_-]{12}$`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			maskerConfig, err := pkg.ParseMethod(tc.spec)
+			require.NoError(t, err)
+			maskerConfig.Salt = salt
+			appConfig := pkg.AppConfig{Format: "json", CPUCount: 2, Masker: maskerConfig}
+
+			input := `[{"user": "alice", "id": 42}, {"user": "alice", "id": 43}]`
+			var buf bytes.Buffer
+			_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+			require.NoError(t, err)
+
+			var output []map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+			require.Len(t, output, 2)
+			assert.Regexp(t, tc.pattern, output[0]["user"])
+			assert.Regexp(t, tc.pattern, output[0]["id"], "Numbers should be hashed as well")
+			assert.Equal(t, output[0]["user"], output[1]["user"], "Identical values should hash identically")
+			assert.NotEqual(t, output[0]["id"], output[1]["id"])
+			if tc.spec == "hash" {
+				assert.Equal(t, expected, output[0]["user"])
+			}
+		})
+	}
+
+	_, err := pkg.ParseMethod("hash:sha1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestHTTPMasking(t *testing.T) {
+	engine, err := pkg.New(pkg.WithCPUCount(1), pkg.WithInclude("**.email"))
+	require.NoError(t, err)
+	user := `{"email": "jane@example.com", "plan": "pro"}`
+	decode := func(t *testing.T, body string) map[string]any {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(body), &record), body)
+		return record
+	}
+
+	t.Run("Responses", func(t *testing.T) {
+		handler := engine.MaskResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, user)
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/user", nil))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		record := decode(t, rec.Body.String())
+		assert.NotEqual(t, "jane@example.com", record["email"])
+		assert.Equal(t, "pro", record["plan"])
+	})
+
+	t.Run("Responses that cannot be masked", func(t *testing.T) {
+		handler := engine.MaskResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"email": "jane@example.com"`)
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/user", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "jane@example.com", "Fails closed")
+	})
+
+	t.Run("Requests", func(t *testing.T) {
+		var received string
+		handler := engine.MaskRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		}))
+		req := httptest.NewRequest("POST", "/users", strings.NewReader(user))
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.NotEqual(t, "jane@example.com", decode(t, received)["email"])
+
+		req = httptest.NewRequest("POST", "/notes", strings.NewReader("jane@example.com"))
+		req.Header.Set("Content-Type", "text/plain")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, "jane@example.com", received, "Other bodies are passed on as they are")
+	})
+
+	t.Run("Transport", func(t *testing.T) {
+		var received string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, user)
+		}))
+		defer server.Close()
+		client := &http.Client{Transport: &pkg.MaskingTransport{Engine: engine, Requests: true, Responses: true}}
+		resp, err := client.Post(server.URL, "application/json", strings.NewReader(user))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.NotEqual(t, "jane@example.com", decode(t, received)["email"])
+		assert.NotEqual(t, "jane@example.com", decode(t, string(body))["email"])
+	})
+
+	t.Run("Mappings", func(t *testing.T) {
+		mappingFile := filepath.Join(t.TempDir(), "customers.map")
+		key := []byte("0123456789abcdef0123456789abcdef")
+		engine, err := pkg.New(pkg.WithConfig(pkg.AppConfig{Format: "json", CPUCount: 1, MappingFile: mappingFile, MappingKey: key}), pkg.WithInclude("**.email"))
+		require.NoError(t, err)
+		var received []string
+		handler := engine.MaskRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = append(received, strings.TrimSpace(string(body)))
+		}))
+		for _, contentType := range []string{"application/json", "application/x-ndjson"} {
+			req := httptest.NewRequest("POST", "/users", strings.NewReader(user+"\n"))
+			req.Header.Set("Content-Type", contentType)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		require.Len(t, received, 2)
+		masked := decode(t, received[0])["email"]
+		assert.NotEqual(t, "jane@example.com", masked)
+		assert.Equal(t, masked, decode(t, received[1])["email"], "Bodies of every format share the mappings")
+
+		mappings, err := pkg.ReadMappings(mappingFile, key)
+		require.NoError(t, err)
+		assert.Contains(t, mappings, pkg.Mapping{Field: "email", Original: "jane@example.com", Masked: masked}, "Mappings are saved once a body is masked")
+	})
+}
@@ -0,0 +1,40 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestInputErrorLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   pkg.InputError
+	}{
+		{"JSON array", "json", "[\n {\"a\": 1},\n {\"b\": {\"c\": [1, 2,\n x]}}\n]\n", pkg.InputError{Record: 2, Line: 4, Column: 2, Path: "b.c[2]"}},
+		{"JSON object", "json", "\n{\"a\": {\"b\": 1, \"c\": {\"d\": }}}", pkg.InputError{Line: 2, Column: 27, Path: "a.c.d"}},
+		{"NDJSON", "ndjson", "{\"a\": 1}\n{\"b\": \"x\",\n \"c\": tru}\n", pkg.InputError{Record: 2, Line: 3, Column: 10, Path: "c"}},
+		{"CSV", "csv", "a,b\n1,2\n3\n", pkg.InputError{Record: 2, Line: 3, Column: 1}},
+		{"XML list", "xml", "<r>\n<i><a>1</a></i>\n<i><a>2</b></i>\n</r>", pkg.InputError{Record: 2, Line: 3, Column: 12, Path: "i.a"}},
+		{"XML document", "xml", "<r><a>1</a>\n<b><c>2</d></b></r>", pkg.InputError{Line: 2, Column: 12, Path: "r.b.c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := pkg.AppConfig{Format: tt.format, CPUCount: 2, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+			_, err := pkg.Start(strings.NewReader(tt.input), &bytes.Buffer{}, appConfig)
+			var inputErr *pkg.InputError
+			require.ErrorAs(t, err, &inputErr)
+			assert.Equal(t, tt.want.Record, inputErr.Record, err.Error())
+			assert.Equal(t, tt.want.Line, inputErr.Line, err.Error())
+			assert.Equal(t, tt.want.Column, inputErr.Column, err.Error())
+			assert.Equal(t, tt.want.Path, inputErr.Path, err.Error())
+		})
+	}
+}
@@ -3,6 +3,8 @@ package test
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -103,7 +105,7 @@ func TestJSONProcessing_Structured(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err = pkg.Start(bytes.NewReader(inputBytes), &buf, appConfig)
+	_, err = pkg.Start(bytes.NewReader(inputBytes), &buf, appConfig)
 	require.NoError(t, err)
 
 	var output ComplexJSON
@@ -161,7 +163,7 @@ func TestJSONStreamingArray(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
 	require.NoError(t, err)
 
 	output := buf.String()
@@ -186,7 +188,7 @@ func TestEmptyReader(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(""), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(""), &buf, appConfig)
 	require.NoError(t, err)
 	assert.Equal(t, "", buf.String())
 }
@@ -201,7 +203,7 @@ func TestReaderError(t *testing.T) {
 		},
 	}
 	var buf bytes.Buffer
-	err := pkg.Start(errorReader, &buf, appConfig)
+	_, err := pkg.Start(errorReader, &buf, appConfig)
 	require.Error(t, err)
 }
 
@@ -226,7 +228,7 @@ func TestJSONStreamingNestedArray(t *testing.T) {
 
 	var buf bytes.Buffer
 	// Use 2 CPUs to ensure concurrency is tested
-	err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
 	require.NoError(t, err)
 
 	output := buf.String()
@@ -241,3 +243,60 @@ func TestJSONStreamingNestedArray(t *testing.T) {
 	err = json.Unmarshal([]byte(output), &result)
 	require.NoError(t, err, "Output should be valid JSON. Got: %s", output)
 }
+
+func TestJSONStreamingDeepNestedArray(t *testing.T) {
+	// The items are more than the 1 MiB from which a nested array is
+	// streamed.
+	var items []string
+	for i := range 8000 {
+		items = append(items, fmt.Sprintf(`{"id": %d, "email": "user%d@example.com", "blob": "%s"}`, i, i, strings.Repeat("x", 100)))
+	}
+	input := `{"meta": {"owner": "piet@example.com"}, "data": {"results": {"items": [` + strings.Join(items, ",") +
+		`], "next": "jan@example.com"}}, "total": 8000}`
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 2,
+		Exclude:  []string{"**.id", "**.blob", "total"},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("streaming-deep-salt")},
+	}
+
+	for _, style := range []string{pkg.StylePretty, pkg.StyleCompact} {
+		t.Run(style, func(t *testing.T) {
+			appConfig.OutputStyle = style
+			var buf bytes.Buffer
+			stats, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+			require.NoError(t, err)
+			assert.Equal(t, 8000, stats.Records, "The items are the records")
+
+			var result struct {
+				Meta struct {
+					Owner string `json:"owner"`
+				} `json:"meta"`
+				Data struct {
+					Results struct {
+						Items []struct {
+							ID    int    `json:"id"`
+							Email string `json:"email"`
+						} `json:"items"`
+						Next string `json:"next"`
+					} `json:"results"`
+				} `json:"data"`
+				Total int `json:"total"`
+			}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &result), "Output should be valid JSON")
+			require.Len(t, result.Data.Results.Items, 8000)
+			for i, item := range result.Data.Results.Items {
+				require.Equal(t, i, item.ID, "Items keep their order")
+				require.NotEqual(t, fmt.Sprintf("user%d@example.com", i), item.Email)
+			}
+			assert.NotEqual(t, "piet@example.com", result.Meta.Owner)
+			assert.NotEqual(t, "jan@example.com", result.Data.Results.Next)
+			assert.Equal(t, 8000, result.Total)
+		})
+	}
+
+	_, err := pkg.Start(strings.NewReader(strings.Replace(input, `"id": 5000,`, `"id": 5000`, 1)), io.Discard, appConfig)
+	var inputErr *pkg.InputError
+	require.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, "data.results.items[5000]", inputErr.Path, "Errors are located in streamed arrays")
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestKAnonymity_CSV(t *testing.T) {
+	input := `name,zip,age,city
+Alice,12345,31,Amsterdam
+Bob,12346,33,Amsterdam
+Carol,12347,35,Utrecht
+Dave,12388,36,Utrecht
+Eve,12399,52,Rotterdam
+Frank,12391,55,Rotterdam
+Grace,12390,54,Rotterdam`
+
+	var report bytes.Buffer
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 2,
+		Exclude:  []string{"zip", "age", "city"},
+		KAnonymity: pkg.KAnonymityConfig{
+			K:                3,
+			QuasiIdentifiers: []string{"zip", "age", "city"},
+		},
+		Report: &report,
+		Masker: pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 8)
+	assert.Equal(t, []string{"name", "zip", "age", "city"}, records[0])
+
+	counts := make(map[string]int)
+	for _, record := range records[1:] {
+		assert.NotContains(t, []string{"Alice", "Bob", "Carol"}, record[0], "Non quasi-identifier columns are still masked")
+		counts[strings.Join(record[1:], ",")]++
+	}
+	for combination, count := range counts {
+		if combination != "*,*,*" {
+			assert.GreaterOrEqual(t, count, 3, "Combination %q should occur at least k times", combination)
+		}
+	}
+
+	assert.Contains(t, report.String(), "k-anonymity (k=3) over 7 rows")
+	assert.Contains(t, report.String(), "suppressed rows:")
+}
+
+func TestKAnonymity_UnknownColumn(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		KAnonymity: pkg.KAnonymityConfig{
+			K:                2,
+			QuasiIdentifiers: []string{"postcode"},
+		},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader("name,zip\nAlice,12345\n"), &buf, appConfig)
+	require.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jacoelho/banking/iban"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestLocale(t *testing.T) {
+	testCases := []struct {
+		locale      string
+		phonePrefix string
+		ibanPrefix  string
+		emailSuffix string
+	}{
+		{locale: "nl", phonePrefix: "+31 6 ", ibanPrefix: "NL", emailSuffix: ".nl"},
+		{locale: "de", phonePrefix: "+49 ", ibanPrefix: "DE", emailSuffix: ".de"},
+		{locale: "fr", phonePrefix: "+33 ", ibanPrefix: "FR", emailSuffix: ".fr"},
+		{locale: "es", phonePrefix: "+34 ", ibanPrefix: "ES", emailSuffix: ".es"},
+		{locale: "it", phonePrefix: "+39 ", ibanPrefix: "IT", emailSuffix: ".it"},
+	}
+
+	input := `[{"name": "John Smith", "phone": "+1 212-555-0123", "email": "john@example.com", "iban": "GB82WEST12345698765432"}]`
+	for _, tc := range testCases {
+		t.Run(tc.locale, func(t *testing.T) {
+			appConfig := pkg.AppConfig{
+				Format:   "json",
+				CPUCount: 1,
+				Rules:    []pkg.Rule{{Pattern: "name", Template: "{firstname} {lastname}"}},
+				Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom, Locale: tc.locale},
+			}
+
+			var buf bytes.Buffer
+			_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+			require.NoError(t, err)
+
+			var output []map[string]string
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+			require.Len(t, output, 1)
+			assert.True(t, strings.HasPrefix(output[0]["phone"], tc.phonePrefix), "Phone %q should use the locale's format", output[0]["phone"])
+			assert.True(t, strings.HasSuffix(output[0]["email"], tc.emailSuffix), "E-mail %q should use the locale's domain", output[0]["email"])
+			assert.True(t, strings.HasPrefix(output[0]["iban"], tc.ibanPrefix))
+			assert.NoError(t, iban.Validate(output[0]["iban"]), "Generated IBAN %q should be valid", output[0]["iban"])
+			assert.NotEqual(t, "John Smith", output[0]["name"])
+		})
+	}
+}
+
+func TestLocale_Unsupported(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom, Locale: "xx"},
+	}
+	_, err := pkg.Start(strings.NewReader(`{"a": "b"}`), &bytes.Buffer{}, appConfig)
+	assert.Error(t, err)
+}
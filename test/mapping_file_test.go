@@ -0,0 +1,132 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestMappingFile_ReusedAcrossSalts(t *testing.T) {
+	mappingFile := filepath.Join(t.TempDir(), "customers.map")
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	run := func(input, salt string) []map[string]any {
+		appConfig := pkg.AppConfig{
+			Format:      "json",
+			CPUCount:    2,
+			MappingFile: mappingFile,
+			MappingKey:  key,
+			Masker: pkg.MaskerConfig{
+				Method: pkg.MethodDeterministic,
+				Salt:   []byte(salt),
+			},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		decoder := json.NewDecoder(&buf)
+		decoder.UseNumber()
+		var output []map[string]any
+		require.NoError(t, decoder.Decode(&output), "Output should be valid JSON")
+		return output
+	}
+
+	first := run(`[{"email": "alice@example.com", "id": 42}]`, "first-salt")
+	second := run(`[{"email": "alice@example.com", "id": 42}, {"email": "bob@example.com", "id": 43}]`, "second-salt")
+
+	require.Len(t, second, 2)
+	assert.Equal(t, first[0], second[0], "Recorded values should keep their masked value after the salt changed")
+	assert.NotEqual(t, "bob@example.com", second[1]["email"])
+
+	mappings, err := pkg.ReadMappings(mappingFile, key)
+	require.NoError(t, err)
+	assert.Len(t, mappings, 4, "New values of the second run should be added")
+	assert.Contains(t, mappings, pkg.Mapping{Field: "email", Original: "alice@example.com", Masked: first[0]["email"]})
+	assert.Contains(t, mappings, pkg.Mapping{Field: "id", Original: json.Number("42"), Masked: first[0]["id"]})
+
+	data, err := os.ReadFile(mappingFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "alice@example.com", "Mapping file should be encrypted")
+}
+
+func TestMappingFile_WrongKey(t *testing.T) {
+	mappingFile := filepath.Join(t.TempDir(), "customers.map")
+	appConfig := pkg.AppConfig{
+		Format:      "csv",
+		CPUCount:    1,
+		MappingFile: mappingFile,
+		MappingKey:  []byte("0123456789abcdef"),
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+		},
+	}
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader("name\nAlice\n"), &buf, appConfig)
+	require.NoError(t, err)
+
+	_, err = pkg.ReadMappings(mappingFile, []byte("fedcba9876543210"))
+	assert.ErrorContains(t, err, "wrong key")
+
+	appConfig.MappingKey = []byte("short")
+	_, err = pkg.Start(strings.NewReader("name\nAlice\n"), &buf, appConfig)
+	assert.ErrorContains(t, err, "invalid mapping key")
+}
+
+func TestMappingSet_ExportedAndPreloaded(t *testing.T) {
+	run := func(set *pkg.MappingSet, input, salt string) string {
+		appConfig := pkg.AppConfig{
+			Format:     "csv",
+			CPUCount:   2,
+			MappingSet: set,
+			Masker:     pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte(salt)},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		return buf.String()
+	}
+	input := "email\njane@example.com\njohn@example.com\n"
+
+	set := pkg.NewMappingSet(nil)
+	first := run(set, input, "salt-a")
+	require.Equal(t, 2, set.Len())
+	mappings := set.Mappings()
+	var originals []any
+	for _, mapping := range mappings {
+		assert.Equal(t, "email", mapping.Field)
+		originals = append(originals, mapping.Original)
+	}
+	assert.ElementsMatch(t, []any{"jane@example.com", "john@example.com"}, originals)
+
+	// Another system preloads the exported mappings and masks alike, though
+	// it has a salt of its own.
+	preloaded := pkg.NewMappingSet(mappings)
+	assert.Equal(t, first, run(preloaded, input, "salt-b"))
+	assert.Equal(t, 2, preloaded.Len(), "Known values are not added again")
+	run(preloaded, "email\nmary@example.com\n", "salt-b")
+	assert.Equal(t, 3, preloaded.Len())
+
+	t.Run("Written to a mapping file", func(t *testing.T) {
+		mappingFile := filepath.Join(t.TempDir(), "customers.map")
+		key := []byte("0123456789abcdef0123456789abcdef")
+		require.NoError(t, pkg.WriteMappings(mappingFile, key, mappings))
+		read, err := pkg.ReadMappings(mappingFile, key)
+		require.NoError(t, err)
+		assert.Equal(t, mappings, read)
+	})
+
+	t.Run("Not with a mapping file", func(t *testing.T) {
+		appConfig := pkg.AppConfig{Format: "csv", CPUCount: 1, MappingSet: set, MappingFile: "customers.map"}
+		_, err := pkg.Start(strings.NewReader(input), &bytes.Buffer{}, appConfig)
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
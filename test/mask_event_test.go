@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestOnMask(t *testing.T) {
+	var mu sync.Mutex
+	events := make(map[string]pkg.MaskEvent)
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 2,
+		OnMask: func(event pkg.MaskEvent) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			events[event.Path] = event
+			return event.Path != "support"
+		},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+	}
+	input := `[{"email": "jane@example.com", "support": "help@example.com", "contact": {"first_name": "Jane"}, "age": 42}]`
+	var out bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &out, appConfig)
+	require.NoError(t, err)
+	var records []map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &records))
+	record := records[0]
+
+	email := events["email"]
+	assert.Equal(t, "email", email.Type)
+	assert.Equal(t, "jane@example.com", email.Original)
+	assert.Equal(t, record["email"], email.Masked)
+	assert.Equal(t, "help@example.com", record["support"], "Rejected values keep the original")
+	assert.Equal(t, "first_name", events["contact.first_name"].Type)
+	assert.Equal(t, "number", events["age"].Type)
+
+	t.Run("Redacted", func(t *testing.T) {
+		var originals []any
+		appConfig := pkg.AppConfig{
+			Format:       "csv",
+			CPUCount:     1,
+			RedactEvents: true,
+			OnMask: func(event pkg.MaskEvent) bool {
+				originals = append(originals, event.Original)
+				return true
+			},
+			Masker: pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		input := "note\nCall Jane Doe about the invoice of last month\n"
+		_, err := pkg.Start(strings.NewReader(input), &bytes.Buffer{}, appConfig)
+		require.NoError(t, err)
+		require.Len(t, originals, 1)
+		assert.Equal(t, "Call J…", originals[0])
+	})
+
+	t.Run("XML records", func(t *testing.T) {
+		var mu sync.Mutex
+		events := make(map[string]pkg.MaskEvent)
+		appConfig := pkg.AppConfig{
+			Format:   "xml",
+			CPUCount: 2,
+			OnMask: func(event pkg.MaskEvent) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				events[event.Path] = event
+				return !strings.HasSuffix(event.Path, "last_name")
+			},
+			Masker: pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+		}
+		user := "<user><first_name>Jane</first_name><last_name>Doe</last_name><card><number>4111111111111111</number><cvv>123</cvv></card></user>"
+		input := "<users>" + user + user + "</users>"
+		var out bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &out, appConfig)
+		require.NoError(t, err)
+
+		first := events["users.user.first_name"]
+		assert.Equal(t, "first_name", first.Type)
+		assert.Equal(t, "Jane", first.Original, "Elements masked with their record are reported by their text")
+		assert.IsType(t, "", first.Masked)
+		assert.Equal(t, "4111111111111111", events["users.user.card.number"].Original)
+		assert.Equal(t, "Doe", events["users.user[1].last_name"].Original)
+		assert.Equal(t, 2, strings.Count(out.String(), "<last_name>Doe</last_name>"), "Rejected elements keep their text")
+		assert.NotContains(t, out.String(), "4111111111111111")
+	})
+}
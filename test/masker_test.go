@@ -0,0 +1,70 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestMasker(t *testing.T) {
+	config := pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")}
+	masker, err := pkg.NewMasker(config)
+	require.NoError(t, err)
+
+	values := []any{"jane@example.com", "+31 6 12345678", json.Number("42"), true, "Utrecht"}
+	masked := make([][]any, 8)
+	var wg sync.WaitGroup
+	for i := range masked {
+		wg.Go(func() {
+			for range 50 {
+				masked[i] = nil
+				for _, value := range values {
+					masked[i] = append(masked[i], masker.Mask(value))
+				}
+			}
+		})
+	}
+	wg.Wait()
+	for _, m := range masked[1:] {
+		assert.Equal(t, masked[0], m, "Every goroutine masks the same values the same way")
+	}
+	assert.NotEqual(t, "jane@example.com", masked[0][0])
+
+	var out bytes.Buffer
+	appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, Masker: config}
+	_, err = pkg.Start(strings.NewReader(`{"email": "jane@example.com"}`), &out, appConfig)
+	require.NoError(t, err)
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, record["email"], masker.MaskKey("email", "jane@example.com"), "Values are masked as in a run")
+	assert.Nil(t, masker.Mask(nil))
+
+	t.Run("Cached values", func(t *testing.T) {
+		masker, err := pkg.NewMasker(config)
+		require.NoError(t, err)
+		assert.IsType(t, "", masker.Mask("42"))
+		assert.IsType(t, json.Number(""), masker.Mask(json.Number("42")), "Numbers are not taken for strings that read the same")
+		assert.IsType(t, "", masker.Mask("true"))
+		assert.IsType(t, true, masker.Mask(true))
+
+		note := "Parcel for the customer left at the front door"
+		first := masker.Mask(note)
+		fresh, err := pkg.NewMasker(config)
+		require.NoError(t, err)
+		fresh.Mask("Left at the door of the customer")
+		assert.Equal(t, first, fresh.Mask(note), "Text is masked the same whichever words were cached before")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		var configErr *pkg.ConfigError
+		_, err := pkg.NewMasker(pkg.MaskerConfig{Method: pkg.MethodDictionary})
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// heldRecords counts the records of the held format read and written, and
+// the most read but not yet written at any time.
+var heldRecords struct {
+	read, written, most atomic.Int64
+}
+
+// heldAssembler writes the records of the held format.
+type heldAssembler struct{}
+
+func (heldAssembler) WriteStart(w io.Writer) error { return nil }
+func (heldAssembler) WriteEnd(w io.Writer) error   { return nil }
+
+func (heldAssembler) WriteItem(w io.Writer, item any, isFirst bool) error {
+	heldRecords.written.Add(1)
+	_, err := fmt.Fprintln(w, item.(map[string]any)["note"])
+	return err
+}
+
+func init() {
+	err := pkg.RegisterFormat("held", func(runner *pkg.Runner) pkg.Processor {
+		return pkg.ProcessorFunc(func(ctx context.Context, r io.Reader, w io.Writer) error {
+			read := func() (any, error) {
+				if heldRecords.read.Load() == 200 {
+					return nil, io.EOF
+				}
+				index := heldRecords.read.Add(1)
+				if held := index - heldRecords.written.Load(); held > heldRecords.most.Load() {
+					heldRecords.most.Store(held)
+				}
+				if index == 1 {
+					return map[string]any{"note": "slow"}, nil
+				}
+				return map[string]any{"note": strings.Repeat("x", 1000)}, nil
+			}
+			return runner.Run(ctx, w, read, heldAssembler{})
+		})
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	run := func(maxMemory int64) int64 {
+		heldRecords.read.Store(0)
+		heldRecords.written.Store(0)
+		heldRecords.most.Store(0)
+		// The first record takes long to mask, so those after it wait for
+		// it to be written.
+		onMask := func(event pkg.MaskEvent) bool {
+			if event.Original == "slow" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return true
+		}
+		stats, err := pkg.Start(strings.NewReader(""), io.Discard, pkg.AppConfig{Format: "held", CPUCount: 4, MaxMemory: maxMemory, OnMask: onMask})
+		require.NoError(t, err)
+		assert.Equal(t, 200, stats.Records)
+		return heldRecords.most.Load()
+	}
+
+	// Records of about 1KB each, of which 8 fit, and one more is read while
+	// waiting for room.
+	assert.LessOrEqual(t, run(8<<10), int64(9), "Reading waits for records to be written")
+	assert.LessOrEqual(t, run(100), int64(2), "Records larger than the bound are held one at a time")
+	most := run(0)
+	assert.Greater(t, most, int64(9), "Without a bound, reading runs ahead of the first record")
+	assert.LessOrEqual(t, most, int64(4*16+1), "Reading runs ahead by at most 16 records per worker")
+}
+
+func TestParseByteSize(t *testing.T) {
+	for input, want := range map[string]int64{
+		"1024":   1024,
+		"64K":    64 << 10,
+		"512MB":  512 << 20,
+		"2 GiB":  2 << 30,
+		"100B":   100,
+		"0":      0,
+		" 1MiB ": 1 << 20,
+	} {
+		size, err := pkg.ParseByteSize(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, size, input)
+	}
+	for _, input := range []string{"", "MB", "-1MB", "1.5GB", "12TB", "9999999999999GB"} {
+		_, err := pkg.ParseByteSize(input)
+		assert.Error(t, err, input)
+	}
+
+	config := pkg.Config{Format: "json", MaxMemory: "256MB"}
+	appConfig, err := config.AppConfig()
+	require.NoError(t, err)
+	assert.Equal(t, int64(256<<20), appConfig.MaxMemory)
+	config.MaxMemory = "lots"
+	_, err = config.AppConfig()
+	assert.ErrorContains(t, err, "invalid size")
+}
+
+func TestBatchSize(t *testing.T) {
+	var items, elements strings.Builder
+	for i := range 50 {
+		fmt.Fprintf(&items, "<item><email>user%d@example.com</email><note>order %d</note></item>", i%7, i)
+		if i > 0 {
+			elements.WriteString(",")
+		}
+		fmt.Fprintf(&elements, `{"email": "user%d@example.com", "n": %d}`, i%7, i)
+	}
+	inputs := map[string]string{
+		"xml":  "<items>" + items.String() + "</items>",
+		"json": "[" + elements.String() + "]",
+		"csv":  "email,n\nuser1@example.com,1\nuser2@example.com,2\nuser1@example.com,3\n",
+	}
+	masker := pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt"), FieldScoped: true}
+	for format, input := range inputs {
+		run := func(cpu, batchSize int) string {
+			var out strings.Builder
+			stats, err := pkg.Start(strings.NewReader(input), &out, pkg.AppConfig{Format: format, CPUCount: cpu, BatchSize: batchSize, Masker: masker})
+			require.NoError(t, err)
+			assert.Positive(t, stats.Records)
+			if format == "xml" {
+				// The fields of XML records are written in any order.
+				lines := strings.Split(out.String(), "\n")
+				slices.Sort(lines)
+				return strings.Join(lines, "\n")
+			}
+			return out.String()
+		}
+		serial := run(1, 1)
+		for _, batchSize := range []int{0, 3, 8, 100} {
+			assert.Equal(t, serial, run(4, batchSize), "%s in batches of %d is masked and ordered as one record at a time", format, batchSize)
+		}
+	}
+
+	var configErr *pkg.ConfigError
+	_, err := pkg.Start(strings.NewReader("[]"), io.Discard, pkg.AppConfig{Format: "json", BatchSize: -1, Masker: masker})
+	assert.ErrorAs(t, err, &configErr)
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// mapInput writes input to a file and maps it from offset.
+func mapInput(t *testing.T, input string, offset int64) *pkg.MappedInput {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.WriteFile(path, []byte(input), 0o644))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Seek(offset, io.SeekStart)
+	require.NoError(t, err)
+	mapped, err := pkg.MapInput(f)
+	require.NoError(t, err)
+	t.Cleanup(func() { mapped.Close() })
+	return mapped
+}
+
+func TestMappedInput(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd":
+	default:
+		t.Skip("memory-mapped input is not supported on", runtime.GOOS)
+	}
+	masker := pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")}
+	inputs := map[string]string{
+		"ndjson": "{\"email\": \"jan@example.com\", \"id\": 1}\n\n  {\"email\": \"piet@example.com\",\r\n \"id\": 2}\r\n{\"id\": 3}{\"id\": 4}  \n[\"kees@example.com\"]\n42",
+		"csv":    "name,email\r\nJan,jan@example.com\n\n\"De Vries, Piet\",\"piet\r\n\"\"p\"\"@example.com\"\nKees,\n",
+		// Read with each of the dialects tested.
+		"csv dialect": "name;email\nK\"ees;x\"\"\n# Wim;'w@ex;ample.com'\n'O''Neil';'o@example.com'\n\"Jan;jan@example.com\n",
+	}
+	configs := []pkg.AppConfig{
+		{Format: "ndjson"},
+		{Format: "ndjson", JSONBackend: "jsoniter"},
+		{Format: "ndjson", OutputStyle: pkg.StylePreserve},
+		{Format: "ndjson", Exclude: []string{"id"}},
+		{Format: "csv"},
+		{Format: "csv", NoHeader: true},
+		{Format: "csv", CSV: pkg.CSVDialect{Delimiter: ';', Quote: '\'', Comment: '#'}},
+		{Format: "csv", CSV: pkg.CSVDialect{LazyQuotes: true}},
+	}
+	for _, config := range configs {
+		config.CPUCount, config.Masker = 2, masker
+		input := inputs[config.Format]
+		if config.CSV != (pkg.CSVDialect{}) {
+			input = inputs["csv dialect"]
+		}
+		var read, sliced bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &read, config)
+		require.NoError(t, err)
+		stats, err := pkg.Start(mapInput(t, input, 0), &sliced, config)
+		require.NoError(t, err)
+		assert.Equal(t, read.String(), sliced.String(), "Records sliced out of the mapping are masked as those read, with %+v", config)
+		assert.Equal(t, int64(len(input)), stats.BytesIn)
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		input := "{\"id\": 1}\n{\"id\": 2}\n"
+		var buf bytes.Buffer
+		_, err := pkg.Start(mapInput(t, input, 10), &buf, pkg.AppConfig{Format: "ndjson", CPUCount: 1, Masker: pkg.MaskerConfig{Method: pkg.MethodNull}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n"), "The input starts at the offset of the file")
+
+		mapped := mapInput(t, input, 0)
+		data, err := io.ReadAll(mapped)
+		require.NoError(t, err)
+		assert.Equal(t, input, string(data), "Other formats read the mapping")
+		assert.EqualValues(t, len(input), mapped.Offset())
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for format, input := range map[string]string{
+			"ndjson": "{\"a\": 1}\n{\"a\": {\"b\":\n [1, }}\n",
+			"csv":    "a,b\n1,2\n\"3\",x\"y\n",
+		} {
+			config := pkg.AppConfig{Format: format, CPUCount: 1, Masker: masker}
+			_, readErr := pkg.Start(strings.NewReader(input), io.Discard, config)
+			_, slicedErr := pkg.Start(mapInput(t, input, 0), io.Discard, config)
+			var inputErr *pkg.InputError
+			require.ErrorAs(t, slicedErr, &inputErr)
+			assert.Equal(t, readErr.Error(), slicedErr.Error(), "Errors are located as in %s that is read", format)
+		}
+	})
+
+	t.Run("Not regular", func(t *testing.T) {
+		dir, err := os.Open(t.TempDir())
+		require.NoError(t, err)
+		defer dir.Close()
+		_, err = pkg.MapInput(dir)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+const mysqlDump = "-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)\n" +
+	"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n" +
+	"/*!40101 SET NAMES utf8mb4 */;\n" +
+	"DROP TABLE IF EXISTS `customers`;\n" +
+	"CREATE TABLE `customers` (\n" +
+	"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+	"  `email` varchar(255) DEFAULT NULL,\n" +
+	"  `note` text,\n" +
+	"  `avatar` blob,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+	"LOCK TABLES `customers` WRITE;\n" +
+	"/*!40000 ALTER TABLE `customers` DISABLE KEYS */;\n" +
+	"INSERT INTO `customers` VALUES (1,'jane@example.com','It\\'s a \\\"note\\\"\\nwith lines',0x89504E47),(2,'john@example.com',NULL,_binary 'GIF89a');\n" +
+	"/*!40000 ALTER TABLE `customers` ENABLE KEYS */;\n" +
+	"UNLOCK TABLES;\n" +
+	"INSERT INTO `orders` (`id`, `email`) VALUES (7,'mary@example.com');\n" +
+	"-- Dump completed on 2024-01-02 03:04:05\n"
+
+func TestMySQLDump(t *testing.T) {
+	run := func(t *testing.T, appConfig pkg.AppConfig) string {
+		appConfig.Format = "mysqldump"
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(mysqlDump), &buf, appConfig)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	t.Run("Layout is kept", func(t *testing.T) {
+		out := run(t, pkg.AppConfig{CPUCount: 2, Include: []string{"*.email"}})
+		assert.NotContains(t, out, "jane@example.com")
+		assert.NotContains(t, out, "mary@example.com")
+		for _, line := range strings.Split(mysqlDump, "\n") {
+			if !strings.HasPrefix(line, "INSERT") {
+				assert.Contains(t, out, line, "Everything but rows is kept")
+			}
+		}
+		assert.Contains(t, out, "INSERT INTO `customers` VALUES (1,'")
+		assert.Contains(t, out, `',0x89504E47),(2,'`, "Blobs are kept")
+		assert.Contains(t, out, `',NULL,_binary 'GIF89a');`)
+		assert.Contains(t, out, "INSERT INTO `orders` (`id`, `email`) VALUES (7,'")
+		assert.Contains(t, out, `'It\'s a \"note\"\nwith lines'`, "Unselected strings are escaped as they were")
+	})
+
+	t.Run("Columns are keyed by table", func(t *testing.T) {
+		out := run(t, pkg.AppConfig{CPUCount: 1, Include: []string{"orders.email"}})
+		assert.Contains(t, out, "jane@example.com")
+		assert.NotContains(t, out, "mary@example.com")
+	})
+
+	t.Run("Escaping", func(t *testing.T) {
+		rules := []pkg.Rule{{Pattern: "customers.note", Regex: `(?s)^(.*)$`, Replacement: "O'Brien\\\n"}}
+		out := run(t, pkg.AppConfig{CPUCount: 1, Rules: rules})
+		assert.Contains(t, out, `'O\'Brien\\\n'`)
+	})
+
+	t.Run("Input errors", func(t *testing.T) {
+		for _, dump := range []string{
+			"INSERT INTO `t` VALUES (1,'open\n",
+			"INSERT INTO `t` VALUES (1,2) (3,4);\n",
+			"CREATE TABLE `t` (\n  `a` int\n);\nINSERT INTO `t` VALUES (1,2);\n",
+		} {
+			_, err := pkg.Start(strings.NewReader(dump), io.Discard, pkg.AppConfig{Format: "mysqldump", CPUCount: 1})
+			var inputErr *pkg.InputError
+			assert.ErrorAs(t, err, &inputErr, dump)
+		}
+	})
+
+	t.Run("Subsets", func(t *testing.T) {
+		_, err := pkg.Start(strings.NewReader(mysqlDump), io.Discard, pkg.AppConfig{Format: "mysqldump", FirstN: 1})
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
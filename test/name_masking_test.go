@@ -0,0 +1,184 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// Gendered first names used when no locale is set.
+var (
+	maleNames   = []string{"James", "John", "Robert", "Michael", "William", "David", "Richard", "Joseph", "Thomas", "Charles", "Daniel", "Matthew", "Anthony", "Mark", "Steven", "Paul", "Andrew", "Joshua", "Kevin", "Brian"}
+	femaleNames = []string{"Mary", "Patricia", "Jennifer", "Linda", "Elizabeth", "Barbara", "Susan", "Jessica", "Sarah", "Karen", "Emily", "Michelle", "Amanda", "Melissa", "Laura", "Rebecca", "Emma", "Olivia", "Hannah", "Rachel"}
+)
+
+func TestNameMasking_CoherentNames(t *testing.T) {
+	input := `[
+		{"first_name": "Alice", "last_name": "Smith", "full_name": "Smith, Alice", "gender": "F"},
+		{"first_name": "Bob", "last_name": "Jones", "full_name": "Bob Jones", "gender": "male"}
+	]`
+
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 2,
+		Exclude:  []string{"gender"},
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodDeterministic,
+			Salt:   []byte("name-salt"),
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	require.Len(t, output, 2)
+
+	alice, bob := output[0], output[1]
+	assert.Equal(t, "F", alice["gender"])
+	assert.Contains(t, femaleNames, alice["first_name"])
+	assert.NotEqual(t, "Smith", alice["last_name"])
+	assert.Equal(t, alice["last_name"]+", "+alice["first_name"], alice["full_name"], "Full name should keep the last, first order")
+
+	assert.Equal(t, "male", bob["gender"])
+	assert.Contains(t, maleNames, bob["first_name"])
+	assert.Equal(t, bob["first_name"]+" "+bob["last_name"], bob["full_name"])
+}
+
+func TestNameMasking_MaskedTitleMatchesName(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("title,first_name,last_name\n")
+	for i := 0; i < 20; i++ {
+		input.WriteString("Mrs.,Alice,Smith\n")
+	}
+
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 21)
+
+	for _, record := range records[1:] {
+		switch record[0] {
+		case "Mrs.":
+			assert.Contains(t, femaleNames, record[1])
+		case "Mr.":
+			assert.Contains(t, maleNames, record[1])
+		default:
+			t.Errorf("Masked title should be Mr. or Mrs., got %q", record[0])
+		}
+		assert.NotEqual(t, "Smith", record[2])
+	}
+}
+
+func TestNameMasking_TitleIsNotAlwaysAName(t *testing.T) {
+	input := `{"title": "Chief Executive Officer", "name": "Alice Smith"}`
+
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Exclude:  []string{"title"},
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+	assert.Equal(t, "Chief Executive Officer", output["title"])
+	assert.NotEqual(t, "Alice Smith", output["name"])
+}
+
+func TestNameMasking_XMLDocument(t *testing.T) {
+	// Not a list, so the document is masked serially, element by element.
+	var filler strings.Builder
+	for i := 0; i < 3000; i++ {
+		filler.WriteString("<note>keep</note>")
+	}
+	input := `<staff>
+		<manager title="Mrs"><first_name>Alice</first_name><last_name>Smith</last_name><full_name>Smith, Alice</full_name><address><city>Paris</city></address></manager>
+		<notes>` + filler.String() + `</notes>
+		<employee><first_name>Bob</first_name><last_name>Jones</last_name><full_name>Bob Jones</full_name><gender>male</gender>
+			<card><number>4111111111111111</number><expiry>2024-03</expiry><cvv>123</cvv></card>
+		</employee>
+	</staff>`
+
+	appConfig := pkg.AppConfig{
+		Format:   "xml",
+		CPUCount: 1,
+		Include:  []string{"**.manager.*", "**.employee.*", "**.card.*"},
+		Exclude:  []string{"**.gender"},
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodDeterministic,
+			Salt:   []byte("name-salt"),
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	type person struct {
+		Title     string `xml:"title,attr"`
+		FirstName string `xml:"first_name"`
+		LastName  string `xml:"last_name"`
+		FullName  string `xml:"full_name"`
+		Gender    string `xml:"gender"`
+		Card      struct {
+			Number string `xml:"number"`
+			Expiry string `xml:"expiry"`
+		} `xml:"card"`
+	}
+	var output struct {
+		Manager  person   `xml:"manager"`
+		Notes    []string `xml:"notes>note"`
+		Employee person   `xml:"employee"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &output), "Output should be valid XML. Got: %s", buf.String())
+
+	manager := output.Manager
+	switch manager.Title {
+	case "Mrs":
+		assert.Contains(t, femaleNames, manager.FirstName)
+	case "Mr":
+		assert.Contains(t, maleNames, manager.FirstName)
+	default:
+		t.Errorf("Masked title should be Mr or Mrs, got %q", manager.Title)
+	}
+	assert.Equal(t, manager.LastName+", "+manager.FirstName, manager.FullName, "Sibling leaves are masked as one person")
+
+	employee := output.Employee
+	assert.Equal(t, "male", employee.Gender)
+	assert.Contains(t, maleNames, employee.FirstName)
+	assert.Equal(t, employee.FirstName+" "+employee.LastName, employee.FullName, "Records after more tokens than are held back are masked as one person")
+	assert.NotEqual(t, "4111111111111111", employee.Card.Number)
+	expiry, err := time.Parse("2006-01", employee.Card.Expiry)
+	require.NoError(t, err, "Expiry should keep the YYYY-MM layout")
+	assert.True(t, expiry.After(pkg.Now()), "Card fields are masked as one card")
+	assert.Len(t, output.Notes, 3000)
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestNDJSONProcessing(t *testing.T) {
+	input := "{\"email\": \"jan@example.com\", \"id\": 1}\n\n{\"email\": \"piet@example.com\",\n \"id\": 2}\n[\"kees@example.com\"]\n"
+	appConfig := pkg.AppConfig{Format: "ndjson", CPUCount: 2, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3, "Every record is written on a line of its own. Got: %s", buf.String())
+	for i, line := range lines {
+		var record any
+		require.NoError(t, json.Unmarshal([]byte(line), &record), "Line %d should be valid JSON", i+1)
+	}
+	assert.NotContains(t, buf.String(), "jan@example.com")
+	assert.NotContains(t, buf.String(), "kees@example.com")
+
+	_, err = pkg.Start(strings.NewReader(input), &bytes.Buffer{}, pkg.AppConfig{Format: "json", CPUCount: 1, Masker: appConfig.Masker})
+	assert.ErrorContains(t, err, "ndjson", "JSON input does not silently drop records after the first")
+}
+
+func TestNDJSONCheckpoint(t *testing.T) {
+	var input strings.Builder
+	var recordEnd int
+	for i := 0; i < 10005; i++ {
+		fmt.Fprintf(&input, "{\"email\": \"user%d@example.com\"}\n", i)
+		if i == 9999 {
+			recordEnd = input.Len() - 1 // Before the line break
+		}
+	}
+
+	var checkpoints []pkg.Checkpoint
+	appConfig := pkg.AppConfig{
+		Format:   "ndjson",
+		CPUCount: 4,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+		Checkpoint: func(c pkg.Checkpoint) error {
+			checkpoints = append(checkpoints, c)
+			return nil
+		},
+	}
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+	require.NoError(t, err)
+
+	require.Len(t, checkpoints, 1)
+	assert.Equal(t, 10000, checkpoints[0].Records)
+	assert.Equal(t, int64(recordEnd), checkpoints[0].Input)
+	assert.Equal(t, int64(len(strings.Join(strings.SplitAfter(buf.String(), "\n")[:10000], ""))), checkpoints[0].Output,
+		"The output offset covers exactly the checkpointed records")
+
+	appConfig.Format = "csv"
+	_, err = pkg.Start(strings.NewReader("a\n1\n"), &bytes.Buffer{}, appConfig)
+	var configErr *pkg.ConfigError
+	assert.ErrorAs(t, err, &configErr)
+}
+
+// countingBackend is a JSON backend counting the values it decodes, encoding
+// as encoding/json does.
+type countingBackend struct{ decoded *int }
+
+func (b countingBackend) Unmarshal(data []byte) (any, error) {
+	*b.decoded++
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	err := decoder.Decode(&v)
+	return v, err
+}
+
+func (b countingBackend) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func TestNDJSONBackends(t *testing.T) {
+	input := "{\"email\": \"jan@example.com\", \"id\": 12345678901234567890, \"tags\": [\"<b>\", 1.50]}\n{\"email\": \"piet@example.com\",\n \"name\": \"Piet\", \"ok\": true, \"none\": null}\n"
+	masker := pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")}
+	run := func(format, backend string) string {
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, pkg.AppConfig{Format: format, OutputStyle: pkg.StyleCompact, CPUCount: 2, Include: []string{"email", "name"}, JSONBackend: backend, Masker: masker})
+		require.NoError(t, err)
+		return buf.String()
+	}
+	std := run("ndjson", "std")
+	assert.Equal(t, std, run("ndjson", "jsoniter"), "Backends write the same records")
+	assert.Contains(t, std, `"id":12345678901234567890`, "Numbers keep their digits")
+	assert.Contains(t, std, `\u003cb\u003e`, "HTML characters are escaped")
+
+	decoded := 0
+	require.NoError(t, pkg.RegisterJSONBackend("counting", countingBackend{&decoded}))
+	assert.Equal(t, std, run("ndjson", "counting"))
+	assert.Equal(t, 2, decoded, "Registered backends decode the records")
+	assert.Error(t, pkg.RegisterJSONBackend("counting", countingBackend{&decoded}), "Names are registered once")
+	assert.Error(t, pkg.RegisterJSONBackend("jsoniter", countingBackend{&decoded}), "Built-in backends cannot be replaced")
+
+	_, err := pkg.Start(strings.NewReader(input), io.Discard, pkg.AppConfig{Format: "ndjson", JSONBackend: "sonic", Masker: masker})
+	var configErr *pkg.ConfigError
+	assert.ErrorAs(t, err, &configErr, "Unknown backends are rejected before reading")
+
+	var inputErr *pkg.InputError
+	_, err = pkg.Start(strings.NewReader("{\"a\": 1}\n{\"a\": }\n"), io.Discard, pkg.AppConfig{Format: "ndjson", CPUCount: 2, JSONBackend: "jsoniter", Masker: masker})
+	require.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, 2, inputErr.Line, "Errors are located as with encoding/json")
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestNullMethod(t *testing.T) {
+	nullConfig := pkg.MaskerConfig{Method: pkg.MethodNull}
+
+	t.Run("JSON", func(t *testing.T) {
+		input := `[{"id": 1, "ssn": "123-45-6789", "card": {"number": "4111111111111111", "cvv": "123"}}]`
+		appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, Exclude: []string{"id"}, Masker: nullConfig}
+
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+
+		var output []map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+		require.Len(t, output, 1)
+		assert.Equal(t, float64(1), output[0]["id"])
+		assert.Contains(t, output[0], "ssn")
+		assert.Nil(t, output[0]["ssn"])
+		assert.Equal(t, map[string]any{"number": nil, "cvv": nil}, output[0]["card"])
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		input := `<users><user id="7"><name>Alice</name></user><user id="8"><name>Bob</name></user></users>`
+		appConfig := pkg.AppConfig{Format: "xml", CPUCount: 1, Masker: nullConfig}
+
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+
+		output := buf.String()
+		assert.Equal(t, 2, strings.Count(output, `<user id="">`))
+		assert.Equal(t, 2, strings.Count(output, `<name></name>`))
+		assert.NotContains(t, output, "<nil>")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		input := "id,name,email\n1,Alice,alice@example.com\n"
+		appConfig := pkg.AppConfig{Format: "csv", CPUCount: 1, Include: []string{"email"}, Masker: nullConfig}
+
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"id", "name", "email"}, {"1", "Alice", ""}}, records)
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		appConfig := pkg.AppConfig{Format: "text", CPUCount: 1, Masker: nullConfig}
+
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader("secret line\n"), &buf, appConfig)
+		require.NoError(t, err)
+		assert.Equal(t, "\n", buf.String())
+	})
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestNumericMasking_PreserveSignAndClamp(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("balance,discount_pct,age\n")
+	for i := 0; i < 50; i++ {
+		input.WriteString("-120.50,85,42\n743,150,7\n")
+	}
+
+	ageRange, err := pkg.ParseRange("age=18:99")
+	require.NoError(t, err)
+	appConfig := pkg.AppConfig{
+		Format:      "csv",
+		CPUCount:    2,
+		Ranges:      []pkg.NumericRange{ageRange},
+		InferRanges: true,
+		Masker: pkg.MaskerConfig{
+			Method:       pkg.MethodRandom,
+			PreserveSign: true,
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 101)
+
+	negative := 0
+	for _, record := range records[1:] {
+		balance, err := strconv.ParseFloat(record[0], 64)
+		require.NoError(t, err)
+		if balance < 0 {
+			negative++
+			assert.Regexp(t, `^-\d{3}\.\d{2}$`, record[0], "Negative balances should keep their digits and decimals")
+		}
+
+		discount, err := strconv.Atoi(record[1])
+		require.NoError(t, err, "Clamped percentages should stay integers")
+		assert.GreaterOrEqual(t, discount, 0)
+		assert.LessOrEqual(t, discount, 100)
+
+		age, err := strconv.Atoi(record[2])
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, age, 18)
+		assert.LessOrEqual(t, age, 99)
+	}
+	assert.Equal(t, 50, negative, "Exactly the negative balances should stay negative")
+}
+
+func TestParseRange(t *testing.T) {
+	r, err := pkg.ParseRange("**.score=-1.5:1.5")
+	require.NoError(t, err)
+	assert.Equal(t, pkg.NumericRange{Pattern: "**.score", Min: -1.5, Max: 1.5}, r)
+
+	_, err = pkg.ParseRange("score=10")
+	assert.ErrorContains(t, err, "expected PATTERN=MIN:MAX")
+
+	appConfig := pkg.AppConfig{Format: "csv", Ranges: []pkg.NumericRange{{Pattern: "score", Min: 10, Max: 1}}}
+	_, err = pkg.Start(strings.NewReader("score\n5\n"), &bytes.Buffer{}, appConfig)
+	assert.ErrorContains(t, err, "minimum above its maximum")
+}
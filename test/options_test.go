@@ -0,0 +1,104 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestNew(t *testing.T) {
+	engine, err := pkg.New(
+		pkg.WithFormat("ndjson"),
+		pkg.WithCPUCount(2),
+		pkg.WithDeterministic([]byte("salt")),
+		pkg.WithInclude("**.email"),
+	)
+	require.NoError(t, err)
+
+	input := `{"email": "jane@example.com", "city": "Utrecht"}` + "\n"
+	outputs := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range outputs {
+		wg.Go(func() {
+			var out bytes.Buffer
+			_, err := engine.Mask(context.Background(), strings.NewReader(input), &out)
+			assert.NoError(t, err)
+			outputs[i] = out.String()
+		})
+	}
+	wg.Wait()
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(outputs[0]), &record))
+	assert.NotEqual(t, "jane@example.com", record["email"])
+	assert.Equal(t, "Utrecht", record["city"], "Keys that are not included are kept")
+	for _, output := range outputs[1:] {
+		assert.Equal(t, outputs[0], output, "Every run masks deterministically the same way")
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var configErr *pkg.ConfigError
+		_, err := pkg.New(pkg.WithInclude("user.[a"))
+		assert.ErrorAs(t, err, &configErr)
+		_, err = pkg.New(pkg.WithFormat("yaml"))
+		assert.ErrorAs(t, err, &configErr)
+	})
+
+	t.Run("Workers", func(t *testing.T) {
+		engine, err := pkg.New()
+		require.NoError(t, err)
+		assert.Zero(t, engine.Config().CPUCount)
+		stats, err := engine.Mask(context.Background(), strings.NewReader(`[{"email": "jane@example.com"}]`), io.Discard)
+		require.NoError(t, err)
+		assert.Equal(t, runtime.GOMAXPROCS(0), stats.Workers, "Engines mask with as many workers as Start")
+	})
+
+	t.Run("Built on an engine", func(t *testing.T) {
+		engine, err := pkg.New(pkg.WithDeterministic([]byte("salt")), pkg.WithInclude("email"))
+		require.NoError(t, err)
+		config := engine.Config()
+		masker, err := pkg.NewMasker(config.Masker)
+		require.NoError(t, err)
+		assert.Equal(t, masker.MaskKey("email", "jane@example.com"), engine.Masker().MaskKey("email", "jane@example.com"), "The masker of an engine masks with its method")
+
+		writeLine := func(w io.WriteCloser, err error) {
+			require.NoError(t, err)
+			_, err = io.WriteString(w, "mail jane@example.com\n")
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+		}
+		var logs, deprecated bytes.Buffer
+		writeLine(engine.Writer(&logs))
+		writeLine(pkg.NewMaskingWriter(&deprecated, config))
+		assert.NotContains(t, logs.String(), "jane@example.com")
+		assert.Equal(t, deprecated.String(), logs.String(), "Deprecated constructors mask as the engine")
+
+		var records bytes.Buffer
+		handler, err := engine.Handler(slog.NewJSONHandler(&records, nil))
+		require.NoError(t, err)
+		slog.New(handler).Info("signup", "email", "jane@example.com")
+		assert.NotContains(t, records.String(), "jane@example.com")
+		assert.Contains(t, records.String(), `"msg":"signup"`)
+	})
+
+	t.Run("From a config", func(t *testing.T) {
+		base := pkg.AppConfig{Format: "csv", CPUCount: 1, Include: []string{"name"}, Masker: pkg.MaskerConfig{Method: pkg.MethodNull}}
+		engine, err := pkg.New(pkg.WithConfig(base), pkg.WithInclude("email"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"name"}, base.Include, "The config passed is not modified")
+		var out bytes.Buffer
+		_, err = engine.Mask(context.Background(), strings.NewReader("name,email,city\nJane,jane@example.com,Utrecht\n"), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "name,email,city\n,,Utrecht\n", out.String())
+	})
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func maskWithStyle(t *testing.T, format, style, input string, exclude ...string) string {
+	t.Helper()
+	appConfig := pkg.AppConfig{
+		Format:      format,
+		CPUCount:    2,
+		Exclude:     exclude,
+		OutputStyle: style,
+		Masker:      pkg.MaskerConfig{Method: pkg.MethodNull},
+	}
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func TestOutputStyle_JSON(t *testing.T) {
+	input := "[\n\t{\"id\": 1, \"zip\": \"1234AB\", \"n\": 1.50, \"tags\": [\"x\"]},\n\t{\n\t\t\"zip\": \"5678CD\",\n\t\t\"id\": 2\n\t}\n]"
+	exclude := []string{"id", "n", "tags"}
+
+	t.Run("Preserve", func(t *testing.T) {
+		expected := "[\n\t{\"id\": 1, \"zip\": null, \"n\": 1.50, \"tags\": [\"x\"]},\n\t{\n\t\t\"zip\": null,\n\t\t\"id\": 2\n\t}\n]\n"
+		assert.Equal(t, expected, maskWithStyle(t, "json", pkg.StylePreserve, input, exclude...))
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		expected := `[{"id":1,"n":1.50,"tags":["x"],"zip":null},{"id":2,"zip":null}]` + "\n"
+		assert.Equal(t, expected, maskWithStyle(t, "json", pkg.StyleCompact, input, exclude...))
+	})
+
+	t.Run("Preserve root object", func(t *testing.T) {
+		input := "{ \"b\" : \"5678CD\",\n  \"a\":[ 1, 2 ] }"
+		expected := "{ \"b\" : null,\n  \"a\":[ 1, 2 ] }\n"
+		assert.Equal(t, expected, maskWithStyle(t, "json", pkg.StylePreserve, input, "a"))
+	})
+
+	t.Run("Preserve subset", func(t *testing.T) {
+		appConfig := pkg.AppConfig{
+			Format:      "json",
+			CPUCount:    1,
+			Exclude:     exclude,
+			OutputStyle: pkg.StylePreserve,
+			LastN:       1,
+			Masker:      pkg.MaskerConfig{Method: pkg.MethodNull},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		assert.Equal(t, "[\n\t{\n\t\t\"zip\": null,\n\t\t\"id\": 2\n\t}\n]\n", buf.String(), "The comma before a skipped record is dropped")
+	})
+}
+
+func TestOutputStyle_NDJSON(t *testing.T) {
+	input := "{\"id\": 1,  \"zip\": \"1234AB\"}\n\n{\"zip\":\"5678CD\",\"id\":2}\n"
+	assert.Equal(t, "{\"id\": 1,  \"zip\": null}\n{\"zip\":null,\"id\":2}\n", maskWithStyle(t, "ndjson", pkg.StylePreserve, input, "id"))
+	assert.Equal(t, "{\"id\":1,\"zip\":null}\n{\"id\":2,\"zip\":null}\n", maskWithStyle(t, "ndjson", "", input, "id"), "ndjson is compact by default")
+}
+
+func TestOutputStyle_XML(t *testing.T) {
+	input := "<users>\n\t<user id=\"1\"><zip>1234AB</zip></user>\n\t<user id=\"2\"><zip>5678CD</zip></user>\n</users>"
+
+	preserved := maskWithStyle(t, "xml", pkg.StylePreserve, input, "**.id")
+	assert.Equal(t, "<users>\n\t<user id=\"1\"><zip></zip></user>\n\t<user id=\"2\"><zip></zip></user>\n</users>", preserved)
+
+	compact := maskWithStyle(t, "xml", pkg.StyleCompact, input, "**.id")
+	assert.Contains(t, compact, `<users><user id="1"><zip></zip></user><user id="2"><zip></zip></user></users>`)
+}
+
+func TestOutputStyle_Invalid(t *testing.T) {
+	for _, appConfig := range []pkg.AppConfig{
+		{Format: "json", OutputStyle: "tidy"},
+		{Format: "csv", OutputStyle: pkg.StyleCompact},
+		{Format: "ndjson", OutputStyle: pkg.StylePretty},
+	} {
+		appConfig.CPUCount = 1
+		appConfig.Masker = pkg.MaskerConfig{Method: pkg.MethodNull}
+		_, err := pkg.Start(strings.NewReader("{}"), &bytes.Buffer{}, appConfig)
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, err, &configErr, appConfig.OutputStyle)
+	}
+}
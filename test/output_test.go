@@ -0,0 +1,62 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// gatedWriter holds up every write until open is closed.
+type gatedWriter struct {
+	open chan struct{}
+	buf  bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.open
+	return w.buf.Write(p)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestSlowOutput(t *testing.T) {
+	var input strings.Builder
+	for i := range 5000 {
+		fmt.Fprintf(&input, "{\"email\": \"user%d@example.com\"}\n", i)
+	}
+	var masked atomic.Int64
+	config := pkg.AppConfig{
+		Format:   "ndjson",
+		CPUCount: 2,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+		OnMask:   func(pkg.MaskEvent) bool { masked.Add(1); return true },
+	}
+
+	w := &gatedWriter{open: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		_, err := pkg.Start(strings.NewReader(input.String()), w, config)
+		done <- err
+	}()
+	// The output of every record fits in the buffers waiting to be written.
+	assert.Eventually(t, func() bool { return masked.Load() == 5000 }, 5*time.Second, time.Millisecond, "Records are masked while the output is held up")
+	close(w.open)
+	require.NoError(t, <-done)
+	assert.Equal(t, 5000, strings.Count(w.buf.String(), "\n"), "Every record is written once the output is")
+
+	_, err := pkg.Start(strings.NewReader(input.String()), failingWriter{}, config)
+	assert.ErrorContains(t, err, "disk full", "Errors writing the output stop the run")
+	_, err = pkg.Start(strings.NewReader(`{"email": "jan@example.com"}`), failingWriter{}, config)
+	assert.ErrorContains(t, err, "disk full", "Errors writing the last of the output are returned")
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestPartialMethod(t *testing.T) {
+	input := `{"card_number": "4111-1111-1111-1234", "phone": "+1 212-555-0123", "account": 1234567890, "name": "Alice"}`
+
+	testCases := []struct {
+		spec     string
+		exclude  []string
+		expected map[string]any
+	}{
+		{
+			spec:    "partial:last4",
+			exclude: []string{"name"},
+			expected: map[string]any{
+				"card_number": "****-****-****-1234",
+				"phone":       "+* ***-***-0123",
+				"account":     "******7890",
+				"name":        "Alice",
+			},
+		},
+		{
+			spec: "partial:first1,last2",
+			expected: map[string]any{
+				"card_number": "4***-****-****-**34",
+				"phone":       "+1 ***-***-**23",
+				"account":     "1*******90",
+				"name":        "A**ce",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			maskerConfig, err := pkg.ParseMethod(tc.spec)
+			require.NoError(t, err)
+
+			appConfig := pkg.AppConfig{
+				Format:   "json",
+				CPUCount: 1,
+				Exclude:  tc.exclude,
+				Masker:   maskerConfig,
+			}
+
+			var buf bytes.Buffer
+			_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+			require.NoError(t, err)
+
+			var output map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+			assert.Equal(t, tc.expected, output)
+		})
+	}
+}
+
+func TestParseMethod_Invalid(t *testing.T) {
+	for _, spec := range []string{"partial", "partial:middle3", "partial:lastx", "random:last4", "scramble"} {
+		_, err := pkg.ParseMethod(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestFilePathMasking(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		separator string
+		ext       string
+		root      string
+	}{
+		{name: "Unix absolute file", input: "/home/alice/documents/report.pdf", separator: "/", ext: ".pdf", root: "/"},
+		{name: "Unix home relative", input: "~/projects/secret/main.go", separator: "/", ext: ".go", root: "~/"},
+		{name: "Unix relative dots", input: "../alice/notes.txt", separator: "/", ext: ".txt", root: "../"},
+		{name: "Unix directory", input: "/var/lib/alice/", separator: "/", ext: "", root: "/"},
+		{name: "Windows drive", input: `C:\Users\Alice\Desktop\salaries.xlsx`, separator: `\`, ext: ".xlsx", root: `C:\`},
+		{name: "Windows UNC", input: `\\fileserver\hr\alice\contract.docx`, separator: `\`, ext: ".docx", root: `\\`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inputBytes, err := json.Marshal(map[string]string{"path": tc.input})
+			require.NoError(t, err)
+
+			appConfig := pkg.AppConfig{
+				Format:   "json",
+				CPUCount: 1,
+				Masker: pkg.MaskerConfig{
+					Method: pkg.MethodDeterministic,
+					Salt:   []byte("path-masking-salt"),
+				},
+			}
+
+			var buf bytes.Buffer
+			_, err = pkg.Start(bytes.NewReader(inputBytes), &buf, appConfig)
+			require.NoError(t, err)
+
+			var output map[string]string
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+			masked := output["path"]
+
+			assert.NotEqual(t, tc.input, masked)
+			assert.NotContains(t, strings.ToLower(masked), "alice")
+			assert.Equal(t, strings.Count(tc.input, tc.separator), strings.Count(masked, tc.separator), "Depth should be preserved")
+			if tc.ext != "" {
+				assert.True(t, strings.HasSuffix(masked, tc.ext), "Extension should be preserved")
+			}
+			assert.True(t, strings.HasPrefix(masked, tc.root), "Path root should be preserved")
+		})
+	}
+}
+
+func TestFilePathMasking_SharedDirectories(t *testing.T) {
+	input := `[{"path": "/home/alice/a.txt"}, {"path": "/home/alice/b.txt"}]`
+
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodDeterministic,
+			Salt:   []byte("path-masking-salt"),
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+	require.Len(t, output, 2)
+
+	// Directories common to both paths should be masked to the same names.
+	first, second := output[0]["path"], output[1]["path"]
+	assert.Equal(t, filepath.Dir(first), filepath.Dir(second))
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestPipe(t *testing.T) {
+	newEngine := func(t *testing.T, appConfig pkg.AppConfig) *pkg.Engine {
+		appConfig.Format = "ndjson"
+		engine, err := pkg.New(pkg.WithConfig(appConfig))
+		require.NoError(t, err)
+		return engine
+	}
+
+	t.Run("Lines are masked", func(t *testing.T) {
+		pipe := pkg.NewPipe(newEngine(t, pkg.AppConfig{Include: []string{"email"}}))
+		input := `{"email":"jane@example.com","level":"info","count":12345678901234567890}` + "\n" +
+			"login failed for jane@example.com\n" +
+			`{"email":"john@example.com"}`
+		var out bytes.Buffer
+		require.NoError(t, pipe.Run(context.Background(), strings.NewReader(input), &out))
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		require.Len(t, lines, 3)
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.NotEqual(t, "jane@example.com", record["email"])
+		assert.Equal(t, "info", record["level"])
+		assert.Contains(t, lines[0], `"count":12345678901234567890`, "Numbers are kept exactly")
+		assert.True(t, strings.HasPrefix(lines[1], "login failed for "))
+		assert.NotContains(t, lines[1], "jane@example.com", "Text lines are masked")
+		assert.NotContains(t, lines[2], "john@example.com", "A last line without a newline is masked")
+	})
+
+	t.Run("Long lines are dropped", func(t *testing.T) {
+		var report bytes.Buffer
+		pipe := pkg.NewPipe(newEngine(t, pkg.AppConfig{Report: &report}))
+		pipe.MaxLine = 16
+		input := `{"a":"short"}` + "\n" + `{"a":"` + strings.Repeat("x", 100000) + `"}` + "\n" + `{"a":"again"}` + "\n"
+		var out bytes.Buffer
+		require.NoError(t, pipe.Run(context.Background(), strings.NewReader(input), &out))
+		assert.Equal(t, 2, strings.Count(out.String(), "\n"))
+		assert.NotContains(t, out.String(), "xxx")
+		assert.Contains(t, report.String(), "line 2")
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		pipe := pkg.NewPipe(newEngine(t, pkg.AppConfig{Include: []string{"email"}}))
+		require.NoError(t, pipe.Reload(newEngine(t, pkg.AppConfig{Exclude: []string{"**"}})))
+		var out bytes.Buffer
+		require.NoError(t, pipe.Run(context.Background(), strings.NewReader(`{"email":"jane@example.com"}`+"\n"), &out))
+		assert.Equal(t, `{"email":"jane@example.com"}`+"\n", out.String())
+	})
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestPresets(t *testing.T) {
+	input := `{
+		"payment": {"card_number": "4111111111111111", "cvv": "123", "reference": "R-1"},
+		"notes": [{"text": "4111-1111-1111-1111"}],
+		"customer": {"first_name": "Jan", "last_name": "Smit", "ssn": "123-45-6789", "contact": "jan@example.com"},
+		"status": "paid"
+	}`
+	config := pkg.Config{
+		Format:  "json",
+		Include: []string{"payment.reference"},
+		Presets: []string{"pci", "gdpr"},
+		Rules:   []pkg.Rule{{Pattern: "customer.ssn", Method: "partial:last4"}},
+	}
+	appConfig, err := config.AppConfig()
+	require.NoError(t, err)
+	appConfig.CPUCount = 1
+	appConfig.Masker.Salt = []byte("preset-salt")
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	payment := output["payment"].(map[string]any)
+	assert.Equal(t, "************1111", payment["card_number"])
+	assert.Nil(t, payment["cvv"])
+	assert.NotEqual(t, "R-1", payment["reference"])
+	assert.Equal(t, "****-****-****-1111", output["notes"].([]any)[0].(map[string]any)["text"], "Card numbers are found under any key")
+
+	customer := output["customer"].(map[string]any)
+	assert.NotEqual(t, "Jan", customer["first_name"])
+	assert.NotEqual(t, "Smit", customer["last_name"])
+	assert.Equal(t, "***-**-6789", customer["ssn"], "Rules of the policy precede those of presets")
+	assert.Contains(t, customer["contact"], "@")
+	assert.NotEqual(t, "jan@example.com", customer["contact"])
+	assert.Equal(t, "paid", output["status"], "Fields no preset targets follow the include patterns")
+}
+
+func TestPresets_Unknown(t *testing.T) {
+	_, err := pkg.Config{Presets: []string{"sox"}}.AppConfig()
+	assert.ErrorContains(t, err, "gdpr, hipaa, pci")
+
+	for _, name := range pkg.Presets() {
+		rules, err := pkg.PresetRules(name)
+		require.NoError(t, err)
+		appConfig := pkg.AppConfig{
+			Format:   "json",
+			CPUCount: 1,
+			Rules:    rules,
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom, Salt: []byte("preset-salt")},
+		}
+		_, err = pkg.Start(strings.NewReader(`{}`), &bytes.Buffer{}, appConfig)
+		assert.NoError(t, err, "Preset %s should compile", name)
+	}
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestRandomSource(t *testing.T) {
+	input := `[{"name": "Jane Doe", "email": "jane@example.com", "age": 42}, {"name": "John Roe", "email": "john@example.com", "age": 37}]`
+	run := func(masker pkg.MaskerConfig, input, format string) string {
+		appConfig := pkg.AppConfig{Format: format, CPUCount: 1, Masker: masker}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		return buf.String()
+	}
+
+	t.Run("Seeded source", func(t *testing.T) {
+		first := run(pkg.MaskerConfig{Source: rand.NewSource(42)}, input, "json")
+		assert.Equal(t, first, run(pkg.MaskerConfig{Source: rand.NewSource(42)}, input, "json"), "The same seed masks the same way")
+		assert.NotEqual(t, first, run(pkg.MaskerConfig{Source: rand.NewSource(43)}, input, "json"))
+		assert.NotContains(t, first, "jane@example.com")
+	})
+
+	t.Run("Faker", func(t *testing.T) {
+		first := run(pkg.MaskerConfig{Faker: gofakeit.New(7)}, input, "json")
+		assert.Equal(t, first, run(pkg.MaskerConfig{Faker: gofakeit.New(7)}, input, "json"))
+	})
+
+	t.Run("Deterministic masking keeps its seeds", func(t *testing.T) {
+		salted := pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")}
+		withSource := salted
+		withSource.Source = rand.NewSource(42)
+		assert.Equal(t, run(salted, input, "json"), run(withSource, input, "json"))
+	})
+
+	t.Run("Shuffled columns", func(t *testing.T) {
+		var csv strings.Builder
+		csv.WriteString("id,city\n")
+		for i := range 50 {
+			csv.WriteString(strings.Repeat("x", i+1) + ",city" + strings.Repeat("y", i) + "\n")
+		}
+		shuffle := func(seed int64) string {
+			appConfig := pkg.AppConfig{Format: "csv", CPUCount: 1, Exclude: []string{"id"}, Shuffle: []string{"city"}, Masker: pkg.MaskerConfig{Source: rand.NewSource(seed)}}
+			var buf bytes.Buffer
+			_, err := pkg.Start(strings.NewReader(csv.String()), &buf, appConfig)
+			require.NoError(t, err)
+			return buf.String()
+		}
+		assert.Equal(t, shuffle(1), shuffle(1))
+		assert.NotEqual(t, shuffle(1), shuffle(2))
+	})
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"unaware/pkg"
+)
+
+func TestMaskMessage(t *testing.T) {
+	userSchema := `{"type": "record", "name": "User", "fields": [
+		{"name": "id", "type": "long"},
+		{"name": "email", "type": "string"},
+		{"name": "nick", "type": ["null", "string"]},
+		{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["ACTIVE", "BLOCKED"]}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}}
+	]}`
+	schemas := map[string]any{
+		"/schemas/ids/1": map[string]any{"schema": userSchema},
+		"/schemas/ids/2": map[string]any{"schemaType": "PROTOBUF", "schema": `syntax = "proto3";
+			message Order { string sku = 1; }
+			message User { int64 id = 1; string email = 2; }`},
+		"/subjects/users-value/versions/latest": map[string]any{"id": 1, "version": 3, "schema": userSchema},
+	}
+	var fetched atomic.Int32
+	registryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		schema, ok := schemas[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"error_code": 40403, "message": "Schema not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(schema)
+	}))
+	defer registryServer.Close()
+	registry, err := pkg.NewSchemaRegistry(registryServer.URL)
+	require.NoError(t, err)
+	engine, err := pkg.New(pkg.WithInclude("email", "nick", "tags[*]"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("Avro", func(t *testing.T) {
+		type user struct {
+			ID     int64    `avro:"id"`
+			Email  string   `avro:"email"`
+			Nick   *string  `avro:"nick"`
+			Status string   `avro:"status"`
+			Tags   []string `avro:"tags"`
+		}
+		nick := "jane@example.com"
+		payload, err := avro.Marshal(avro.MustParse(userSchema), user{ID: 42, Email: "jane@example.com", Nick: &nick, Status: "BLOCKED", Tags: []string{"+31 20 123 4567"}})
+		require.NoError(t, err)
+		msg := append([]byte{0, 0, 0, 0, 1}, payload...)
+
+		for range 2 {
+			masked, err := engine.MaskMessage(ctx, registry, msg)
+			require.NoError(t, err)
+			assert.Equal(t, msg[:5], masked[:5], "The schema ID is kept")
+			var got user
+			require.NoError(t, avro.Unmarshal(avro.MustParse(userSchema), masked[5:], &got))
+			assert.Equal(t, int64(42), got.ID)
+			assert.Equal(t, "BLOCKED", got.Status, "Enums are kept")
+			assert.NotEqual(t, "jane@example.com", got.Email)
+			assert.Contains(t, got.Email, "@")
+			require.NotNil(t, got.Nick)
+			assert.NotEqual(t, nick, *got.Nick)
+			require.Len(t, got.Tags, 1)
+			assert.NotEqual(t, "+31 20 123 4567", got.Tags[0])
+		}
+		assert.Equal(t, int32(1), fetched.Load(), "Schemas are fetched once")
+	})
+
+	t.Run("Protobuf", func(t *testing.T) {
+		payload := protowire.AppendTag(nil, 1, protowire.VarintType)
+		payload = protowire.AppendVarint(payload, 42)
+		payload = protowire.AppendTag(payload, 2, protowire.BytesType)
+		payload = protowire.AppendString(payload, "jane@example.com")
+		// The message indexes [1] select User, the second message.
+		msg := append([]byte{0, 0, 0, 0, 2, 2, 2}, payload...)
+
+		masked, err := engine.MaskMessage(ctx, registry, msg)
+		require.NoError(t, err)
+		assert.Equal(t, msg[:7], masked[:7], "The schema ID and message indexes are kept")
+		fields := map[protowire.Number][]byte{}
+		for b := masked[7:]; len(b) > 0; {
+			number, kind, n := protowire.ConsumeTag(b)
+			require.Positive(t, n)
+			b = b[n:]
+			n = protowire.ConsumeFieldValue(number, kind, b)
+			require.Positive(t, n)
+			fields[number], b = b[:n], b[n:]
+		}
+		id, _ := protowire.ConsumeVarint(fields[1])
+		assert.Equal(t, uint64(42), id)
+		email, _ := protowire.ConsumeString(fields[2])
+		assert.NotEqual(t, "jane@example.com", email)
+		assert.Contains(t, email, "@")
+	})
+
+	t.Run("Subjects", func(t *testing.T) {
+		id, err := registry.SchemaID(ctx, "users-value", "latest")
+		require.NoError(t, err)
+		assert.Equal(t, 1, id)
+		_, err = registry.SchemaID(ctx, "orders-value", "latest")
+		assert.ErrorContains(t, err, "Schema not found")
+	})
+
+	t.Run("Invalid messages", func(t *testing.T) {
+		var inputErr *pkg.InputError
+		_, err := engine.MaskMessage(ctx, registry, []byte{1, 0, 0, 0, 1, 0})
+		assert.ErrorAs(t, err, &inputErr, "Unknown magic byte")
+		_, err = engine.MaskMessage(ctx, registry, []byte{0, 0, 0, 0, 1, 84})
+		assert.ErrorAs(t, err, &inputErr, "Truncated payload")
+		_, err = engine.MaskMessage(ctx, registry, []byte{0, 0, 0, 0, 9})
+		assert.ErrorContains(t, err, "Schema not found")
+	})
+}
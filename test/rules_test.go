@@ -0,0 +1,237 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestRegexRules(t *testing.T) {
+	input := `[{"order_id": "ORD-20240101", "email": "jane@example.com", "amount": 1234.56, "ref": "none", "notes": "keep me"}]`
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Include:  []string{"notes"},
+		Exclude:  []string{"notes"},
+		Rules: []pkg.Rule{
+			{Pattern: "order_id", Regex: `-(\d+)$`},
+			{Pattern: "email", Regex: `^[^@]+@(.+)$`, Replacement: "user@$1"},
+			{Pattern: "amount", Regex: `\.\d+$`, Replacement: ".00"},
+			{Pattern: "ref", Regex: `\d+`},
+		},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]any
+	decoder := json.NewDecoder(&buf)
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&output))
+	require.Len(t, output, 1)
+
+	assert.Regexp(t, `^ORD-\d{8}$`, output[0]["order_id"], "Only the captured digits should be masked")
+	assert.NotEqual(t, "ORD-20240101", output[0]["order_id"])
+	assert.Equal(t, "user@example.com", output[0]["email"])
+	assert.Equal(t, json.Number("1234.00"), output[0]["amount"], "Numbers should stay numbers")
+	assert.Equal(t, "none", output[0]["ref"], "Values the regex does not match should be left unchanged")
+	assert.Equal(t, "keep me", output[0]["notes"], "Unmatched fields follow the include and exclude patterns")
+}
+
+func TestRegexRules_Text(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "text",
+		CPUCount: 1,
+		Rules:    []pkg.Rule{{Regex: `\d{3}-\d{4}`}},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader("call 555-1234 now\n"), &buf, appConfig)
+	require.NoError(t, err)
+	assert.Regexp(t, `^call \d{3}-\d{4} now\n$`, buf.String())
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := pkg.ParseRule(`email=^[^@]+@(.+)$=>user@$1`)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.Rule{Pattern: "email", Regex: `^[^@]+@(.+)$`, Replacement: "user@$1"}, rule)
+
+	rule, err = pkg.ParseRule(`order_id=-(\d+)$`)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.Rule{Pattern: "order_id", Regex: `-(\d+)$`}, rule)
+
+	_, err = pkg.ParseRule("order_id")
+	assert.Error(t, err)
+
+	appConfig := pkg.AppConfig{Format: "json", CPUCount: 1, Rules: []pkg.Rule{{Pattern: "a", Regex: "("}}}
+	_, err = pkg.Start(strings.NewReader(`{"a": "b"}`), &bytes.Buffer{}, appConfig)
+	assert.Error(t, err, "Invalid regexes should be rejected")
+}
+
+func TestTemplateRules(t *testing.T) {
+	input := `name,location,employee_id
+Alice Smith,Amsterdam,E1
+Alice Smith,Utrecht,E2`
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 2,
+		Rules: []pkg.Rule{
+			{Pattern: "name", Template: "{firstname} {lastname}"},
+			{Pattern: "location", Template: "{city}, {stateabr}"},
+			{Pattern: "employee_id", Template: "EMP-####"},
+		},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("template-salt")},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	for _, record := range records[1:] {
+		assert.Regexp(t, `^\S+ \S+$`, record[0])
+		assert.Regexp(t, `^.+, [A-Z]{2}$`, record[1])
+		assert.Regexp(t, `^EMP-\d{4}$`, record[2])
+	}
+	assert.NotEqual(t, "Alice Smith", records[1][0])
+	assert.Equal(t, records[1][0], records[2][0], "Identical values should generate identical fakes in deterministic mode")
+
+	appConfig.Rules = []pkg.Rule{{Pattern: "name", Template: "{nosuchfunction}"}}
+	_, err = pkg.Start(strings.NewReader(input), &bytes.Buffer{}, appConfig)
+	assert.Error(t, err, "Unknown template functions should be rejected")
+}
+
+func TestValueRules(t *testing.T) {
+	input := `{"id": "T-1", "thread": [{"from": "jane@example.com", "body": "hello", "ref": "ORD-42"}], "comments": {"by": "bob@example.org"}, "label": "open"}`
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Include:  []string{"id"},
+		Rules: []pkg.Rule{
+			{Pattern: "comments.**", Detected: "email", Method: "hash:12"},
+			{Detected: "email"},
+			{Value: `^ORD-\d+$`, Regex: `\d+`},
+		},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodRandom, Salt: []byte("value-salt")},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	assert.NotEqual(t, "T-1", output["id"])
+	message := output["thread"].([]any)[0].(map[string]any)
+	assert.NotEqual(t, "jane@example.com", message["from"])
+	assert.Contains(t, message["from"], "@", "Detected emails are masked as emails")
+	assert.Equal(t, "hello", message["body"], "Values no rule matches follow the include patterns")
+	assert.Regexp(t, `^ORD-\d+$`, message["ref"])
+	assert.NotEqual(t, "ORD-42", message["ref"])
+	assert.Regexp(t, `^[0-9a-f]{12}$`, output["comments"].(map[string]any)["by"], "Rules combine key and value conditions")
+	assert.Equal(t, "open", output["label"])
+}
+
+func TestValueRules_Invalid(t *testing.T) {
+	for _, rule := range []pkg.Rule{{Value: "("}, {Detected: "name"}} {
+		appConfig := pkg.AppConfig{
+			Format:   "json",
+			CPUCount: 1,
+			Rules:    []pkg.Rule{rule},
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		_, err := pkg.Start(strings.NewReader(`{}`), &bytes.Buffer{}, appConfig)
+		assert.Error(t, err)
+	}
+}
+
+func TestRulePriority(t *testing.T) {
+	input := `{"support": {"agent": "Jane", "ticket": "T-9", "email": "jane@example.com"}, "owner": "bob@example.org"}`
+	rules := []pkg.Rule{
+		{Pattern: "**", Detected: "email", Method: "hash:12", Priority: -1},
+		{Pattern: "support.**", Method: "null"},
+		{Pattern: "support.agent", Template: "AGENT", Priority: 10},
+		{Pattern: "support.ticket", Template: "never applied"},
+	}
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 1,
+		Rules:    rules,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom, Salt: []byte("priority-salt")},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	support := output["support"].(map[string]any)
+	assert.Equal(t, "AGENT", support["agent"], "Higher priorities are evaluated first")
+	assert.Nil(t, support["ticket"], "Equal priorities keep their order, the first match wins")
+	assert.Nil(t, support["email"])
+	assert.Regexp(t, `^[0-9a-f]{12}$`, output["owner"], "Lower priorities apply when nothing else matches")
+	assert.Equal(t, "**", rules[0].Pattern, "The caller's rules keep their order")
+}
+
+func TestRulesOnRepeatedKeys(t *testing.T) {
+	// More elements than a masker remembers the keys of, which repeat the
+	// same keys with values the rules tell apart.
+	var input strings.Builder
+	const elements = 20000
+	for i := range elements {
+		if i%2 == 0 {
+			fmt.Fprintf(&input, `{"items": [{"email": "user%d@example.com", "note": "jane%d@example.com", "city": "Utrecht"}]}`+"\n", i, i)
+		} else {
+			fmt.Fprintf(&input, `{"items": [{"email": "user%d@example.com", "note": "call back %d", "city": "Utrecht"}]}`+"\n", i, i)
+		}
+	}
+	input.WriteString(`{"items": [` + strings.Repeat(`{"email": "bulk@example.com", "city": "Utrecht"},`, elements) + `{"city": "Utrecht"}]}` + "\n")
+	appConfig := pkg.AppConfig{
+		Format:   "ndjson",
+		CPUCount: 2,
+		Include:  []string{"**.email"},
+		Exclude:  []string{"items[1].email"},
+		Rules:    []pkg.Rule{{Pattern: "**.note", Detected: "email", Method: "hash:12"}},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, elements+1)
+	for i, line := range lines[:elements] {
+		var record struct{ Items []map[string]string }
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		item := record.Items[0]
+		require.NotEqual(t, fmt.Sprintf("user%d@example.com", i), item["email"], "Include patterns select the key in every record")
+		require.Equal(t, "Utrecht", item["city"])
+		if strings.HasPrefix(item["note"], "call back") {
+			continue
+		}
+		require.Regexp(t, `^[0-9a-f]{12}$`, item["note"], "Rules select the values of the key they detect")
+	}
+	var bulk struct{ Items []map[string]string }
+	require.NoError(t, json.Unmarshal([]byte(lines[elements]), &bulk))
+	assert.Equal(t, "bulk@example.com", bulk.Items[1]["email"], "Exclude patterns select the elements they index")
+	for i, item := range bulk.Items[:elements] {
+		if i != 1 && item["email"] == "bulk@example.com" {
+			t.Fatalf("Element %d is not masked: %v", i, item)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestInspectSample_JSON(t *testing.T) {
+	var records []string
+	for i := 0; i < 12; i++ {
+		status := []string{"open", "paid"}[i%2]
+		records = append(records, fmt.Sprintf(`{"id": %d, "status": %q, "active": true, "customer": {"first_name": "Jan", "email": "user%d@example.com"}, "note": null}`, i, status, i))
+	}
+	fields, err := pkg.InspectSample(strings.NewReader("["+strings.Join(records, ",")+"]"), "json")
+	require.NoError(t, err)
+
+	byPath := make(map[string]pkg.FieldSummary)
+	var paths []string
+	for _, field := range fields {
+		byPath[field.Path] = field
+		paths = append(paths, field.Path)
+	}
+	assert.Equal(t, []string{"active", "customer.email", "customer.first_name", "id", "note", "status"}, paths)
+
+	email := byPath["customer.email"]
+	assert.Equal(t, "email", email.Type)
+	assert.Equal(t, 12, email.Count)
+	assert.Equal(t, 12, email.Distinct)
+	assert.Equal(t, "user0@…", email.Example, "Examples are truncated")
+	assert.True(t, email.Mask)
+
+	assert.Equal(t, "first_name", byPath["customer.first_name"].Type, "Names are recognized by their key")
+	assert.True(t, byPath["customer.first_name"].Mask, "Names are masked even when they repeat")
+	assert.True(t, byPath["id"].Mask)
+	assert.False(t, byPath["status"].Mask, "Categorical fields are kept")
+	assert.False(t, byPath["active"].Mask)
+	assert.False(t, byPath["note"].Mask)
+}
+
+func TestScaffoldConfig(t *testing.T) {
+	input := "id,country,email\n"
+	for i := 0; i < 20; i++ {
+		input += fmt.Sprintf("%d,NL,user%d@example.com\n", i, i)
+	}
+	fields, err := pkg.InspectSample(strings.NewReader(input), "csv")
+	require.NoError(t, err)
+	require.Len(t, fields, 3)
+
+	var buf bytes.Buffer
+	require.NoError(t, pkg.ScaffoldConfig(&buf, "csv", fields))
+	assert.Contains(t, buf.String(), `- country # text, 1 distinct of 20, e.g. "NL"`)
+
+	// The starter config is a valid policy.
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	config, err := pkg.LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "csv", config.Format)
+	assert.Equal(t, []string{"country"}, config.Exclude)
+	require.Len(t, config.Rules, 2)
+	assert.Equal(t, pkg.Rule{Pattern: "email", Type: "email"}, config.Rules[1])
+
+	appConfig, err := config.AppConfig()
+	require.NoError(t, err)
+	appConfig.CPUCount = 1
+	var masked bytes.Buffer
+	_, err = pkg.Start(strings.NewReader(input), &masked, appConfig)
+	require.NoError(t, err)
+	assert.Contains(t, masked.String(), ",NL,")
+	assert.NotContains(t, masked.String(), "user1@example.com")
+}
+
+func TestInspectSample_UnsupportedFormat(t *testing.T) {
+	_, err := pkg.InspectSample(strings.NewReader("<a/>"), "xml")
+	assert.Error(t, err)
+}
+
+func TestScaffoldConfig_Methods(t *testing.T) {
+	fields := []pkg.FieldSummary{
+		{Path: "ssn", Type: "number_like", Count: 1, Distinct: 1, Mask: true, Method: "null"},
+		{Path: "card", Type: "credit_card", Count: 1, Distinct: 1, Mask: true, Method: "partial:last4"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, pkg.ScaffoldConfig(&buf, "json", fields))
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	config, err := pkg.LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, config.Rules, 2)
+	assert.Equal(t, "null", config.Rules[0].Method, "The null method is not written as a YAML null")
+	assert.Equal(t, pkg.Rule{Pattern: "card", Type: "credit_card", Method: "partial:last4"}, config.Rules[1])
+}
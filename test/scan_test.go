@@ -0,0 +1,70 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestScan_JSON(t *testing.T) {
+	input := `[
+		{"user": {"email": "jan@example.com", "firstName": "Jan"}, "status": "active"},
+		{"user": {"email": "piet@example.com"}, "devices": [{"ip": "10.0.0.1"}, {"ip": "192.168.1.20"}]}
+	]`
+	findings, err := pkg.Scan(strings.NewReader(input), "json", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.Finding{
+		{Path: "devices.ip", Type: "ipv4", Count: 2, Location: "record 2, devices[0].ip", Line: 3},
+		{Path: "user.email", Type: "email", Count: 2, Location: "record 1", Line: 2},
+		{Path: "user.firstName", Type: "first_name", Count: 1, Location: "record 1", Line: 2},
+	}, findings)
+
+	findings, err = pkg.Scan(strings.NewReader(input), "json", []string{"devices.**", "**.firstName"})
+	require.NoError(t, err)
+	require.Len(t, findings, 1, "Excluded keys are not reported")
+	assert.Equal(t, "user.email", findings[0].Path)
+}
+
+func TestScan_CSV(t *testing.T) {
+	input := "id,contact,note\n1,jan@example.com,hello\n2,+31 20 123 4567,\n3,piet@example.com,\n"
+	findings, err := pkg.Scan(strings.NewReader(input), "csv", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.Finding{
+		{Path: "contact", Type: "email", Count: 2, Location: "line 2", Line: 2},
+		{Path: "contact", Type: "phone", Count: 1, Location: "line 3", Line: 3},
+	}, findings)
+
+	_, err = pkg.Scan(strings.NewReader("hello"), "text", nil)
+	var configErr *pkg.ConfigError
+	assert.ErrorAs(t, err, &configErr)
+}
+
+func TestScan_XML(t *testing.T) {
+	input := "<users>\n  <user id=\"1\">\n    <email>jan@example.com</email>\n    <phone>+31 20 123 4567</phone>\n  </user>\n" +
+		"  <user owner=\"piet@example.com\">\n    <email>piet@example.com</email>\n  </user>\n</users>\n"
+	findings, err := pkg.Scan(strings.NewReader(input), "xml", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.Finding{
+		{Path: "user.-owner", Type: "email", Count: 1, Location: "line 6", Line: 6},
+		{Path: "user.email", Type: "email", Count: 2, Location: "line 3", Line: 3},
+		{Path: "user.phone", Type: "phone", Count: 1, Location: "line 4", Line: 4},
+	}, findings)
+
+	_, err = pkg.Scan(strings.NewReader("<users><user>"), "xml", nil)
+	var inputErr *pkg.InputError
+	assert.ErrorAs(t, err, &inputErr)
+}
+
+func TestScan_MySQLDump(t *testing.T) {
+	input := "CREATE TABLE `customers` (\n  `id` int,\n  `email` varchar(255)\n);\n" +
+		"INSERT INTO `customers` VALUES (1,'jan@example.com'),(2,'piet@example.com');\n"
+	findings, err := pkg.Scan(strings.NewReader(input), "mysqldump", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.Finding{
+		{Path: "customers.email", Type: "email", Count: 2, Location: "line 5", Line: 5},
+	}, findings)
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestServer(t *testing.T) {
+	serve := func(t *testing.T, options ...pkg.Option) (string, func() error) {
+		engine, err := pkg.New(append([]pkg.Option{pkg.WithCPUCount(1)}, options...)...)
+		require.NoError(t, err)
+		server, err := pkg.NewServer(engine)
+		require.NoError(t, err)
+		server.MaxFrame = 1024
+		socket := filepath.Join(t.TempDir(), "unaware.sock")
+		listener, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- server.Serve(ctx, listener) }()
+		stop := sync.OnceValue(func() error {
+			cancel()
+			return <-done
+		})
+		t.Cleanup(func() { stop() })
+		return socket, stop
+	}
+	request := func(t *testing.T, r *bufio.Reader, conn net.Conn, format, input string) (string, string) {
+		fmt.Fprintf(conn, "%s %d\n%s", format, len(input), input)
+		header, err := r.ReadString('\n')
+		require.NoError(t, err)
+		status, length, _ := strings.Cut(strings.TrimSpace(header), " ")
+		n, err := strconv.Atoi(length)
+		require.NoError(t, err)
+		body := make([]byte, n)
+		_, err = io.ReadFull(r, body)
+		require.NoError(t, err)
+		return status, string(body)
+	}
+
+	t.Run("Requests", func(t *testing.T) {
+		socket, _ := serve(t, pkg.WithInclude("email"))
+		conn, err := net.Dial("unix", socket)
+		require.NoError(t, err)
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		status, body := request(t, r, conn, "json", `{"email":"jane@example.com","plan":"pro"}`)
+		assert.Equal(t, "ok", status)
+		assert.NotContains(t, body, "jane@example.com")
+		assert.Contains(t, body, `"plan":"pro"`)
+		assert.Equal(t, 1, strings.Count(body, "\n"), "JSON is answered on one line")
+
+		status, body = request(t, r, conn, "csv", "email,plan\njane@example.com,pro\n")
+		assert.Equal(t, "ok", status)
+		assert.True(t, strings.HasPrefix(body, "email,plan\n"))
+		assert.NotContains(t, body, "jane@example.com")
+
+		status, body = request(t, r, conn, "yaml", "email: jane@example.com")
+		assert.Equal(t, "error", status)
+		assert.Contains(t, body, "yaml")
+
+		status, _ = request(t, r, conn, "-", `{"email":"jane@example.com"}`)
+		assert.Equal(t, "ok", status, "Connections outlive failed requests")
+	})
+
+	t.Run("Malformed requests close the connection", func(t *testing.T) {
+		socket, _ := serve(t)
+		for _, header := range []string{"json\n", "json -1\n", "json 2048\n"} {
+			conn, err := net.Dial("unix", socket)
+			require.NoError(t, err)
+			fmt.Fprint(conn, header)
+			response, err := io.ReadAll(conn)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(response), "error "), header)
+			conn.Close()
+		}
+	})
+
+	t.Run("Mappings are saved on shutdown", func(t *testing.T) {
+		mappingFile := filepath.Join(t.TempDir(), "mappings")
+		key := []byte("0123456789abcdef0123456789abcdef")
+		socket, stop := serve(t, pkg.WithInclude("email"), func(c *pkg.AppConfig) {
+			c.MappingFile = mappingFile
+			c.MappingKey = key
+		})
+		var masked []string
+		for range 2 {
+			conn, err := net.Dial("unix", socket)
+			require.NoError(t, err)
+			_, body := request(t, bufio.NewReader(conn), conn, "json", `{"email":"jane@example.com"}`)
+			masked = append(masked, body)
+			conn.Close()
+		}
+		assert.Equal(t, masked[0], masked[1], "Requests share mappings")
+		require.NoError(t, stop())
+
+		mappings, err := pkg.ReadMappings(mappingFile, key)
+		require.NoError(t, err)
+		require.Len(t, mappings, 1)
+		assert.Equal(t, "jane@example.com", mappings[0].Original)
+	})
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestShuffleColumns(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("name,salary,department\n")
+	var salaries, departments []string
+	for i := range 50 {
+		salary, department := fmt.Sprint(30000+i*1000), fmt.Sprintf("dept-%d", i%5)
+		salaries, departments = append(salaries, salary), append(departments, department)
+		fmt.Fprintf(&input, "Person %d,%s,%s\n", i, salary, department)
+	}
+
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 4,
+		Shuffle:  []string{"salary", "department"},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+	require.NoError(t, err)
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 51)
+	assert.Equal(t, []string{"name", "salary", "department"}, records[0])
+
+	var gotSalaries, gotDepartments []string
+	moved := 0
+	for i, record := range records[1:] {
+		assert.NotEqual(t, fmt.Sprintf("Person %d", i), record[0], "Other columns should be masked")
+		gotSalaries, gotDepartments = append(gotSalaries, record[1]), append(gotDepartments, record[2])
+		if record[1] != salaries[i] {
+			moved++
+		}
+	}
+	slices.Sort(gotSalaries)
+	slices.Sort(gotDepartments)
+	slices.Sort(salaries)
+	slices.Sort(departments)
+	assert.Equal(t, salaries, gotSalaries, "Shuffled columns should keep exactly the original values")
+	assert.Equal(t, departments, gotDepartments)
+	assert.Greater(t, moved, 25, "Most values should end up in another row")
+}
+
+func TestShuffleColumns_UnknownColumn(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		Shuffle:  []string{"salary"},
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+	_, err := pkg.Start(strings.NewReader("name\nAlice\n"), &bytes.Buffer{}, appConfig)
+	assert.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestMaskingHandler(t *testing.T) {
+	var out bytes.Buffer
+	appConfig := pkg.AppConfig{
+		Include: []string{"**.name", "user.age"},
+		Exclude: []string{"request_id"},
+		Masker:  pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+	}
+	handler, err := pkg.NewMaskingHandler(slog.NewJSONHandler(&out, nil), appConfig)
+	require.NoError(t, err)
+	logger := slog.New(handler).With("request_id", "ops@example.com")
+	logger.WithGroup("user").Info("signed up from 10.0.0.1",
+		"name", "Jane Doe",
+		"age", 42,
+		"note", "reach me at jane@example.com",
+		"plan", "pro",
+		slog.Group("address", "city", "Utrecht"),
+	)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry), out.String())
+	assert.NotContains(t, entry["msg"], "10.0.0.1", "Detected words of messages are masked")
+	assert.Contains(t, entry["msg"], "signed up from ")
+	assert.Equal(t, "ops@example.com", entry["request_id"], "Excluded keys are kept")
+	user := entry["user"].(map[string]any)
+	assert.NotEqual(t, "Jane Doe", user["name"])
+	assert.IsType(t, float64(0), user["age"], "Numbers stay numbers")
+	assert.NotEqual(t, float64(42), user["age"])
+	assert.NotContains(t, user["note"], "jane@example.com")
+	assert.Contains(t, user["note"], "reach me at ")
+	assert.Equal(t, "pro", user["plan"], "Other values are kept")
+	assert.Equal(t, "Utrecht", user["address"].(map[string]any)["city"])
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+// fakeRows are rows of a query, as a database driver would return them.
+type fakeRows struct {
+	columns []string
+	rows    [][]any
+	next    int
+}
+
+func (r *fakeRows) Columns() ([]string, error) { return r.columns, nil }
+func (r *fakeRows) Next() bool                 { r.next++; return r.next <= len(r.rows) }
+func (r *fakeRows) Err() error                 { return nil }
+func (r *fakeRows) Close() error               { return nil }
+
+func (r *fakeRows) Scan(dest ...any) error {
+	if r.next < 1 || r.next > len(r.rows) {
+		return errors.New("no row")
+	}
+	for i, value := range r.rows[r.next-1] {
+		*dest[i].(*any) = value
+	}
+	return nil
+}
+
+func TestMaskedRows(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := &fakeRows{
+		columns: []string{"id", "email", "balance", "created_at", "nickname"},
+		rows:    [][]any{{int64(7), []byte("jane@example.com"), 1042.5, created, nil}},
+	}
+	appConfig := pkg.AppConfig{
+		Exclude: []string{"id"},
+		Masker:  pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+	}
+	masked, err := pkg.NewMaskedRows(rows, appConfig)
+	require.NoError(t, err)
+
+	require.True(t, masked.Next())
+	var (
+		id        int
+		email     string
+		balance   float64
+		createdAt time.Time
+		nickname  sql.NullString
+	)
+	require.NoError(t, masked.Scan(&id, &email, &balance, &createdAt, &nickname))
+	assert.Equal(t, 7, id, "Excluded columns are kept")
+	assert.NotEqual(t, "jane@example.com", email)
+	assert.Contains(t, email, "@")
+	assert.NotEqual(t, 1042.5, balance)
+	assert.False(t, createdAt.IsZero())
+	assert.NotEqual(t, created, createdAt)
+	assert.False(t, nickname.Valid, "NULL stays NULL")
+	assert.False(t, masked.Next())
+	assert.NoError(t, masked.Err())
+	assert.NoError(t, masked.Close())
+
+	assert.Error(t, masked.Scan(&id), "Every column needs a destination")
+
+	t.Run("Engine", func(t *testing.T) {
+		engine, err := pkg.New(pkg.WithExclude("id"), pkg.WithDeterministic([]byte("salt")))
+		require.NoError(t, err)
+		rows.next = 0
+		masked, err := engine.Rows(rows)
+		require.NoError(t, err)
+		require.True(t, masked.Next())
+		var maskedEmail string
+		require.NoError(t, masked.Scan(&id, &maskedEmail, &balance, &createdAt, &nickname))
+		assert.Equal(t, 7, id)
+		assert.Equal(t, email, maskedEmail, "Rows of an engine mask as those of its config")
+	})
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestStats(t *testing.T) {
+	input := `[{"email": "jane@example.com", "phone": "+31 6 12345678", "plan": "pro"}, {"email": "john@example.com", "plan": "free"}]`
+	appConfig := pkg.AppConfig{Format: "json", CPUCount: 2, Include: []string{"email", "phone"}}
+	var out bytes.Buffer
+	stats, err := pkg.Start(strings.NewReader(input), &out, appConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Records)
+	assert.Equal(t, map[string]int{"email": 2, "phone": 1}, stats.Masked)
+	assert.Equal(t, 3, stats.MaskedValues())
+	assert.Equal(t, int64(len(input)), stats.BytesIn)
+	assert.Equal(t, int64(out.Len()), stats.BytesOut)
+	assert.Positive(t, stats.Duration)
+	assert.Equal(t, 2, stats.Workers)
+	assert.GreaterOrEqual(t, stats.Utilization, 0.0)
+	assert.LessOrEqual(t, stats.Utilization, 1.0)
+
+	t.Run("Formats", func(t *testing.T) {
+		for _, tc := range []struct {
+			format, input string
+			records       int
+		}{
+			{"json", `{"email": "jane@example.com"}`, 1},
+			{"ndjson", "{\"email\": \"jane@example.com\"}\n{\"email\": \"john@example.com\"}\n", 2},
+			{"csv", "email\njane@example.com\njohn@example.com\n", 2},
+			{"xml", "<users><user><email>jane@example.com</email></user><user><email>john@example.com</email></user></users>", 2},
+			{"text", "jane@example.com\njohn@example.com\n", 2},
+		} {
+			stats, err := pkg.Start(strings.NewReader(tc.input), io.Discard, pkg.AppConfig{Format: tc.format, CPUCount: 1})
+			require.NoError(t, err, tc.format)
+			assert.Equal(t, tc.records, stats.Records, tc.format)
+			assert.Equal(t, tc.records, stats.Masked["email"], tc.format)
+		}
+	})
+
+	t.Run("XML records", func(t *testing.T) {
+		user := "<user><first_name>Jane</first_name><last_name>Doe</last_name><card><number>4111111111111111</number><cvv>123</cvv></card></user>"
+		stats, err := pkg.Start(strings.NewReader("<users>"+user+user+"</users>"), io.Discard, pkg.AppConfig{Format: "xml", CPUCount: 2})
+		require.NoError(t, err, "Elements masked with their record are counted by their text")
+		assert.Equal(t, 2, stats.Records)
+		assert.Equal(t, 2, stats.Masked["first_name"])
+		assert.Equal(t, 2, stats.Masked["last_name"])
+		assert.Equal(t, 2, stats.Masked["credit_card"])
+	})
+
+	t.Run("Input errors", func(t *testing.T) {
+		stats, err := pkg.Start(strings.NewReader("{\"email\": \"jane@example.com\"}\n{\"email\": \n"), io.Discard, pkg.AppConfig{Format: "ndjson", CPUCount: 1})
+		var inputErr *pkg.InputError
+		require.ErrorAs(t, err, &inputErr)
+		require.NotNil(t, stats)
+		assert.Equal(t, 1, stats.Records, "Records masked before the error are counted")
+	})
+
+	t.Run("Config errors", func(t *testing.T) {
+		stats, err := pkg.Start(strings.NewReader("{}"), io.Discard, pkg.AppConfig{Format: "yaml"})
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, err, &configErr)
+		assert.Nil(t, stats)
+	})
+
+	t.Run("Record streams", func(t *testing.T) {
+		stream := pkg.NewRecordStream(context.Background(), strings.NewReader(input), appConfig)
+		assert.Nil(t, stream.Stats(), "No stats before the stream ends")
+		for {
+			if _, err := stream.Next(); err == io.EOF {
+				break
+			}
+		}
+		require.NotNil(t, stream.Stats())
+		assert.Equal(t, 2, stream.Stats().Records)
+		assert.Equal(t, 3, stream.Stats().MaskedValues())
+	})
+}
+
+// slowReader returns a line of its input every read, after a pause.
+type slowReader struct {
+	lines []string
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(5 * time.Millisecond)
+	n := copy(p, r.lines[0])
+	r.lines[0] = r.lines[0][n:]
+	if r.lines[0] == "" {
+		r.lines = r.lines[1:]
+	}
+	return n, nil
+}
+
+func TestWorkers(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		for format, input := range map[string]string{
+			"json":   `[{"email": "jane@example.com"}, {"email": "john@example.com"}]`,
+			"ndjson": "{\"email\": \"jane@example.com\"}\n{\"email\": \"john@example.com\"}\n",
+			"csv":    "email\njane@example.com\njohn@example.com\n",
+			"xml":    "<users><user><email>jane@example.com</email></user><user><email>john@example.com</email></user></users>",
+			"text":   "jane@example.com\njohn@example.com\n",
+		} {
+			stats, err := pkg.Start(strings.NewReader(input), io.Discard, pkg.AppConfig{Format: format})
+			require.NoError(t, err, format)
+			assert.Equal(t, 2, stats.Records, "%s is masked without a CPUCount", format)
+			assert.Equal(t, runtime.GOMAXPROCS(0), stats.Workers, format)
+		}
+	})
+
+	// concurrency runs ndjson records through OnMask, which takes wait per
+	// value, and returns the most values masked at the same time.
+	concurrency := func(r io.Reader, wait time.Duration) int64 {
+		var masking, most atomic.Int64
+		onMask := func(pkg.MaskEvent) bool {
+			now := masking.Add(1)
+			for seen := most.Load(); now > seen && !most.CompareAndSwap(seen, now); seen = most.Load() {
+			}
+			time.Sleep(wait)
+			masking.Add(-1)
+			return true
+		}
+		_, err := pkg.Start(r, io.Discard, pkg.AppConfig{Format: "ndjson", CPUCount: 4, BatchSize: 1, OnMask: onMask})
+		require.NoError(t, err)
+		return most.Load()
+	}
+	lines := make([]string, 20)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("{\"email\": \"user%d@example.com\"}\n", i)
+	}
+	assert.Equal(t, int64(4), concurrency(strings.NewReader(strings.Join(lines, "")), 20*time.Millisecond), "Workers are added while masking keeps them busy")
+	assert.Equal(t, int64(1), concurrency(&slowReader{lines: lines}, 0), "A run held up by its input masks a record at a time")
+}
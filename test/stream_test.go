@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func collectRecords(t *testing.T, format, input string, exclude ...string) []any {
+	t.Helper()
+	appConfig := pkg.AppConfig{Format: format, CPUCount: 2, Exclude: exclude, Masker: pkg.MaskerConfig{Method: pkg.MethodNull}}
+	stream := pkg.NewRecordStream(context.Background(), strings.NewReader(input), appConfig)
+	defer stream.Close()
+	var records []any
+	for {
+		record, err := stream.Next()
+		if err == io.EOF {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestRecordStream(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		records := collectRecords(t, "json", `[{"id": 1, "email": "jane@example.com"}, {"id": 2, "email": "bob@example.com"}]`, "id")
+		assert.Equal(t, []any{
+			map[string]any{"id": json.Number("1"), "email": nil},
+			map[string]any{"id": json.Number("2"), "email": nil},
+		}, records)
+	})
+
+	t.Run("Root object", func(t *testing.T) {
+		records := collectRecords(t, "json", `{"email": "jane@example.com"}`)
+		assert.Equal(t, []any{map[string]any{"email": nil}}, records)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		records := collectRecords(t, "csv", "id,email\n1,jane@example.com\n", "id")
+		assert.Equal(t, []any{map[string]any{"id": "1", "email": nil}}, records)
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		records := collectRecords(t, "xml", "<users><user><zip>1234AB</zip></user><user><zip>5678CD</zip></user></users>")
+		assert.Len(t, records, 2)
+	})
+
+	t.Run("Close early", func(t *testing.T) {
+		var input strings.Builder
+		input.WriteString("[")
+		for i := range 1000 {
+			if i > 0 {
+				input.WriteString(",")
+			}
+			input.WriteString(`{"email": "jane@example.com"}`)
+		}
+		input.WriteString("]")
+		appConfig := pkg.AppConfig{Format: "json", CPUCount: 2, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+		stream := pkg.NewRecordStream(context.Background(), strings.NewReader(input.String()), appConfig)
+		_, err := stream.Next()
+		require.NoError(t, err)
+		require.NoError(t, stream.Close())
+		_, err = stream.Next()
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		appConfig := pkg.AppConfig{Format: "json", CPUCount: 2, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+		stream := pkg.NewRecordStream(context.Background(), strings.NewReader(`[{"a": 1}, {"a": `), appConfig)
+		defer stream.Close()
+		_, err := stream.Next()
+		require.NoError(t, err)
+		_, err = stream.Next()
+		var inputErr *pkg.InputError
+		assert.ErrorAs(t, err, &inputErr)
+
+		appConfig = pkg.AppConfig{Format: "csv", CPUCount: 1, Shuffle: []string{"a"}, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+		stream = pkg.NewRecordStream(context.Background(), strings.NewReader("a\n1\n"), appConfig)
+		defer stream.Close()
+		_, err = stream.Next()
+		var configErr *pkg.ConfigError
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -109,7 +111,7 @@ func TestSubsettingFirstN(t *testing.T) {
 				},
 			}
 
-			err := pkg.Start(in, &out, appConfig)
+			_, err := pkg.Start(in, &out, appConfig)
 			require.NoError(t, err)
 
 			outputStr := out.String()
@@ -144,3 +146,106 @@ func TestSubsettingFirstN(t *testing.T) {
 		})
 	}
 }
+
+func TestSubsettingLastAndRange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   string
+		input    string
+		lastN    int
+		records  string
+		expected []string // Ids, or the lines of text, kept in order
+	}{
+		{name: "JSON Last 2", format: "json", input: jsonInputSubset, lastN: 2, expected: []string{"3", "4"}},
+		{name: "JSON Last More Than All", format: "json", input: jsonInputSubset, lastN: 10, expected: []string{"1", "2", "3", "4"}},
+		{name: "JSON Range 2:3", format: "json", input: jsonInputSubset, records: "2:3", expected: []string{"2", "3"}},
+		{name: "NDJSON Range 3:", format: "ndjson", input: "{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n{\"id\": 4}\n", records: "3:", expected: []string{"3", "4"}},
+		{name: "XML Last 1", format: "xml", input: xmlInputSubset, lastN: 1, expected: []string{"4"}},
+		{name: "CSV Last 3", format: "csv", input: csvInputSubset, lastN: 3, expected: []string{"2", "3", "4"}},
+		{name: "CSV Range :1", format: "csv", input: csvInputSubset, records: ":1", expected: []string{"1"}},
+		{name: "Text Range 2:3", format: "text", input: textInputSubset, records: "2:3", expected: []string{"Bob", "Charlie"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var records pkg.RecordRange
+			if tc.records != "" {
+				var err error
+				records, err = pkg.ParseRecordRange(tc.records)
+				require.NoError(t, err)
+			}
+			appConfig := pkg.AppConfig{
+				Format:   tc.format,
+				CPUCount: 1,
+				LastN:    tc.lastN,
+				Range:    records,
+				Exclude:  []string{"id", "user.id", "**.id"},
+				Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+			}
+			if tc.format == "text" {
+				appConfig.SafeValues = []string{"Alice", "Bob", "Charlie", "David"}
+			}
+			var out bytes.Buffer
+			_, err := pkg.Start(strings.NewReader(tc.input), &out, appConfig)
+			require.NoError(t, err)
+
+			var ids []string
+			switch tc.format {
+			case "json":
+				var result []map[string]any
+				require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+				for _, record := range result {
+					ids = append(ids, fmt.Sprint(record["id"]))
+				}
+			case "ndjson":
+				decoder := json.NewDecoder(&out)
+				for decoder.More() {
+					var record map[string]any
+					require.NoError(t, decoder.Decode(&record))
+					ids = append(ids, fmt.Sprint(record["id"]))
+				}
+			case "xml":
+				for _, match := range regexp.MustCompile(`<id>(\d+)</id>`).FindAllStringSubmatch(out.String(), -1) {
+					ids = append(ids, match[1])
+				}
+			case "csv":
+				rows, err := csv.NewReader(&out).ReadAll()
+				require.NoError(t, err)
+				for _, row := range rows[1:] {
+					ids = append(ids, row[0])
+				}
+			case "text":
+				ids = strings.Split(strings.TrimSpace(out.String()), "\n")
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func TestParseRecordRange(t *testing.T) {
+	r, err := pkg.ParseRecordRange("100:200")
+	require.NoError(t, err)
+	assert.Equal(t, pkg.RecordRange{Start: 100, End: 200}, r)
+
+	r, err = pkg.ParseRecordRange(":50")
+	require.NoError(t, err)
+	assert.Equal(t, pkg.RecordRange{End: 50}, r)
+
+	for _, invalid := range []string{"100", "0:5", "5:2", "a:b", "-1:"} {
+		_, err := pkg.ParseRecordRange(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSubsettingCannotBeCombined(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		FirstN:   1,
+		LastN:    1,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+	}
+	_, err := pkg.Start(strings.NewReader(csvInputSubset), &bytes.Buffer{}, appConfig)
+	var configErr *pkg.ConfigError
+	assert.ErrorAs(t, err, &configErr)
+}
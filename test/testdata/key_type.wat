@@ -0,0 +1,23 @@
+;; Wasm masking hook for the tests: masks every value to "key:type".
+;; Assembled into key_type.wasm.
+(module
+  (memory (export "memory") 1)
+  (global $heap (mut i32) (i32.const 1024))
+
+  (func $alloc (export "alloc") (param $size i32) (result i32)
+    global.get $heap
+    global.get $heap
+    local.get $size
+    i32.add
+    global.set $heap)
+
+  (func (export "mask") (param $key i32) (param $keyLen i32) (param $value i32) (param $valueLen i32)
+    (param $type i32) (param $typeLen i32) (result i64)
+    (local $out i32)
+    (local.set $out (call $alloc (i32.add (i32.add (local.get $keyLen) (local.get $typeLen)) (i32.const 1))))
+    (memory.copy (local.get $out) (local.get $key) (local.get $keyLen))
+    (i32.store8 (i32.add (local.get $out) (local.get $keyLen)) (i32.const 58))
+    (memory.copy (i32.add (i32.add (local.get $out) (local.get $keyLen)) (i32.const 1)) (local.get $type) (local.get $typeLen))
+    (i64.or
+      (i64.shl (i64.extend_i32_u (local.get $out)) (i64.const 32))
+      (i64.extend_i32_u (i32.add (i32.add (local.get $keyLen) (local.get $typeLen)) (i32.const 1))))))
@@ -2,9 +2,12 @@ package test
 
 import (
 	"bytes"
+	"slices"
 	"strings"
 	"testing"
 	"unaware/pkg"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,7 +46,7 @@ func TestTextProcessor(t *testing.T) {
 					Method: pkg.MethodRandom,
 				},
 			}
-			err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
+			_, err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
 			require.NoError(t, err)
 
 			output := buf.String()
@@ -63,3 +66,128 @@ func TestTextProcessor(t *testing.T) {
 		})
 	}
 }
+
+func TestTextProcessor_UnicodeWords(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		script *unicode.RangeTable
+	}{
+		{name: "Cyrillic", input: "Привет Мир", script: unicode.Cyrillic},
+		{name: "Arabic", input: "مرحبا بالعالم", script: unicode.Arabic},
+		{name: "Greek", input: "Καλημέρα κόσμε", script: unicode.Greek},
+		{name: "Accented Latin", input: "Élodie Ørsted", script: unicode.Latin},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			appConfig := pkg.AppConfig{
+				Format:   "text",
+				CPUCount: 1,
+				Masker: pkg.MaskerConfig{
+					Method: pkg.MethodDeterministic,
+					Salt:   []byte("unicode-salt"),
+				},
+			}
+			_, err := pkg.Start(strings.NewReader(tc.input), &buf, appConfig)
+			require.NoError(t, err)
+
+			output := strings.TrimSuffix(buf.String(), "\n")
+			inputWords := strings.Fields(tc.input)
+			outputWords := strings.Fields(output)
+			require.Len(t, outputWords, len(inputWords), "Word count should be preserved")
+
+			for i, word := range outputWords {
+				assert.NotEqual(t, inputWords[i], word, "Word should be masked")
+				for _, r := range word {
+					assert.True(t, unicode.Is(tc.script, r) || unicode.IsMark(r), "Masked word %q should stay in the original script", word)
+				}
+				first, _ := utf8.DecodeRuneInString(word)
+				original, _ := utf8.DecodeRuneInString(inputWords[i])
+				assert.Equal(t, unicode.IsUpper(original), unicode.IsUpper(first), "Capitalization should be preserved")
+			}
+		})
+	}
+}
+
+func TestTextProcessor_UnspacedScripts(t *testing.T) {
+	input := "東京タワーに行きました"
+
+	var buf bytes.Buffer
+	appConfig := pkg.AppConfig{
+		Format:   "text",
+		CPUCount: 1,
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+		},
+	}
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	output := strings.TrimSuffix(buf.String(), "\n")
+	assert.NotContains(t, output, "東京")
+	assert.Equal(t, utf8.RuneCountInString(input), utf8.RuneCountInString(output), "Length should be preserved for text without spaces")
+	for _, r := range output {
+		assert.True(t, unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー', "Masked text should stay Japanese, got %q", r)
+	}
+}
+
+func TestTextProcessor_PreserveLength(t *testing.T) {
+	input := "John Doe lives at the Heerengracht, Amsterdam. Привет мир"
+
+	var buf bytes.Buffer
+	appConfig := pkg.AppConfig{
+		Format:   "text",
+		CPUCount: 1,
+		Masker: pkg.MaskerConfig{
+			Method:         pkg.MethodRandom,
+			PreserveLength: true,
+		},
+	}
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	output := strings.TrimSuffix(buf.String(), "\n")
+	assert.NotEqual(t, input, output)
+	inputWords, outputWords := strings.Fields(input), strings.Fields(output)
+	require.Len(t, outputWords, len(inputWords))
+	for i := range inputWords {
+		assert.Equal(t, utf8.RuneCountInString(inputWords[i]), utf8.RuneCountInString(outputWords[i]), "Word %q should keep its length, got %q", inputWords[i], outputWords[i])
+	}
+}
+
+func TestLongTextLines(t *testing.T) {
+	record := `{"email":"jane@example.com","note":"left at the door"},`
+	long := "[" + strings.Repeat(record, 40000) + "]"
+	input := "short line\r\n" + long + "\nlast line"
+	run := func(maxTextLine int) []string {
+		var buf bytes.Buffer
+		appConfig := pkg.AppConfig{Format: "text", CPUCount: 2, MaxTextLine: maxTextLine, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}}
+		stats, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+		require.NoError(t, err)
+		assert.Equal(t, 3, stats.Records)
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	for _, maxTextLine := range []int{0, 100, 8 << 20} {
+		lines := run(maxTextLine)
+		require.Len(t, lines, 3, "Lines longer than the longest masked as a whole stay one line")
+		assert.NotContains(t, strings.Join(lines, "\n"), "jane@example.com")
+		for _, line := range lines {
+			assert.True(t, utf8.ValidString(line))
+			assert.NotContains(t, line, "\r")
+		}
+	}
+	longest := slices.MaxFunc(run(100), func(a, b string) int { return len(a) - len(b) })
+	assert.Greater(t, len(longest), len(long)/4, "Long lines are masked in parts rather than cut short")
+
+	var configErr *pkg.ConfigError
+	_, err := pkg.Start(strings.NewReader(input), &bytes.Buffer{}, pkg.AppConfig{Format: "text", MaxTextLine: -1, Masker: pkg.MaskerConfig{Method: pkg.MethodRandom}})
+	assert.ErrorAs(t, err, &configErr)
+
+	config := pkg.Config{Format: "text", MaxTextLine: "16MB"}
+	appConfig, err := config.AppConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 16<<20, appConfig.MaxTextLine)
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestUniqueDeterministicMasking(t *testing.T) {
+	// Two digit codes have few possible outputs, so plain deterministic
+	// masking is all but certain to map some of them to the same value.
+	var input strings.Builder
+	input.WriteString("code,other\n")
+	for i := 10; i < 60; i++ {
+		input.WriteString(strconv.Itoa(i) + ",x\n")
+	}
+	input.WriteString("42,x\n")
+
+	run := func(t *testing.T, unique bool) [][]string {
+		appConfig := pkg.AppConfig{
+			Format:   "csv",
+			CPUCount: 4,
+			Include:  []string{"code"},
+			Unique:   unique,
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("unique-salt")},
+		}
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+		require.NoError(t, err)
+		records, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 52)
+		return records[1:]
+	}
+
+	collisions := func(records [][]string) int {
+		seen := make(map[string]bool)
+		count := 0
+		for _, record := range records[:50] {
+			if seen[record[0]] {
+				count++
+			}
+			seen[record[0]] = true
+		}
+		return count
+	}
+
+	require.Positive(t, collisions(run(t, false)), "The input should produce collisions without -unique")
+
+	records := run(t, true)
+	assert.Zero(t, collisions(records), "Different codes should never share an output")
+	assert.Equal(t, records[32][0], records[50][0], "Repeated codes should still mask to the same output")
+}
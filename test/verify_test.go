@@ -0,0 +1,76 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestVerify(t *testing.T) {
+	mask := func(t *testing.T, format, input string, exclude ...string) []pkg.Leak {
+		t.Helper()
+		appConfig := pkg.AppConfig{
+			Format:   format,
+			CPUCount: 2,
+			Exclude:  exclude,
+			Verify:   pkg.NewMaskedValues(),
+			Masker:   pkg.MaskerConfig{Method: pkg.MethodRandom},
+		}
+		var out bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &out, appConfig)
+		require.NoError(t, err)
+		leaks, err := appConfig.Verify.Verify(&out)
+		require.NoError(t, err)
+		return leaks
+	}
+
+	t.Run("Embedded in a kept field", func(t *testing.T) {
+		input := `[{"email": "jane@example.com", "note": "Mail jane@example.com today"}, {"email": "bob@example.com", "note": "none"}]`
+		leaks := mask(t, "json", input, "note")
+		require.Len(t, leaks, 1)
+		assert.Equal(t, "jane@e…", leaks[0].Example, "Reports do not repeat the value")
+		assert.Equal(t, 1, leaks[0].Count)
+	})
+
+	t.Run("Everything masked", func(t *testing.T) {
+		input := "email,note\njane@example.com,Mail jane@example.com today\n"
+		assert.Empty(t, mask(t, "csv", input))
+	})
+
+	t.Run("Short values are not checked", func(t *testing.T) {
+		input := "code,kept\nNL,NL\n"
+		assert.Empty(t, mask(t, "csv", input, "kept"))
+	})
+
+	t.Run("Names masked as a record", func(t *testing.T) {
+		input := `[{"first_name": "Alexandra", "last_name": "Johnson", "bio": "Alexandra likes tea"}]`
+		leaks := mask(t, "json", input, "bio")
+		require.Len(t, leaks, 1)
+		assert.Equal(t, "Alexan…", leaks[0].Example)
+	})
+
+	t.Run("XML records", func(t *testing.T) {
+		user := "<user><first_name>Alexandra</first_name><last_name>Johnson</last_name><bio>Alexandra likes tea</bio></user>"
+		leaks := mask(t, "xml", "<users>"+user+user+"</users>", "**.bio")
+		require.Len(t, leaks, 1, "Elements masked with their record are checked by their text")
+		assert.Equal(t, "Alexan…", leaks[0].Example)
+		assert.Equal(t, 2, leaks[0].Count)
+	})
+
+	t.Run("Escaped in the output", func(t *testing.T) {
+		for format, input := range map[string]string{
+			"json": `[{"email": "jane<x>@example.com", "note": "Mail jane<x>@example.com"}]`,
+			"xml":  `<users><user><email>jane&amp;x@example.com</email><note>Mail jane&amp;x@example.com</note></user></users>`,
+			"csv":  "email,note\n" + `"jane""x""@example.com","Mail jane""x""@example.com"` + "\n",
+		} {
+			leaks := mask(t, format, input, "note", "**.note")
+			require.Len(t, leaks, 1, "Values are looked for as %s escapes them", format)
+			assert.True(t, strings.HasPrefix(leaks[0].Example, "jane"), "Leaks are reported by the value masked")
+		}
+	})
+}
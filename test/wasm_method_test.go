@@ -0,0 +1,68 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestWasmMethod(t *testing.T) {
+	input := `[{"user": {"email": "alice@example.com", "note": "likes tea"}, "id": "42"}]`
+
+	appConfig := pkg.AppConfig{
+		Format:   "json",
+		CPUCount: 2,
+		Masker: pkg.MaskerConfig{
+			Method:   pkg.MethodWasm,
+			WasmFile: "testdata/key_type.wasm",
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	var output []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output), "Output should be valid JSON. Got: %s", buf.String())
+	require.Len(t, output, 1)
+	assert.Equal(t, map[string]any{"email": "user.email:email", "note": "user.note:text"}, output[0]["user"],
+		"The module should receive the key and detected type of every value")
+	assert.Equal(t, "id:integer", output[0]["id"])
+}
+
+func TestWasmMethod_FieldMethod(t *testing.T) {
+	rule, err := pkg.ParseMethodRule("ticket=wasm:testdata/key_type.wasm")
+	require.NoError(t, err)
+	appConfig := pkg.AppConfig{
+		Format:   "csv",
+		CPUCount: 1,
+		Rules:    []pkg.Rule{rule},
+		Exclude:  []string{"status"},
+		Masker: pkg.MaskerConfig{
+			Method: pkg.MethodRandom,
+		},
+	}
+
+	var buf bytes.Buffer
+	_, err = pkg.Start(strings.NewReader("ticket,status\nINC-123,open\n"), &buf, appConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "ticket,status\nticket:text,open\n", buf.String())
+}
+
+func TestWasmMethod_InvalidModule(t *testing.T) {
+	appConfig := pkg.AppConfig{
+		Format: "json",
+		Masker: pkg.MaskerConfig{
+			Method:   pkg.MethodWasm,
+			WasmFile: "testdata/key_type.wat",
+		},
+	}
+	_, err := pkg.Start(strings.NewReader(`{}`), &bytes.Buffer{}, appConfig)
+	assert.ErrorContains(t, err, "error loading wasm module")
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"unaware/pkg"
+)
+
+func TestMaskingWriter(t *testing.T) {
+	var out bytes.Buffer
+	appConfig := pkg.AppConfig{
+		Rules:  []pkg.Rule{{Regex: `order (\d+)`}},
+		Masker: pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+	}
+	w, err := pkg.NewMaskingWriter(&out, appConfig)
+	require.NoError(t, err)
+	logger := log.New(w, "", 0)
+	logger.Printf("login user=jane@example.com from 10.0.0.1.")
+	logger.Printf("payment for order 12345 failed")
+	fmt.Fprint(w, "shutting down, contact ")
+	fmt.Fprint(w, "ops@example.com")
+	assert.Equal(t, strings.Count(out.String(), "\n"), 2, "Lines are held until they end")
+	require.NoError(t, w.Close())
+
+	lines := strings.Split(out.String(), "\n")
+	require.Len(t, lines, 3)
+	assert.Regexp(t, `^login user=\S+@\S+ from \d+\.\d+\.\d+\.\d+\.$`, lines[0])
+	assert.NotContains(t, lines[0], "jane@example.com")
+	assert.NotContains(t, lines[0], "10.0.0.1")
+	assert.Regexp(t, `^payment for order \d{5} failed$`, lines[1], "Rules mask lines as text input is masked")
+	assert.NotContains(t, lines[1], "12345")
+	assert.True(t, strings.HasPrefix(lines[2], "shutting down, contact "))
+	assert.NotContains(t, lines[2], "ops@example.com", "A last line not ended is masked on Close")
+
+	t.Run("Invalid", func(t *testing.T) {
+		var configErr *pkg.ConfigError
+		_, err := pkg.NewMaskingWriter(&out, pkg.AppConfig{Masker: pkg.MaskerConfig{Method: "zodiac"}})
+		assert.ErrorAs(t, err, &configErr)
+	})
+}
@@ -3,6 +3,8 @@ package test
 import (
 	"bytes"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -74,7 +76,7 @@ func TestXMLProcessing_Structured(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err = pkg.Start(bytes.NewReader(inputWithHeader), &buf, appConfig)
+	_, err = pkg.Start(bytes.NewReader(inputWithHeader), &buf, appConfig)
 	require.NoError(t, err)
 
 	var output ComplexXML
@@ -118,7 +120,7 @@ func TestXMLStreaming(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
 	require.NoError(t, err)
 
 	output := buf.String()
@@ -129,3 +131,124 @@ func TestXMLStreaming(t *testing.T) {
 	assert.NotContains(t, output, "data2")
 	assert.NotContains(t, output, "data3")
 }
+
+func TestXMLStreaming_LargeFirstElement(t *testing.T) {
+	// The first element is larger than the detector peeks at, so the
+	// document is masked serially rather than as a list.
+	input := `<items><item id="1"><!--` + strings.Repeat("x", 5<<20) + `-->data1</item><item id="2">data2</item></items>`
+	appConfig := pkg.AppConfig{
+		Format:   "xml",
+		CPUCount: 2,
+		Masker:   pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("xml-streaming-salt")},
+	}
+
+	var buf bytes.Buffer
+	_, err := pkg.Start(strings.NewReader(input), &buf, appConfig)
+	require.NoError(t, err)
+
+	output := buf.String()
+	assert.Equal(t, 2, strings.Count(output, "<item id="))
+	assert.NotContains(t, output, "data1")
+	assert.NotContains(t, output, "data2")
+}
+
+func TestXMLSerialDocument(t *testing.T) {
+	// The children of the root differ, so the document is masked serially,
+	// passed on in many batches of tokens.
+	var input strings.Builder
+	input.WriteString("<export>\n<meta><owner email=\"owner@example.com\">Jane Doe</owner></meta>\n<data>\n")
+	for i := range 2000 {
+		fmt.Fprintf(&input, "<customer id=\"%d\"><email>user%d@example.com</email><note>called</note></customer>\n", i, i%10)
+	}
+	input.WriteString("</data>\n</export>\n")
+	appConfig := pkg.AppConfig{
+		Format:      "xml",
+		CPUCount:    2,
+		OutputStyle: pkg.StyleCompact,
+		Include:     []string{"**.email"},
+		Exclude:     []string{"export.meta.**"},
+		Masker:      pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("xml-serial-salt")},
+	}
+
+	var buf bytes.Buffer
+	stats, err := pkg.Start(strings.NewReader(input.String()), &buf, appConfig)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Records)
+	output := buf.String()
+	assert.Contains(t, output, `<meta><owner email="owner@example.com">Jane Doe</owner></meta>`, "Excluded subtrees are copied through")
+	assert.NotContains(t, output, "user1@example.com")
+
+	var doc struct {
+		Customers []struct {
+			ID    int    `xml:"id,attr"`
+			Email string `xml:"email"`
+			Note  string `xml:"note"`
+		} `xml:"data>customer"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	require.Len(t, doc.Customers, 2000)
+	for i, customer := range doc.Customers {
+		assert.Equal(t, i, customer.ID, "Elements keep their order")
+		assert.Equal(t, doc.Customers[i%10].Email, customer.Email, "Equal values are masked the same")
+		assert.Equal(t, "called", customer.Note)
+	}
+
+	broken := strings.Replace(input.String(), "<note>called</note></customer>\n</data>", "<note>called</notes></customer>\n</data>", 1)
+	_, err = pkg.Start(strings.NewReader(broken), io.Discard, appConfig)
+	var inputErr *pkg.InputError
+	require.ErrorAs(t, err, &inputErr)
+	assert.Equal(t, 2003, inputErr.Line, "Errors late in the document are located")
+	assert.Equal(t, "export.data.customer[1999].note", inputErr.Path)
+}
+
+func TestXMLCDATA(t *testing.T) {
+	run := func(input string, markup bool, include ...string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		_, err := pkg.Start(strings.NewReader(input), &buf, pkg.AppConfig{
+			Format:      "xml",
+			CPUCount:    2,
+			OutputStyle: pkg.StyleCompact,
+			Include:     include,
+			CDATAMarkup: markup,
+			Masker:      pkg.MaskerConfig{Method: pkg.MethodDeterministic, Salt: []byte("salt")},
+		})
+		require.NoError(t, err)
+		return buf.String()
+	}
+	// The children of the root differ in the serial document, and repeat in
+	// the list.
+	serial := `<doc><meta>x</meta><user><email><![CDATA[jan@example.com]]></email><bio><![CDATA[<p class="intro">Mail <a href="mailto:jan@example.com">Jan</a></p>]]></bio><empty><![CDATA[]]></empty></user></doc>`
+	list := `<users><user><email><![CDATA[jan@example.com]]></email><bio><![CDATA[<p class="intro">Call <b>Jan</b></p>]]></bio></user><user><email>piet@example.com</email></user></users>`
+
+	for name, input := range map[string]string{"Serial": serial, "List": list} {
+		t.Run(name, func(t *testing.T) {
+			output := run(input, false)
+			assert.Regexp(t, `<email><!\[CDATA\[[^<\]]+\]\]></email>`, output, "Masked sections are written as CDATA")
+			assert.NotContains(t, output, "jan@example.com")
+			assert.NotContains(t, output, "intro", "Without CDATAMarkup, markup is masked as text")
+			assert.Regexp(t, `<(meta|email)>[^<]+</`, output, "Text that was not a section is not written as one")
+
+			output = run(input, true)
+			assert.Contains(t, output, `<bio><![CDATA[<p class="`, "Markup is masked as the elements it holds")
+			assert.NotContains(t, output, "intro")
+			assert.NotContains(t, output, ">Jan<")
+			assert.NotContains(t, output, "jan@example.com")
+
+			output = run(input, true, "**.bio.p.class")
+			assert.NotContains(t, output, "intro", "Paths reach into the markup")
+			assert.Contains(t, output, "Jan<")
+		})
+	}
+	assert.Contains(t, run(serial, false), "<empty><![CDATA[]]></empty>", "Empty sections are kept")
+
+	var doc struct {
+		Value string `xml:"value"`
+	}
+	output := run(`<doc><value><![CDATA[a]]]]><![CDATA[>b]]></value></doc>`, false, "nothing")
+	require.NoError(t, xml.Unmarshal([]byte(output), &doc))
+	assert.Equal(t, "a]]>b", doc.Value, "Sections holding the end marker are split")
+
+	output = run(`<doc><bio><![CDATA[Mail jan@example.com <now>]]></bio></doc>`, true)
+	assert.NotContains(t, output, "jan@example.com", "Sections that are not markup are masked as text")
+}